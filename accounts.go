@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+func FetchAccounts(ctx context.Context, client plaid_cli.PlaidClient, accessToken string) ([]Account, error) {
+	res, err := client.AccountsGet(ctx, plaid.AccountsGetRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := plaid_cli.AccountsFromPlaid(res.Accounts)
+	for i := range accounts {
+		accounts[i].ItemID = res.Item.ItemId
+	}
+	return accounts, nil
+}
+
+// FetchAllAccounts fetches accounts for each item, relinking as needed.
+// Items that fail are logged and skipped.
+func FetchAllAccounts(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, linker *plaid_cli.Linker, items []idAndAlias) []Account {
+	var allAccounts []Account
+	for _, item := range items {
+		if item.id == sandboxItemID {
+			continue
+		}
+		err := WithRelinkOnAuthError(ctx, item, data, linker, func() error {
+			accounts, err := FetchAccounts(ctx, client, data.Tokens[item.id])
+			if err != nil {
+				return err
+			}
+
+			allAccounts = append(allAccounts, accounts...)
+			return nil
+		})
+		if err != nil {
+			ItemFailed("Cannot fetch accounts", err, ItemLabel(data, item.id))
+		} else {
+			ItemSucceeded(ItemLabel(data, item.id))
+		}
+	}
+	return allAccounts
+}
+
+func PrintAccountsTable(data *plaid_cli.Data, accounts []Account) {
+	accountAliases := make(map[string]string)
+	for alias, accountID := range data.AccountAliases {
+		accountAliases[accountID] = alias
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTITUTION\tACCOUNT\tALIAS\tMASK\tTYPE\tCURRENT\tAVAILABLE\tACCOUNT ID")
+	for _, a := range accounts {
+		accountType := a.Type
+		if a.Subtype != "" {
+			accountType += "/" + a.Subtype
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			ItemLabel(data, a.ItemID),
+			a.DisplayName(),
+			accountAliases[a.ID],
+			a.Mask,
+			accountType,
+			formatBalance(a.Balances.Current, a.Balances.IsoCurrencyCode),
+			formatBalance(a.Balances.Available, a.Balances.IsoCurrencyCode),
+			a.ID,
+		)
+	}
+	w.Flush()
+}
+
+func formatBalance(amount *float64, currency string) string {
+	if amount == nil {
+		return "-"
+	}
+	if currency == "" {
+		return fmt.Sprintf("%.2f", *amount)
+	}
+	return fmt.Sprintf("%.2f %s", *amount, currency)
+}
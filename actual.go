@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/actual"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// NewActualClient reads the actual.* settings, falling back to
+// ACTUAL_API_KEY for the API key.
+func NewActualClient() (*actual.Client, error) {
+	client := &actual.Client{
+		URL:                viper.GetString("actual.url"),
+		APIKey:             viper.GetString("actual.api_key"),
+		BudgetID:           viper.GetString("actual.budget_id"),
+		EncryptionPassword: viper.GetString("actual.encryption_password"),
+	}
+	if client.APIKey == "" {
+		client.APIKey = os.Getenv("ACTUAL_API_KEY")
+	}
+	if client.URL == "" || client.APIKey == "" || client.BudgetID == "" {
+		return nil, errors.New("Set url, api_key and budget_id under [actual] in the config file")
+	}
+	return client, nil
+}
+
+// ActualAccounts resolves actual.accounts, which maps Plaid account IDs or
+// aliases to Actual accounts by ID or name, e.g.
+//
+//	[actual.accounts]
+//	checking = "Joint Checking"
+//
+// It returns the Actual account ID per Plaid account ID.
+func ActualAccounts(client *actual.Client, data *plaid_cli.Data) (map[string]string, error) {
+	mapping := viper.GetStringMapString("actual.accounts")
+	if len(mapping) == 0 {
+		return nil, errors.New("Map Plaid accounts to Actual accounts under [actual.accounts] in the config file")
+	}
+
+	accounts, err := client.Accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string)
+	for accountOrAlias, actualAccount := range mapping {
+		// viper lowercases map keys, so aliases are compared case
+		// insensitively
+		accountID := accountOrAlias
+		for alias, id := range data.AccountAliases {
+			if strings.EqualFold(alias, accountOrAlias) {
+				accountID = id
+			}
+		}
+
+		found := false
+		for _, a := range accounts {
+			if a.ID == actualAccount || strings.EqualFold(a.Name, actualAccount) {
+				ids[accountID] = a.ID
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New(fmt.Sprintf("No Actual account %s, mapped from %s", actualAccount, accountOrAlias))
+		}
+	}
+	return ids, nil
+}
+
+// SyncActual imports the posted transactions in txs into the Actual
+// accounts their accounts are mapped to, with imported_id set to the
+// Plaid transaction ID so Actual skips those it already has. Transactions
+// in unmapped accounts are left out. It returns how many transactions
+// Actual added and how many it matched to existing ones.
+func SyncActual(client *actual.Client, data *plaid_cli.Data, txs []Transaction) (int, int, error) {
+	accountIDs, err := ActualAccounts(client, data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	byAccount := make(map[string][]actual.Transaction)
+	unmapped := make(map[string]bool)
+	for _, t := range txs {
+		// Plaid gives pending transactions a new ID when they post
+		if t.Pending {
+			continue
+		}
+		accountID, ok := accountIDs[t.AccountID]
+		if !ok {
+			unmapped[t.AccountID] = true
+			continue
+		}
+		payee := t.MerchantName
+		if payee == "" {
+			payee = t.Name
+		}
+		byAccount[accountID] = append(byAccount[accountID], actual.Transaction{
+			Date:          t.Date,
+			Amount:        int64(math.Round((inflow(data, t) - outflow(data, t)) * 100)),
+			PayeeName:     payee,
+			ImportedPayee: t.Name,
+			ImportedID:    t.ID,
+			Cleared:       true,
+		})
+	}
+	for accountID := range unmapped {
+		slog.Warn("Account isn't in actual.accounts, skipping its transactions", "account", AccountLabel(data, accountID))
+	}
+
+	added, updated := 0, 0
+	for accountID, txs := range byAccount {
+		res, err := client.ImportTransactions(accountID, txs)
+		if err != nil {
+			return added, updated, err
+		}
+		added += len(res.Added)
+		updated += len(res.Updated)
+	}
+	return added, updated, nil
+}
@@ -1,17 +1,21 @@
 package main
 
 import (
-	"fmt"
-	"os"
+	"log/slog"
 
-	"github.com/brianloveswords/airtable"
-	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/landakram/plaid-cli/pkg/airtable"
 )
 
 type AccountFields struct {
-	AccountID string
-	Name      string
-	Mask      string
+	AccountID        string
+	ItemID           string
+	Name             string
+	Mask             string
+	CurrentBalance   *float64 `json:",omitempty"`
+	AvailableBalance *float64 `json:",omitempty"`
+	// Cleared once Plaid stops returning the account, e.g. when it is closed
+	Active      bool
+	Institution airtable.RecordLink `json:",omitempty"`
 }
 
 type AccountRecord struct {
@@ -19,48 +23,130 @@ type AccountRecord struct {
 	Fields AccountFields
 }
 
-func SyncAccounts(accounts []plaid.AccountBase) error {
-	client := airtable.Client{
-		APIKey: os.Getenv("AIRTABLE_KEY"),
-		BaseID: "appxCfKnRz94NZadj",
-	}
+func FetchAirtableAccounts() ([]AccountRecord, error) {
+	client := NewAirtableClient()
+
+	accountsTable := client.Table("Accounts")
+
+	var airtableAccounts []AccountRecord
+	err := accountsTable.List(&airtableAccounts, &airtable.Options{})
+	return airtableAccounts, err
+}
+
+// SyncAccounts creates and updates account records. institutionLinks maps
+// item IDs to records in the Institutions table (see SyncInstitutions).
+func SyncAccounts(accounts []Account, institutionLinks map[string]string) error {
+	client := NewAirtableClient()
 
 	accountsTable := client.Table("Accounts")
 
 	plaidAccounts := make([]AccountRecord, len(accounts))
 	for i, a := range accounts {
-		name := val(a.OfficialName)
-		if name == "" {
-			name = a.Name
-		}
 		plaidAccounts[i] = AccountRecord{Fields: AccountFields{
-			AccountID: a.AccountId,
-			Name:      name,
-			Mask:      val(a.Mask),
+			AccountID:        a.ID,
+			ItemID:           a.ItemID,
+			Name:             a.DisplayName(),
+			Mask:             a.Mask,
+			CurrentBalance:   a.Balances.Current,
+			AvailableBalance: a.Balances.Available,
+			Active:           true,
 		}}
+		if recordID, ok := institutionLinks[a.ItemID]; ok {
+			plaidAccounts[i].Fields.Institution = airtable.RecordLink{recordID}
+		}
 	}
 
-	var airtableAccounts []AccountRecord
-	err := accountsTable.List(&airtableAccounts, &airtable.Options{})
+	airtableAccounts, err := FetchAirtableAccounts()
 	if err != nil {
 		return err
 	}
-	existingIDs := map[string]struct{}{}
+	existing := map[string]AccountRecord{}
 	for _, account := range airtableAccounts {
-		existingIDs[account.Fields.AccountID] = struct{}{}
+		existing[account.Fields.AccountID] = account
+	}
+
+	// Only items that Plaid actually answered for; an item that failed to
+	// fetch shouldn't have all of its accounts marked inactive.
+	fetched := map[string]struct{}{}
+	returned := map[string]struct{}{}
+	for _, a := range accounts {
+		fetched[a.ItemID] = struct{}{}
+		returned[a.ID] = struct{}{}
 	}
 
 	for i, account := range plaidAccounts {
-		if _, ok := existingIDs[account.Fields.AccountID]; ok {
+		e, ok := existing[account.Fields.AccountID]
+		if !ok {
+			err := accountsTable.Create(&account)
+			if err != nil {
+				return err
+			}
+			slog.Info("Created account", "account", account.Fields.Name, "n", i+1, "total", len(plaidAccounts))
+			continue
+		}
+
+		if len(account.Fields.Institution) == 0 {
+			account.Fields.Institution = e.Fields.Institution
+		}
+		if !accountChanged(e.Fields, account.Fields) {
 			continue
 		}
 
-		err := accountsTable.Create(&account)
+		account.ID = e.ID
+		err := accountsTable.Update(&account)
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Created %d/%d account\n", i, len(plaidAccounts))
+		slog.Info("Updated account", "account", account.Fields.Name, "n", i+1, "total", len(plaidAccounts))
+	}
+
+	for _, account := range airtableAccounts {
+		if !account.Fields.Active {
+			continue
+		}
+		if _, ok := fetched[account.Fields.ItemID]; !ok {
+			continue
+		}
+		if _, ok := returned[account.Fields.AccountID]; ok {
+			continue
+		}
+
+		account.Fields.Active = false
+		err := accountsTable.Update(&account)
+		if err != nil {
+			return err
+		}
+		slog.Info("Marked account inactive", "account", account.Fields.Name, "account_id", account.Fields.AccountID)
 	}
 
 	return nil
 }
+
+func accountChanged(existing, updated AccountFields) bool {
+	return existing.ItemID != updated.ItemID ||
+		existing.Active != updated.Active ||
+		!sameLinks(existing.Institution, updated.Institution) ||
+		existing.Name != updated.Name ||
+		existing.Mask != updated.Mask ||
+		!sameBalance(existing.CurrentBalance, updated.CurrentBalance) ||
+		!sameBalance(existing.AvailableBalance, updated.AvailableBalance)
+}
+
+func sameBalance(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameLinks(a, b airtable.RecordLink) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/spf13/viper"
+)
+
+type whoamiResponse struct {
+	ID     string
+	Scopes []string
+}
+
+type basesResponse struct {
+	Bases []struct {
+		ID              string
+		Name            string
+		PermissionLevel string
+	}
+	Offset string
+}
+
+// AirtableToken returns the Airtable personal access token (or OAuth
+// access token) from airtable.token in the config file or AIRTABLE_TOKEN,
+// falling back to AIRTABLE_KEY for older setups.
+func AirtableToken() string {
+	token := viper.GetString("airtable.token")
+	if token != "" {
+		return token
+	}
+	return os.Getenv("AIRTABLE_KEY")
+}
+
+// AirtableBaseID is the base to sync to, airtable.base_id.
+func AirtableBaseID() string {
+	return viper.GetString("airtable.base_id")
+}
+
+// CheckAirtableWriteAccess uses the Metadata API to make sure the token can
+// write records to the base, so a sync fails before it starts rather than
+// hundreds of records in.
+func CheckAirtableWriteAccess() error {
+	apiKey := AirtableToken()
+	baseID := AirtableBaseID()
+
+	if apiKey == "" {
+		return errors.New("No Airtable token configured. Create a personal access token at https://airtable.com/create/tokens and set airtable.token in the config file or AIRTABLE_TOKEN.")
+	}
+	// Legacy user API keys look like keyXXXXXXXXXXXXXX and no longer work
+	if strings.HasPrefix(apiKey, "key") {
+		return errors.New("Airtable API keys have been replaced by personal access tokens. Create one with the data.records:read and data.records:write scopes at https://airtable.com/create/tokens and set airtable.token in the config file or AIRTABLE_TOKEN.")
+	}
+
+	var whoami whoamiResponse
+	err := airtableMeta("whoami", &whoami)
+	if err != nil {
+		return err
+	}
+
+	// Scopes are only reported for personal access tokens and OAuth
+	if whoami.Scopes != nil {
+		for _, scope := range []string{"data.records:read", "data.records:write"} {
+			if !contains(whoami.Scopes, scope) {
+				return errors.New(fmt.Sprintf("The Airtable token is missing the %s scope. Add it at https://airtable.com/create/tokens.", scope))
+			}
+		}
+	}
+
+	offset := ""
+	for {
+		var bases basesResponse
+		endpoint := "bases"
+		if offset != "" {
+			endpoint += "?offset=" + offset
+		}
+		err := airtableMeta(endpoint, &bases)
+		if err != nil {
+			slog.Warn("Cannot list Airtable bases to check permissions (does the token have schema.bases:read?)", "error", err)
+			return nil
+		}
+
+		for _, base := range bases.Bases {
+			if base.ID != baseID {
+				continue
+			}
+			if base.PermissionLevel != "edit" && base.PermissionLevel != "create" {
+				return errors.New(fmt.Sprintf("The Airtable token only has %s access to base %s (%s). Give it edit access at https://airtable.com/create/tokens.", base.PermissionLevel, base.Name, base.ID))
+			}
+			return nil
+		}
+
+		if bases.Offset == "" {
+			return errors.New(fmt.Sprintf("The Airtable token has no access to base %s. Add the base to the token at https://airtable.com/create/tokens.", baseID))
+		}
+		offset = bases.Offset
+	}
+}
+
+func airtableMeta(endpoint string, v interface{}) error {
+	return airtableMetaRequest("GET", endpoint, nil, v)
+}
+
+func airtableMetaPost(endpoint string, body interface{}, v interface{}) error {
+	return airtableMetaRequest("POST", endpoint, body, v)
+}
+
+func airtableMetaRequest(method string, endpoint string, body interface{}, v interface{}) error {
+	err := NewAirtableClient().Meta(method, endpoint, body, v)
+	if apiErr, ok := err.(*airtable.Error); ok && apiErr.StatusCode == http.StatusUnauthorized {
+		return errors.New("The Airtable token was rejected. Check airtable.token or AIRTABLE_TOKEN.")
+	}
+	return err
+}
+
+func contains(slice []string, s string) bool {
+	for _, x := range slice {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
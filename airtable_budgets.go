@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// The Budgets table has a row per category per month. Budget is set from
+// budgets.monthly when the row is created and can be edited in Airtable
+// afterwards; sync fills in Actual and Remaining.
+
+type BudgetFields struct {
+	// Personal finance category, e.g. FOOD_AND_DRINK
+	Category string
+	// YYYY-MM
+	Month     string
+	Budget    float64
+	Actual    float64
+	Remaining float64
+}
+
+type BudgetRecord struct {
+	airtable.Record
+	Fields BudgetFields
+}
+
+// BudgetLimits returns budgets.monthly, keyed by upper case category.
+func BudgetLimits() map[string]float64 {
+	limits := make(map[string]float64)
+	// viper lowercases map keys
+	for category := range viper.GetStringMap("budgets.monthly") {
+		limits[strings.ToUpper(category)] = viper.GetFloat64("budgets.monthly." + category)
+	}
+	return limits
+}
+
+// SyncBudgets writes this month's spending per category in txs to the
+// Budgets table, and notifies when a category goes over budget. txs
+// should cover every account, or spending will be undercounted.
+func SyncBudgets(data *plaid_cli.Data, txs []Transaction, now time.Time) error {
+	client := NewAirtableClient()
+
+	budgetsTable := client.Table("Budgets")
+
+	month := now.Format("2006-01")
+	var existing []BudgetRecord
+	err := budgetsTable.List(&existing, &airtable.Options{
+		Filter: fmt.Sprintf("{Month} = '%s'", month),
+	})
+	if err != nil {
+		return err
+	}
+
+	actuals := make(map[string]float64)
+	for _, t := range txs {
+		amount := outflow(data, t)
+		if amount <= 0 || isTransfer(t) || !strings.HasPrefix(t.Date, month) {
+			continue
+		}
+		actuals[spendCategory(t)] += amount
+	}
+
+	rows := make(map[string]BudgetRecord)
+	for _, r := range existing {
+		rows[strings.ToUpper(r.Fields.Category)] = r
+	}
+
+	var toCreate []BudgetRecord
+	for category, limit := range BudgetLimits() {
+		if _, ok := rows[category]; !ok {
+			toCreate = append(toCreate, BudgetRecord{Fields: BudgetFields{Category: category, Month: month, Budget: limit}})
+		}
+	}
+	update := func(r BudgetRecord, wasOver bool) BudgetRecord {
+		r.Fields.Actual = actuals[strings.ToUpper(r.Fields.Category)]
+		r.Fields.Remaining = r.Fields.Budget - r.Fields.Actual
+		if r.Fields.Remaining < 0 && !wasOver {
+			Notify(NotifyEvent{
+				Event:   EventBudget,
+				Message: fmt.Sprintf("Over the %s budget for %s: spent %.2f of %.2f", r.Fields.Category, month, r.Fields.Actual, r.Fields.Budget),
+			})
+		}
+		return r
+	}
+	for i, r := range toCreate {
+		toCreate[i] = update(r, false)
+	}
+	for i, r := range existing {
+		existing[i] = update(r, r.Fields.Remaining < 0)
+	}
+
+	err = budgetsTable.CreateAll(toCreate, nil)
+	if err != nil {
+		return err
+	}
+	return budgetsTable.UpdateAll(existing, nil)
+}
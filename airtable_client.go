@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/spf13/viper"
+)
+
+// AirtableClient is the synced base. Everything reading or writing it
+// goes through NewAirtableClient, so tests can swap in a fake.
+type AirtableClient interface {
+	Table(name string) airtable.TableClient
+	UploadAttachment(recordID string, field string, filename string, contentType string, file string) error
+	// Meta calls the Metadata API, e.g. GET bases/{baseID}/tables
+	Meta(method string, endpoint string, body interface{}, v interface{}) error
+}
+
+var NewAirtableClient = func() AirtableClient {
+	client := &airtable.Client{
+		APIKey: AirtableToken(),
+		BaseID: AirtableBaseID(),
+
+		HTTPClient: airtableHTTPClient,
+		Context:    runContext,
+	}
+	if auditLog != nil && viper.GetBool("audit.enabled") {
+		client.OnMutation = auditLog.OnMutation(client.BaseID)
+	}
+	return &airtableBase{client}
+}
+
+// airtableBase wraps the API client, whose Table returns a *Table.
+type airtableBase struct {
+	client *airtable.Client
+}
+
+func (b *airtableBase) Table(name string) airtable.TableClient {
+	return b.client.Table(name)
+}
+
+func (b *airtableBase) UploadAttachment(recordID string, field string, filename string, contentType string, file string) error {
+	return b.client.UploadAttachment(recordID, field, filename, contentType, file)
+}
+
+func (b *airtableBase) Meta(method string, endpoint string, body interface{}, v interface{}) error {
+	return b.client.Meta(method, endpoint, body, v)
+}
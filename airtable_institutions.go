@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+type InstitutionFields struct {
+	InstitutionID string
+	Name          string
+	URL           string
+	Logo          airtable.Attachment `json:",omitempty"`
+}
+
+type InstitutionRecord struct {
+	airtable.Record
+	Fields InstitutionFields
+}
+
+func FetchAirtableInstitutions() ([]InstitutionRecord, error) {
+	client := NewAirtableClient()
+
+	institutionsTable := client.Table("Institutions")
+
+	var airtableInstitutions []InstitutionRecord
+	err := institutionsTable.List(&airtableInstitutions, &airtable.Options{})
+	return airtableInstitutions, err
+}
+
+// SyncInstitutions makes sure each institution has a record in the
+// Institutions table and returns the record IDs keyed by institution ID,
+// for linking accounts.
+func SyncInstitutions(institutions []plaid_cli.Institution) (map[string]string, error) {
+	client := NewAirtableClient()
+
+	institutionsTable := client.Table("Institutions")
+
+	airtableInstitutions, err := FetchAirtableInstitutions()
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]InstitutionRecord{}
+	for _, institution := range airtableInstitutions {
+		existing[institution.Fields.InstitutionID] = institution
+	}
+
+	recordIDs := map[string]string{}
+	for _, institution := range institutions {
+		if _, ok := recordIDs[institution.ID]; ok {
+			continue
+		}
+
+		record := InstitutionRecord{Fields: InstitutionFields{
+			InstitutionID: institution.ID,
+			Name:          institution.Name,
+			URL:           institution.URL,
+		}}
+
+		e, ok := existing[institution.ID]
+		if !ok {
+			err := institutionsTable.Create(&record)
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("Created institution", "institution", institution.Name)
+		} else {
+			record.ID = e.ID
+			record.Fields.Logo = e.Fields.Logo
+			if e.Fields.Name != record.Fields.Name || e.Fields.URL != record.Fields.URL {
+				// Leave the logo alone; it's uploaded separately below
+				update := InstitutionRecord{Fields: record.Fields}
+				update.ID = e.ID
+				update.Fields.Logo = nil
+				err := institutionsTable.Update(&update)
+				if err != nil {
+					return nil, err
+				}
+				slog.Info("Updated institution", "institution", institution.Name)
+			}
+		}
+		recordIDs[institution.ID] = record.ID
+
+		if len(record.Fields.Logo) == 0 && institution.Logo != "" {
+			// Attachments are normally given as a public URL, which Plaid
+			// logos don't have
+			err := client.UploadAttachment(record.ID, "Logo", institution.ID+".png", "image/png", institution.Logo)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return recordIDs, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// AirtableRoute syncs some items to another base or transactions table
+// than airtable.base_id, configured as e.g.
+//
+//	[[airtable.routes]]
+//	items = ["chase-business", "amex-business"]
+//	base = "appBusinessBase"
+//	table = "Transactions" # optional
+type AirtableRoute struct {
+	Items []string
+	Base  string
+	Table string
+}
+
+// AirtableDestination is where a group of items is synced to.
+type AirtableDestination struct {
+	BaseID            string
+	TransactionsTable string
+	Items             []idAndAlias
+}
+
+// AirtableTransactionsTable is airtable.transactions_table, the table
+// transactions are synced to in the current base.
+func AirtableTransactionsTable() string {
+	return viper.GetString("airtable.transactions_table")
+}
+
+// RouteItems groups items by the base and table airtable.routes sends
+// them to. Items without a route go to airtable.base_id, first.
+func RouteItems(data *plaid_cli.Data, items []idAndAlias) ([]AirtableDestination, error) {
+	var routes []AirtableRoute
+	err := viper.UnmarshalKey("airtable.routes", &routes)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid airtable.routes: %s", err))
+	}
+
+	routeOf := make(map[string]AirtableRoute)
+	for _, route := range routes {
+		if route.Base == "" && route.Table == "" {
+			return nil, errors.New("Invalid airtable.routes: each route needs a base or table")
+		}
+		for _, itemOrAlias := range route.Items {
+			item, err := ResolveItem(data, itemOrAlias)
+			if err != nil {
+				return nil, err
+			}
+			routeOf[item.id] = route
+		}
+	}
+
+	defaultDestination := AirtableDestination{BaseID: AirtableBaseID(), TransactionsTable: AirtableTransactionsTable()}
+	destinations := []AirtableDestination{defaultDestination}
+	for _, item := range items {
+		d := defaultDestination
+		if route, ok := routeOf[item.id]; ok {
+			if route.Base != "" {
+				d.BaseID = route.Base
+			}
+			if route.Table != "" {
+				d.TransactionsTable = route.Table
+			}
+		}
+
+		found := false
+		for i := range destinations {
+			if destinations[i].BaseID == d.BaseID && destinations[i].TransactionsTable == d.TransactionsTable {
+				destinations[i].Items = append(destinations[i].Items, item)
+				found = true
+				break
+			}
+		}
+		if !found {
+			d.Items = []idAndAlias{item}
+			destinations = append(destinations, d)
+		}
+	}
+
+	var ret []AirtableDestination
+	for _, d := range destinations {
+		if len(d.Items) > 0 {
+			ret = append(ret, d)
+		}
+	}
+	return ret, nil
+}
+
+// UseAirtableDestination points everything reading or writing Airtable
+// at d until the next call.
+func UseAirtableDestination(d AirtableDestination) {
+	viper.Set("airtable.base_id", d.BaseID)
+	viper.Set("airtable.transactions_table", d.TransactionsTable)
+}
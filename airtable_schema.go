@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/viper"
+)
+
+// The tables plaid-cli reads and writes, in dependency order so linked
+// tables exist before the fields that link to them.
+
+type schemaField struct {
+	Name    string                 `json:"name"`
+	Type    string                 `json:"type"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+type schemaTable struct {
+	Name   string        `json:"name"`
+	Fields []schemaField `json:"fields"`
+}
+
+func textField(name string) schemaField {
+	return schemaField{Name: name, Type: "singleLineText"}
+}
+
+func currencyField(name string) schemaField {
+	return schemaField{Name: name, Type: "currency", Options: map[string]interface{}{"precision": 2, "symbol": "$"}}
+}
+
+func numberField(name string) schemaField {
+	return schemaField{Name: name, Type: "number", Options: map[string]interface{}{"precision": 0}}
+}
+
+func checkboxField(name string) schemaField {
+	return schemaField{Name: name, Type: "checkbox", Options: map[string]interface{}{"icon": "check", "color": "greenBright"}}
+}
+
+// linkField is resolved to the linked table's ID when it is created.
+func linkField(name string, table string) schemaField {
+	return schemaField{Name: name, Type: "multipleRecordLinks", Options: map[string]interface{}{"linkedTableId": table}}
+}
+
+var dateTimeOptions = map[string]interface{}{
+	"dateFormat": map[string]string{"name": "iso"},
+	"timeFormat": map[string]string{"name": "24hour"},
+	"timeZone":   "client",
+}
+
+var airtableSchema = []schemaTable{
+	{Name: "Categories", Fields: []schemaField{
+		textField("Name"),
+		textField("CategoryID"),
+		textField("Primary"),
+		{Name: "Description", Type: "multilineText"},
+		textField("Taxonomy"),
+	}},
+	{Name: "Category Mapping", Fields: []schemaField{
+		textField("PFC"),
+		linkField("Category", "Categories"),
+	}},
+	{Name: "Institutions", Fields: []schemaField{
+		textField("InstitutionID"),
+		textField("Name"),
+		{Name: "URL", Type: "url"},
+		{Name: "Logo", Type: "multipleAttachments"},
+	}},
+	{Name: "Accounts", Fields: []schemaField{
+		textField("AccountID"),
+		textField("ItemID"),
+		textField("Name"),
+		textField("Mask"),
+		currencyField("CurrentBalance"),
+		currencyField("AvailableBalance"),
+		checkboxField("Active"),
+		linkField("Institution", "Institutions"),
+		{Name: "Statements", Type: "multipleAttachments"},
+	}},
+	{Name: "Owners", Fields: []schemaField{
+		textField("Name"),
+		{Name: "Emails", Type: "multilineText"},
+		{Name: "Addresses", Type: "multilineText"},
+		linkField("Accounts", "Accounts"),
+	}},
+	{Name: "Transactions", Fields: []schemaField{
+		textField("PlaidID"),
+		textField("AccountIDDedupe"),
+		linkField("AccountID", "Accounts"),
+		currencyField("Amount"),
+		textField("Name"),
+		textField("RawName"),
+		{Name: "OriginalDescription", Type: "multilineText"},
+		textField("MerchantName"),
+		checkboxField("Pending"),
+		{Name: "DateTime", Type: "date", Options: map[string]interface{}{"dateFormat": map[string]string{"name": "iso"}}},
+		{Name: "AuthorizedDate", Type: "date", Options: map[string]interface{}{"dateFormat": map[string]string{"name": "iso"}}},
+		{Name: "AuthorizedAt", Type: "dateTime", Options: dateTimeOptions},
+		{Name: "PostedAt", Type: "dateTime", Options: dateTimeOptions},
+		textField("PlaidCategory1"),
+		textField("PlaidCategory2"),
+		textField("PlaidCategory3"),
+		{Name: "PFCPrimary", Type: "singleSelect", Options: map[string]interface{}{"choices": []map[string]string{}}},
+		{Name: "PFCDetailed", Type: "singleSelect", Options: map[string]interface{}{"choices": []map[string]string{}}},
+		textField("PFCConfidence"),
+		textField("Address"),
+		textField("City"),
+		textField("Region"),
+		textField("PostalCode"),
+		textField("Country"),
+		{Name: "Latitude", Type: "number", Options: map[string]interface{}{"precision": 6}},
+		{Name: "Longitude", Type: "number", Options: map[string]interface{}{"precision": 6}},
+		textField("StoreNumber"),
+		linkField("CategoryLookup", "Categories"),
+		textField("CheckNumber"),
+		textField("ReferenceNumber"),
+		textField("Payer"),
+		textField("Payee"),
+		textField("PPDID"),
+		// Syncs only consider rows where this is 1. It is meant to be a
+		// formula, which the Metadata API can't create.
+		checkboxField("After Plaid Issues"),
+		textField("Currency"),
+		{Name: "OriginalAmount", Type: "number", Options: map[string]interface{}{"precision": 2}},
+		textField("OriginalCurrency"),
+		{Name: "MerchantLogo", Type: "multipleAttachments"},
+		{Name: "Website", Type: "url"},
+		textField("PaymentChannel"),
+		{Name: "Counterparties", Type: "multilineText"},
+		checkboxField("Split"),
+		linkField("SplitOf", "Transactions"),
+		checkboxField("Transfer"),
+		linkField("TransferPair", "Transactions"),
+		checkboxField("Removed"),
+		checkboxField("Deductible"),
+		{Name: "RemovedAt", Type: "dateTime", Options: dateTimeOptions},
+	}},
+	{Name: "Budgets", Fields: []schemaField{
+		textField("Category"),
+		textField("Month"),
+		currencyField("Budget"),
+		currencyField("Actual"),
+		currencyField("Remaining"),
+	}},
+	{Name: "Sync Log", Fields: []schemaField{
+		textField("Owner"),
+		{Name: "StartedAt", Type: "dateTime", Options: dateTimeOptions},
+		{Name: "Accounts", Type: "multilineText"},
+		numberField("Created"),
+		numberField("Updated"),
+		numberField("Deleted"),
+	}},
+}
+
+type metaTable struct {
+	ID     string
+	Name   string
+	Fields []struct {
+		ID   string
+		Name string
+	}
+}
+
+// InitAirtableSchema creates any missing tables and fields in baseID.
+// Existing fields are left alone, even if their type differs.
+func InitAirtableSchema(baseID string) error {
+	var existing struct {
+		Tables []metaTable
+	}
+	err := airtableMeta(fmt.Sprintf("bases/%s/tables", baseID), &existing)
+	if err != nil {
+		return err
+	}
+
+	tableIDs := map[string]string{}
+	tablesByName := map[string]metaTable{}
+	for _, table := range existing.Tables {
+		tableIDs[table.Name] = table.ID
+		tablesByName[table.Name] = table
+	}
+
+	timeZone := viper.GetString("sync.timezone")
+	if timeZone == "" {
+		timeZone = "client"
+	}
+
+	// Links are resolved to table IDs as late as possible, since a table
+	// can link to itself
+	resolve := func(field schemaField) schemaField {
+		switch field.Type {
+		case "dateTime":
+			// Show times in sync.timezone rather than each viewer's
+			field.Options = map[string]interface{}{
+				"dateFormat": field.Options["dateFormat"],
+				"timeFormat": field.Options["timeFormat"],
+				"timeZone":   timeZone,
+			}
+		case "multipleRecordLinks":
+			linked := field.Options["linkedTableId"].(string)
+			field.Options = map[string]interface{}{"linkedTableId": tableIDs[linked]}
+		}
+		return field
+	}
+
+	for _, table := range airtableSchema {
+		e, ok := tablesByName[table.Name]
+		if !ok {
+			var fields []schemaField
+			for _, field := range table.Fields {
+				if field.Type == "multipleRecordLinks" && field.Options["linkedTableId"] == table.Name {
+					continue
+				}
+				fields = append(fields, resolve(field))
+			}
+
+			err := airtableMetaPost(fmt.Sprintf("bases/%s/tables", baseID), schemaTable{Name: table.Name, Fields: fields}, &e)
+			if err != nil {
+				return err
+			}
+			tableIDs[table.Name] = e.ID
+			slog.Info("Created table", "table", table.Name)
+		}
+
+		existingFields := map[string]struct{}{}
+		for _, field := range e.Fields {
+			existingFields[field.Name] = struct{}{}
+		}
+		for _, field := range table.Fields {
+			if _, ok := existingFields[field.Name]; ok {
+				continue
+			}
+			var created struct{ ID string }
+			err := airtableMetaPost(fmt.Sprintf("bases/%s/tables/%s/fields", baseID, e.ID), resolve(field), &created)
+			if err != nil {
+				return err
+			}
+			slog.Info("Created field", "table", table.Name, "field", field.Name)
+		}
+	}
+
+	return nil
+}
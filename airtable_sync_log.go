@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+)
+
+// The Sync Log table lets several machines sync into one base. Each run
+// records which accounts it synced and who ran it, so a machine can avoid
+// deleting transactions in accounts another household member owns.
+
+type SyncLogFields struct {
+	Owner     string
+	StartedAt string
+	// Comma separated account IDs
+	Accounts string
+	Created  int
+	Updated  int
+	Deleted  int
+}
+
+type SyncLogRecord struct {
+	airtable.Record
+	Fields SyncLogFields
+}
+
+// FetchAccountOwners returns the owner of the most recent sync of each
+// account.
+func FetchAccountOwners() (map[string]string, error) {
+	client := NewAirtableClient()
+
+	syncLogTable := client.Table("Sync Log")
+
+	var entries []SyncLogRecord
+	err := syncLogTable.List(&entries, &airtable.Options{
+		Sort: []airtable.SortField{{Field: "StartedAt", Direction: airtable.SortAsc}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[string]string)
+	for _, e := range entries {
+		for _, accountID := range strings.Split(e.Fields.Accounts, ",") {
+			if accountID != "" {
+				owners[accountID] = e.Fields.Owner
+			}
+		}
+	}
+	return owners, nil
+}
+
+func RecordSyncLog(owner string, accountIDs []string, summary *RunSummary) error {
+	client := NewAirtableClient()
+
+	syncLogTable := client.Table("Sync Log")
+
+	entry := SyncLogRecord{Fields: SyncLogFields{
+		Owner:     owner,
+		StartedAt: summary.StartedAt.Format(time.RFC3339),
+		Accounts:  strings.Join(accountIDs, ","),
+		Created:   summary.Created,
+		Updated:   summary.Updated,
+		Deleted:   summary.Deleted,
+	}}
+	return syncLogTable.Create(&entry)
+}
+
+func SyncedAccountIDs(transactions []Transaction) []string {
+	seen := make(map[string]struct{})
+	var accountIDs []string
+	for _, t := range transactions {
+		if _, ok := seen[t.AccountID]; !ok {
+			seen[t.AccountID] = struct{}{}
+			accountIDs = append(accountIDs, t.AccountID)
+		}
+	}
+	sort.Strings(accountIDs)
+	return accountIDs
+}
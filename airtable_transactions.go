@@ -1,244 +1,378 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"strings"
 	"time"
 
-	"github.com/brianloveswords/airtable"
-	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/pipeline"
+	"github.com/spf13/viper"
 )
 
-type TransactionFields struct {
-	PlaidID string
-	// Used to dedupe, not for human consumption
-	AccountID      string              `json:"AccountIDDedupe"`
-	AccountIDLink  airtable.RecordLink `json:"AccountID"`
-	Amount         float64
-	Name           string
-	MerchantName   string
-	Pending        bool
-	DateTime       string
-	PlaidCategory1 string
-	PlaidCategory2 string
-	PlaidCategory3 string
-	Address        string
-	CategoryLookup airtable.RecordLink
-	//CategoryLookup
+// The transaction records and sync engine live in pkg/pipeline; these
+// aliases keep the CLI's code short.
+
+type TransactionFields = pipeline.TransactionFields
+type TransactionRecord = pipeline.Record
+type TombstoneFields = pipeline.TombstoneFields
+type TombstoneRecord = pipeline.TombstoneRecord
+
+// SyncFields are the fields Sync needs to diff Airtable against Plaid.
+var SyncFields = pipeline.SyncFields
+
+// transactionsTarget is the Transactions table as a sync target, fetching
+// only the given fields (all of them when nil).
+func transactionsTarget(fields []string) *pipeline.AirtableTarget {
+	client := NewAirtableClient()
+
+	return &pipeline.AirtableTarget{
+		Table:      client.Table(AirtableTransactionsTable()),
+		View:       viper.GetString("airtable.transactions_view"),
+		Fields:     fields,
+		SoftDelete: viper.GetBool("sync.soft_delete"),
+	}
 }
 
-type TransactionRecord struct {
-	airtable.Record
-	Fields   TransactionFields
-	Typecast bool
+// FetchAirtableTransactions lists synced transactions dated on or after
+// since (all of them when since is zero), restricted to
+// airtable.transactions_view when set. Only the given fields are fetched,
+// or all of them when fields is nil.
+func FetchAirtableTransactions(fields []string, since time.Time) ([]TransactionRecord, error) {
+	slog.Info("Fetching Airtable transactions")
+	airtableTransactions, err := transactionsTarget(fields).Existing(since)
+	slog.Info("Fetched Airtable transactions", "count", len(airtableTransactions))
+	return airtableTransactions, err
 }
 
-func FetchAirtableTransactions() ([]TransactionRecord, error) {
-	log.Println("Fetching airtable transactions...")
-	client := airtable.Client{
-		APIKey: os.Getenv("AIRTABLE_KEY"),
-		BaseID: "appxCfKnRz94NZadj",
+// CountAirtableTransactions returns how many synced transactions in
+// Airtable belong to the given accounts.
+func CountAirtableTransactions(accountIDs []string) (int, error) {
+	if len(accountIDs) == 0 {
+		return 0, nil
 	}
 
-	transactionsTable := client.Table("Transactions")
+	client := NewAirtableClient()
+
+	transactionsTable := client.Table(AirtableTransactionsTable())
+
+	conditions := make([]string, len(accountIDs))
+	for i, id := range accountIDs {
+		conditions[i] = fmt.Sprintf("{AccountIDDedupe} = '%s'", id)
+	}
 
 	var airtableTransactions []TransactionRecord
 	err := transactionsTable.List(&airtableTransactions, &airtable.Options{
-		Filter: "{After Plaid Issues} = 1",
+		Fields: []string{"PlaidID"},
+		Filter: fmt.Sprintf("OR(%s)", strings.Join(conditions, ", ")),
 	})
-	log.Println("Fetched airtable transactions")
-	return airtableTransactions, err
+	return len(airtableTransactions), err
 }
 
-func val(s plaid.NullableString) string {
-	if !s.IsSet() {
-		return ""
-	}
-	return *s.Get()
+// TransactionRecords maps transactions to the Airtable records Sync
+// would write.
+func TransactionRecords(transactions []Transaction) []TransactionRecord {
+	return pipeline.Records(transactions, pipeline.RecordOptions{
+		MerchantDetails: viper.GetBool("sync.merchant_details"),
+		Location:        Timezone(),
+	})
 }
-func Sync(transactions []plaid.Transaction, airtableTransactions []TransactionRecord) error {
-	client := airtable.Client{
-		APIKey: os.Getenv("AIRTABLE_KEY"),
-		BaseID: "appxCfKnRz94NZadj",
-	}
-
-	transactionsTable := client.Table("Transactions")
 
-	plaidTransactions := make([]TransactionRecord, len(transactions))
-	for i, t := range transactions {
-		s := func(tags []string, n int) string {
-			if n >= len(tags) {
-				return ""
-			}
-			return tags[n]
-		}
-		address := val(t.Location.Address) + " " + val(t.Location.City)
-		plaidTransactions[i] = TransactionRecord{Fields: TransactionFields{
-			PlaidID:        t.TransactionId,
-			AccountID:      t.AccountId,
-			AccountIDLink:  airtable.RecordLink{t.AccountId},
-			Amount:         t.Amount,
-			Name:           t.Name,
-			MerchantName:   val(t.MerchantName),
-			Pending:        t.Pending,
-			DateTime:       t.Date,
-			PlaidCategory1: s(t.Category, 0),
-			PlaidCategory2: s(t.Category, 1),
-			PlaidCategory3: s(t.Category, 2),
-			Address:        address,
-		}, Typecast: true}
-		plaidTransactions[i].ID = t.TransactionId
-	}
+type SyncOptions struct {
+	// Household member running this sync. Empty when not sharing a base.
+	Owner string
+	// Account ID to the household member that last synced it
+	AccountOwners map[string]string
+	// Airtable transactions missing from Plaid are only deleted when dated
+	// after this
+	DeleteCutoff time.Time
+	// Mark removed transactions with TombstoneFields instead of deleting
+	SoftDelete bool
+	// When set, the Transactions table is snapshotted here before any
+	// records are updated or deleted
+	SnapshotDir string
+}
 
-	plaidArranged := byAccountIDbyTransactionID(plaidTransactions)
-	airtableArranged := byAccountIDbyTransactionID(airtableTransactions)
+func Sync(transactions []Transaction, airtableTransactions []TransactionRecord, summary *RunSummary, opts SyncOptions) error {
+	target := transactionsTarget(nil)
+	target.SoftDelete = opts.SoftDelete
 
-	for accountID, transactions := range plaidArranged {
-		updates := updateAccount(transactions, airtableArranged[accountID])
+	updates, err := pipeline.Plan(TransactionRecords(transactions), airtableTransactions, pipeline.Options{
+		Owner:         opts.Owner,
+		AccountOwners: opts.AccountOwners,
+		DeleteCutoff:  opts.DeleteCutoff,
+	})
+	if err != nil {
+		return err
+	}
 
-		// Update is delete + create
-		for _, t := range updates.ToDelete {
-			err := transactionsTable.Delete(&t)
-			if err != nil {
-				return err
-			}
+	// Only new transactions are categorized, so categories picked by hand
+	// are never overwritten
+	mapping, err := LoadCategoryMapping()
+	if err != nil {
+		return err
+	}
+	categorized := 0
+	for _, u := range updates {
+		for _, n := range mapping.Categorize(u.ToCreate) {
+			categorized += n
 		}
+	}
+	if categorized > 0 {
+		slog.Info("Categorized new transactions", "count", categorized)
+	}
 
-		for i, t := range updates.ToCreate {
-			err := transactionsTable.Create(&t)
-			if err != nil {
-				return err
+	total, overwritten := 0, 0
+	for _, u := range updates {
+		total += len(u.ToDelete) + len(u.ToCreate) + len(u.ToUpdate)
+		overwritten += len(u.ToDelete) + len(u.ToUpdate)
+	}
+
+	if opts.SnapshotDir != "" && overwritten > 0 {
+		err = summary.Time("airtable snapshot", func() error {
+			path, n, err := SnapshotTable(AirtableTransactionsTable(), opts.SnapshotDir, "json")
+			if err == nil {
+				slog.Info("Snapshotted Airtable transactions", "path", path, "count", n)
 			}
-			fmt.Printf("Created %d/%d transactions\n", i+1, len(updates.ToCreate))
+			return err
+		})
+		if err != nil {
+			return err
 		}
+	}
 
-		for i, t := range updates.ToUpdate {
-			err := transactionsTable.Update(&t)
-			if err != nil {
-				return err
+	err = summary.Time("airtable write", func() error {
+		progress := StartProgress("Writing to Airtable", NewETA(total))
+		defer progress.Finish()
+		return pipeline.Apply(target, updates, func(change pipeline.Change, n int) {
+			progress.Step(n)
+			switch change {
+			case pipeline.Created:
+				summary.Created += n
+			case pipeline.Updated:
+				summary.Updated += n
+			case pipeline.Deleted:
+				summary.Deleted += n
 			}
-			fmt.Printf("Updated %d/%d transactions\n", i+1, len(updates.ToUpdate))
-		}
+		})
+	})
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return ApplyPlugins(updates, summary)
 }
 
-func byAccountIDbyTransactionID(ts []TransactionRecord) map[string]map[string]TransactionRecord {
-	ret := make(map[string]map[string]TransactionRecord)
-	for _, t := range ts {
-		byID, ok := ret[t.Fields.AccountID]
-		if !ok {
-			byID = make(map[string]TransactionRecord)
-			ret[t.Fields.AccountID] = byID
-		}
-		byID[t.Fields.PlaidID] = t
+// PurgeRemovedTransactions deletes transactions tombstoned more than
+// olderThan ago and returns how many were deleted.
+func PurgeRemovedTransactions(olderThan time.Duration) (int, error) {
+	client := NewAirtableClient()
+
+	transactionsTable := client.Table(AirtableTransactionsTable())
+
+	cutoff := time.Now().Add(-olderThan).Format(time.RFC3339)
+	var removed []TombstoneRecord
+	err := transactionsTable.List(&removed, &airtable.Options{
+		Fields: []string{"Removed", "RemovedAt"},
+		Filter: fmt.Sprintf("AND({Removed}, IS_BEFORE({RemovedAt}, '%s'))", cutoff),
+	})
+	if err != nil {
+		return 0, err
 	}
-	return ret
+
+	err = transactionsTable.DeleteAll(removed, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(removed), nil
 }
 
-type AccountUpdate struct {
-	ToCreate []TransactionRecord
-	ToDelete []TransactionRecord
-	ToUpdate []TransactionRecord
+type PFCFields struct {
+	PlaidID       string
+	PFCPrimary    string
+	PFCDetailed   string
+	PFCConfidence string
 }
 
-func updateAccount(plaidTs, airtableTs map[string]TransactionRecord) AccountUpdate {
-	var u AccountUpdate
-	ids := make(map[string]struct{})
-	for id, t := range plaidTs {
-		ids[id] = struct{}{}
-		existing, ok := airtableTs[id]
-		if !ok {
-			u.ToCreate = append(u.ToCreate, t)
-		} else if existing.Fields.Pending != t.Fields.Pending ||
-			existing.Fields.Address != t.Fields.Address {
-			t.ID = existing.ID
-			u.ToUpdate = append(u.ToUpdate, t)
-		}
+type PFCRecord struct {
+	airtable.Record
+	Fields   PFCFields
+	Typecast bool
+}
+
+// BackfillPFC fills in personal finance categories on Airtable
+// transactions synced before they were, and returns how many were
+// updated. Only rows with no PFCPrimary are touched.
+func BackfillPFC(transactions []Transaction) (int, error) {
+	client := NewAirtableClient()
+
+	transactionsTable := client.Table(AirtableTransactionsTable())
+
+	var missing []PFCRecord
+	err := transactionsTable.List(&missing, &airtable.Options{
+		Fields: []string{"PlaidID"},
+		Filter: "AND({After Plaid Issues} = 1, NOT({PFCPrimary}))",
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	cutoff := time.Now().AddDate(0, -1, 0)
-	for id, t := range airtableTs {
-		if _, ok := ids[id]; !ok {
-			transactionTime, err := time.Parse("2006-01-02", t.Fields.DateTime)
-			if err != nil {
-				panic(err)
-			}
-			if transactionTime.After(cutoff) {
-				fmt.Println("Deleting", t)
-				u.ToDelete = append(u.ToDelete, t)
-			}
+	byID := make(map[string]Transaction)
+	for _, t := range transactions {
+		byID[t.ID] = t
+	}
+
+	var updates []PFCRecord
+	for _, r := range missing {
+		t, ok := byID[r.Fields.PlaidID]
+		if !ok || t.PersonalFinanceCategory == nil {
+			continue
 		}
+		u := PFCRecord{Fields: PFCFields{
+			PlaidID:       t.ID,
+			PFCPrimary:    t.PersonalFinanceCategory.Primary,
+			PFCDetailed:   t.PersonalFinanceCategory.Detailed,
+			PFCConfidence: t.PersonalFinanceCategory.ConfidenceLevel,
+		}, Typecast: true}
+		u.ID = r.ID
+		updates = append(updates, u)
 	}
-	return u
+
+	err = transactionsTable.UpdateAll(updates, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(updates), nil
+}
+
+// FieldBackfill is a group of columns Sync only writes on new
+// transactions, for filling in on those synced before.
+type FieldBackfill struct {
+	// Rows where all of these are empty are backfilled
+	Missing []string
+	// Columns written, as Sync would write them now
+	Columns []string
+}
+
+// FieldBackfills are the groups backfill-fields fills in, by name.
+var FieldBackfills = map[string]FieldBackfill{
+	// Amount too, since it changes when currency.home converts it
+	"currency": {
+		Missing: []string{"Currency"},
+		Columns: []string{"Amount", "Currency", "OriginalAmount", "OriginalCurrency"},
+	},
+	// Whether or not sync.merchant_details is on, since asking for them is
+	// turning it on for older transactions
+	"merchant": {
+		Missing: []string{"PaymentChannel"},
+		Columns: []string{"MerchantLogo", "Website", "PaymentChannel", "Counterparties"},
+	},
+	"description": {
+		Missing: []string{"OriginalDescription"},
+		Columns: []string{"OriginalDescription"},
+	},
+	// Address was synced from the start, so it's left alone
+	"location": {
+		Missing: []string{"City", "Region", "PostalCode", "Country", "Latitude", "Longitude", "StoreNumber"},
+		Columns: []string{"City", "Region", "PostalCode", "Country", "Latitude", "Longitude", "StoreNumber"},
+	},
+	"payment": {
+		Missing: []string{"CheckNumber", "ReferenceNumber", "Payer", "Payee", "PPDID"},
+		Columns: []string{"CheckNumber", "ReferenceNumber", "Payer", "Payee", "PPDID"},
+	},
+	// Dated in sync.timezone, as Sync would
+	"dates": {
+		Missing: []string{"AuthorizedDate", "AuthorizedAt", "PostedAt"},
+		Columns: []string{"AuthorizedDate", "AuthorizedAt", "PostedAt"},
+	},
+}
+
+type backfillRecord struct {
+	airtable.Record
+	Fields   map[string]interface{}
+	Typecast bool
 }
 
-func FixAT(airtableTransactions []TransactionRecord) error {
-	client := airtable.Client{
-		APIKey: os.Getenv("AIRTABLE_KEY"),
-		BaseID: "appxCfKnRz94NZadj",
+// BackfillFields fills in backfill's columns on Airtable transactions
+// missing them, from transactions, and returns how many were updated.
+func BackfillFields(transactions []Transaction, backfill FieldBackfill) (int, error) {
+	client := NewAirtableClient()
+
+	transactionsTable := client.Table(AirtableTransactionsTable())
+
+	conditions := []string{"{After Plaid Issues} = 1"}
+	for _, column := range backfill.Missing {
+		conditions = append(conditions, fmt.Sprintf("NOT({%s})", column))
+	}
+	var missing []TransactionRecord
+	err := transactionsTable.List(&missing, &airtable.Options{
+		Fields: []string{"PlaidID"},
+		Filter: fmt.Sprintf("AND(%s)", strings.Join(conditions, ", ")),
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	transactionsTable := client.Table("Transactions")
-	_ = transactionsTable
+	byID := make(map[string]TransactionRecord)
+	records := pipeline.Records(transactions, pipeline.RecordOptions{
+		MerchantDetails: true,
+		Location:        Timezone(),
+	})
+	for _, r := range records {
+		byID[r.Fields.PlaidID] = r
+	}
 
-	airtableArranged := make(map[string]map[string][]TransactionRecord)
-	for _, t := range airtableTransactions {
-		byAmount, ok := airtableArranged[t.Fields.DateTime]
+	var updates []backfillRecord
+	for _, r := range missing {
+		t, ok := byID[r.Fields.PlaidID]
 		if !ok {
-			byAmount = make(map[string][]TransactionRecord)
-			airtableArranged[t.Fields.DateTime] = byAmount
+			continue
 		}
-		key := fmt.Sprintf("%v%s", t.Fields.Amount, t.Fields.Name)
-		byAmount[key] = append(byAmount[key], t)
-	}
-
-	for _, dateTs := range airtableArranged {
-		for _, amountTs := range dateTs {
-			if len(amountTs) == 1 {
-				fmt.Println("ok")
-			} else if len(amountTs) == 2 {
-				fmt.Println(amountTs[0].Fields.CategoryLookup, amountTs[0].Fields.AccountID, amountTs[0].Fields.AccountIDLink, amountTs[0])
-				fmt.Println(amountTs[1].Fields.CategoryLookup, amountTs[1].Fields.AccountID, amountTs[1].Fields.AccountIDLink, amountTs[1])
-			} else {
-				fmt.Println("fuck")
-				for _, a := range amountTs {
-					fmt.Println(a.Fields.AccountID, a.Fields.AccountIDLink, a)
-				}
-				//panic(fmt.Sprintf("fuck", len(amountTs)))
-			}
+		fields, err := recordFields(t.Fields, backfill.Columns)
+		if err != nil {
+			return 0, err
 		}
-	}
-
-	/*for accountID, transactions := range plaidArranged {
-		updates := updateAccount(transactions, airtableArranged[accountID])
-
-		// Update is delete + create
-		for _, t := range updates.ToDelete {
-			err := transactionsTable.Delete(&t)
-			if err != nil {
-				return err
+		// Nothing to fill in, e.g. Plaid has no location either
+		found := false
+		for _, column := range backfill.Missing {
+			if _, ok := fields[column]; ok {
+				found = true
 			}
 		}
-
-		for i, t := range updates.ToCreate {
-			err := transactionsTable.Create(&t)
-			if err != nil {
-				return err
-			}
-			fmt.Printf("Created %d/%d transactions\n", i + 1, len(updates.ToCreate))
+		if !found {
+			continue
 		}
+		u := backfillRecord{Fields: fields, Typecast: true}
+		u.ID = r.ID
+		updates = append(updates, u)
+	}
 
-		for i, t := range updates.ToUpdate {
-			err := transactionsTable.Update(&t)
-			if err != nil {
-				return err
-			}
-			fmt.Printf("Updated %d/%d transactions\n", i + 1, len(updates.ToUpdate))
-		}
-	}*/
+	err = transactionsTable.UpdateAll(updates, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(updates), nil
+}
 
-	return nil
+// recordFields is the non-empty columns of f among columns, as written
+// to Airtable.
+func recordFields(f TransactionFields, columns []string) (map[string]interface{}, error) {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]interface{}
+	err = json.Unmarshal(b, &all)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	for _, column := range columns {
+		if v, ok := all[column]; ok {
+			fields[column] = v
+		}
+	}
+	return fields, nil
 }
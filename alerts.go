@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// TransactionAlert fires for new transactions of at least Amount
+// (ignoring sign), optionally only in one category or account, e.g.
+//
+//	[[alerts.transactions]]
+//	amount = 500
+//	category = "TRAVEL"
+//
+// Category matches the personal finance category, primary or detailed.
+// Account is an account ID or alias.
+type TransactionAlert struct {
+	Amount   float64
+	Category string
+	Account  string
+}
+
+// BalanceAlert fires when an account's available balance (current when
+// Plaid has no available balance) drops below Below. It fires once, and
+// again only after the balance got back up to Clear (Below by default),
+// so a balance hovering around Below doesn't alert on every sync.
+type BalanceAlert struct {
+	Account string
+	Below   float64
+	Clear   float64
+}
+
+// ID identifies the alert in `alerts list` and `alerts ack`.
+func (a BalanceAlert) ID() string {
+	return fmt.Sprintf("balance-%s-%g", a.Account, a.Below)
+}
+
+func (a TransactionAlert) matches(data *plaid_cli.Data, t Transaction) bool {
+	if math.Abs(t.Amount) < a.Amount {
+		return false
+	}
+	if a.Account != "" && ResolveAccountID(data, a.Account) != t.AccountID {
+		return false
+	}
+	if a.Category != "" {
+		pfc := t.PersonalFinanceCategory
+		if pfc == nil || (!strings.EqualFold(pfc.Primary, a.Category) && !strings.EqualFold(pfc.Detailed, a.Category)) {
+			return false
+		}
+	}
+	return true
+}
+
+// AlertTransactions notifies about transactions matching
+// alerts.transactions. Each transaction is reported once, even if it
+// matches several alerts.
+func AlertTransactions(data *plaid_cli.Data, txs []Transaction) {
+	var alerts []TransactionAlert
+	err := viper.UnmarshalKey("alerts.transactions", &alerts)
+	if err != nil {
+		slog.Warn("Invalid alerts.transactions", "error", err)
+		return
+	}
+
+	for _, t := range txs {
+		for _, a := range alerts {
+			if !a.matches(data, t) {
+				continue
+			}
+			Notify(NotifyEvent{
+				Event:   EventAlert,
+				Message: fmt.Sprintf("%.2f %s at %s on %s (%s)", t.Amount, t.IsoCurrencyCode, t.Name, t.Date, AccountLabel(data, t.AccountID)),
+			})
+			break
+		}
+	}
+}
+
+// AlertBalances notifies about accounts that dropped below an
+// alerts.balances threshold. Alerts that fired are kept in the data dir
+// until they clear, and sent again every alerts.remind until acknowledged.
+func AlertBalances(data *plaid_cli.Data, accounts []Account) {
+	var alerts []BalanceAlert
+	err := viper.UnmarshalKey("alerts.balances", &alerts)
+	if err != nil {
+		slog.Warn("Invalid alerts.balances", "error", err)
+		return
+	}
+
+	now := time.Now()
+	remind := viper.GetDuration("alerts.remind")
+	configured := make(map[string]bool)
+	for _, a := range alerts {
+		id := a.ID()
+		configured[id] = true
+		accountID := ResolveAccountID(data, a.Account)
+		for _, account := range accounts {
+			if account.ID != accountID {
+				continue
+			}
+			balance := account.Balances.Available
+			if balance == nil {
+				balance = account.Balances.Current
+			}
+			if balance == nil {
+				continue
+			}
+
+			state, fired := data.Alerts[id]
+			if *balance >= math.Max(a.Clear, a.Below) {
+				if fired {
+					slog.Info("Alert cleared", "alert", id)
+					delete(data.Alerts, id)
+				}
+				continue
+			}
+			if *balance >= a.Below {
+				continue
+			}
+
+			state.Message = fmt.Sprintf("%s balance is %.2f, below %.2f", AccountLabel(data, account.ID), *balance, a.Below)
+			if !fired {
+				state.FiredAt = now
+			}
+			if !fired || (!state.Acked && remind > 0 && now.Sub(state.SentAt) >= remind) {
+				Notify(NotifyEvent{
+					Event:   EventAlert,
+					Message: state.Message,
+				})
+				state.SentAt = now
+			}
+			data.Alerts[id] = state
+		}
+	}
+
+	// Alerts removed from the config
+	for id := range data.Alerts {
+		if strings.HasPrefix(id, "balance-") && !configured[id] {
+			delete(data.Alerts, id)
+		}
+	}
+
+	err = data.SaveAlerts()
+	if err != nil {
+		LogError("Cannot save alerts", err)
+	}
+}
+
+// AckAlert acknowledges the alert with id, or all of them, so they're not
+// sent again until they clear and fire again.
+func AckAlert(data *plaid_cli.Data, id string) error {
+	if id == "all" {
+		for id, state := range data.Alerts {
+			state.Acked = true
+			data.Alerts[id] = state
+		}
+		return data.SaveAlerts()
+	}
+
+	state, ok := data.Alerts[id]
+	if !ok {
+		return errors.New(fmt.Sprintf("No alert %s, see plaid-cli alerts list", id))
+	}
+	state.Acked = true
+	data.Alerts[id] = state
+	return data.SaveAlerts()
+}
+
+// PrintAlerts lists the alerts that fired and haven't cleared.
+func PrintAlerts(data *plaid_cli.Data) {
+	var ids []string
+	for id := range data.Alerts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ALERT\tFIRED\tACKED\tMESSAGE")
+	for _, id := range ids {
+		state := data.Alerts[id]
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", id, state.FiredAt.Local().Format(time.DateTime), state.Acked, state.Message)
+	}
+	w.Flush()
+}
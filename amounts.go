@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// Plaid reports money leaving an account as positive and money coming in
+// as negative, for every account type. amounts.sign picks the convention
+// for exports and Airtable, and amounts.account_types and
+// amounts.accounts override it per account type (e.g. "credit") or per
+// account ID or alias.
+const (
+	SignPlaid = "plaid"
+	// Expenses negative, income positive
+	SignInvert = "invert"
+)
+
+// NormalizeAmounts applies the configured sign convention to txs in
+// place.
+func NormalizeAmounts(data *plaid_cli.Data, txs []Transaction) {
+	for i := range txs {
+		if amountSign(data, txs[i]) == SignInvert {
+			txs[i].Amount = -txs[i].Amount
+		}
+	}
+}
+
+func amountSign(data *plaid_cli.Data, t Transaction) string {
+	// viper lowercases map keys, so account IDs are compared case
+	// insensitively
+	for accountOrAlias, sign := range viper.GetStringMapString("amounts.accounts") {
+		if strings.EqualFold(accountOrAlias, t.AccountID) {
+			return sign
+		}
+		for alias, accountID := range data.AccountAliases {
+			if accountID == t.AccountID && strings.EqualFold(alias, accountOrAlias) {
+				return sign
+			}
+		}
+	}
+
+	if sign, ok := viper.GetStringMapString("amounts.account_types")[strings.ToLower(t.AccountType)]; ok {
+		return sign
+	}
+
+	if sign := viper.GetString("amounts.sign"); sign != "" {
+		return sign
+	}
+	return SignPlaid
+}
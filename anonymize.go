@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+func anonymizeSaltPath(dataDir string) string {
+	return filepath.Join(dataDir, "data", "anonymize_salt")
+}
+
+// AnonymizeSalt is anonymize.salt, or else a random salt generated on
+// first use and kept in the data dir, so merchant hashes stay comparable
+// between exports without being guessable.
+func AnonymizeSalt(dataDir string) (string, error) {
+	salt := viper.GetString("anonymize.salt")
+	if salt != "" {
+		return salt, nil
+	}
+
+	b, err := ioutil.ReadFile(anonymizeSaltPath(dataDir))
+	if err == nil && strings.TrimSpace(string(b)) != "" {
+		return strings.TrimSpace(string(b)), nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	random := make([]byte, 32)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	salt = hex.EncodeToString(random)
+	return salt, ioutil.WriteFile(anonymizeSaltPath(dataDir), []byte(salt+"\n"), 0600)
+}
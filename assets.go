@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// AssetReport is a report created with Plaid Assets, once ready.
+type AssetReport struct {
+	ID     string
+	Report plaid.AssetReport
+	PDF    []byte
+}
+
+// CreateAssetReport asks Plaid for an Asset Report covering the items'
+// accounts over the last days, waits until it is ready, polling every
+// interval, and downloads it as JSON and PDF.
+func CreateAssetReport(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, items []idAndAlias, days int, interval time.Duration) (AssetReport, error) {
+	// Plaid allows up to two years
+	if days < 1 || days > 731 {
+		return AssetReport{}, errors.New(fmt.Sprintf("Invalid days: %d. Plaid allows 1 to 731", days))
+	}
+
+	var tokens []string
+	for _, item := range items {
+		if item.id == sandboxItemID {
+			continue
+		}
+		tokens = append(tokens, data.Tokens[item.id])
+	}
+	if len(tokens) == 0 {
+		return AssetReport{}, errors.New("No items to report on")
+	}
+
+	created, err := client.AssetReportCreate(ctx, plaid.AssetReportCreateRequest{
+		AccessTokens:  &tokens,
+		DaysRequested: int32(days),
+	})
+	if err != nil {
+		return AssetReport{}, err
+	}
+	slog.Info("Requested asset report, waiting for it to be ready", "asset_report_id", created.AssetReportId, "items", len(tokens))
+
+	report := AssetReport{ID: created.AssetReportId}
+	for {
+		res, err := client.AssetReportGet(ctx, plaid.AssetReportGetRequest{
+			AssetReportToken: &created.AssetReportToken,
+		})
+		if err == nil {
+			report.Report = res.Report
+			break
+		}
+		if e, perr := plaid.ToPlaidError(err); perr != nil || e.ErrorCode != "PRODUCT_NOT_READY" {
+			return report, err
+		}
+		slog.Debug("Asset report isn't ready", "asset_report_id", created.AssetReportId)
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	report.PDF, err = client.AssetReportPdfGet(ctx, plaid.AssetReportPDFGetRequest{
+		AssetReportToken: created.AssetReportToken,
+	})
+	return report, err
+}
+
+// SaveAssetReport writes the report to dir as
+// asset-report-<date>-<ID>.json and .pdf, returning the paths written.
+func SaveAssetReport(dir string, report AssetReport) ([]string, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	generated := report.Report.DateGenerated
+	if generated.IsZero() {
+		generated = time.Now()
+	}
+	base := filepath.Join(dir, fmt.Sprintf("asset-report-%s-%s", generated.Format("2006-01-02"), report.ID))
+
+	b, err := json.MarshalIndent(report.Report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// The reports carry balances and account holders' details
+	err = ioutil.WriteFile(base+".json", b, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(base+".pdf", report.PDF, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return []string{base + ".json", base + ".pdf"}, nil
+}
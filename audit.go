@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+)
+
+// AuditEntry is a record changed in Airtable, as appended to
+// data/audit.jsonl. Entries of one invocation share a Run.
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Run     string    `json:"run"`
+	Command string    `json:"command"`
+	Base    string    `json:"base"`
+	airtable.Mutation
+	// Set on the entries of an undo, to the run undone
+	Undoes string `json:"undoes,omitempty"`
+	// Set on the entries of an undo, to the index of the entry reverted
+	// among the run's, so an undo that failed partway can be resumed
+	Reverts *int `json:"reverts,omitempty"`
+}
+
+// AuditLog appends every Airtable mutation to data/audit.jsonl, unless
+// audit.enabled is false. It is only ever appended to.
+type AuditLog struct {
+	path    string
+	run     string
+	command string
+	// Set while undoing a run
+	undoes  string
+	reverts *int
+
+	mu sync.Mutex
+}
+
+// auditLog is set up in main once the data directory is known.
+var auditLog *AuditLog
+
+func NewAuditLog(dataDir string) *AuditLog {
+	return &AuditLog{
+		path:    filepath.Join(dataDir, "data", "audit.jsonl"),
+		run:     time.Now().UTC().Format("20060102T150405.000Z"),
+		command: auditCommand(os.Args[1:]),
+	}
+}
+
+// auditCommand is the subcommand and its arguments, leaving out flags,
+// whose values may be secrets.
+func auditCommand(args []string) string {
+	var words []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
+
+// OnMutation is an airtable.Client OnMutation for the given base.
+func (l *AuditLog) OnMutation(base string) func(airtable.Mutation) {
+	return func(m airtable.Mutation) {
+		err := l.append(AuditEntry{
+			Time:     time.Now(),
+			Run:      l.run,
+			Command:  l.command,
+			Base:     base,
+			Mutation: m,
+			Undoes:   l.undoes,
+			Reverts:  l.reverts,
+		})
+		if err != nil {
+			LogError("Cannot write audit log", err)
+		}
+	}
+}
+
+func (l *AuditLog) append(e AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// ReadAuditLog reads every entry, oldest first.
+func ReadAuditLog(dataDir string) ([]AuditEntry, error) {
+	f, err := os.Open(filepath.Join(dataDir, "data", "audit.jsonl"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			var e AuditEntry
+			if jsonErr := json.Unmarshal(line, &e); jsonErr != nil {
+				return entries, jsonErr
+			}
+			entries = append(entries, e)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+	}
+}
+
+// AuditRun sums up a run's entries.
+type AuditRun struct {
+	Run     string
+	Time    time.Time
+	Command string
+	Created int
+	Updated int
+	Deleted int
+	// Set on undos, to the run undone
+	Undoes string
+	// Set on runs that were undone, to the undo's run
+	UndoneBy string
+	// Whether the undo failed before reverting every change
+	PartlyUndone bool
+}
+
+// AuditRuns groups entries by run, oldest first.
+func AuditRuns(entries []AuditEntry) []AuditRun {
+	byRun := make(map[string]*AuditRun)
+	var runs []*AuditRun
+	for _, e := range entries {
+		run, ok := byRun[e.Run]
+		if !ok {
+			run = &AuditRun{Run: e.Run, Time: e.Time, Command: e.Command, Undoes: e.Undoes}
+			byRun[e.Run] = run
+			runs = append(runs, run)
+		}
+		switch e.Op {
+		case airtable.OpCreate:
+			run.Created++
+		case airtable.OpUpdate:
+			run.Updated++
+		case airtable.OpDelete:
+			run.Deleted++
+		}
+	}
+
+	var ret []AuditRun
+	for _, run := range runs {
+		if undone, ok := byRun[run.Undoes]; ok {
+			undone.UndoneBy = run.Run
+		}
+	}
+	for _, run := range runs {
+		if run.UndoneBy != "" {
+			_, _, done := undoProgress(entries, run.Run)
+			run.PartlyUndone = !done
+		}
+	}
+	for _, run := range runs {
+		ret = append(ret, *run)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	return ret
+}
+
+func PrintAuditRuns(runs []AuditRun) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tTIME\tCOMMAND\tCREATED\tUPDATED\tDELETED\tNOTE")
+	for _, r := range runs {
+		note := ""
+		if r.Undoes != "" {
+			note = "undoes " + r.Undoes
+		}
+		if r.UndoneBy != "" {
+			note = "undone by " + r.UndoneBy
+		}
+		if r.PartlyUndone {
+			note = "partly undone by " + r.UndoneBy
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", r.Run, r.Time.Local().Format("2006-01-02 15:04:05"), r.Command, r.Created, r.Updated, r.Deleted, note)
+	}
+	w.Flush()
+}
+
+// PrintAuditEntries lists a run's changes, with the before and after
+// values of each changed field.
+func PrintAuditEntries(entries []AuditEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTABLE\tOP\tRECORD\tFIELD\tBEFORE\tAFTER")
+	for _, e := range entries {
+		fields := make(map[string]bool)
+		for k := range e.Before {
+			fields[k] = true
+		}
+		for k := range e.After {
+			fields[k] = true
+		}
+		var names []string
+		for k := range fields {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		time := e.Time.Local().Format("15:04:05")
+		if len(names) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\t\t\n", time, e.Table, e.Op, e.RecordID)
+		}
+		for _, name := range names {
+			before, after := auditValue(e.Before[name]), auditValue(e.After[name])
+			if e.Op == airtable.OpUpdate && before == after {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", time, e.Table, e.Op, e.RecordID, name, before, after)
+		}
+	}
+	w.Flush()
+}
+
+func auditValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// computedFieldTypes can't be written, so undoing a delete leaves them
+// out.
+var computedFieldTypes = []string{"formula", "rollup", "multipleLookupValues", "count", "createdTime", "lastModifiedTime", "autoNumber", "button", "createdBy", "lastModifiedBy"}
+
+// RunEntries are the entries of run, oldest first.
+func RunEntries(entries []AuditEntry, run string) []AuditEntry {
+	var runEntries []AuditEntry
+	for _, e := range entries {
+		if e.Run == run {
+			runEntries = append(runEntries, e)
+		}
+	}
+	return runEntries
+}
+
+// LastUndoableRun is the latest run that is neither an undo nor
+// completely undone.
+func LastUndoableRun(entries []AuditEntry) (string, bool) {
+	runs := AuditRuns(entries)
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Undoes != "" {
+			continue
+		}
+		if _, _, done := undoProgress(entries, runs[i].Run); !done {
+			return runs[i].Run, true
+		}
+	}
+	return "", false
+}
+
+// undoProgress is which of run's entries undos reverted, by index among
+// the run's entries, and the last undo. done is whether nothing is left
+// to revert. Undos logged before entries recorded what they reverted
+// count as complete.
+func undoProgress(entries []AuditEntry, run string) (reverted map[int]bool, by string, done bool) {
+	reverted = make(map[int]bool)
+	legacy := false
+	for _, e := range entries {
+		if e.Undoes != run {
+			continue
+		}
+		by = e.Run
+		if e.Reverts == nil {
+			legacy = true
+			continue
+		}
+		reverted[*e.Reverts] = true
+	}
+	if by == "" {
+		return reverted, "", false
+	}
+	if legacy {
+		return reverted, by, true
+	}
+	for i, e := range RunEntries(entries, run) {
+		if !reverted[i] && undoable(e) {
+			return reverted, by, false
+		}
+	}
+	return reverted, by, true
+}
+
+// RecreatedRecords is how many records undoing a run with entries
+// creates again, under new IDs.
+func RecreatedRecords(entries []AuditEntry) int {
+	n := 0
+	for _, e := range entries {
+		if e.Op == airtable.OpDelete {
+			n++
+		}
+	}
+	return n
+}
+
+// undoable is whether UndoRun can revert e. Updates logged by an upsert
+// have no previous values to set back.
+func undoable(e AuditEntry) bool {
+	return e.Op != airtable.OpUpdate || e.Before != nil
+}
+
+// changedLater are the records of run that later runs changed again,
+// whose changes undoing run would overwrite.
+func changedLater(entries []AuditEntry, run string) []string {
+	records := make(map[string]bool)
+	seen := make(map[string]bool)
+	var changed []string
+	after := false
+	for _, e := range entries {
+		if e.Run == run {
+			records[e.Table+"/"+e.RecordID] = true
+			after = true
+			continue
+		}
+		key := e.Table + "/" + e.RecordID
+		if after && e.Undoes != run && records[key] && !seen[key] {
+			seen[key] = true
+			changed = append(changed, e.RecordID)
+		}
+	}
+	return changed
+}
+
+// UndoRun reverts a run's changes, newest first: created records are
+// deleted, updated fields are set back and deleted records are created
+// again from their logged fields, under new record IDs. The undo is
+// itself a logged run, and undoing a run again after a failure picks up
+// with the changes not reverted yet. Runs against another base than the
+// current one can't be undone, nor, unless force, runs whose records were
+// changed again since.
+func UndoRun(entries []AuditEntry, run string, force bool) (int, error) {
+	reverted, by, done := undoProgress(entries, run)
+	if done {
+		return 0, errors.New(fmt.Sprintf("Run %s was already undone by %s", run, by))
+	}
+	if by != "" {
+		slog.Info("Resuming undo", "run", run, "undo", by, "reverted", len(reverted))
+	}
+	runEntries := RunEntries(entries, run)
+	if len(runEntries) == 0 {
+		return 0, errors.New(fmt.Sprintf("No changes recorded for run %s", run))
+	}
+	for _, e := range runEntries {
+		if e.Base != AirtableBaseID() {
+			return 0, errors.New(fmt.Sprintf("Run %s changed base %s, not the current base %s", run, e.Base, AirtableBaseID()))
+		}
+	}
+	if changed := changedLater(entries, run); len(changed) > 0 && !force {
+		return 0, errors.New(fmt.Sprintf("%d records of run %s were changed by later runs, e.g. %s; undo those first or pass --force", len(changed), run, changed[0]))
+	}
+
+	if auditLog != nil {
+		auditLog.undoes = run
+		defer func() {
+			auditLog.undoes = ""
+			auditLog.reverts = nil
+		}()
+	}
+
+	computed, err := computedFields()
+	if err != nil {
+		LogError("Cannot read the base schema, restoring all fields of deleted records", err)
+	}
+
+	client := NewAirtableClient()
+	undone := 0
+	for i := len(runEntries) - 1; i >= 0; i-- {
+		e := runEntries[i]
+		if reverted[i] {
+			continue
+		}
+		if !undoable(e) {
+			LogError("Cannot undo an upsert update, skipping", nil, "table", e.Table, "record", e.RecordID)
+			continue
+		}
+		if auditLog != nil {
+			index := i
+			auditLog.reverts = &index
+		}
+		table := client.Table(e.Table)
+		var err error
+		switch e.Op {
+		case airtable.OpCreate:
+			err = table.Delete(&FieldRecord{Record: airtable.Record{ID: e.RecordID}, Fields: map[string]interface{}{}})
+		case airtable.OpUpdate:
+			err = table.Update(&FieldRecord{Record: airtable.Record{ID: e.RecordID}, Fields: e.Before, Typecast: true})
+		case airtable.OpDelete:
+			fields := make(map[string]interface{})
+			for k, v := range e.Before {
+				if !computed[e.Table][k] {
+					fields[k] = v
+				}
+			}
+			err = table.Create(&FieldRecord{Fields: fields, Typecast: true})
+		}
+		if err != nil {
+			return undone, errors.New(fmt.Sprintf("Cannot undo %s of %s in %s: %s", e.Op, e.RecordID, e.Table, err))
+		}
+		undone++
+	}
+	return undone, nil
+}
+
+// computedFields are the computed fields per table, from the Metadata
+// API.
+func computedFields() (map[string]map[string]bool, error) {
+	var schema struct {
+		Tables []struct {
+			Name   string `json:"name"`
+			Fields []struct {
+				Name string `json:"name"`
+				Type string `json:"type"`
+			} `json:"fields"`
+		} `json:"tables"`
+	}
+	err := airtableMeta(fmt.Sprintf("bases/%s/tables", AirtableBaseID()), &schema)
+	if err != nil {
+		return nil, err
+	}
+
+	computed := make(map[string]map[string]bool)
+	for _, t := range schema.Tables {
+		computed[t.Name] = make(map[string]bool)
+		for _, f := range t.Fields {
+			computed[t.Name][f.Name] = contains(computedFieldTypes, f.Type)
+		}
+	}
+	return computed, nil
+}
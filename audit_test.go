@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+)
+
+func auditEntry(run string, op string, recordID string, before map[string]interface{}) AuditEntry {
+	return AuditEntry{
+		Run:  run,
+		Base: "app1",
+		Mutation: airtable.Mutation{
+			Op:       op,
+			Table:    "Transactions",
+			RecordID: recordID,
+			Before:   before,
+		},
+	}
+}
+
+// undoEntry is an entry of undo run u reverting the entry at index of
+// run.
+func undoEntry(u string, run string, index int) AuditEntry {
+	e := auditEntry(u, airtable.OpUpdate, fmt.Sprintf("rec%d", index), nil)
+	e.Undoes = run
+	e.Reverts = &index
+	return e
+}
+
+// runEntries are run r1: a create, an update, a delete and an upsert's
+// update, which has no previous values to undo.
+func runEntries() []AuditEntry {
+	return []AuditEntry{
+		auditEntry("r1", airtable.OpCreate, "rec1", nil),
+		auditEntry("r1", airtable.OpUpdate, "rec2", map[string]interface{}{"Name": "old"}),
+		auditEntry("r1", airtable.OpDelete, "rec3", map[string]interface{}{"Name": "gone", "Total": 5.0}),
+		auditEntry("r1", airtable.OpUpdate, "rec4", nil),
+	}
+}
+
+func TestUndoProgress(t *testing.T) {
+	legacy := auditEntry("u1", airtable.OpDelete, "rec1", nil)
+	legacy.Undoes = "r1"
+
+	tests := []struct {
+		name     string
+		undos    []AuditEntry
+		reverted []int
+		by       string
+		done     bool
+	}{
+		{name: "not undone"},
+		{name: "partly undone", undos: []AuditEntry{undoEntry("u1", "r1", 2)}, reverted: []int{2}, by: "u1"},
+		{name: "undone but the upsert", undos: []AuditEntry{undoEntry("u1", "r1", 2), undoEntry("u1", "r1", 1), undoEntry("u1", "r1", 0)}, reverted: []int{0, 1, 2}, by: "u1", done: true},
+		{name: "resumed by a second undo", undos: []AuditEntry{undoEntry("u1", "r1", 2), undoEntry("u2", "r1", 1), undoEntry("u2", "r1", 0)}, reverted: []int{0, 1, 2}, by: "u2", done: true},
+		{name: "undo of another run", undos: []AuditEntry{undoEntry("u1", "r0", 0)}},
+		// Logged before undos recorded what they reverted
+		{name: "legacy undo", undos: []AuditEntry{legacy}, by: "u1", done: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reverted, by, done := undoProgress(append(runEntries(), tt.undos...), "r1")
+			if by != tt.by || done != tt.done {
+				t.Errorf("by = %q, done = %v, want %q, %v", by, done, tt.by, tt.done)
+			}
+			if len(reverted) != len(tt.reverted) {
+				t.Fatalf("reverted = %v, want %v", reverted, tt.reverted)
+			}
+			for _, i := range tt.reverted {
+				if !reverted[i] {
+					t.Errorf("reverted = %v, want %v", reverted, tt.reverted)
+				}
+			}
+		})
+	}
+}
+
+func TestUndoRun(t *testing.T) {
+	later := auditEntry("r2", airtable.OpUpdate, "rec2", map[string]interface{}{"Name": "new"})
+
+	tests := []struct {
+		name    string
+		extra   []AuditEntry
+		base    string
+		force   bool
+		fail    string
+		undone  int
+		wantErr string
+		// Writes, newest change first, as "<op> <record>"
+		calls []string
+	}{
+		{
+			name:   "whole run",
+			undone: 3,
+			calls:  []string{"create ", "update rec2", "delete rec1"},
+		},
+		{
+			name:   "resumed",
+			extra:  []AuditEntry{undoEntry("u1", "r1", 2)},
+			undone: 2,
+			calls:  []string{"update rec2", "delete rec1"},
+		},
+		{
+			name:    "already undone",
+			extra:   []AuditEntry{undoEntry("u1", "r1", 2), undoEntry("u1", "r1", 1), undoEntry("u1", "r1", 0)},
+			wantErr: "already undone by u1",
+		},
+		{
+			name:    "fails partway",
+			fail:    "rec2",
+			undone:  1,
+			wantErr: "Cannot undo update of rec2",
+			calls:   []string{"create "},
+		},
+		{
+			name:    "another base",
+			base:    "app2",
+			wantErr: "not the current base app2",
+		},
+		{
+			name:    "changed by a later run",
+			extra:   []AuditEntry{later},
+			wantErr: "1 records of run r1 were changed by later runs, e.g. rec2",
+		},
+		{
+			name:   "changed by a later run, forced",
+			extra:  []AuditEntry{later},
+			force:  true,
+			undone: 3,
+			calls:  []string{"create ", "update rec2", "delete rec1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := tt.base
+			if base == "" {
+				base = "app1"
+			}
+			setConfig(t, "airtable.base_id", base)
+
+			fake := useFakeAirtable(t)
+			fake.MetaResponses["bases/"+base+"/tables"] = map[string]interface{}{
+				"tables": []map[string]interface{}{{
+					"name": "Transactions",
+					"fields": []map[string]string{
+						{"name": "Name", "type": "singleLineText"},
+						{"name": "Total", "type": "formula"},
+					},
+				}},
+			}
+			table := fake.Table("Transactions")
+			table.Records = []fakeRecord{
+				{ID: "rec1", Fields: map[string]interface{}{"Name": "created"}},
+				{ID: "rec2", Fields: map[string]interface{}{"Name": "new"}},
+				{ID: "rec4", Fields: map[string]interface{}{"Name": "upserted"}},
+			}
+			if tt.fail != "" {
+				table.fail = map[string]error{tt.fail: errors.New("rate limited")}
+			}
+
+			undone, err := UndoRun(append(runEntries(), tt.extra...), "r1", tt.force)
+			if undone != tt.undone {
+				t.Errorf("undone = %d, want %d", undone, tt.undone)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var calls []string
+			for _, c := range table.Calls {
+				calls = append(calls, c.Op+" "+c.ID)
+			}
+			if strings.Join(calls, ", ") != strings.Join(tt.calls, ", ") {
+				t.Errorf("calls = %q, want %q", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestUndoRunRecreatesWithoutComputedFields(t *testing.T) {
+	setConfig(t, "airtable.base_id", "app1")
+	fake := useFakeAirtable(t)
+	fake.MetaResponses["bases/app1/tables"] = map[string]interface{}{
+		"tables": []map[string]interface{}{{
+			"name":   "Transactions",
+			"fields": []map[string]string{{"name": "Name", "type": "singleLineText"}, {"name": "Total", "type": "formula"}},
+		}},
+	}
+	table := fake.Table("Transactions")
+
+	entries := []AuditEntry{auditEntry("r1", airtable.OpDelete, "rec3", map[string]interface{}{"Name": "gone", "Total": 5.0})}
+	_, err := UndoRun(entries, "r1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.Calls) != 1 {
+		t.Fatalf("calls = %+v, want one create", table.Calls)
+	}
+	fields := table.Calls[0].Fields
+	if fields["Name"] != "gone" || fields["Total"] != nil {
+		t.Errorf("recreated with %v, want Name and not the Total formula", fields)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// AccountNumbers are the numbers to pay into an account, from /auth/get.
+// They are only printed, never written to disk or Airtable.
+type AccountNumbers struct {
+	ItemID    string
+	AccountID string
+	Account   string
+	// ACH, EFT, IBAN or BACS
+	Kind   string
+	Number string
+	// Routing number, institution and branch number, BIC or sort code
+	Routing     string
+	WireRouting string
+}
+
+func FetchAuth(ctx context.Context, client plaid_cli.PlaidClient, accessToken string) ([]AccountNumbers, error) {
+	res, err := client.AuthGet(ctx, plaid.AuthGetRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)
+	for _, a := range plaid_cli.AccountsFromPlaid(res.Accounts) {
+		names[a.ID] = a.DisplayName()
+	}
+
+	var numbers []AccountNumbers
+	add := func(accountID, kind, number, routing, wireRouting string) {
+		numbers = append(numbers, AccountNumbers{
+			ItemID:      res.Item.ItemId,
+			AccountID:   accountID,
+			Account:     names[accountID],
+			Kind:        kind,
+			Number:      number,
+			Routing:     routing,
+			WireRouting: wireRouting,
+		})
+	}
+	for _, n := range res.Numbers.Ach {
+		add(n.AccountId, "ACH", n.Account, n.Routing, n.GetWireRouting())
+	}
+	for _, n := range res.Numbers.Eft {
+		add(n.AccountId, "EFT", n.Account, n.Institution+"-"+n.Branch, "")
+	}
+	for _, n := range res.Numbers.International {
+		add(n.AccountId, "IBAN", n.Iban, n.Bic, "")
+	}
+	for _, n := range res.Numbers.Bacs {
+		add(n.AccountId, "BACS", n.Account, n.SortCode, "")
+	}
+	return numbers, nil
+}
+
+// FetchAllAuth fetches account numbers for each item, relinking as
+// needed. Items that fail, e.g. because Auth isn't enabled for them, are
+// logged and skipped.
+func FetchAllAuth(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, linker *plaid_cli.Linker, items []idAndAlias) []AccountNumbers {
+	var allNumbers []AccountNumbers
+	for _, item := range items {
+		if item.id == sandboxItemID {
+			continue
+		}
+		err := WithRelinkOnAuthError(ctx, item, data, linker, func() error {
+			numbers, err := FetchAuth(ctx, client, data.Tokens[item.id])
+			if err != nil {
+				return err
+			}
+
+			allNumbers = append(allNumbers, numbers...)
+			return nil
+		})
+		if err != nil {
+			ItemFailed("Cannot fetch account numbers", err, ItemLabel(data, item.id))
+		} else {
+			ItemSucceeded(ItemLabel(data, item.id))
+		}
+	}
+	return allNumbers
+}
+
+// PrintAuthTable prints account numbers, masked to their last four
+// digits unless reveal is set. Routing numbers are public and shown as is.
+func PrintAuthTable(data *plaid_cli.Data, numbers []AccountNumbers, reveal bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTITUTION\tACCOUNT\tTYPE\tNUMBER\tROUTING\tWIRE ROUTING")
+	for _, n := range numbers {
+		number := n.Number
+		if !reveal {
+			number = maskNumber(number)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			ItemLabel(data, n.ItemID),
+			n.Account,
+			n.Kind,
+			number,
+			n.Routing,
+			n.WireRouting,
+		)
+	}
+	w.Flush()
+}
+
+func maskNumber(number string) string {
+	if len(number) <= 4 {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
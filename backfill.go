@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/pipeline"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/spf13/viper"
+)
+
+type BackfillOptions struct {
+	// The oldest date to sync
+	From time.Time
+	// Months per chunk
+	Months int
+	// Wait between chunks, to stay under Plaid's rate limits
+	Delay time.Duration
+	// Start over instead of resuming from the checkpoint
+	Restart bool
+}
+
+// Backfill syncs an item's transactions from opts.From to today into
+// Airtable, one chunk of opts.Months at a time walking back from today,
+// so institutions that time out on long date ranges can still be
+// backfilled. After each chunk the progress is checkpointed in
+// data.Backfills, and a later backfill with the same From resumes after
+// the last synced chunk. Like an import, a backfill never deletes.
+func Backfill(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, linker *plaid_cli.Linker, item idAndAlias, existing []TransactionRecord, summary *RunSummary, opts BackfillOptions) error {
+	label := ItemLabel(data, item.id)
+	if opts.Months < 1 {
+		return errors.New(fmt.Sprintf("Invalid chunk size: %d months", opts.Months))
+	}
+
+	rates, err := NewRatesProvider()
+	if err != nil {
+		return err
+	}
+	names, err := NewNameNormalizer()
+	if err != nil {
+		return err
+	}
+	fields, err := LoadFieldCache(data.DataDir)
+	if err != nil {
+		return err
+	}
+
+	from := opts.From.Format(DateLayout)
+	checkpoint, ok := data.Backfills[item.id]
+	if ok && checkpoint.From == from && !opts.Restart {
+		slog.Info("Resuming backfill", "item", label, "synced_from", checkpoint.SyncedFrom)
+	} else {
+		now := time.Now()
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)
+		checkpoint = plaid_cli.Backfill{From: from, SyncedFrom: tomorrow.Format(DateLayout)}
+	}
+
+	end, err := time.ParseInLocation(DateLayout, checkpoint.SyncedFrom, time.Local)
+	if err != nil {
+		return err
+	}
+	for end.After(opts.From) {
+		start := end.AddDate(0, -opts.Months, 0)
+		if start.Before(opts.From) {
+			start = opts.From
+		}
+		last := end.AddDate(0, 0, -1)
+
+		var txs []Transaction
+		downloaded := false
+		err := WithRelinkOnAuthError(ctx, item, data, linker, func() error {
+			return withBackoff(ctx, label, func() error {
+				req := transactionsRequest(data.Tokens[item.id], nil, start, last)
+				var err error
+				txs, err = pipeline.AllTransactions(ctx, req, client, nil)
+				downloaded = err == nil
+				return err
+			})
+		})
+		if err == nil && !downloaded {
+			err = errors.New("Plaid didn't return the chunk's transactions, see the warning above")
+		}
+		if err != nil {
+			return fmt.Errorf("%s to %s: %w", start.Format(DateLayout), last.Format(DateLayout), err)
+		}
+
+		err = prepareTransactions(data, txs, rates, names, fields)
+		if err != nil {
+			return err
+		}
+		txs = WithoutIgnoredAccounts(data, txs)
+		slog.Info("Syncing backfilled transactions", "item", label, "from", start.Format(DateLayout), "to", last.Format(DateLayout), "count", len(txs))
+		err = Sync(txs, existing, summary, SyncOptions{DeleteCutoff: noDeleteCutoff})
+		if err != nil {
+			return err
+		}
+
+		checkpoint.SyncedFrom = start.Format(DateLayout)
+		checkpoint.UpdatedAt = time.Now()
+		data.Backfills[item.id] = checkpoint
+		err = data.SaveBackfills()
+		if err != nil {
+			return err
+		}
+
+		end = start
+		if end.After(opts.From) && opts.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(opts.Delay):
+			}
+		}
+	}
+
+	slog.Info("Backfill complete", "item", label, "from", from)
+	delete(data.Backfills, item.id)
+	return data.SaveBackfills()
+}
+
+// withBackoff runs action, retrying when Plaid rate limits it or it fails
+// without a Plaid error, e.g. on a timeout. It waits recovery.retry_delay,
+// doubling each time, up to recovery.retries times.
+func withBackoff(ctx context.Context, label string, action func() error) error {
+	delay := viper.GetDuration("recovery.retry_delay")
+	for retries := 0; ; retries++ {
+		err := action()
+		if err == nil || retries >= viper.GetInt("recovery.retries") || ctx.Err() != nil {
+			return err
+		}
+		e, perr := plaid.ToPlaidError(err)
+		if perr == nil && e.ErrorType != plaid.PLAIDERRORTYPE_RATE_LIMIT_EXCEEDED {
+			return err
+		}
+
+		slog.Info("Request failed, retrying", "item", label, "error", err, "retry", retries+1, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// Encrypted backups start with this header, followed by the salt, the
+// nonce and the AES-GCM sealed tar.gz.
+const backupMagic = "PLAIDCLI-ENC1"
+
+const (
+	backupSaltSize   = 16
+	backupIterations = 600000
+)
+
+// CreateBackup packages the data files and the config file (if any) into
+// a tar.gz, encrypting it when passphrase is non-empty.
+func CreateBackup(dataDir string, configFile string, passphrase string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	files, err := ioutil.ReadDir(filepath.Join(dataDir, "data"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		// Skip the lock files and in-flight temp files
+		if f.IsDir() || f.Name() == plaid_cli.RunLockFile || strings.HasPrefix(f.Name(), ".") || strings.Contains(f.Name(), ".tmp") {
+			continue
+		}
+		err = addToBackup(tw, filepath.Join(dataDir, "data", f.Name()), filepath.Join("data", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if configFile != "" {
+		err = addToBackup(tw, configFile, filepath.Base(configFile))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if passphrase == "" {
+		return buf.Bytes(), nil
+	}
+	return encryptBackup(buf.Bytes(), passphrase)
+}
+
+func addToBackup(tw *tar.Writer, path string, name string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0600,
+		Size: int64(len(b)),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(b)
+	return err
+}
+
+// RestoreBackup unpacks a backup created by CreateBackup into dataDir.
+func RestoreBackup(b []byte, dataDir string, passphrase func() (string, error)) error {
+	if IsEncryptedBackup(b) {
+		p, err := passphrase()
+		if err != nil {
+			return err
+		}
+		b, err = decryptBackup(b, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(hdr.Name)
+		if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return errors.New(fmt.Sprintf("Refusing to restore %s outside of the data dir", hdr.Name))
+		}
+		// Older backups have the run lock, which restore itself holds
+		if name == filepath.Join("data", plaid_cli.RunLockFile) {
+			continue
+		}
+
+		target := filepath.Join(dataDir, name)
+		err = os.MkdirAll(filepath.Dir(target), os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		contents, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(target, contents, 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func IsEncryptedBackup(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(backupMagic))
+}
+
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, backupIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encryptBackup(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, backupSaltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(backupMagic), salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+func decryptBackup(b []byte, passphrase string) ([]byte, error) {
+	b = b[len(backupMagic):]
+	if len(b) < backupSaltSize {
+		return nil, errors.New("Backup is truncated")
+	}
+	salt, b := b[:backupSaltSize], b[backupSaltSize:]
+
+	gcm, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < gcm.NonceSize() {
+		return nil, errors.New("Backup is truncated")
+	}
+	nonce, b := b[:gcm.NonceSize()], b[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, b, nil)
+	if err != nil {
+		return nil, errors.New("Cannot decrypt backup. Wrong passphrase?")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// tarGz packs files, by name, as CreateBackup does.
+func tarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(files[name]))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(files[name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func noPassphrase() (string, error) {
+	return "", errors.New("not encrypted")
+}
+
+func TestRestoreBackupPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+		// Where the file ends up, relative to the data dir; nowhere when
+		// empty
+		want string
+	}{
+		{name: "data file", file: "data/tokens.json", want: "data/tokens.json"},
+		{name: "config file", file: "config.toml", want: "config.toml"},
+		{name: "parent directory", file: "../evil", wantErr: true},
+		{name: "parent directory after cleaning", file: "data/../../evil", wantErr: true},
+		{name: "absolute path", file: "/tmp/evil", wantErr: true},
+		{name: "cleaned into the data dir", file: "data/../tokens.json", want: "tokens.json"},
+		// Restore holds the run lock itself
+		{name: "run lock from an older backup", file: "data/run.lock"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			err := RestoreBackup(tarGz(t, map[string]string{tt.file: "contents"}), dataDir, noPassphrase)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				if !strings.Contains(err.Error(), "outside of the data dir") {
+					t.Errorf("err = %v, want a refusal", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					rel, _ := filepath.Rel(dataDir, path)
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return nil
+			})
+			if tt.want == "" {
+				if len(got) > 0 {
+					t.Errorf("restored %v, want nothing", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("restored %v, want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreBackupKeepsRunLock(t *testing.T) {
+	dataDir := t.TempDir()
+	lock := filepath.Join(dataDir, "data", "run.lock")
+	if err := os.MkdirAll(filepath.Dir(lock), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(lock, []byte("mine"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := RestoreBackup(tarGz(t, map[string]string{"data/run.lock": "theirs", "data/tokens.json": "{}"}), dataDir, noPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(lock); string(b) != "mine" {
+		t.Errorf("run.lock = %q, want it untouched", b)
+	}
+}
+
+func TestCreateBackupSkipsLockAndTempFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	for _, name := range []string{"tokens.json", "run.lock", ".lock", "tokens.json.tmp123"} {
+		path := filepath.Join(dataDir, "data", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := CreateBackup(dataDir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != 1 || names[0] != filepath.Join("data", "tokens.json") {
+		t.Errorf("backed up %v, want only data/tokens.json", names)
+	}
+}
+
+func TestDecryptBackup(t *testing.T) {
+	plaintext := []byte("a tar.gz")
+	encrypted, err := encryptBackup(plaintext, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedBackup(encrypted) {
+		t.Fatal("encrypted backup lacks the header")
+	}
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name       string
+		b          []byte
+		passphrase string
+		wantErr    string
+	}{
+		{name: "right passphrase", b: encrypted, passphrase: "correct horse"},
+		{name: "wrong passphrase", b: encrypted, passphrase: "battery staple", wantErr: "Wrong passphrase"},
+		{name: "tampered", b: tampered, passphrase: "correct horse", wantErr: "Wrong passphrase"},
+		{name: "no salt", b: []byte(backupMagic + "short"), passphrase: "correct horse", wantErr: "truncated"},
+		{name: "no nonce", b: encrypted[:len(backupMagic)+backupSaltSize+4], passphrase: "correct horse", wantErr: "truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptBackup(tt.b, tt.passphrase)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("got %q, want %q", got, plaintext)
+			}
+		})
+	}
+}
+
+func TestRestoreEncryptedBackup(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "data", "tokens.json"), []byte(`{"item":"token"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := CreateBackup(src, "", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	err = RestoreBackup(b, dst, func() (string, error) { return "correct horse", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dst, "data", "tokens.json"))
+	if err != nil || string(got) != `{"item":"token"}` {
+		t.Errorf("tokens.json = %q, %v", got, err)
+	}
+}
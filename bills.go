@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/ics"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// Plaid error codes for items without Liabilities, which just have no
+// due dates
+var liabilitiesUnavailableCodes = []string{
+	"PRODUCTS_NOT_SUPPORTED",
+	"PRODUCT_NOT_ENABLED",
+	"ADDITIONAL_CONSENT_REQUIRED",
+	"NO_LIABILITY_ACCOUNTS",
+	"INVALID_PRODUCT",
+}
+
+// Bill is an expected bill, paycheck or loan payment.
+type Bill struct {
+	ID      string
+	Date    time.Time
+	Account string
+	// e.g. "Netflix" or "Minimum payment"
+	Name string
+	// Unknown for some loans
+	Amount   *float64
+	Currency string
+	// Money coming in, e.g. a paycheck
+	Income bool
+	// e.g. "Monthly", or "Due date" for loans and cards
+	Frequency string
+}
+
+// FetchBills projects the recurring streams Plaid detected in each item's
+// transactions, and the due dates of its credit cards and loans, from
+// today until until. Items that fail are logged and skipped.
+func FetchBills(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, linker *plaid_cli.Linker, items []idAndAlias, until time.Time) []Bill {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	var bills []Bill
+	for _, item := range items {
+		if item.id == sandboxItemID {
+			continue
+		}
+		err := WithRelinkOnAuthError(ctx, item, data, linker, func() error {
+			itemBills, err := fetchItemBills(ctx, client, data, item, today, until)
+			if err != nil {
+				return err
+			}
+			bills = append(bills, itemBills...)
+			return nil
+		})
+		if err != nil {
+			ItemFailed("Cannot fetch recurring transactions", err, ItemLabel(data, item.id))
+		} else {
+			ItemSucceeded(ItemLabel(data, item.id))
+		}
+	}
+
+	sort.SliceStable(bills, func(i, j int) bool {
+		if !bills[i].Date.Equal(bills[j].Date) {
+			return bills[i].Date.Before(bills[j].Date)
+		}
+		return bills[i].Name < bills[j].Name
+	})
+	return bills
+}
+
+func fetchItemBills(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, item idAndAlias, from time.Time, until time.Time) ([]Bill, error) {
+	accessToken := data.Tokens[item.id]
+	accounts, err := FetchAccounts(ctx, client, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	for _, a := range accounts {
+		names[a.ID] = a.DisplayName()
+	}
+
+	res, err := client.TransactionsRecurringGet(ctx, plaid.TransactionsRecurringGetRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var bills []Bill
+	for _, s := range res.OutflowStreams {
+		bills = append(bills, projectStream(s, names[s.AccountId], false, from, until)...)
+	}
+	for _, s := range res.InflowStreams {
+		bills = append(bills, projectStream(s, names[s.AccountId], true, from, until)...)
+	}
+
+	liabilities, err := client.LiabilitiesGet(ctx, plaid.LiabilitiesGetRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		if e, perr := plaid.ToPlaidError(err); perr == nil && contains(liabilitiesUnavailableCodes, e.ErrorCode) {
+			slog.Debug("No liabilities", "item", ItemLabel(data, item.id), "plaid_error_code", e.ErrorCode)
+			return bills, nil
+		}
+		return nil, err
+	}
+	currencies := make(map[string]string)
+	for _, a := range plaid_cli.AccountsFromPlaid(liabilities.Accounts) {
+		currencies[a.ID] = a.Balances.IsoCurrencyCode
+	}
+	due := func(accountID string, date plaid.NullableString, amount plaid.NullableFloat64, name string) {
+		if date.Get() == nil {
+			return
+		}
+		d, err := time.ParseInLocation(DateLayout, *date.Get(), time.Local)
+		if err != nil || d.Before(from) || d.After(until) {
+			return
+		}
+		bills = append(bills, Bill{
+			ID:        fmt.Sprintf("due-%s-%s", accountID, d.Format(DateLayout)),
+			Date:      d,
+			Account:   names[accountID],
+			Name:      name,
+			Amount:    amount.Get(),
+			Currency:  currencies[accountID],
+			Frequency: "Due date",
+		})
+	}
+	for _, l := range liabilities.Liabilities.Credit {
+		due(l.GetAccountId(), l.NextPaymentDueDate, l.MinimumPaymentAmount, "Minimum payment")
+	}
+	for _, l := range liabilities.Liabilities.Student {
+		due(l.GetAccountId(), l.NextPaymentDueDate, l.MinimumPaymentAmount, "Minimum payment")
+	}
+	for _, l := range liabilities.Liabilities.Mortgage {
+		due(l.AccountId, l.NextPaymentDueDate, l.NextMonthlyPayment, "Mortgage payment")
+	}
+	return bills, nil
+}
+
+// projectStream is the occurrences of an active recurring stream from
+// from until until, continuing from its last transaction.
+func projectStream(s plaid.TransactionStream, account string, income bool, from time.Time, until time.Time) []Bill {
+	if !s.IsActive || s.Status == plaid.TRANSACTIONSTREAMSTATUS_TOMBSTONED {
+		return nil
+	}
+	last, err := time.ParseInLocation(DateLayout, s.LastDate, time.Local)
+	if err != nil {
+		return nil
+	}
+
+	// The nth occurrence after the last transaction
+	var next func(n int) time.Time
+	var frequency string
+	switch s.Frequency {
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_WEEKLY:
+		next = func(n int) time.Time { return last.AddDate(0, 0, 7*n) }
+		frequency = "Weekly"
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_BIWEEKLY:
+		next = func(n int) time.Time { return last.AddDate(0, 0, 14*n) }
+		frequency = "Every two weeks"
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_SEMI_MONTHLY:
+		// Alternating between the last day and 15 days later, e.g. the
+		// 1st and 16th
+		next = func(n int) time.Time {
+			if n%2 == 1 {
+				return last.AddDate(0, n/2, 15)
+			}
+			return last.AddDate(0, n/2, 0)
+		}
+		frequency = "Twice a month"
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_MONTHLY:
+		next = func(n int) time.Time { return last.AddDate(0, n, 0) }
+		frequency = "Monthly"
+	case plaid.RECURRINGTRANSACTIONFREQUENCY_ANNUALLY:
+		next = func(n int) time.Time { return last.AddDate(n, 0, 0) }
+		frequency = "Yearly"
+	default:
+		return nil
+	}
+
+	name := s.GetMerchantName()
+	if name == "" {
+		name = s.Description
+	}
+	amount := math.Abs(s.AverageAmount.GetAmount())
+	currency := s.AverageAmount.GetIsoCurrencyCode()
+
+	var bills []Bill
+	for n := 1; !next(n).After(until); n++ {
+		d := next(n)
+		if d.Before(from) {
+			continue
+		}
+		bills = append(bills, Bill{
+			ID:        fmt.Sprintf("%s-%s", s.StreamId, d.Format(DateLayout)),
+			Date:      d,
+			Account:   account,
+			Name:      name,
+			Amount:    &amount,
+			Currency:  currency,
+			Income:    income,
+			Frequency: frequency,
+		})
+	}
+	return bills
+}
+
+// BillEvents are bills as calendar events.
+func BillEvents(bills []Bill) []ics.Event {
+	var events []ics.Event
+	for _, b := range bills {
+		summary := b.Name
+		if b.Amount != nil {
+			summary += " " + formatBalance(b.Amount, b.Currency)
+		}
+		if b.Income {
+			summary = "+ " + summary
+		}
+		events = append(events, ics.Event{
+			UID:         b.ID + "@plaid-cli",
+			Date:        b.Date,
+			Summary:     summary,
+			Description: fmt.Sprintf("%s\n%s", b.Frequency, b.Account),
+		})
+	}
+	return events
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// CashFlow is the money in and out of an account over a month, leaving
+// out transfers between your own accounts.
+type CashFlow struct {
+	Month     string  `json:"month"`
+	AccountID string  `json:"account_id"`
+	Account   string  `json:"account"`
+	Income    float64 `json:"income"`
+	Spending  float64 `json:"spending"`
+	Net       float64 `json:"net"`
+}
+
+// NewCashFlow sums txs per month and account, by month then account name.
+// Transfers found by DetectTransfers and pending transactions are left
+// out. accountNames maps account IDs to the names to show.
+func NewCashFlow(data *plaid_cli.Data, txs []Transaction, window time.Duration, accountNames map[string]string) []CashFlow {
+	transfers := make(map[string]bool)
+	for _, p := range DetectTransfers(txs, window) {
+		transfers[p.A.ID] = true
+		transfers[p.B.ID] = true
+	}
+
+	byKey := make(map[string]*CashFlow)
+	for _, t := range txs {
+		if t.Pending || transfers[t.ID] || len(t.Date) < 7 {
+			continue
+		}
+		key := t.Date[:7] + "/" + t.AccountID
+		flow, ok := byKey[key]
+		if !ok {
+			name, ok := accountNames[t.AccountID]
+			if !ok {
+				name = AccountLabel(data, t.AccountID)
+			}
+			flow = &CashFlow{Month: t.Date[:7], AccountID: t.AccountID, Account: name}
+			byKey[key] = flow
+		}
+		flow.Spending += outflow(data, t)
+		flow.Income += inflow(data, t)
+	}
+
+	var flows []CashFlow
+	for _, flow := range byKey {
+		flow.Income = roundCents(flow.Income)
+		flow.Spending = roundCents(flow.Spending)
+		flow.Net = roundCents(flow.Income - flow.Spending)
+		flows = append(flows, *flow)
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		if flows[i].Month != flows[j].Month {
+			return flows[i].Month < flows[j].Month
+		}
+		return flows[i].Account < flows[j].Account
+	})
+	return flows
+}
+
+// inflow is how much money t brought into its account, whatever the sign
+// convention, or 0 for money going out.
+func inflow(data *plaid_cli.Data, t Transaction) float64 {
+	t.Amount = -t.Amount
+	return outflow(data, t)
+}
+
+func roundCents(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// WriteCashFlow writes flows as a table with a total per month, or as CSV
+// or JSON with just the per-account rows.
+func WriteCashFlow(w io.Writer, flows []CashFlow, format string) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "MONTH\tACCOUNT\tINCOME\tSPENDING\tNET")
+		var total CashFlow
+		for i, f := range flows {
+			fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%.2f\n", f.Month, f.Account, f.Income, f.Spending, f.Net)
+			total.Income += f.Income
+			total.Spending += f.Spending
+			total.Net += f.Net
+			if i == len(flows)-1 || flows[i+1].Month != f.Month {
+				fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%.2f\n", f.Month, "Total", total.Income, total.Spending, total.Net)
+				total = CashFlow{}
+			}
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"month", "account_id", "account", "income", "spending", "net"})
+		for _, f := range flows {
+			cw.Write([]string{
+				f.Month,
+				f.AccountID,
+				f.Account,
+				strconv.FormatFloat(f.Income, 'f', 2, 64),
+				strconv.FormatFloat(f.Spending, 'f', 2, 64),
+				strconv.FormatFloat(f.Net, 'f', 2, 64),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		if flows == nil {
+			flows = []CashFlow{}
+		}
+		b, err := json.MarshalIndent(flows, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	default:
+		return errors.New(fmt.Sprintf("Invalid output format: %s (table, csv or json)", format))
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// The Categories table is what CategoryLookup links to. `categories
+// sync` keeps a record per category of a Plaid taxonomy in it, matched on
+// CategoryID, and leaves categories added by hand (e.g. by splits) alone.
+
+// Plaid only publishes the personal finance category taxonomy as a CSV
+const pfcTaxonomyURL = "https://plaid.com/documents/transactions-personal-finance-category-taxonomy.csv"
+
+// Category is one category of a Plaid taxonomy.
+type Category struct {
+	// The detailed category for pfc, e.g. FOOD_AND_DRINK_COFFEE, or the
+	// category ID for legacy
+	ID string
+	// e.g. FOOD_AND_DRINK_COFFEE, or "Food and Drink > Restaurants >
+	// Coffee Shop"
+	Name string
+	// e.g. FOOD_AND_DRINK, or "Food and Drink"
+	Primary     string
+	Description string
+}
+
+type CategoryFields struct {
+	Name        string
+	CategoryID  string `json:",omitempty"`
+	Primary     string `json:",omitempty"`
+	Description string `json:",omitempty"`
+	// pfc or legacy
+	Taxonomy string `json:",omitempty"`
+}
+
+type CategoryRecord struct {
+	airtable.Record
+	Fields CategoryFields
+}
+
+// FetchAirtableCategories returns the names of the Categories records.
+func FetchAirtableCategories() ([]CategoryRecord, error) {
+	var categories []CategoryRecord
+	err := NewAirtableClient().Table("Categories").List(&categories, &airtable.Options{Fields: []string{"Name"}})
+	return categories, err
+}
+
+// FetchCategories returns the pfc (personal finance category) or legacy
+// taxonomy.
+func FetchCategories(ctx context.Context, client plaid_cli.PlaidClient, taxonomy string) ([]Category, error) {
+	switch taxonomy {
+	case "pfc":
+		return fetchPFCTaxonomy(viper.GetString("categories.pfc_url"))
+	case "legacy":
+		resp, err := client.CategoriesGet(ctx)
+		if err != nil {
+			return nil, err
+		}
+		categories := make([]Category, len(resp.Categories))
+		for i, c := range resp.Categories {
+			categories[i] = Category{
+				ID:   c.CategoryId,
+				Name: strings.Join(c.Hierarchy, " > "),
+			}
+			if len(c.Hierarchy) > 0 {
+				categories[i].Primary = c.Hierarchy[0]
+			}
+		}
+		return categories, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown taxonomy: %s. Valid: pfc, legacy", taxonomy))
+	}
+}
+
+// fetchPFCTaxonomy reads the taxonomy CSV, with PRIMARY, DETAILED and
+// DESCRIPTION columns.
+func fetchPFCTaxonomy(url string) ([]Category, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("Cannot download the category taxonomy from %s: %s", url, resp.Status))
+	}
+
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New(fmt.Sprintf("Empty category taxonomy at %s", url))
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToUpper(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"PRIMARY", "DETAILED"} {
+		if _, ok := columns[name]; !ok {
+			return nil, errors.New(fmt.Sprintf("The category taxonomy at %s has no %s column", url, name))
+		}
+	}
+	column := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var categories []Category
+	for _, row := range rows[1:] {
+		detailed := column(row, "DETAILED")
+		if detailed == "" {
+			continue
+		}
+		categories = append(categories, Category{
+			ID:          detailed,
+			Name:        detailed,
+			Primary:     column(row, "PRIMARY"),
+			Description: column(row, "DESCRIPTION"),
+		})
+	}
+	return categories, nil
+}
+
+// SyncCategories creates or updates a Categories record per category,
+// returning how many were written.
+func SyncCategories(categories []Category, taxonomy string) (int, error) {
+	client := NewAirtableClient()
+
+	records := make([]CategoryRecord, len(categories))
+	for i, c := range categories {
+		records[i] = CategoryRecord{Fields: CategoryFields{
+			Name:        c.Name,
+			CategoryID:  c.ID,
+			Primary:     c.Primary,
+			Description: c.Description,
+			Taxonomy:    taxonomy,
+		}}
+	}
+
+	progress := StartProgress("Writing categories", NewETA(len(records)))
+	defer progress.Finish()
+	err := client.Table("Categories").UpsertAll(records, []string{"CategoryID"}, progress.Step)
+	return len(records), err
+}
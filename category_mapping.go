@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/spf13/viper"
+)
+
+// A category mapping links new transactions to one of your own
+// categories by their Plaid personal finance category, configured as
+// e.g.
+//
+//	[categories.mapping]
+//	FOOD_AND_DRINK_COFFEE = "Coffee"
+//	FOOD_AND_DRINK = "Eating Out"
+//
+// or in an Airtable table named by categories.mapping_table, with a PFC
+// text field and a Category field linking to Categories. Detailed
+// categories win over primary ones, and the table over the config.
+
+type CategoryMappingFields struct {
+	PFC      string
+	Category airtable.RecordLink
+}
+
+type CategoryMappingRecord struct {
+	airtable.Record
+	Fields CategoryMappingFields
+}
+
+// CategoryMapping is the CategoryLookup to set per upper case PFC.
+// Values from the config are category names, which typecasting links to
+// the Categories record with that Name, and values from the table are
+// record IDs.
+type CategoryMapping map[string]airtable.RecordLink
+
+// LoadCategoryMapping reads categories.mapping and, when set, the
+// categories.mapping_table table.
+func LoadCategoryMapping() (CategoryMapping, error) {
+	mapping := CategoryMapping{}
+	// viper lowercases map keys
+	for pfc, category := range viper.GetStringMapString("categories.mapping") {
+		mapping[strings.ToUpper(pfc)] = airtable.RecordLink{category}
+	}
+
+	table := viper.GetString("categories.mapping_table")
+	if table == "" {
+		return mapping, nil
+	}
+	var records []CategoryMappingRecord
+	err := NewAirtableClient().Table(table).List(&records, &airtable.Options{})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		pfc := strings.ToUpper(strings.TrimSpace(r.Fields.PFC))
+		if pfc != "" && len(r.Fields.Category) > 0 {
+			mapping[pfc] = r.Fields.Category
+		}
+	}
+	return mapping, nil
+}
+
+// Categorize sets CategoryLookup on records that have none from their
+// detailed or primary PFC, returning how many it set per mapped PFC.
+func (m CategoryMapping) Categorize(records []TransactionRecord) map[string]int {
+	hits := make(map[string]int)
+	for i := range records {
+		f := &records[i].Fields
+		if len(f.CategoryLookup) > 0 {
+			continue
+		}
+		if pfc, ok := m.match(*f); ok {
+			f.CategoryLookup = m[pfc]
+			hits[pfc]++
+		}
+	}
+	return hits
+}
+
+// match returns the mapped PFC for f, detailed first.
+func (m CategoryMapping) match(f TransactionFields) (string, bool) {
+	for _, pfc := range []string{f.PFCDetailed, f.PFCPrimary} {
+		pfc = strings.ToUpper(pfc)
+		if _, ok := m[pfc]; ok && pfc != "" {
+			return pfc, true
+		}
+	}
+	return "", false
+}
+
+// MappedCategory is the category name for destinations other than
+// Airtable: the one picked in Airtable when synced back (sync.fields), or
+// the one categories.mapping gives t's detailed or primary personal
+// finance category, or the primary one.
+func MappedCategory(t Transaction) string {
+	if category := t.Fields[categoryField]; category != "" {
+		return category
+	}
+	mapping := viper.GetStringMapString("categories.mapping")
+	if pfc := t.PersonalFinanceCategory; pfc != nil {
+		for _, key := range []string{pfc.Detailed, pfc.Primary} {
+			if category, ok := mapping[strings.ToLower(key)]; ok && key != "" {
+				return category
+			}
+		}
+	}
+	return spendCategory(t)
+}
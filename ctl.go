@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// ControlClient talks to the control API of `plaid-cli serve`.
+type ControlClient struct {
+	URL   string
+	Token string
+}
+
+func (c *ControlClient) Items() ([]ControlItem, error) {
+	var items []ControlItem
+	err := c.do("GET", "/v1/items", nil, &items)
+	return items, err
+}
+
+// Sync starts a sync of item, an item ID, alias or "all".
+func (c *ControlClient) Sync(item string) (*Job, error) {
+	var job Job
+	err := c.do("POST", "/v1/sync", map[string]string{"item": item}, &job)
+	return &job, err
+}
+
+// Jobs are the recent syncs, newest first.
+func (c *ControlClient) Jobs() ([]*Job, error) {
+	var jobs []*Job
+	err := c.do("GET", "/v1/jobs", nil, &jobs)
+	return jobs, err
+}
+
+func (c *ControlClient) Job(id string) (*Job, error) {
+	var job Job
+	err := c.do("GET", "/v1/jobs/"+id, nil, &job)
+	return &job, err
+}
+
+// Logs copies a job's output to w, with follow until it finishes.
+func (c *ControlClient) Logs(id string, follow bool, w io.Writer) error {
+	resp, err := c.request("GET", fmt.Sprintf("/v1/jobs/%s/logs?follow=%t", id, follow), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *ControlClient) do(method string, path string, body interface{}, v interface{}) error {
+	resp, err := c.request(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// request sends a request, turning error responses into errors.
+func (c *ControlClient) request(method string, path string, body interface{}) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.URL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(b, &apiErr) == nil && apiErr.Error != "" {
+			return nil, errors.New(fmt.Sprintf("%s: %s", resp.Status, apiErr.Error))
+		}
+		return nil, errors.New(fmt.Sprintf("%s: %s", resp.Status, b))
+	}
+	return resp, nil
+}
+
+func PrintControlItems(items []ControlItem) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tINSTITUTION\tITEM ID")
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", item.Alias, item.Institution, item.ID)
+	}
+	w.Flush()
+}
+
+func PrintJobs(jobs []*Job) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tITEM\tSTATE\tEXIT CODE\tSTARTED\tFINISHED")
+	for _, job := range jobs {
+		exitCode := ""
+		if job.ExitCode != nil {
+			exitCode = fmt.Sprint(*job.ExitCode)
+		}
+		finished := ""
+		if job.FinishedAt != nil {
+			finished = job.FinishedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Item, job.State, exitCode, job.StartedAt.Local().Format(time.DateTime), finished)
+	}
+	w.Flush()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// RatesProvider returns how many units of to one unit of from was worth on
+// date (YYYY-MM-DD).
+type RatesProvider interface {
+	Rate(from string, to string, date string) (float64, error)
+}
+
+// NewRatesProvider returns the provider configured in currency.provider,
+// or nil when currency.home is not set and no conversion is wanted.
+func NewRatesProvider() (RatesProvider, error) {
+	if viper.GetString("currency.home") == "" {
+		return nil, nil
+	}
+
+	switch viper.GetString("currency.provider") {
+	case "", "frankfurter":
+		return &FrankfurterRates{cache: make(map[string]float64)}, nil
+	case "static":
+		return &StaticRates{Rates: viper.GetStringMapString("currency.rates")}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown currency.provider: %s", viper.GetString("currency.provider")))
+	}
+}
+
+// ConvertCurrency converts amounts to currency.home using provider,
+// keeping the original amount and currency. Transactions without a
+// currency code, or already in the home currency, are left alone.
+func ConvertCurrency(txs []Transaction, provider RatesProvider) error {
+	if provider == nil {
+		return nil
+	}
+	home := strings.ToUpper(viper.GetString("currency.home"))
+
+	for i := range txs {
+		t := &txs[i]
+		if t.IsoCurrencyCode == "" || strings.EqualFold(t.IsoCurrencyCode, home) {
+			continue
+		}
+
+		rate, err := provider.Rate(t.IsoCurrencyCode, home, t.Date)
+		if err != nil {
+			return err
+		}
+
+		original := t.Amount
+		t.OriginalAmount = &original
+		t.OriginalCurrency = t.IsoCurrencyCode
+		t.Amount = original * rate
+		t.IsoCurrencyCode = home
+	}
+	return nil
+}
+
+// StaticRates uses fixed rates from currency.rates, given as units of the
+// home currency per unit of each currency, e.g. gbp = 1.27.
+type StaticRates struct {
+	Rates map[string]string
+}
+
+func (r *StaticRates) Rate(from string, to string, date string) (float64, error) {
+	// viper lowercases map keys
+	s, ok := r.Rates[strings.ToLower(from)]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("No rate for %s in currency.rates", from))
+	}
+
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid rate for %s in currency.rates: %s", from, s))
+	}
+	return rate, nil
+}
+
+// FrankfurterRates looks up daily ECB reference rates from
+// https://www.frankfurter.app, which needs no API key.
+type FrankfurterRates struct {
+	mu    sync.Mutex
+	cache map[string]float64
+}
+
+func (r *FrankfurterRates) Rate(from string, to string, date string) (float64, error) {
+	key := fmt.Sprintf("%s/%s/%s", date, from, to)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rate, ok := r.cache[key]; ok {
+		return rate, nil
+	}
+
+	resp, err := http.Get(fmt.Sprintf("https://api.frankfurter.app/%s?from=%s&to=%s", date, from, to))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.New(fmt.Sprintf("Cannot get %s to %s rate for %s: %s %s", from, to, date, resp.Status, b))
+	}
+
+	var rates struct {
+		Rates map[string]float64
+	}
+	err = json.Unmarshal(b, &rates)
+	if err != nil {
+		return 0, err
+	}
+
+	rate, ok := rates.Rates[strings.ToUpper(to)]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("No %s to %s rate for %s", from, to, date))
+	}
+	r.cache[key] = rate
+	return rate, nil
+}
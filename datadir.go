@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DataDir picks the root data directory, holding config.toml, tokens and
+// profiles, from --data-dir or PLAID_CLI_DATA_DIR, falling back to
+// plaid-cli in the user config directory: $XDG_CONFIG_HOME/plaid-cli
+// (~/.config/plaid-cli) on Linux, ~/Library/Application Support/plaid-cli
+// on macOS and %AppData%\plaid-cli on Windows. A ~/.plaid-cli left by
+// older versions is moved there the first time.
+func DataDir(args []string) (string, error) {
+	if dir, ok := flagFromArgs(args, "data-dir"); ok {
+		return dir, nil
+	}
+	if dir := os.Getenv("PLAID_CLI_DATA_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Cannot find the user config directory, pass --data-dir: %s", err))
+	}
+	dir := filepath.Join(configDir, "plaid-cli")
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dir, nil
+	}
+	return dir, migrateLegacyDataDir(filepath.Join(home, ".plaid-cli"), dir)
+}
+
+// migrateLegacyDataDir moves legacy to dir, unless there is nothing to
+// move or dir is already in use.
+func migrateLegacyDataDir(legacy string, dir string) error {
+	if _, err := os.Stat(legacy); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(dir); err == nil {
+		slog.Warn("Ignoring the old data directory, since the new one exists", "old", legacy, "new", dir)
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(dir), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(legacy, dir)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Cannot move %s to %s, move it by hand or pass --data-dir %s: %s", legacy, dir, legacy, err))
+	}
+	slog.Info("Moved data directory", "old", legacy, "new", dir)
+	return nil
+}
+
+// flagFromArgs finds --name's value in args. It is for the few flags
+// needed before cobra runs, to find the data directory.
+func flagFromArgs(args []string, name string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--"+name && i+1 < len(args) {
+			return args[i+1], true
+		}
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			return strings.TrimPrefix(arg, "--"+name+"="), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Timezone is sync.timezone (e.g. "America/Los_Angeles"), defaulting to
+// the local timezone. Plaid dates are already local to the account;
+// this is for datetimes, which Plaid reports in UTC, and for how
+// Airtable displays them.
+func Timezone() *time.Location {
+	name := viper.GetString("sync.timezone")
+	if name == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		slog.Warn("Invalid sync.timezone, using local time", "timezone", name, "error", err)
+		return time.Local
+	}
+	return loc
+}
+
+// DateLayout is how dates are written in flags and sent to Plaid.
+const DateLayout = "2006-01-02"
+
+var relativeDatePattern = regexp.MustCompile(`^(\d+)([dwmy])$`)
+
+// ParseDate reads a date flag: YYYY-MM-DD, today, yesterday, a time ago
+// like 30d, 2w, 3m or 1y, or a period: ytd, this-month, last-month or
+// last-year. A period is its first day, or its last day (today for ytd
+// and this-month) when end is set, as for --to.
+func ParseDate(s string, end bool) (time.Time, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	if m := relativeDatePattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "d":
+			return today.AddDate(0, 0, -n), nil
+		case "w":
+			return today.AddDate(0, 0, -7*n), nil
+		case "m":
+			return today.AddDate(0, -n, 0), nil
+		default:
+			return today.AddDate(-n, 0, 0), nil
+		}
+	}
+
+	thisMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.Local)
+	thisYear := time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, time.Local)
+	period := func(start time.Time, last time.Time) time.Time {
+		if end {
+			return last
+		}
+		return start
+	}
+	switch s {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "ytd":
+		return period(thisYear, today), nil
+	case "this-month":
+		return period(thisMonth, today), nil
+	case "last-month":
+		return period(thisMonth.AddDate(0, -1, 0), thisMonth.AddDate(0, 0, -1)), nil
+	case "last-year":
+		return period(thisYear.AddDate(-1, 0, 0), thisYear.AddDate(0, 0, -1)), nil
+	}
+
+	t, err := time.ParseInLocation(DateLayout, s, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("Invalid date: %q. Use YYYY-MM-DD, today, yesterday, 30d, 2w, 3m, 1y, ytd, this-month, last-month or last-year", s))
+	}
+	return t, nil
+}
+
+// ParseDateRange reads --from and --to, making sure they are in order.
+// An empty to is today.
+func ParseDateRange(from string, to string) (time.Time, time.Time, error) {
+	start, err := ParseDate(from, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to == "" {
+		to = "today"
+	}
+	end, err := ParseDate(to, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, errors.New(fmt.Sprintf("--from %s is after --to %s", start.Format(DateLayout), end.Format(DateLayout)))
+	}
+	return start, end, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	thisMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.Local)
+	thisYear := time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		in   string
+		end  bool
+		want time.Time
+	}{
+		{"2024-02-29", false, time.Date(2024, 2, 29, 0, 0, 0, 0, time.Local)},
+		{"today", false, today},
+		{"yesterday", false, today.AddDate(0, 0, -1)},
+		{"30d", false, today.AddDate(0, 0, -30)},
+		{"2w", false, today.AddDate(0, 0, -14)},
+		{"3m", false, today.AddDate(0, -3, 0)},
+		{"1y", false, today.AddDate(-1, 0, 0)},
+		{"0d", false, today},
+		{"ytd", false, thisYear},
+		{"ytd", true, today},
+		{"this-month", false, thisMonth},
+		{"this-month", true, today},
+		{"last-month", false, thisMonth.AddDate(0, -1, 0)},
+		{"last-month", true, thisMonth.AddDate(0, 0, -1)},
+		{"last-year", false, thisYear.AddDate(-1, 0, 0)},
+		{"last-year", true, thisYear.AddDate(0, 0, -1)},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.in, tt.end)
+		if err != nil {
+			t.Errorf("ParseDate(%q, %v): %s", tt.in, tt.end, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseDate(%q, %v) = %s, want %s", tt.in, tt.end, got.Format(DateLayout), tt.want.Format(DateLayout))
+		}
+	}
+}
+
+func TestParseDateInvalid(t *testing.T) {
+	for _, in := range []string{"", "3", "3x", "-3d", "d3", "2024-13-01", "02/29/2024", "next-month"} {
+		_, err := ParseDate(in, false)
+		if err == nil {
+			t.Errorf("ParseDate(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	_, _, err := ParseDateRange("2024-03-01", "2024-02-01")
+	if err == nil {
+		t.Error("want an error for --from after --to")
+	}
+
+	start, end, err := ParseDateRange("last-month", "last-month")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end.Before(start) || start.Day() != 1 || end.AddDate(0, 0, 1).Day() != 1 {
+		t.Errorf("last-month = %s to %s, want a whole month", start.Format(DateLayout), end.Format(DateLayout))
+	}
+}
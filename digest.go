@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// Digest summarizes spending over a period. It is rendered with the
+// template in digest.template (a file path), or defaultDigestTemplate.
+type Digest struct {
+	Period     string
+	Start      time.Time
+	End        time.Time
+	TotalSpend float64
+	// Largest first
+	Categories []CategorySpend
+	Largest    []DigestTransaction
+	Balances   []DigestBalance
+}
+
+type CategorySpend struct {
+	Category string
+	Amount   float64
+}
+
+type DigestTransaction struct {
+	Date    string
+	Name    string
+	Account string
+	Amount  float64
+}
+
+type DigestBalance struct {
+	Account   string
+	Current   *float64
+	Available *float64
+}
+
+const defaultDigestTemplate = `Spending from {{.Start.Format "Jan 2"}} to {{.End.Format "Jan 2"}}: {{printf "%.2f" .TotalSpend}}
+
+By category:
+{{range .Categories}}  {{printf "%-28s %10.2f" .Category .Amount}}
+{{end}}
+Largest transactions:
+{{range .Largest}}  {{.Date}}  {{printf "%-28s %10.2f" .Name .Amount}}  {{.Account}}
+{{end}}
+Balances:
+{{range .Balances}}  {{printf "%-28s" .Account}} {{if .Current}}{{printf "%10.2f" (deref .Current)}}{{end}}
+{{end}}`
+
+// How many of the largest transactions a digest lists
+const digestLargest = 5
+
+// DigestStart is when a digest for period ("week" or "month") ending at
+// end starts.
+func DigestStart(period string, end time.Time) (time.Time, error) {
+	switch period {
+	case "week":
+		return end.AddDate(0, 0, -7), nil
+	case "month":
+		return end.AddDate(0, -1, 0), nil
+	default:
+		return time.Time{}, errors.New(fmt.Sprintf("Invalid period: %s (week or month)", period))
+	}
+}
+
+// NewDigest summarizes txs. Only money leaving accounts counts as
+// spending, and transfers between accounts are left out.
+func NewDigest(data *plaid_cli.Data, period string, start time.Time, end time.Time, txs []Transaction, accounts []Account) Digest {
+	d := Digest{Period: period, Start: start, End: end}
+
+	byCategory := map[string]float64{}
+	var spent []DigestTransaction
+	for _, t := range txs {
+		amount := outflow(data, t)
+		if amount <= 0 || isTransfer(t) {
+			continue
+		}
+		d.TotalSpend += amount
+		byCategory[spendCategory(t)] += amount
+		spent = append(spent, DigestTransaction{Date: t.Date, Name: t.Name, Account: AccountLabel(data, t.AccountID), Amount: amount})
+	}
+
+	for category, amount := range byCategory {
+		d.Categories = append(d.Categories, CategorySpend{Category: category, Amount: amount})
+	}
+	sort.Slice(d.Categories, func(i, j int) bool {
+		return d.Categories[i].Amount > d.Categories[j].Amount
+	})
+
+	sort.Slice(spent, func(i, j int) bool {
+		return spent[i].Amount > spent[j].Amount
+	})
+	if len(spent) > digestLargest {
+		spent = spent[:digestLargest]
+	}
+	d.Largest = spent
+
+	for _, a := range accounts {
+		d.Balances = append(d.Balances, DigestBalance{Account: a.DisplayName(), Current: a.Balances.Current, Available: a.Balances.Available})
+	}
+	return d
+}
+
+// Render executes digest.template, or the default template, with d.
+func (d Digest) Render() (string, error) {
+	text := defaultDigestTemplate
+	if path := viper.GetString("digest.template"); path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		text = string(b)
+	}
+
+	t, err := template.New("digest").Funcs(template.FuncMap{
+		"deref": func(f *float64) float64 { return *f },
+	}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	err = t.Execute(&b, d)
+	return b.String(), err
+}
+
+// outflow is how much money t took out of its account, whatever the sign
+// convention, or 0 for money coming in.
+func outflow(data *plaid_cli.Data, t Transaction) float64 {
+	amount := t.Amount
+	if amountSign(data, t) == SignInvert {
+		amount = -amount
+	}
+	if amount < 0 {
+		return 0
+	}
+	return amount
+}
+
+func isTransfer(t Transaction) bool {
+	pfc := t.PersonalFinanceCategory
+	return pfc != nil && (pfc.Primary == "TRANSFER_IN" || pfc.Primary == "TRANSFER_OUT")
+}
+
+func spendCategory(t Transaction) string {
+	if category := t.Fields[categoryField]; category != "" {
+		return category
+	}
+	if pfc := t.PersonalFinanceCategory; pfc != nil && pfc.Primary != "" {
+		return pfc.Primary
+	}
+	if len(t.Category) > 0 {
+		return t.Category[0]
+	}
+	return "Uncategorized"
+}
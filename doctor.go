@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// A DoctorCheck is one thing `plaid-cli doctor` verifies. Fix says what
+// to do about it when Err is set.
+type DoctorCheck struct {
+	Name string
+	Err  error
+	Fix  string
+}
+
+// Doctor checks the configuration and everything a sync depends on, so
+// problems show up with a fix instead of as errors halfway through.
+func Doctor(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data) []DoctorCheck {
+	checks := []DoctorCheck{
+		checkPlaidCredentials(ctx, client),
+		checkDataDir(data),
+	}
+
+	airtableCheck := DoctorCheck{Name: "Airtable token and base access"}
+	airtableCheck.Err = CheckAirtableWriteAccess()
+	checks = append(checks, airtableCheck)
+	if airtableCheck.Err == nil {
+		checks = append(checks, checkAirtableSchema(AirtableBaseID()))
+	}
+
+	var itemIDs []string
+	for itemID := range data.Tokens {
+		itemIDs = append(itemIDs, itemID)
+	}
+	sort.Slice(itemIDs, func(i, j int) bool {
+		return ItemLabel(data, itemIDs[i]) < ItemLabel(data, itemIDs[j])
+	})
+	for _, itemID := range itemIDs {
+		checks = append(checks, checkItem(ctx, client, data, itemID))
+	}
+
+	return checks
+}
+
+// checkPlaidCredentials calls /item/get with a made up access token. Plaid
+// checks the API keys first, so anything but INVALID_API_KEYS means they
+// are good.
+func checkPlaidCredentials(ctx context.Context, client plaid_cli.PlaidClient) DoctorCheck {
+	check := DoctorCheck{Name: "Plaid credentials"}
+
+	_, err := client.ItemGet(ctx, plaid.ItemGetRequest{AccessToken: "access-doctor"})
+	e, perr := plaid.ToPlaidError(err)
+	switch {
+	case err == nil:
+	case perr != nil:
+		check.Err = err
+		check.Fix = "Check your network connection and plaid.environment."
+	case e.ErrorCode == "INVALID_API_KEYS":
+		check.Err = errors.New(e.ErrorMessage)
+		check.Fix = "Set plaid.client_id and plaid.secret (or PLAID_CLIENT_ID and PLAID_SECRET) from https://dashboard.plaid.com/team/keys, using the secret for plaid.environment."
+	}
+	return check
+}
+
+// checkDataDir makes sure tokens and aliases can be saved.
+func checkDataDir(data *plaid_cli.Data) DoctorCheck {
+	dir := filepath.Join(data.DataDir, "data")
+	check := DoctorCheck{Name: fmt.Sprintf("Data directory %s is writable", dir)}
+
+	f, err := os.CreateTemp(dir, ".doctor")
+	if err != nil {
+		check.Err = err
+		check.Fix = fmt.Sprintf("Create %s and make it writable, or pass --data-dir.", dir)
+		return check
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return check
+}
+
+// checkAirtableSchema compares the base against airtableSchema.
+func checkAirtableSchema(baseID string) DoctorCheck {
+	check := DoctorCheck{Name: "Airtable tables and fields"}
+
+	var existing struct {
+		Tables []metaTable
+	}
+	err := airtableMeta(fmt.Sprintf("bases/%s/tables", baseID), &existing)
+	if err != nil {
+		check.Err = err
+		check.Fix = "Give the Airtable token the schema.bases:read scope to check the schema."
+		return check
+	}
+
+	fields := map[string]map[string]bool{}
+	for _, table := range existing.Tables {
+		fields[table.Name] = map[string]bool{}
+		for _, field := range table.Fields {
+			fields[table.Name][field.Name] = true
+		}
+	}
+
+	var missing []string
+	for _, table := range airtableSchema {
+		if _, ok := fields[table.Name]; !ok {
+			missing = append(missing, table.Name)
+			continue
+		}
+		for _, field := range table.Fields {
+			if !fields[table.Name][field.Name] {
+				missing = append(missing, table.Name+"."+field.Name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		check.Err = errors.New(fmt.Sprintf("Missing %s", strings.Join(missing, ", ")))
+		check.Fix = "Run `plaid-cli airtable init` to create them."
+	}
+	return check
+}
+
+// checkItem reports items that need relinking, or whose consent expires
+// within a week.
+func checkItem(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, itemID string) DoctorCheck {
+	check := DoctorCheck{Name: fmt.Sprintf("Item %s", ItemLabel(data, itemID))}
+	var relink bool
+	relink, check.Err = ItemHealth(ctx, client, data, itemID, 7*24*time.Hour)
+	if relink {
+		check.Fix = fmt.Sprintf("Run `plaid-cli link %s` to relink it.", itemRef(data, itemID))
+	}
+	return check
+}
+
+// ItemHealth asks Plaid about an item, returning what is wrong with it
+// and whether relinking fixes that, as when its login expired or its
+// consent expires within the given time.
+func ItemHealth(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, itemID string, within time.Duration) (bool, error) {
+	resp, err := client.ItemGet(ctx, plaid.ItemGetRequest{AccessToken: data.Tokens[itemID]})
+	if err != nil {
+		e, perr := plaid.ToPlaidError(err)
+		return perr == nil && (e.ErrorCode == "ITEM_LOGIN_REQUIRED" || e.ErrorCode == "INVALID_ACCESS_TOKEN"), err
+	}
+
+	if itemErr, ok := resp.Item.GetErrorOk(); ok && itemErr != nil && itemErr.ErrorCode != "" {
+		return true, errors.New(fmt.Sprintf("%s: %s", itemErr.ErrorCode, itemErr.ErrorMessage))
+	}
+
+	if expires, ok := resp.Item.GetConsentExpirationTimeOk(); ok && expires != nil && time.Until(*expires) < within {
+		return true, errors.New(fmt.Sprintf("Consent expires %s", expires.Format("2006-01-02")))
+	}
+	return false, nil
+}
+
+// itemRef is what to pass to commands to refer to an item: its alias,
+// or its ID.
+func itemRef(data *plaid_cli.Data, itemID string) string {
+	if alias, ok := data.BackAliases[itemID]; ok {
+		return alias
+	}
+	return itemID
+}
+
+// PrintDoctor prints each check and its fix, and reports whether they
+// all passed.
+func PrintDoctor(checks []DoctorCheck) bool {
+	ok := true
+	for _, check := range checks {
+		if check.Err == nil {
+			fmt.Printf("✓ %s\n", check.Name)
+			continue
+		}
+		ok = false
+		fmt.Printf("✗ %s: %s\n", check.Name, check.Err)
+		if check.Fix != "" {
+			fmt.Printf("  %s\n", check.Fix)
+		}
+	}
+	return ok
+}
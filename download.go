@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/pipeline"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/spf13/viper"
+)
+
+// Sandbox item that should never be synced
+const sandboxItemID = "7jKq173RmNfQyGvRnw6XFxQjKVlo8DcgjdEMJ"
+
+func syncStartDate(item idAndAlias) time.Time {
+	if from := viper.GetString("sync.from"); from != "" {
+		start, err := ParseDate(from, false)
+		if err == nil {
+			return start
+		}
+		slog.Warn("Invalid sync.from, using the default sync window", "error", err)
+	}
+	if item.alias == "citi" {
+		return time.Date(2023, time.August, 1, 0, 0, 0, 0, time.Local)
+	}
+	return time.Date(2024, time.May, 24, 0, 0, 0, 0, time.Local)
+}
+
+// SyncWindowStart is the earliest start date across items, so an Airtable
+// fetch covers every item's window.
+func SyncWindowStart(items []idAndAlias) time.Time {
+	var start time.Time
+	for _, item := range items {
+		if s := syncStartDate(item); start.IsZero() || s.Before(start) {
+			start = s
+		}
+	}
+	return start
+}
+
+// DeleteCutoff is the date after which Airtable transactions Plaid no
+// longer returns are deleted: sync.delete_window ago, but never before an
+// item's window starts since older transactions weren't downloaded.
+func DeleteCutoff(items []idAndAlias) time.Time {
+	cutoff := time.Now().Add(-viper.GetDuration("sync.delete_window"))
+	for _, item := range items {
+		if s := syncStartDate(item); s.After(cutoff) {
+			cutoff = s
+		}
+	}
+	return cutoff
+}
+
+// DownloadTransactions fetches the sync window of transactions for every
+// item concurrently. Items that fail are logged and skipped.
+func DownloadTransactions(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, linker *plaid_cli.Linker, items []idAndAlias, accountIDs []string) []Transaction {
+	return DownloadTransactionsSince(ctx, client, data, linker, items, accountIDs, syncStartDate)
+}
+
+// transactionsRequest asks for an item's transactions dated from start to
+// end, inclusive.
+func transactionsRequest(token string, accountIDs []string, start time.Time, end time.Time) plaid.TransactionsGetRequest {
+	layout := "2006-01-02"
+	options := plaid.NewTransactionsGetRequestOptions()
+	options.SetCount(pipeline.MaxPageSize)
+	options.SetAccountIds(accountIDs)
+	options.SetIncludePersonalFinanceCategory(true)
+	options.SetIncludeOriginalDescription(true)
+	return plaid.TransactionsGetRequest{
+		StartDate:   start.Format(layout),
+		EndDate:     end.Format(layout),
+		Options:     options,
+		AccessToken: token,
+	}
+}
+
+// prepareTransactions applies the amount sign, currency and name settings
+// and the field cache to downloaded transactions, in place.
+func prepareTransactions(data *plaid_cli.Data, txs []Transaction, rates RatesProvider, names *NameNormalizer, fields FieldCache) error {
+	NormalizeAmounts(data, txs)
+	err := ConvertCurrency(txs, rates)
+	if err != nil {
+		return err
+	}
+	NormalizeNames(txs, names)
+	fields.Apply(txs)
+	return nil
+}
+
+// DownloadTransactionsSince is DownloadTransactions with a different start
+// date per item.
+func DownloadTransactionsSince(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, linker *plaid_cli.Linker, items []idAndAlias, accountIDs []string, startDate func(idAndAlias) time.Time) []Transaction {
+	var transactionsMu sync.Mutex
+	var allTransactions []Transaction
+
+	var wg sync.WaitGroup
+
+	rates, err := NewRatesProvider()
+	if err != nil {
+		Fatal("Invalid currency configuration", &ConfigError{err})
+	}
+
+	names, err := NewNameNormalizer()
+	if err != nil {
+		Fatal("Invalid names configuration", &ConfigError{err})
+	}
+
+	fields, err := LoadFieldCache(data.DataDir)
+	if err != nil {
+		Fatal("Cannot read the field cache", err)
+	}
+
+	for _, item := range items {
+		if item.id == sandboxItemID {
+			continue
+		}
+		wg.Add(1)
+		go func(item idAndAlias) {
+			defer wg.Done()
+			err := WithRelinkOnAuthError(ctx, item, data, linker, func() error {
+				progress := StartProgress(ItemLabel(data, item.id), NewDownloadETA(0))
+				defer progress.Finish()
+
+				req := transactionsRequest(data.Tokens[item.id], accountIDs, startDate(item), time.Now())
+				transactions, err := pipeline.AllTransactions(ctx, req, client, progress.Update)
+				if err != nil {
+					return err
+				}
+				err = prepareTransactions(data, transactions, rates, names, fields)
+				if err != nil {
+					return err
+				}
+
+				transactionsMu.Lock()
+				allTransactions = append(allTransactions, transactions...)
+				transactionsMu.Unlock()
+				return nil
+			})
+
+			if err != nil {
+				ItemFailed("Cannot download transactions", err, ItemLabel(data, item.id))
+			} else {
+				ItemSucceeded(ItemLabel(data, item.id))
+			}
+		}(item)
+	}
+
+	wg.Wait()
+	return WithoutIgnoredAccounts(data, allTransactions)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/manifoldco/promptui"
+)
+
+// DuplicateGroup is the same transaction showing up in several accounts,
+// which happens when one card is linked through two items (e.g. after a
+// bank migration).
+type DuplicateGroup struct {
+	Transactions []Transaction
+}
+
+// DetectDuplicates groups transactions in different accounts with the
+// same date, amount, merchant and account mask.
+func DetectDuplicates(txs []Transaction) []DuplicateGroup {
+	byKey := make(map[string][]Transaction)
+	var keys []string
+	for _, t := range txs {
+		if t.AccountMask == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s|%.2f|%s|%s", t.Date, t.Amount, normalizeMerchant(t), t.AccountMask)
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], t)
+	}
+	sort.Strings(keys)
+
+	var groups []DuplicateGroup
+	for _, key := range keys {
+		group := byKey[key]
+		accounts := make(map[string]struct{})
+		for _, t := range group {
+			accounts[t.AccountID] = struct{}{}
+		}
+		if len(accounts) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].AccountID < group[j].AccountID
+		})
+		groups = append(groups, DuplicateGroup{Transactions: group})
+	}
+	return groups
+}
+
+// RemoveDuplicates drops duplicates found by DetectDuplicates, keeping
+// the transaction from the account that sorts first so the same side is
+// kept on every run.
+func RemoveDuplicates(txs []Transaction) []Transaction {
+	drop := make(map[string]struct{})
+	for _, g := range DetectDuplicates(txs) {
+		keep := g.Transactions[0].AccountID
+		for _, t := range g.Transactions {
+			if t.AccountID != keep {
+				drop[t.ID] = struct{}{}
+			}
+		}
+	}
+
+	var ret []Transaction
+	for _, t := range txs {
+		if _, ok := drop[t.ID]; !ok {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// WithoutIgnoredAccounts drops transactions in accounts ignored with
+// `duplicates --resolve`.
+func WithoutIgnoredAccounts(data *plaid_cli.Data, txs []Transaction) []Transaction {
+	if len(data.IgnoredAccounts) == 0 {
+		return txs
+	}
+
+	var ret []Transaction
+	for _, t := range txs {
+		if _, ok := data.IgnoredAccounts[t.AccountID]; !ok {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+func normalizeMerchant(t Transaction) string {
+	name := t.MerchantName
+	if name == "" {
+		name = t.Name
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+func PrintDuplicates(groups []DuplicateGroup) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tAMOUNT\tNAME\tMASK\tACCOUNT ID\tTRANSACTION ID")
+	for _, g := range groups {
+		for _, t := range g.Transactions {
+			fmt.Fprintf(w, "%s\t%.2f\t%s\t%s\t%s\t%s\n", t.Date, t.Amount, t.Name, t.AccountMask, t.AccountID, t.ID)
+		}
+		fmt.Fprintln(w, "\t\t\t\t\t")
+	}
+	w.Flush()
+}
+
+// ResolveDuplicates asks, for each set of accounts sharing duplicates,
+// which account to keep. The others are ignored from then on.
+func ResolveDuplicates(data *plaid_cli.Data, groups []DuplicateGroup) error {
+	counts := make(map[string]int)
+	accountSets := make(map[string][]string)
+	var setKeys []string
+	for _, g := range groups {
+		var accountIDs []string
+		seen := make(map[string]struct{})
+		for _, t := range g.Transactions {
+			if _, ok := seen[t.AccountID]; !ok {
+				seen[t.AccountID] = struct{}{}
+				accountIDs = append(accountIDs, t.AccountID)
+			}
+		}
+		key := strings.Join(accountIDs, ",")
+		if _, ok := accountSets[key]; !ok {
+			setKeys = append(setKeys, key)
+			accountSets[key] = accountIDs
+		}
+		counts[key]++
+	}
+
+	accountNames := make(map[string]string)
+	for alias, accountID := range data.AccountAliases {
+		accountNames[accountID] = alias
+	}
+
+	for _, key := range setKeys {
+		accountIDs := accountSets[key]
+		options := make([]string, len(accountIDs))
+		for i, accountID := range accountIDs {
+			options[i] = accountID
+			if name, ok := accountNames[accountID]; ok {
+				options[i] = fmt.Sprintf("%s (%s)", name, accountID)
+			}
+		}
+		options = append(options, "Skip")
+
+		prompt := promptui.Select{
+			Label: fmt.Sprintf("%d duplicated transactions between these accounts. Keep syncing which?", counts[key]),
+			Items: options,
+		}
+		i, _, err := prompt.Run()
+		if err != nil {
+			return err
+		}
+		if i == len(accountIDs) {
+			continue
+		}
+
+		for j, accountID := range accountIDs {
+			if j != i {
+				data.IgnoredAccounts[accountID] = fmt.Sprintf("Duplicate of %s", accountIDs[i])
+			}
+		}
+	}
+
+	return data.SaveIgnoredAccounts()
+}
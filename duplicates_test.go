@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDetectDuplicates(t *testing.T) {
+	withMask := func(t Transaction, mask string, merchant string) Transaction {
+		t.AccountMask = mask
+		t.MerchantName = merchant
+		return t
+	}
+
+	tests := []struct {
+		name   string
+		txs    []Transaction
+		groups int
+	}{
+		{
+			name: "same card through two items",
+			txs: []Transaction{
+				withMask(tx("a", "old-item-card", "2024-03-01", 12.5), "1234", "Blue Bottle"),
+				withMask(tx("b", "new-item-card", "2024-03-01", 12.5), "1234", "BLUE BOTTLE!"),
+			},
+			groups: 1,
+		},
+		{
+			name: "same account",
+			txs: []Transaction{
+				withMask(tx("a", "card", "2024-03-01", 12.5), "1234", "Blue Bottle"),
+				withMask(tx("b", "card", "2024-03-01", 12.5), "1234", "Blue Bottle"),
+			},
+		},
+		{
+			name: "different masks",
+			txs: []Transaction{
+				withMask(tx("a", "card1", "2024-03-01", 12.5), "1234", "Blue Bottle"),
+				withMask(tx("b", "card2", "2024-03-01", 12.5), "5678", "Blue Bottle"),
+			},
+		},
+		{
+			name: "no mask",
+			txs: []Transaction{
+				withMask(tx("a", "card1", "2024-03-01", 12.5), "", "Blue Bottle"),
+				withMask(tx("b", "card2", "2024-03-01", 12.5), "", "Blue Bottle"),
+			},
+		},
+		{
+			name: "different dates",
+			txs: []Transaction{
+				withMask(tx("a", "card1", "2024-03-01", 12.5), "1234", "Blue Bottle"),
+				withMask(tx("b", "card2", "2024-03-02", 12.5), "1234", "Blue Bottle"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectDuplicates(tt.txs); len(got) != tt.groups {
+				t.Errorf("got %d groups, want %d: %+v", len(got), tt.groups, got)
+			}
+		})
+	}
+}
+
+func TestRemoveDuplicatesKeepsFirstAccount(t *testing.T) {
+	a := tx("a", "b-account", "2024-03-01", 12.5)
+	b := tx("b", "a-account", "2024-03-01", 12.5)
+	other := tx("c", "b-account", "2024-03-02", 3)
+	for _, t := range []*Transaction{&a, &b, &other} {
+		t.AccountMask = "1234"
+		t.Name = "Blue Bottle"
+	}
+
+	got := RemoveDuplicates([]Transaction{a, b, other})
+	if len(got) != 2 || got[0].ID != "b" || got[1].ID != "c" {
+		t.Errorf("RemoveDuplicates kept %+v, want b and c", got)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/spf13/viper"
+)
+
+// Exit codes, so cron wrappers and scripts can tell failures apart.
+const (
+	// Any other failure
+	ExitError = 1
+	// Invalid flags, arguments or configuration
+	ExitConfig = 2
+	// An item needs to be relinked or linked again
+	ExitAuth = 3
+	// A Plaid API request failed
+	ExitPlaid = 4
+	// An Airtable API request failed
+	ExitAirtable = 5
+	// Some items failed and were skipped, the others succeeded
+	ExitPartial = 6
+)
+
+// Plaid error codes that only relinking or linking again fixes
+var authErrorCodes = []string{
+	"ITEM_LOGIN_REQUIRED",
+	"PENDING_EXPIRATION",
+	"INVALID_ACCESS_TOKEN",
+	"INVALID_CREDENTIALS",
+	"ITEM_LOCKED",
+	"USER_SETUP_REQUIRED",
+	"ACCESS_NOT_GRANTED",
+}
+
+// ConfigError marks an error as caused by the config file, flags or
+// environment.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// AuthError marks an error that relinking, or linking again, fixes.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode is the exit code for a command failing with err.
+func ExitCode(err error) int {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return ExitConfig
+	}
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return ExitAuth
+	}
+	var airtableErr *airtable.Error
+	if errors.As(err, &airtableErr) {
+		return ExitAirtable
+	}
+	var apiErr plaid.GenericOpenAPIError
+	if errors.As(err, &apiErr) {
+		if e, perr := plaid.ToPlaidError(apiErr); perr == nil && contains(authErrorCodes, e.ErrorCode) {
+			return ExitAuth
+		}
+		return ExitPlaid
+	}
+	return ExitError
+}
+
+// itemResults is how each item fared in commands over several items,
+// which carry on past items that fail. An item fails if any step for it
+// failed, keeping the first error.
+var itemResults struct {
+	sync.Mutex
+	items  []string
+	errors map[string]error
+}
+
+// ItemSucceeded records that a step for an item succeeded.
+func ItemSucceeded(item string) {
+	recordItemResult(item, nil)
+}
+
+// ItemFailed logs that an item failed and is skipped, for commands that
+// carry on with the other items. The command then exits with ExitPartial.
+func ItemFailed(msg string, err error, item string, args ...any) {
+	LogError(msg, err, append([]any{"item", item}, args...)...)
+	recordItemResult(item, err)
+}
+
+func recordItemResult(item string, err error) {
+	itemResults.Lock()
+	defer itemResults.Unlock()
+	if itemResults.errors == nil {
+		itemResults.errors = make(map[string]error)
+	}
+	previous, seen := itemResults.errors[item]
+	if !seen {
+		itemResults.items = append(itemResults.items, item)
+	}
+	if previous == nil {
+		itemResults.errors[item] = err
+	}
+}
+
+// ItemsFailed reports whether any item failed so far, so steps that need
+// every item's data, like budgets, can be left out.
+func ItemsFailed() bool {
+	itemResults.Lock()
+	defer itemResults.Unlock()
+	for _, err := range itemResults.errors {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// FailedItemsSummary is a line per item that failed, with its error.
+func FailedItemsSummary() string {
+	itemResults.Lock()
+	defer itemResults.Unlock()
+	var b strings.Builder
+	for _, item := range itemResults.items {
+		if err := itemResults.errors[item]; err != nil {
+			fmt.Fprintf(&b, "%s: %s\n", item, err)
+		}
+	}
+	return b.String()
+}
+
+// reportItemResults prints a table of how each item fared to stderr,
+// when there were several items or one failed, and returns whether any
+// failed.
+func reportItemResults() bool {
+	failed := ItemsFailed()
+
+	itemResults.Lock()
+	defer itemResults.Unlock()
+	if len(itemResults.items) < 2 && !failed {
+		return false
+	}
+
+	// Keeps JSON logs one object per line
+	if viper.GetString("log.format") == "json" {
+		for _, item := range itemResults.items {
+			if err := itemResults.errors[item]; err != nil {
+				slog.Error("Item failed", "item", item, "error", err)
+			} else {
+				slog.Info("Item succeeded", "item", item)
+			}
+		}
+		return failed
+	}
+
+	w := tabwriter.NewWriter(progressWriter{}, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ITEM\tRESULT\tERROR")
+	for _, item := range itemResults.items {
+		if err := itemResults.errors[item]; err != nil {
+			fmt.Fprintf(w, "%s\tfailed\t%s\n", item, strings.ReplaceAll(err.Error(), "\n", " "))
+		} else {
+			fmt.Fprintf(w, "%s\tok\t\n", item)
+		}
+	}
+	w.Flush()
+	return failed
+}
+
+// Exit ends a command that didn't fail, with ExitPartial if items were
+// skipped.
+func Exit() {
+	failed := reportItemResults()
+	if failed {
+		HealthcheckFailed(FailedItemsSummary())
+	} else {
+		HealthcheckSucceeded()
+	}
+	releaseRunLock()
+	StopRunDeadline()
+	if failed {
+		os.Exit(ExitPartial)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// ExportAnalytics writes transactions, accounts and a balance snapshot as
+// CSV files under dir, with transactions and balances partitioned Hive
+// style (year=2024/month=05) so DuckDB can prune by date. A schema.sql
+// with matching views is written alongside, for `duckdb -init schema.sql`.
+//
+// Transaction partitions are replaced on each export. Balances are
+// appended, so repeated exports build up a balance history.
+func ExportAnalytics(dir string, data *plaid_cli.Data, transactions []Transaction, accounts []Account) error {
+	byMonth := map[string][]Transaction{}
+	for _, t := range transactions {
+		if len(t.Date) < 7 {
+			continue
+		}
+		byMonth[t.Date[:7]] = append(byMonth[t.Date[:7]], t)
+	}
+
+	var months []string
+	for month := range byMonth {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+
+	for _, month := range months {
+		txs := byMonth[month]
+		sort.Slice(txs, func(i, j int) bool {
+			if txs[i].Date != txs[j].Date {
+				return txs[i].Date < txs[j].Date
+			}
+			return txs[i].ID < txs[j].ID
+		})
+
+		rows := [][]string{{"transaction_id", "account_id", "date", "amount", "name", "merchant_name", "pending", "category", "address", "city"}}
+		for _, t := range txs {
+			rows = append(rows, []string{
+				t.ID,
+				t.AccountID,
+				t.Date,
+				strconv.FormatFloat(t.Amount, 'f', 2, 64),
+				t.Name,
+				t.MerchantName,
+				strconv.FormatBool(t.Pending),
+				strings.Join(t.Category, " > "),
+				t.Location.Address,
+				t.Location.City,
+			})
+		}
+
+		err := writeCSV(filepath.Join(dir, "transactions", partition(month), "transactions.csv"), rows, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	accountRows := [][]string{{"account_id", "item_id", "institution", "name", "official_name", "mask", "type", "subtype", "iso_currency_code"}}
+	for _, a := range accounts {
+		accountRows = append(accountRows, []string{
+			a.ID,
+			a.ItemID,
+			data.Institutions[a.ItemID].Name,
+			a.Name,
+			a.OfficialName,
+			a.Mask,
+			a.Type,
+			a.Subtype,
+			a.Balances.IsoCurrencyCode,
+		})
+	}
+	err := writeCSV(filepath.Join(dir, "accounts", "accounts.csv"), accountRows, false)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	balanceRows := [][]string{{"as_of", "account_id", "current", "available", "limit", "iso_currency_code"}}
+	for _, a := range accounts {
+		balanceRows = append(balanceRows, []string{
+			now.Format(time.RFC3339),
+			a.ID,
+			formatOptionalFloat(a.Balances.Current),
+			formatOptionalFloat(a.Balances.Available),
+			formatOptionalFloat(a.Balances.Limit),
+			a.Balances.IsoCurrencyCode,
+		})
+	}
+	err = writeCSV(filepath.Join(dir, "balances", partition(now.Format("2006-01")), "balances.csv"), balanceRows, true)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, "schema.sql"), []byte(analyticsSchema), 0644)
+}
+
+const analyticsSchema = `-- Generated by plaid-cli export analytics. Run from the export directory:
+--   duckdb -init schema.sql
+CREATE OR REPLACE VIEW transactions AS
+  SELECT * FROM read_csv('transactions/*/*/transactions.csv', hive_partitioning = true, header = true, columns = {
+    'transaction_id': 'VARCHAR',
+    'account_id': 'VARCHAR',
+    'date': 'DATE',
+    'amount': 'DECIMAL(18,2)',
+    'name': 'VARCHAR',
+    'merchant_name': 'VARCHAR',
+    'pending': 'BOOLEAN',
+    'category': 'VARCHAR',
+    'address': 'VARCHAR',
+    'city': 'VARCHAR'
+  });
+
+CREATE OR REPLACE VIEW accounts AS
+  SELECT * FROM read_csv('accounts/accounts.csv', header = true, columns = {
+    'account_id': 'VARCHAR',
+    'item_id': 'VARCHAR',
+    'institution': 'VARCHAR',
+    'name': 'VARCHAR',
+    'official_name': 'VARCHAR',
+    'mask': 'VARCHAR',
+    'type': 'VARCHAR',
+    'subtype': 'VARCHAR',
+    'iso_currency_code': 'VARCHAR'
+  });
+
+CREATE OR REPLACE VIEW balances AS
+  SELECT * FROM read_csv('balances/*/*/balances.csv', hive_partitioning = true, header = true, columns = {
+    'as_of': 'TIMESTAMPTZ',
+    'account_id': 'VARCHAR',
+    'current': 'DECIMAL(18,2)',
+    'available': 'DECIMAL(18,2)',
+    'limit': 'DECIMAL(18,2)',
+    'iso_currency_code': 'VARCHAR'
+  });
+`
+
+// partition turns "2024-05" into "year=2024/month=05".
+func partition(month string) string {
+	return filepath.Join("year="+month[:4], "month="+month[5:7])
+}
+
+func formatOptionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', 2, 64)
+}
+
+// writeCSV writes rows to path, the first row being the header. When
+// appending to an existing file the header is skipped.
+func writeCSV(path string, rows [][]string, appendRows bool) error {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendRows {
+		if _, err := os.Stat(path); err == nil {
+			rows = rows[1:]
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	err = w.WriteAll(rows)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
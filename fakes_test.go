@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/spf13/viper"
+)
+
+// fakeRecord is a record as the fake tables keep it.
+type fakeRecord struct {
+	ID     string                 `json:"id"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// fakeCall is a write to a fakeTable.
+type fakeCall struct {
+	Op     string
+	ID     string
+	Fields map[string]interface{}
+}
+
+// fakeTable is an in-memory airtable.TableClient. It can't evaluate
+// formulas, so List returns every record unless match is set.
+type fakeTable struct {
+	Records []fakeRecord
+	// Writes, in order
+	Calls []fakeCall
+	// Picks the records List returns for a filter formula
+	match func(r fakeRecord, filter string) bool
+	// Fails writes to these record IDs
+	fail map[string]error
+
+	nextID int
+}
+
+func (t *fakeTable) List(listPtr interface{}, options *airtable.Options) error {
+	var records []fakeRecord
+	for _, r := range t.Records {
+		if t.match == nil || options == nil || t.match(r, options.Filter) {
+			records = append(records, r)
+		}
+	}
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, listPtr)
+}
+
+// write decodes records, one record or a slice of them, and applies op to
+// each.
+func (t *fakeTable) write(op string, records interface{}) error {
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	var decoded []fakeRecord
+	if json.Unmarshal(b, &decoded) != nil {
+		var one fakeRecord
+		err = json.Unmarshal(b, &one)
+		if err != nil {
+			return err
+		}
+		decoded = []fakeRecord{one}
+	}
+
+	for _, r := range decoded {
+		if err := t.fail[r.ID]; err != nil {
+			return err
+		}
+		t.Calls = append(t.Calls, fakeCall{Op: op, ID: r.ID, Fields: r.Fields})
+		switch op {
+		case airtable.OpCreate:
+			t.nextID++
+			r.ID = fmt.Sprintf("recNew%d", t.nextID)
+			t.Records = append(t.Records, r)
+		case airtable.OpUpdate:
+			i := t.find(r.ID)
+			if i < 0 {
+				return errors.New(fmt.Sprintf("no record %s", r.ID))
+			}
+			if t.Records[i].Fields == nil {
+				t.Records[i].Fields = make(map[string]interface{})
+			}
+			for k, v := range r.Fields {
+				t.Records[i].Fields[k] = v
+			}
+		case airtable.OpDelete:
+			i := t.find(r.ID)
+			if i < 0 {
+				return errors.New(fmt.Sprintf("no record %s", r.ID))
+			}
+			t.Records = append(t.Records[:i], t.Records[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func (t *fakeTable) find(id string) int {
+	for i, r := range t.Records {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *fakeTable) Create(recordPtr interface{}) error {
+	return t.write(airtable.OpCreate, recordPtr)
+}
+
+func (t *fakeTable) Update(recordPtr interface{}) error {
+	return t.write(airtable.OpUpdate, recordPtr)
+}
+
+func (t *fakeTable) Delete(recordPtr interface{}) error {
+	return t.write(airtable.OpDelete, recordPtr)
+}
+
+func (t *fakeTable) CreateAll(records interface{}, progress func(int)) error {
+	return t.write(airtable.OpCreate, records)
+}
+
+func (t *fakeTable) UpdateAll(records interface{}, progress func(int)) error {
+	return t.write(airtable.OpUpdate, records)
+}
+
+func (t *fakeTable) UpsertAll(records interface{}, fieldsToMergeOn []string, progress func(int)) error {
+	return errors.New("fakeTable does not upsert")
+}
+
+func (t *fakeTable) DeleteAll(records interface{}, progress func(int)) error {
+	return t.write(airtable.OpDelete, records)
+}
+
+// fakeAirtable is an AirtableClient with fakeTables, created on first
+// use.
+type fakeAirtable struct {
+	Tables map[string]*fakeTable
+	// Metadata API responses, by endpoint
+	MetaResponses map[string]interface{}
+}
+
+// useFakeAirtable makes NewAirtableClient return a fakeAirtable for the
+// rest of the test.
+func useFakeAirtable(t *testing.T) *fakeAirtable {
+	fake := &fakeAirtable{Tables: make(map[string]*fakeTable), MetaResponses: make(map[string]interface{})}
+	previous := NewAirtableClient
+	NewAirtableClient = func() AirtableClient {
+		return fakeBase{fake}
+	}
+	t.Cleanup(func() {
+		NewAirtableClient = previous
+	})
+	return fake
+}
+
+func (a *fakeAirtable) Table(name string) *fakeTable {
+	if a.Tables[name] == nil {
+		a.Tables[name] = &fakeTable{}
+	}
+	return a.Tables[name]
+}
+
+// fakeBase adapts fakeAirtable to AirtableClient, whose Table returns
+// the interface.
+type fakeBase struct {
+	*fakeAirtable
+}
+
+func (b fakeBase) Table(name string) airtable.TableClient {
+	return b.fakeAirtable.Table(name)
+}
+
+func (b fakeBase) UploadAttachment(recordID string, field string, filename string, contentType string, file string) error {
+	return errors.New("fakeAirtable does not upload attachments")
+}
+
+func (b fakeBase) Meta(method string, endpoint string, body interface{}, v interface{}) error {
+	resp, ok := b.MetaResponses[endpoint]
+	if !ok {
+		return errors.New(fmt.Sprintf("no fake response for %s %s", method, endpoint))
+	}
+	j, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, v)
+}
+
+// fakePlaid is a PlaidClient answering the calls a test sets up. Other
+// calls panic on the nil embedded client.
+type fakePlaid struct {
+	plaid_cli.PlaidClient
+
+	linkTokenCreate func(req plaid.LinkTokenCreateRequest) (plaid.LinkTokenCreateResponse, error)
+}
+
+func (c *fakePlaid) LinkTokenCreate(ctx context.Context, req plaid.LinkTokenCreateRequest) (plaid.LinkTokenCreateResponse, error) {
+	return c.linkTokenCreate(req)
+}
+
+// plaidError is an error as the Plaid SDK returns it.
+func plaidError(code string) error {
+	e := plaid.PlaidError{ErrorCode: code, ErrorMessage: code + " from the fake"}
+	body, _ := json.Marshal(e)
+	return plaid.MakeGenericOpenAPIError(body, "400 Bad Request", e)
+}
+
+// setConfig sets a config value for the rest of the test.
+func setConfig(t *testing.T, key string, value interface{}) {
+	previous := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() {
+		viper.Set(key, previous)
+	})
+}
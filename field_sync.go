@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/spf13/viper"
+)
+
+// Directions a field can sync in, set per field in sync.fields, e.g.
+//
+//	[[sync.fields]]
+//	field = "CategoryLookup"
+//	direction = "bidirectional"
+//
+// Every field plaid-cli writes goes from Plaid to Airtable, the default.
+// Fields pulled from Airtable are kept in a local cache, which fills in
+// Transaction.Fields for exports and reports.
+const (
+	DirectionPlaidToAirtable = "plaid->airtable"
+	// Airtable is the source of truth, e.g. for categories picked there
+	DirectionAirtableToLocal = "airtable->local"
+	// Edits on either side are synced, the later one winning
+	DirectionBidirectional = "bidirectional"
+)
+
+// categoryField links transactions to Categories. Its cached value is the
+// category names, which reports prefer over Plaid's categories.
+const categoryField = "CategoryLookup"
+
+type FieldSync struct {
+	Field     string
+	Direction string
+}
+
+func fieldSyncs() ([]FieldSync, error) {
+	var fields []FieldSync
+	err := viper.UnmarshalKey("sync.fields", &fields)
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range fields {
+		if f.Field == "" {
+			return nil, errors.New(fmt.Sprintf("sync.fields entry %d needs a field", i+1))
+		}
+		switch f.Direction {
+		case "":
+			fields[i].Direction = DirectionPlaidToAirtable
+		case DirectionPlaidToAirtable, DirectionAirtableToLocal, DirectionBidirectional:
+		default:
+			return nil, errors.New(fmt.Sprintf("Invalid direction for %s: %s (%s, %s or %s)", f.Field, f.Direction, DirectionPlaidToAirtable, DirectionAirtableToLocal, DirectionBidirectional))
+		}
+	}
+	return fields, nil
+}
+
+// FieldValue is a field's value in the local cache.
+type FieldValue struct {
+	Value string `json:"value"`
+	// When the value last changed here, by a pull or a local edit
+	Modified time.Time `json:"modified"`
+	// Edited locally and not pushed to Airtable yet
+	Dirty bool `json:"dirty,omitempty"`
+}
+
+// FieldCache holds the values of sync.fields per Plaid transaction ID,
+// then field.
+type FieldCache map[string]map[string]FieldValue
+
+func fieldCachePath(dataDir string) string {
+	return filepath.Join(dataDir, "data", "fields.json")
+}
+
+// LoadFieldCache reads the cache, which is empty before the first pull.
+func LoadFieldCache(dataDir string) (FieldCache, error) {
+	cache := FieldCache{}
+	b, err := ioutil.ReadFile(fieldCachePath(dataDir))
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &cache)
+	return cache, err
+}
+
+// Save replaces fields.json through a temp file, so a save cut short
+// leaves the previous cache rather than one LoadFieldCache can't read.
+func (c FieldCache) Save(dataDir string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	path := fieldCachePath(dataDir)
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// Set edits a value locally. Only bidirectional fields can be edited,
+// since pulls overwrite the others.
+func (c FieldCache) Set(plaidID string, field string, value string) error {
+	fields, err := fieldSyncs()
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.Field == field && f.Direction == DirectionBidirectional {
+			if c[plaidID] == nil {
+				c[plaidID] = make(map[string]FieldValue)
+			}
+			c[plaidID][field] = FieldValue{Value: value, Modified: time.Now(), Dirty: true}
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprintf("%s isn't a bidirectional field in sync.fields", field))
+}
+
+// Apply fills in the cached values on txs.
+func (c FieldCache) Apply(txs []Transaction) {
+	for i, t := range txs {
+		values, ok := c[t.ID]
+		if !ok {
+			continue
+		}
+		txs[i].Fields = make(map[string]string, len(values))
+		for field, v := range values {
+			txs[i].Fields[field] = v.Value
+		}
+	}
+}
+
+// FieldRecord is read into a map since the synced fields are configured.
+type FieldRecord struct {
+	airtable.Record
+	Fields   map[string]interface{}
+	Typecast bool
+}
+
+// fieldValue is an Airtable value as a string: lists are joined with
+// ", ", and linked Categories records become their names.
+func fieldValue(v interface{}, categoryNames map[string]string) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		if name, ok := categoryNames[v]; ok {
+			return name
+		}
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, e := range v {
+			values[i] = fieldValue(e, categoryNames)
+		}
+		return strings.Join(values, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// SyncFieldValues pulls the sync.fields that flow out of Airtable into
+// the cache for transactions dated on or after since, and first pushes
+// local edits of bidirectional fields, unless the field was changed in
+// Airtable after the edit. Values are pushed as text with typecasting, so
+// a category name links to the category. It returns how many values were
+// pulled and pushed.
+func SyncFieldValues(cache FieldCache, since time.Time) (int, int, error) {
+	fields, err := fieldSyncs()
+	if err != nil {
+		return 0, 0, err
+	}
+	if !pullsFields(fields) {
+		return 0, 0, nil
+	}
+
+	client := NewAirtableClient()
+	table := client.Table(AirtableTransactionsTable())
+
+	var categories []CategoryRecord
+	err = client.Table("Categories").List(&categories, &airtable.Options{Fields: []string{"Name"}})
+	if err != nil {
+		return 0, 0, err
+	}
+	categoryNames := make(map[string]string)
+	for _, c := range categories {
+		categoryNames[c.ID] = c.Fields.Name
+	}
+
+	pulled, pushed := 0, 0
+	for _, f := range fields {
+		if f.Direction == DirectionPlaidToAirtable {
+			continue
+		}
+
+		if f.Direction == DirectionBidirectional {
+			n, err := pushFieldValues(table, cache, f.Field)
+			pushed += n
+			if err != nil {
+				return pulled, pushed, err
+			}
+		}
+
+		var records []FieldRecord
+		err := table.List(&records, &airtable.Options{
+			Fields: []string{"PlaidID", f.Field},
+			Filter: fmt.Sprintf("NOT(IS_BEFORE({DateTime}, '%s'))", since.Format(DateLayout)),
+		})
+		if err != nil {
+			return pulled, pushed, err
+		}
+		for _, r := range records {
+			plaidID, _ := r.Fields["PlaidID"].(string)
+			if plaidID == "" {
+				continue
+			}
+			value := fieldValue(r.Fields[f.Field], categoryNames)
+			if _, ok := cache[plaidID][f.Field]; !ok && value == "" {
+				continue
+			}
+			if cache[plaidID] == nil {
+				cache[plaidID] = make(map[string]FieldValue)
+			}
+			cached := cache[plaidID][f.Field]
+			if cached.Dirty || cached.Value == value {
+				continue
+			}
+			cache[plaidID][f.Field] = FieldValue{Value: value, Modified: time.Now()}
+			pulled++
+		}
+	}
+	return pulled, pushed, nil
+}
+
+func pullsFields(fields []FieldSync) bool {
+	for _, f := range fields {
+		if f.Direction != DirectionPlaidToAirtable {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncFieldCache runs SyncFieldValues on the cache in dataDir and saves
+// it.
+func SyncFieldCache(dataDir string, since time.Time) error {
+	cache, err := LoadFieldCache(dataDir)
+	if err != nil {
+		return err
+	}
+	pulled, pushed, err := SyncFieldValues(cache, since)
+	if pulled > 0 || pushed > 0 {
+		slog.Info("Synced fields with Airtable", "pulled", pulled, "pushed", pushed)
+	}
+	// Whatever was synced before an error is kept
+	saveErr := cache.Save(dataDir)
+	if err != nil {
+		return err
+	}
+	return saveErr
+}
+
+// pushFieldValues writes local edits of field to Airtable, last write
+// winning: edits made before the field last changed in Airtable are
+// dropped, and the next pull brings in Airtable's value.
+func pushFieldValues(table airtable.TableClient, cache FieldCache, field string) (int, error) {
+	var dirty []string
+	for plaidID, values := range cache {
+		if values[field].Dirty {
+			dirty = append(dirty, plaidID)
+		}
+	}
+	sort.Strings(dirty)
+
+	pushed := 0
+	const chunk = 50
+	for start := 0; start < len(dirty); start += chunk {
+		end := start + chunk
+		if end > len(dirty) {
+			end = len(dirty)
+		}
+
+		var byID, newer []string
+		for _, plaidID := range dirty[start:end] {
+			byID = append(byID, fmt.Sprintf("{PlaidID} = '%s'", plaidID))
+			newer = append(newer, fmt.Sprintf("AND({PlaidID} = '%s', IS_AFTER(LAST_MODIFIED_TIME({%s}), '%s'))", plaidID, field, cache[plaidID][field].Modified.UTC().Format(time.RFC3339)))
+		}
+
+		var records, newerRecords []FieldRecord
+		err := table.List(&records, &airtable.Options{Fields: []string{"PlaidID"}, Filter: fmt.Sprintf("OR(%s)", strings.Join(byID, ", "))})
+		if err != nil {
+			return pushed, err
+		}
+		err = table.List(&newerRecords, &airtable.Options{Fields: []string{"PlaidID"}, Filter: fmt.Sprintf("OR(%s)", strings.Join(newer, ", "))})
+		if err != nil {
+			return pushed, err
+		}
+		airtableWins := make(map[string]bool)
+		for _, r := range newerRecords {
+			plaidID, _ := r.Fields["PlaidID"].(string)
+			airtableWins[plaidID] = true
+		}
+
+		var updates []FieldRecord
+		var updated []string
+		for _, r := range records {
+			plaidID, _ := r.Fields["PlaidID"].(string)
+			v := cache[plaidID][field]
+			if airtableWins[plaidID] {
+				slog.Info("Dropping local edit, changed in Airtable since", "field", field, "plaid_id", plaidID)
+				v.Dirty = false
+				cache[plaidID][field] = v
+				continue
+			}
+
+			updated = append(updated, plaidID)
+			var value interface{}
+			if v.Value != "" {
+				value = v.Value
+			}
+			updates = append(updates, FieldRecord{
+				Record:   airtable.Record{ID: r.ID},
+				Fields:   map[string]interface{}{field: value},
+				Typecast: true,
+			})
+		}
+		err = table.UpdateAll(updates, nil)
+		if err != nil {
+			return pushed, err
+		}
+		for _, plaidID := range updated {
+			v := cache[plaidID][field]
+			v.Dirty = false
+			cache[plaidID][field] = v
+		}
+		pushed += len(updates)
+	}
+	return pushed, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fieldTable is a Transactions table whose List picks records by PlaidID
+// from the filter, and treats those in changed as edited in Airtable after
+// any local edit.
+func fieldTable(plaidIDs []string, changed map[string]bool) *fakeTable {
+	table := &fakeTable{}
+	for _, id := range plaidIDs {
+		table.Records = append(table.Records, fakeRecord{ID: "rec" + id, Fields: map[string]interface{}{"PlaidID": id}})
+	}
+	table.match = func(r fakeRecord, filter string) bool {
+		id := r.Fields["PlaidID"].(string)
+		if !strings.Contains(filter, fmt.Sprintf("{PlaidID} = '%s'", id)) {
+			return false
+		}
+		return !strings.Contains(filter, "LAST_MODIFIED_TIME") || changed[id]
+	}
+	return table
+}
+
+func TestPushFieldValues(t *testing.T) {
+	edited := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// Whether the transaction is in Airtable
+		inAirtable bool
+		// Whether Airtable's value changed after the local edit
+		changed bool
+		local   FieldValue
+		// The value pushed, if any
+		pushed    interface{}
+		wantPush  bool
+		wantDirty bool
+	}{
+		{name: "local edit", inAirtable: true, local: FieldValue{Value: "Coffee", Modified: edited, Dirty: true}, pushed: "Coffee", wantPush: true},
+		{name: "cleared locally", inAirtable: true, local: FieldValue{Modified: edited, Dirty: true}, pushed: nil, wantPush: true},
+		{name: "changed in Airtable since", inAirtable: true, changed: true, local: FieldValue{Value: "Coffee", Modified: edited, Dirty: true}},
+		{name: "not edited", inAirtable: true, local: FieldValue{Value: "Coffee", Modified: edited}},
+		// Stays dirty, to be pushed once synced
+		{name: "not in Airtable", local: FieldValue{Value: "Coffee", Modified: edited, Dirty: true}, wantDirty: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			if tt.inAirtable {
+				ids = append(ids, "tx")
+			}
+			table := fieldTable(ids, map[string]bool{"tx": tt.changed})
+			cache := FieldCache{"tx": {"CategoryLookup": tt.local}}
+
+			pushed, err := pushFieldValues(table, cache, "CategoryLookup")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantPushed := 0
+			if tt.wantPush {
+				wantPushed = 1
+			}
+			if pushed != wantPushed || len(table.Calls) != wantPushed {
+				t.Fatalf("pushed = %d with calls %+v, want %d", pushed, table.Calls, wantPushed)
+			}
+			if tt.wantPush {
+				call := table.Calls[0]
+				if call.ID != "rectx" || call.Fields["CategoryLookup"] != tt.pushed {
+					t.Errorf("pushed %+v, want CategoryLookup = %v on rectx", call, tt.pushed)
+				}
+			}
+
+			got := cache["tx"]["CategoryLookup"]
+			if got.Dirty != tt.wantDirty {
+				t.Errorf("Dirty = %v, want %v", got.Dirty, tt.wantDirty)
+			}
+			// Airtable's value comes in with the next pull
+			if got.Value != tt.local.Value {
+				t.Errorf("Value = %q, want %q kept until the pull", got.Value, tt.local.Value)
+			}
+		})
+	}
+}
+
+func TestPushFieldValuesInChunks(t *testing.T) {
+	cache := FieldCache{}
+	var ids []string
+	for i := 0; i < 120; i++ {
+		id := fmt.Sprintf("tx%03d", i)
+		ids = append(ids, id)
+		cache[id] = map[string]FieldValue{"Notes": {Value: "note", Modified: time.Now(), Dirty: true}}
+	}
+	changed := map[string]bool{"tx007": true, "tx077": true}
+	table := fieldTable(ids, changed)
+
+	pushed, err := pushFieldValues(table, cache, "Notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed != 118 {
+		t.Errorf("pushed = %d, want 118", pushed)
+	}
+	for id, values := range cache {
+		if values["Notes"].Dirty {
+			t.Errorf("%s is still dirty", id)
+		}
+	}
+	for _, c := range table.Calls {
+		if c.ID == "rectx007" || c.ID == "rectx077" {
+			t.Errorf("pushed %s, which changed in Airtable", c.ID)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/firefly"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// NewFireflyClient reads firefly.url and firefly.token, falling back to
+// FIREFLY_TOKEN for the token.
+func NewFireflyClient() (*firefly.Client, error) {
+	url := viper.GetString("firefly.url")
+	if url == "" {
+		return nil, errors.New("Set url under [firefly] in the config file")
+	}
+	token := viper.GetString("firefly.token")
+	if token == "" {
+		token = os.Getenv("FIREFLY_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("Set token under [firefly] in the config file or FIREFLY_TOKEN")
+	}
+	return &firefly.Client{URL: url, Token: token}, nil
+}
+
+// Firefly III accounts have no external ID, so the Plaid account ID is
+// kept in the notes.
+func fireflyAccountNote(accountID string) string {
+	return "Plaid account " + accountID
+}
+
+func fireflyAccountName(data *plaid_cli.Data, a Account) string {
+	parts := []string{a.DisplayName()}
+	if institution, ok := data.Institutions[a.ItemID]; ok {
+		parts = append([]string{institution.Name}, parts...)
+	}
+	if a.Mask != "" {
+		parts = append(parts, a.Mask)
+	}
+	return strings.Join(parts, " ")
+}
+
+// fireflyAccount is the asset account a Plaid account becomes: credit
+// cards get the credit card role, savings accounts the savings role.
+func fireflyAccount(data *plaid_cli.Data, a Account) firefly.Account {
+	account := firefly.Account{
+		Name:         fireflyAccountName(data, a),
+		Type:         "asset",
+		AccountRole:  "defaultAsset",
+		CurrencyCode: a.Balances.IsoCurrencyCode,
+		Notes:        fireflyAccountNote(a.ID),
+	}
+	switch {
+	case a.Type == "credit":
+		account.AccountRole = "ccAsset"
+		account.CreditCardType = "monthlyFull"
+		account.MonthlyPaymentDate = time.Now().Format(DateLayout)
+	case a.Subtype == "savings":
+		account.AccountRole = "savingAsset"
+	}
+	return account
+}
+
+// SyncFireflyAccounts creates an asset account in Firefly III for each
+// account that doesn't have one yet, recognized by the Plaid account ID in
+// its notes. Accounts ignored with `duplicates --resolve` are left out.
+// It returns the Firefly III account ID per Plaid account ID.
+func SyncFireflyAccounts(client *firefly.Client, data *plaid_cli.Data, accounts []Account) (map[string]string, error) {
+	existing, err := client.Accounts("asset")
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string)
+	for _, a := range accounts {
+		if _, ok := data.IgnoredAccounts[a.ID]; ok {
+			continue
+		}
+		for _, e := range existing {
+			if strings.Contains(e.Notes, fireflyAccountNote(a.ID)) {
+				ids[a.ID] = e.ID
+				break
+			}
+		}
+		if _, ok := ids[a.ID]; ok {
+			continue
+		}
+
+		created, err := client.CreateAccount(fireflyAccount(data, a))
+		if err != nil {
+			return ids, errors.New(fmt.Sprintf("Cannot create account %s: %s", created.Name, err))
+		}
+		slog.Info("Created Firefly III account", "account", created.Name, "id", created.ID)
+		ids[a.ID] = created.ID
+	}
+	return ids, nil
+}
+
+func fireflySplit(data *plaid_cli.Data, t Transaction, accountID string) firefly.Split {
+	counterparty := t.MerchantName
+	if counterparty == "" {
+		counterparty = t.Name
+	}
+	split := firefly.Split{
+		Date:         t.Date,
+		Description:  t.Name,
+		CurrencyCode: t.IsoCurrencyCode,
+		CategoryName: MappedCategory(t),
+		ExternalID:   t.ID,
+	}
+	if t.OriginalAmount != nil {
+		split.ForeignAmount = strconv.FormatFloat(abs(*t.OriginalAmount), 'f', 2, 64)
+		split.ForeignCurrencyCode = t.OriginalCurrency
+	}
+
+	// Firefly III creates expense and revenue accounts by name
+	if out := outflow(data, t); out > 0 {
+		split.Type = "withdrawal"
+		split.Amount = strconv.FormatFloat(out, 'f', 2, 64)
+		split.SourceID = accountID
+		split.DestinationName = counterparty
+	} else {
+		split.Type = "deposit"
+		split.Amount = strconv.FormatFloat(inflow(data, t), 'f', 2, 64)
+		split.SourceName = counterparty
+		split.DestinationID = accountID
+	}
+	return split
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+// SyncFireflyTransactions creates the posted transactions in txs that
+// aren't in Firefly III yet, recognized by the Plaid transaction ID in
+// external_id. accountIDs maps Plaid account IDs to Firefly III ones.
+// Pending transactions are left until they post, since Plaid gives them a
+// new ID then. It returns how many were created.
+func SyncFireflyTransactions(client *firefly.Client, data *plaid_cli.Data, accountIDs map[string]string, txs []Transaction) (int, error) {
+	if len(txs) == 0 {
+		return 0, nil
+	}
+	start := txs[0].Date
+	for _, t := range txs {
+		if t.Date < start {
+			start = t.Date
+		}
+	}
+
+	existing := make(map[string]bool)
+	for _, id := range accountIDs {
+		ids, err := client.ExternalIDs(id, start, time.Now().Format(DateLayout))
+		if err != nil {
+			return 0, err
+		}
+		for externalID := range ids {
+			existing[externalID] = true
+		}
+	}
+
+	created := 0
+	for _, t := range txs {
+		accountID, ok := accountIDs[t.AccountID]
+		if !ok || t.Pending || t.Amount == 0 || existing[t.ID] {
+			continue
+		}
+		err := client.CreateTransaction(fireflySplit(data, t, accountID), viper.GetBool("firefly.apply_rules"))
+		if err != nil {
+			return created, errors.New(fmt.Sprintf("Cannot create transaction %s (%s): %s", t.ID, t.Name, err))
+		}
+		created++
+	}
+	return created, nil
+}
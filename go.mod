@@ -1,14 +1,16 @@
 module github.com/landakram/plaid-cli
 
-go 1.19
+go 1.24
 
 require (
-	github.com/brianloveswords/airtable v0.0.0-20201104232343-083b90826e4a
 	github.com/manifoldco/promptui v0.7.0
+	github.com/mattn/go-isatty v0.0.4
+	github.com/pelletier/go-toml v1.8.0
 	github.com/plaid/plaid-go/v27 v27.0.0
 	github.com/skratchdot/open-golang v0.0.0-20200116055534-eef842397966
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.0
+	golang.org/x/sys v0.13.0
 )
 
 require (
@@ -21,9 +23,7 @@ require (
 	github.com/lunixbochs/vtclean v0.0.0-20180621232353-2d01aacdc34a // indirect
 	github.com/magiconair/properties v1.8.1 // indirect
 	github.com/mattn/go-colorable v0.0.9 // indirect
-	github.com/mattn/go-isatty v0.0.4 // indirect
 	github.com/mitchellh/mapstructure v1.3.2 // indirect
-	github.com/pelletier/go-toml v1.8.0 // indirect
 	github.com/smartystreets/goconvey v1.6.7 // indirect
 	github.com/spf13/afero v1.2.2 // indirect
 	github.com/spf13/cast v1.3.1 // indirect
@@ -33,7 +33,6 @@ require (
 	go.uber.org/ratelimit v0.1.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/oauth2 v0.0.0-20220822191816-0ebed06d0094 // indirect
-	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/protobuf v1.28.1 // indirect
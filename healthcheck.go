@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Commands annotated with healthcheckAnnotation, the syncs usually run
+// from cron, ping healthcheck.url so a monitor like healthchecks.io or
+// Dead Man's Snitch notices when they fail or stop running.
+const healthcheckAnnotation = "healthcheck"
+
+// Whether the running command pings
+var healthcheckActive bool
+
+// healthcheckURL is the URL for a ping, e.g. "start", which is the
+// setting healthcheck.<ping>_url when set, empty to not send it, and
+// otherwise healthcheck.url with /<ping> appended, as healthchecks.io
+// expects. Success pings healthcheck.url itself.
+func healthcheckURL(ping string) string {
+	key := fmt.Sprintf("healthcheck.%s_url", ping)
+	if viper.IsSet(key) {
+		return viper.GetString(key)
+	}
+	return strings.TrimSuffix(viper.GetString("healthcheck.url"), "/") + "/" + ping
+}
+
+// StartHealthcheck sends the start ping for cmd, if it pings.
+func StartHealthcheck(cmd *cobra.Command) {
+	if cmd.Annotations[healthcheckAnnotation] == "" || viper.GetString("healthcheck.url") == "" {
+		return
+	}
+	healthcheckActive = true
+	pingHealthcheck(healthcheckURL("start"), "")
+}
+
+// HealthcheckSucceeded sends the success ping, if the command pings.
+func HealthcheckSucceeded() {
+	if healthcheckActive {
+		pingHealthcheck(viper.GetString("healthcheck.url"), "")
+	}
+}
+
+// HealthcheckFailed sends the failure ping with summary, which monitors
+// show with the failure, if the command pings.
+func HealthcheckFailed(summary string) {
+	if healthcheckActive {
+		pingHealthcheck(healthcheckURL("fail"), strings.TrimSpace(summary))
+	}
+}
+
+// pingHealthcheck POSTs body to url. A monitor being down shouldn't fail
+// the sync, so errors are only logged.
+func pingHealthcheck(url string, body string) {
+	if url == "" {
+		return
+	}
+	// Through http.DefaultClient's transport, for --debug-http
+	client := &http.Client{Transport: http.DefaultClient.Transport, Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		LogError("Cannot ping healthcheck", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		LogError("Cannot ping healthcheck", errors.New(resp.Status))
+	}
+}
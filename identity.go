@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// AccountOwner is a holder of an account as the institution reports it
+// through /identity/get.
+type AccountOwner struct {
+	ItemID    string
+	AccountID string
+	Account   string
+	Mask      string
+	// The first name is the one shown and matched on in the Owners table
+	Names     []string
+	Emails    []string
+	Addresses []string
+}
+
+func (o AccountOwner) Name() string {
+	if len(o.Names) == 0 {
+		return ""
+	}
+	return o.Names[0]
+}
+
+func FetchIdentity(ctx context.Context, client plaid_cli.PlaidClient, accessToken string) ([]AccountOwner, error) {
+	res, err := client.IdentityGet(ctx, plaid.IdentityGetRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var owners []AccountOwner
+	for _, a := range res.Accounts {
+		for _, o := range a.Owners {
+			owner := AccountOwner{
+				ItemID:    res.Item.ItemId,
+				AccountID: a.AccountId,
+				Account:   a.Name,
+				Mask:      a.GetMask(),
+				Names:     o.Names,
+			}
+			// Primary email and address first
+			sort.SliceStable(o.Emails, func(i, j int) bool { return o.Emails[i].Primary && !o.Emails[j].Primary })
+			for _, e := range o.Emails {
+				owner.Emails = append(owner.Emails, e.Data)
+			}
+			sort.SliceStable(o.Addresses, func(i, j int) bool {
+				return o.Addresses[i].GetPrimary() && !o.Addresses[j].GetPrimary()
+			})
+			for _, address := range o.Addresses {
+				owner.Addresses = append(owner.Addresses, formatAddress(address.Data))
+			}
+			owners = append(owners, owner)
+		}
+	}
+	return owners, nil
+}
+
+// FetchAllIdentities fetches account owners for each item, relinking as
+// needed. Items that fail, e.g. because Identity isn't enabled for them,
+// are logged and skipped.
+func FetchAllIdentities(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, linker *plaid_cli.Linker, items []idAndAlias) []AccountOwner {
+	var allOwners []AccountOwner
+	for _, item := range items {
+		if item.id == sandboxItemID {
+			continue
+		}
+		err := WithRelinkOnAuthError(ctx, item, data, linker, func() error {
+			owners, err := FetchIdentity(ctx, client, data.Tokens[item.id])
+			if err != nil {
+				return err
+			}
+
+			allOwners = append(allOwners, owners...)
+			return nil
+		})
+		if err != nil {
+			ItemFailed("Cannot fetch identity", err, ItemLabel(data, item.id))
+		} else {
+			ItemSucceeded(ItemLabel(data, item.id))
+		}
+	}
+	return allOwners
+}
+
+func formatAddress(a plaid.AddressData) string {
+	var parts []string
+	for _, part := range []string{a.Street, a.GetCity(), strings.TrimSpace(a.GetRegion() + " " + a.GetPostalCode()), a.GetCountry()} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func PrintIdentityTable(data *plaid_cli.Data, owners []AccountOwner) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTITUTION\tACCOUNT\tMASK\tOWNER\tEMAIL\tADDRESS")
+	for _, o := range owners {
+		var email, address string
+		if len(o.Emails) > 0 {
+			email = o.Emails[0]
+		}
+		if len(o.Addresses) > 0 {
+			address = o.Addresses[0]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			ItemLabel(data, o.ItemID),
+			o.Account,
+			o.Mask,
+			strings.Join(o.Names, " / "),
+			email,
+			address,
+		)
+	}
+	w.Flush()
+}
+
+type OwnerFields struct {
+	Name string
+	// One per line
+	Emails    string
+	Addresses string
+	Accounts  airtable.RecordLink `json:",omitempty"`
+}
+
+type OwnerRecord struct {
+	airtable.Record
+	Fields OwnerFields
+}
+
+// SyncOwners creates or updates a record per owner in the Owners table,
+// matched on name, linked to their accounts in the Accounts table.
+// Emails, addresses and accounts are added to what is already there, so
+// syncing one item doesn't unlink accounts at another.
+func SyncOwners(owners []AccountOwner) error {
+	client := NewAirtableClient()
+	ownersTable := client.Table("Owners")
+
+	airtableAccounts, err := FetchAirtableAccounts()
+	if err != nil {
+		return err
+	}
+	accountRecordIDs := make(map[string]string)
+	for _, a := range airtableAccounts {
+		accountRecordIDs[a.Fields.AccountID] = a.ID
+	}
+
+	var existing []OwnerRecord
+	err = ownersTable.List(&existing, &airtable.Options{})
+	if err != nil {
+		return err
+	}
+	records := make(map[string]*OwnerRecord)
+	for i := range existing {
+		records[strings.ToLower(existing[i].Fields.Name)] = &existing[i]
+	}
+
+	changed := make(map[string]bool)
+	var names []string
+	for _, o := range owners {
+		name := o.Name()
+		if name == "" {
+			continue
+		}
+		key := strings.ToLower(name)
+		r, ok := records[key]
+		if !ok {
+			r = &OwnerRecord{Fields: OwnerFields{Name: name}}
+			records[key] = r
+		}
+		if !changed[key] {
+			changed[key] = true
+			names = append(names, key)
+		}
+
+		r.Fields.Emails = addLines(r.Fields.Emails, o.Emails)
+		r.Fields.Addresses = addLines(r.Fields.Addresses, o.Addresses)
+		recordID, ok := accountRecordIDs[o.AccountID]
+		if !ok {
+			slog.Warn("Account isn't in Airtable, run sync-accounts to link it to its owner", "account", o.Account, "account_id", o.AccountID)
+			continue
+		}
+		if !contains(r.Fields.Accounts, recordID) {
+			r.Fields.Accounts = append(r.Fields.Accounts, recordID)
+		}
+	}
+
+	var toCreate, toUpdate []OwnerRecord
+	for _, key := range names {
+		if records[key].ID == "" {
+			toCreate = append(toCreate, *records[key])
+		} else {
+			toUpdate = append(toUpdate, *records[key])
+		}
+	}
+
+	err = ownersTable.CreateAll(toCreate, nil)
+	if err != nil {
+		return err
+	}
+	err = ownersTable.UpdateAll(toUpdate, nil)
+	if err != nil {
+		return err
+	}
+	slog.Info("Synced owners", "created", len(toCreate), "updated", len(toUpdate))
+	return nil
+}
+
+// addLines appends the values not already in lines, one per line.
+func addLines(lines string, values []string) string {
+	existing := strings.Split(lines, "\n")
+	for _, v := range values {
+		if v == "" || contains(existing, v) {
+			continue
+		}
+		existing = append(existing, v)
+	}
+	return strings.TrimLeft(strings.Join(existing, "\n"), "\n")
+}
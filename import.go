@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/importer"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// noDeleteCutoff keeps Sync from deleting anything, for syncs like imports
+// and backfills that only cover part of an account's history.
+var noDeleteCutoff = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+type ImportResult struct {
+	Parsed int
+	// Already in Airtable from Plaid, matched on account, date and amount
+	Duplicates int
+	Created    int
+}
+
+// ImportTransactions syncs transactions read from a bank export into
+// Airtable, after the same amount, currency and name normalization as
+// downloaded ones. Transactions already synced from Plaid, with the same
+// account, date and amount, are skipped, and importing a file again only
+// adds what's new. Nothing is deleted or updated.
+func ImportTransactions(data *plaid_cli.Data, txs []Transaction, dryRun bool) (ImportResult, error) {
+	result := ImportResult{Parsed: len(txs)}
+	if len(txs) == 0 {
+		return result, nil
+	}
+
+	NormalizeAmounts(data, txs)
+	rates, err := NewRatesProvider()
+	if err != nil {
+		return result, err
+	}
+	err = ConvertCurrency(txs, rates)
+	if err != nil {
+		return result, err
+	}
+	names, err := NewNameNormalizer()
+	if err != nil {
+		return result, err
+	}
+	NormalizeNames(txs, names)
+
+	since := time.Now()
+	for _, t := range txs {
+		d, err := time.Parse(DateLayout, t.Date)
+		if err != nil {
+			return result, err
+		}
+		if d.Before(since) {
+			since = d
+		}
+	}
+	airtableTransactions, err := FetchAirtableTransactions(append(append([]string{}, SyncFields...), "Amount"), since)
+	if err != nil {
+		return result, err
+	}
+
+	synced := make(map[string]bool, len(airtableTransactions))
+	plaidTransactions := make(map[string]int)
+	for _, r := range airtableTransactions {
+		synced[r.Fields.PlaidID] = true
+		if !importer.IsImported(r.Fields.PlaidID) {
+			plaidTransactions[importKey(r.Fields.AccountID, r.Fields.DateTime, r.Fields.Amount)]++
+		}
+	}
+	var toImport []Transaction
+	for _, t := range txs {
+		key := importKey(t.AccountID, t.Date, t.Amount)
+		if !synced[t.ID] && plaidTransactions[key] > 0 {
+			plaidTransactions[key]--
+			result.Duplicates++
+			continue
+		}
+		toImport = append(toImport, t)
+	}
+
+	if dryRun {
+		for _, t := range toImport {
+			if !synced[t.ID] {
+				result.Created++
+			}
+		}
+		return result, nil
+	}
+
+	err = CheckAirtableWriteAccess()
+	if err != nil {
+		return result, err
+	}
+	summary := NewRunSummary()
+	err = Sync(toImport, airtableTransactions, summary, SyncOptions{DeleteCutoff: noDeleteCutoff})
+	result.Created = summary.Created
+	summary.Print()
+	return result, err
+}
+
+// importKey matches an imported transaction to one from Plaid. Airtable
+// dates may carry a time.
+func importKey(accountID string, date string, amount float64) string {
+	if len(date) > len(DateLayout) {
+		date = date[:len(DateLayout)]
+	}
+	return fmt.Sprintf("%s %s %s", accountID, date, strconv.FormatFloat(amount, 'f', 2, 64))
+}
+
+// openImportFile opens the file named in args, or stdin.
+func openImportFile(args []string) (io.ReadCloser, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(args[0])
+}
+
+func LogImportResult(result ImportResult, dryRun bool) {
+	msg := "Imported transactions"
+	if dryRun {
+		msg = "Would import transactions"
+	}
+	slog.Info(msg, "read", result.Parsed, "already_synced_from_plaid", result.Duplicates, "created", result.Created)
+}
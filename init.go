@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/manifoldco/promptui"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/viper"
+)
+
+// RunInitWizard asks for Plaid and Airtable credentials, checks them,
+// and saves them to config.toml in dataDir, keeping any other settings
+// already there.
+func RunInitWizard(ctx context.Context, dataDir string) error {
+	fmt.Println("Plaid API keys are at https://dashboard.plaid.com/team/keys.")
+	for {
+		clientID, err := promptValue("Plaid client ID", viper.GetString("plaid.client_id"), 0)
+		if err != nil {
+			return err
+		}
+		secret, err := promptValue("Plaid secret", viper.GetString("plaid.secret"), '*')
+		if err != nil {
+			return err
+		}
+		environments := []string{"production", "sandbox"}
+		_, environment, err := (&promptui.Select{Label: "Plaid environment", Items: environments}).Run()
+		if err != nil {
+			return err
+		}
+
+		viper.Set("plaid.client_id", clientID)
+		viper.Set("plaid.secret", secret)
+		viper.Set("plaid.environment", environment)
+
+		client, err := PlaidClientFromConfig()
+		if err != nil {
+			return err
+		}
+		check := checkPlaidCredentials(ctx, client)
+		if check.Err == nil {
+			fmt.Println("✓ Plaid credentials work")
+			break
+		}
+		fmt.Printf("✗ %s\n  %s\n", check.Err, check.Fix)
+	}
+
+	fmt.Println("Create an Airtable personal access token with the data.records:read, data.records:write, schema.bases:read and schema.bases:write scopes at https://airtable.com/create/tokens.")
+	for {
+		token, err := promptValue("Airtable token", AirtableToken(), '*')
+		if err != nil {
+			return err
+		}
+		baseID, err := promptValue("Airtable base ID (appXXXXXXXXXXXXXX, from the base's URL)", AirtableBaseID(), 0)
+		if err != nil {
+			return err
+		}
+
+		viper.Set("airtable.token", token)
+		viper.Set("airtable.base_id", baseID)
+
+		err = CheckAirtableWriteAccess()
+		if err == nil {
+			fmt.Println("✓ Airtable token can write to the base")
+			break
+		}
+		fmt.Printf("✗ %s\n", err)
+	}
+
+	path := filepath.Join(dataDir, "config.toml")
+	err := writeInitConfig(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved %s\n", path)
+
+	_, err = (&promptui.Prompt{Label: "Create the Airtable tables and fields plaid-cli uses", IsConfirm: true}).Run()
+	if err == nil {
+		err = InitAirtableSchema(AirtableBaseID())
+		if err != nil {
+			return err
+		}
+		fmt.Println("Done. Change \"After Plaid Issues\" in Transactions to a formula field returning 1 (the API can't create formulas).")
+	} else if err != promptui.ErrAbort {
+		return err
+	}
+
+	fmt.Println("Next, link a bank with `plaid-cli link`.")
+	return nil
+}
+
+func promptValue(label string, current string, mask rune) (string, error) {
+	prompt := promptui.Prompt{
+		Label:   label,
+		Default: current,
+		Mask:    mask,
+		Validate: func(input string) error {
+			if input == "" {
+				return errors.New("Required")
+			}
+			return nil
+		},
+	}
+	return prompt.Run()
+}
+
+// writeInitConfig sets the credentials the wizard collected in the
+// config file at path, creating it if needed.
+func writeInitConfig(path string) error {
+	tree, err := toml.TreeFromMap(map[string]interface{}{})
+	if _, statErr := os.Stat(path); statErr == nil {
+		tree, err = toml.LoadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []string{"plaid.client_id", "plaid.secret", "plaid.environment", "airtable.token", "airtable.base_id"} {
+		tree.Set(key, viper.GetString(key))
+	}
+
+	s, err := tree.ToTomlString()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(s), 0600)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/spf13/viper"
+)
+
+// PlaidCountries is plaid.countries (PLAID_COUNTRIES), e.g. "US,CA",
+// which decides the institutions Link offers. It defaults to the system
+// locale's country, or US.
+func PlaidCountries() ([]plaid.CountryCode, error) {
+	var countries []string
+	for _, c := range ConfigList("plaid.countries") {
+		countries = append(countries, strings.ToUpper(c))
+	}
+	if len(countries) == 0 {
+		_, country := systemLocale()
+		countries = []string{country}
+	}
+	if !AreValidCountries(countries) {
+		return nil, errors.New(fmt.Sprintf("Unsupported countries %s. Supported: %s", strings.Join(countries, ","), strings.Join(plaidSupportedCountries, ",")))
+	}
+
+	codes := make([]plaid.CountryCode, len(countries))
+	for i, c := range countries {
+		codes[i] = plaid.CountryCode(c)
+	}
+	return codes, nil
+}
+
+// PlaidLanguage is plaid.language (PLAID_LANGUAGE), the language Link is
+// shown in. It defaults to the system locale's language, or en.
+func PlaidLanguage() (string, error) {
+	lang := strings.ToLower(viper.GetString("plaid.language"))
+	if lang == "" {
+		lang, _ = systemLocale()
+	}
+	if !IsValidLanguageCode(lang) {
+		return "", errors.New(fmt.Sprintf("Unsupported language %s. Supported: %s", lang, strings.Join(plaidSupportedLanguages, ",")))
+	}
+	return lang, nil
+}
+
+// systemLocale reads the language and country from the POSIX locale
+// variables, e.g. "fr_CA.UTF-8". Either falls back to en/US when unset
+// or not supported by Plaid.
+func systemLocale() (string, string) {
+	lang, country := "en", "US"
+
+	var locale string
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale = os.Getenv(key); locale != "" {
+			break
+		}
+	}
+	locale = strings.SplitN(locale, ".", 2)[0]
+	locale = strings.SplitN(locale, "@", 2)[0]
+	parts := strings.FieldsFunc(locale, func(r rune) bool { return r == '_' || r == '-' })
+
+	if len(parts) > 0 && IsValidLanguageCode(strings.ToLower(parts[0])) {
+		lang = strings.ToLower(parts[0])
+	}
+	if len(parts) > 1 && AreValidCountries([]string{strings.ToUpper(parts[1])}) {
+		country = strings.ToUpper(parts[1])
+	}
+	return lang, country
+}
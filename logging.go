@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// SetupLogging sends logs to stderr through slog: text by default, or one
+// JSON object per line with format "json" for systemd and log shippers.
+// verbose adds debug logs; quiet leaves only warnings and errors.
+func SetupLogging(verbose bool, quiet bool, format string) error {
+	if verbose && quiet {
+		return errors.New("Pass only one of --verbose and --quiet")
+	}
+
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	if quiet {
+		level = slog.LevelWarn
+	}
+
+	// Bars would hide warnings, and are noise in JSON logs
+	showProgressBars = showProgressBars && !quiet && (format == "" || format == "text")
+
+	var handler slog.Handler
+	switch format {
+	case "", "text":
+		handler = slog.NewTextHandler(progressWriter{}, &slog.HandlerOptions{
+			Level: level,
+			// Timestamps are noise on a terminal, and journald adds its own
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey && len(groups) == 0 {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	default:
+		return errors.New(fmt.Sprintf("Invalid log format: %s (text or json)", format))
+	}
+
+	// Also routes the standard logger, used by the pkg/ packages, through
+	// the handler
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// ErrorAttrs are the attributes to log err with. Plaid errors include
+// the error code and request ID, which Plaid support asks for.
+func ErrorAttrs(err error) []any {
+	if err == nil {
+		return nil
+	}
+	attrs := []any{"error", err}
+
+	var apiErr plaid.GenericOpenAPIError
+	if errors.As(err, &apiErr) {
+		if e, perr := plaid.ToPlaidError(apiErr); perr == nil {
+			attrs = append(attrs, "plaid_error_code", e.ErrorCode, "plaid_request_id", e.GetRequestId())
+		}
+	}
+	return attrs
+}
+
+// LogError logs msg at error level with err and any other attributes,
+// e.g. "item".
+func LogError(msg string, err error, args ...any) {
+	slog.Error(msg, append(ErrorAttrs(err), args...)...)
+}
+
+// Fatal logs like LogError, then exits with err's ExitCode, after
+// reporting any items that failed before.
+func Fatal(msg string, err error, args ...any) {
+	LogError(msg, err, args...)
+	reportItemResults()
+	HealthcheckFailed(fmt.Sprintf("%s: %s\n%s", msg, err, FailedItemsSummary()))
+	releaseRunLock()
+	os.Exit(ExitCode(err))
+}
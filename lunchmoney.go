@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/lunchmoney"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// NewLunchMoneyClient reads lunchmoney.token, falling back to
+// LUNCHMONEY_TOKEN.
+func NewLunchMoneyClient() (*lunchmoney.Client, error) {
+	token := viper.GetString("lunchmoney.token")
+	if token == "" {
+		token = os.Getenv("LUNCHMONEY_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("Set token under [lunchmoney] in the config file or LUNCHMONEY_TOKEN")
+	}
+	return &lunchmoney.Client{Token: token}, nil
+}
+
+func lunchMoneyAssetName(a Account) string {
+	if a.Mask != "" {
+		return a.DisplayName() + " " + a.Mask
+	}
+	return a.DisplayName()
+}
+
+func lunchMoneyAsset(data *plaid_cli.Data, a Account) lunchmoney.Asset {
+	asset := lunchmoney.Asset{
+		Name:     lunchMoneyAssetName(a),
+		Balance:  "0",
+		Currency: strings.ToLower(a.Balances.IsoCurrencyCode),
+	}
+	if institution, ok := data.Institutions[a.ItemID]; ok {
+		asset.InstitutionName = institution.Name
+	}
+	if a.Balances.Current != nil {
+		asset.Balance = strconv.FormatFloat(*a.Balances.Current, 'f', 2, 64)
+	}
+
+	switch a.Type {
+	case "depository":
+		asset.TypeName = "cash"
+		asset.SubtypeName = a.Subtype
+	case "credit":
+		asset.TypeName = "credit"
+		asset.SubtypeName = a.Subtype
+	case "investment", "brokerage":
+		asset.TypeName = "investment"
+		asset.SubtypeName = a.Subtype
+	case "loan":
+		asset.TypeName = "loan"
+		asset.SubtypeName = a.Subtype
+	default:
+		asset.TypeName = "other asset"
+	}
+	return asset
+}
+
+// configuredAsset is the asset lunchmoney.assets maps an account to, by
+// account ID or alias, e.g.
+//
+//	[lunchmoney.assets]
+//	checking = 12345
+func configuredAsset(data *plaid_cli.Data, accountID string) (int64, bool, error) {
+	// viper lowercases map keys, so account IDs are compared case
+	// insensitively
+	for accountOrAlias, assetID := range viper.GetStringMapString("lunchmoney.assets") {
+		matches := strings.EqualFold(accountOrAlias, accountID)
+		for alias, id := range data.AccountAliases {
+			matches = matches || (id == accountID && strings.EqualFold(alias, accountOrAlias))
+		}
+		if !matches {
+			continue
+		}
+		id, err := strconv.ParseInt(assetID, 10, 64)
+		if err != nil {
+			return 0, false, errors.New(fmt.Sprintf("Invalid lunchmoney.assets ID for %s: %s", accountOrAlias, assetID))
+		}
+		return id, true, nil
+	}
+	return 0, false, nil
+}
+
+// SyncLunchMoneyAssets finds each account's Lunch Money asset, from
+// lunchmoney.assets or by name and institution, updating its balance, and
+// creates the missing ones. Accounts ignored with `duplicates --resolve`
+// are left out. It returns the asset ID per account ID.
+func SyncLunchMoneyAssets(client *lunchmoney.Client, data *plaid_cli.Data, accounts []Account) (map[string]int64, error) {
+	existing, err := client.Assets()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int64)
+	for _, a := range accounts {
+		if _, ok := data.IgnoredAccounts[a.ID]; ok {
+			continue
+		}
+		asset := lunchMoneyAsset(data, a)
+
+		id, ok, err := configuredAsset(data, a.ID)
+		if err != nil {
+			return ids, err
+		}
+		for _, e := range existing {
+			if ok {
+				break
+			}
+			if e.Name == asset.Name && e.InstitutionName == asset.InstitutionName {
+				id, ok = e.ID, true
+			}
+		}
+
+		if !ok {
+			created, err := client.CreateAsset(asset)
+			if err != nil {
+				return ids, errors.New(fmt.Sprintf("Cannot create asset %s: %s", asset.Name, err))
+			}
+			slog.Info("Created Lunch Money asset", "asset", asset.Name, "id", created.ID)
+			ids[a.ID] = created.ID
+			continue
+		}
+
+		ids[a.ID] = id
+		if a.Balances.Current != nil {
+			err := client.UpdateBalance(id, asset.Balance)
+			if err != nil {
+				return ids, errors.New(fmt.Sprintf("Cannot update balance of asset %s: %s", asset.Name, err))
+			}
+		}
+	}
+	return ids, nil
+}
+
+// SyncLunchMoney syncs the accounts' assets, then inserts the posted
+// transactions in txs that aren't in Lunch Money yet, recognized by the
+// Plaid transaction ID in external_id. Categories are matched by the name
+// MappedCategory gives. Pending transactions are left until they post,
+// since Plaid gives them a new ID then. It returns how many were inserted.
+func SyncLunchMoney(client *lunchmoney.Client, data *plaid_cli.Data, accounts []Account, txs []Transaction) (int, error) {
+	assetIDs, err := SyncLunchMoneyAssets(client, data, accounts)
+	if err != nil {
+		return 0, err
+	}
+	if len(txs) == 0 {
+		return 0, nil
+	}
+
+	categories, err := client.Categories()
+	if err != nil {
+		return 0, err
+	}
+	categoryIDs := make(map[string]int64)
+	for _, c := range categories {
+		categoryIDs[strings.ToLower(c.Name)] = c.ID
+	}
+
+	start := txs[0].Date
+	for _, t := range txs {
+		if t.Date < start {
+			start = t.Date
+		}
+	}
+	existing := make(map[string]bool)
+	for _, id := range assetIDs {
+		ids, err := client.ExternalIDs(id, start, time.Now().Format(DateLayout))
+		if err != nil {
+			return 0, err
+		}
+		for externalID := range ids {
+			existing[externalID] = true
+		}
+	}
+
+	var inserts []lunchmoney.Transaction
+	for _, t := range txs {
+		assetID, ok := assetIDs[t.AccountID]
+		if !ok || t.Pending || t.Amount == 0 || existing[t.ID] {
+			continue
+		}
+		payee := t.MerchantName
+		if payee == "" {
+			payee = t.Name
+		}
+		inserts = append(inserts, lunchmoney.Transaction{
+			Date: t.Date,
+			// Lunch Money takes Plaid's sign, whatever amounts.sign is
+			Amount:     strconv.FormatFloat(outflow(data, t)-inflow(data, t), 'f', 2, 64),
+			Payee:      payee,
+			Currency:   strings.ToLower(t.IsoCurrencyCode),
+			AssetID:    assetID,
+			CategoryID: categoryIDs[strings.ToLower(MappedCategory(t))],
+			Status:     "cleared",
+			ExternalID: t.ID,
+		})
+	}
+
+	return client.InsertTransactions(inserts, lunchmoney.InsertOptions{
+		ApplyRules:        viper.GetBool("lunchmoney.apply_rules"),
+		CheckForRecurring: true,
+		// Balances come from Plaid
+		SkipBalanceUpdate: true,
+	})
+}
@@ -1,23 +1,33 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
-	"os/user"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 
+	"github.com/landakram/plaid-cli/pkg/httplog"
+	"github.com/landakram/plaid-cli/pkg/ics"
+	"github.com/landakram/plaid-cli/pkg/importer"
+	"github.com/landakram/plaid-cli/pkg/lunchmoney"
+	"github.com/landakram/plaid-cli/pkg/pipeline"
 	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/landakram/plaid-cli/pkg/replay"
 	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-isatty"
 	"github.com/plaid/plaid-go/v27/plaid"
 	"github.com/spf13/cobra"
 
@@ -57,87 +67,161 @@ func IsValidLanguageCode(lang string) bool {
 func main() {
 	log.SetFlags(0)
 
-	usr, _ := user.Current()
-	dir := usr.HomeDir
-	viper.SetDefault("cli.data_dir", filepath.Join(dir, ".plaid-cli"))
+	rootDir, err := DataDir(os.Args[1:])
+	if err != nil {
+		Fatal("Cannot find data directory", &ConfigError{err})
+	}
+	profile := ProfileName(os.Args[1:], rootDir)
+	err = CheckProfile(rootDir, profile)
+	if err != nil {
+		Fatal("Cannot load profile", &ConfigError{err})
+	}
 
-	dataDir := viper.GetString("cli.data_dir")
+	dataDir := ProfileDir(rootDir, profile)
 	data, err := plaid_cli.LoadData(dataDir)
 
 	if err != nil {
-		log.Fatal(err)
+		Fatal("Cannot load data", err)
 	}
+	auditLog = NewAuditLog(dataDir)
 
 	viper.SetConfigName("config")
 	viper.SetConfigType("toml")
-	viper.AddConfigPath(dataDir)
+	viper.AddConfigPath(rootDir)
 	viper.AddConfigPath(".")
 	err = viper.ReadInConfig()
 	if err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
 			// Config file not found; ignore error if desired
 		} else {
-			log.Fatal(err)
+			Fatal("Cannot read config", &ConfigError{err})
+		}
+	}
+	if dataDir != rootDir {
+		// The profile's settings override the shared ones
+		profileConfig := filepath.Join(dataDir, "config.toml")
+		if _, err := os.Stat(profileConfig); err == nil {
+			viper.SetConfigFile(profileConfig)
+			err = viper.MergeInConfig()
+			if err != nil {
+				Fatal("Cannot read config", &ConfigError{err})
+			}
 		}
 	}
 
+	viper.SetDefault("plaid.institution_cache_ttl", 7*24*time.Hour)
+	viper.SetDefault("sync.delete_window", 30*24*time.Hour)
+	viper.SetDefault("sync.transfer_window", 3*24*time.Hour)
+	viper.SetDefault("airtable.base_id", "appxCfKnRz94NZadj")
+	viper.SetDefault("airtable.transactions_table", "Transactions")
+	viper.SetDefault("categories.pfc_url", pfcTaxonomyURL)
+	viper.SetDefault("recovery.login_required", RecoverRelink)
+	viper.SetDefault("recovery.pending_expiration", RecoverRelink)
+	viper.SetDefault("recovery.invalid_access_token", RecoverLink)
+	viper.SetDefault("recovery.product_not_ready", RecoverRetry)
+	viper.SetDefault("recovery.institution_down", RecoverSkip)
+	viper.SetDefault("recovery.retries", 3)
+	viper.SetDefault("recovery.retry_delay", 30*time.Second)
+	viper.SetDefault("tax.deductible_field", "Deductible")
+	viper.SetDefault("alerts.remind", 24*time.Hour)
+	viper.SetDefault("audit.enabled", true)
+	viper.SetDefault("plaid.timeout", 2*time.Minute)
+	viper.SetDefault("airtable.timeout", time.Minute)
+
 	viper.SetEnvPrefix("")
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
 	viper.AutomaticEnv()
 
-	cfg := plaid.NewConfiguration()
-	cfg.AddDefaultHeader("PLAID-CLIENT-ID", viper.GetString("plaid.client_id"))
-	cfg.AddDefaultHeader("PLAID-SECRET", viper.GetString("plaid.secret"))
-	cfg.UseEnvironment(plaid.Production)
-	client := plaid.NewAPIClient(cfg)
+	client, err := PlaidClientFromConfig()
+	if err != nil {
+		Fatal("Invalid plaid.environment", &ConfigError{err})
+	}
 
 	ctx := context.Background()
-	linker := plaid_cli.NewLinker(data, client, []plaid.CountryCode{"US"}, "en")
+	countries, err := PlaidCountries()
+	if err != nil {
+		Fatal("Invalid plaid.countries", &ConfigError{err})
+	}
+	lang, err := PlaidLanguage()
+	if err != nil {
+		Fatal("Invalid plaid.language", &ConfigError{err})
+	}
+	linker := plaid_cli.NewLinker(data, client, countries, lang)
 
+	var replaceFlag string
 	linkCommand := &cobra.Command{
 		Use:   "link [ITEM-ID-OR-ALIAS]",
 		Short: "Link an institution so plaid-cli can pull transactions",
-		Long:  "Link an institution so plaid-cli can pull transactions. An item ID or alias can be passed to initiate a relink.",
+		Long:  "Link an institution so plaid-cli can pull transactions. An item ID or alias can be passed to initiate a relink. --replace links an institution again as a new item, e.g. when its access token is invalid, and moves the old item's alias to it.",
 		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			port := viper.GetString("link.port")
 
+			var replaced *idAndAlias
+			if replaceFlag != "" {
+				if len(args) > 0 {
+					Fatal("link failed", errors.New("--replace links a new item, so it can't be combined with relinking"))
+				}
+				item, err := ResolveItem(data, replaceFlag)
+				if err != nil {
+					Fatal("link failed", err)
+				}
+				replaced = &item
+			}
+
 			var tokenPair *plaid_cli.TokenPair
 
 			var err error
 
 			if len(args) > 0 && len(args[0]) > 0 {
-				itemOrAlias := args[0]
-
-				itemID, ok := data.Aliases[itemOrAlias]
-				if ok {
-					itemOrAlias = itemID
+				item, err := ResolveItem(data, args[0])
+				if err != nil {
+					Fatal("link failed", err)
 				}
 
-				err = linker.Relink(ctx, itemOrAlias, port)
+				err = linker.Relink(ctx, item.id, port)
 				if err != nil {
-					log.Fatalln("Cannot relink", err)
+					Fatal("Cannot relink", err, "item", ItemLabel(data, item.id))
 				}
-				log.Println("Institution relinked!")
+				slog.Info("Institution relinked", "item", ItemLabel(data, item.id))
 				return
 			} else {
 				tokenPair, err = linker.Link(ctx, port)
 				if err != nil {
-					log.Fatalln("Cannot link", err)
+					Fatal("Cannot link", err)
 				}
 				data.Tokens[tokenPair.ItemID] = tokenPair.AccessToken
 				err = data.Save()
 			}
 
 			if err != nil {
-				log.Fatalln("Cannot save", err)
+				Fatal("Cannot save", err)
+			}
+
+			slog.Info("Institution linked", "item_id", tokenPair.ItemID)
+
+			if replaced != nil {
+				err = ReplaceItem(data, *replaced, tokenPair.ItemID)
+				if err != nil {
+					Fatal("Cannot save", err)
+				}
+				slog.Info("Replaced item", "old_item_id", replaced.id, "item_id", tokenPair.ItemID)
 			}
 
-			log.Println("Institution linked!")
-			log.Println(fmt.Sprintf("Item ID: %s", tokenPair.ItemID))
+			institution, err := plaid_cli.FetchInstitution(ctx, client, data, tokenPair.AccessToken, countries, viper.GetDuration("plaid.institution_cache_ttl"))
+			if err != nil {
+				LogError("Cannot fetch institution", err, "item_id", tokenPair.ItemID)
+			} else {
+				data.Institutions[tokenPair.ItemID] = institution
+				err = data.SaveInstitutions()
+				if err != nil {
+					Fatal("Cannot save", err)
+				}
+				slog.Info("Fetched institution", "item_id", tokenPair.ItemID, "institution", institution.Name)
+			}
 
 			if alias, ok := data.BackAliases[tokenPair.ItemID]; ok {
-				log.Println(fmt.Sprintf("Alias: %s", alias))
+				slog.Info("Item already has an alias", "item_id", tokenPair.ItemID, "alias", alias)
 				return
 			}
 
@@ -154,7 +238,7 @@ func main() {
 				return nil
 			}
 
-			log.Println("You can give the institution a friendly alias and use that instead of the item ID in most commands.")
+			fmt.Fprintln(os.Stderr, "You can give the institution a friendly alias and use that instead of the item ID in most commands.")
 			prompt := promptui.Prompt{
 				Label:    "Alias (default: none)",
 				Validate: validate,
@@ -162,41 +246,89 @@ func main() {
 
 			input, err := prompt.Run()
 			if err != nil {
-				log.Fatalln(err)
+				Fatal("link failed", err)
 			}
 
 			if input != "" {
 				err = SetAlias(data, tokenPair.ItemID, input)
 				if err != nil {
-					log.Fatalln(err)
+					Fatal("link failed", err)
 				}
 			}
 		},
 	}
 
-	linkCommand.Flags().StringP("port", "p", "9090", "Port on which to serve Plaid Link")
+	linkCommand.Flags().StringVar(&replaceFlag, "replace", "", "Item ID or alias of an item the new one replaces")
+	linkCommand.Flags().StringP("port", "p", "9090", "Port on which to serve Plaid Link (0 picks a free port)")
 	viper.BindPFlag("link.port", linkCommand.Flags().Lookup("port"))
-
+	linkCommand.Flags().String("bind", "", "Address on which to serve Plaid Link (default all interfaces)")
+	viper.BindPFlag("link.bind", linkCommand.Flags().Lookup("bind"))
+	linkCommand.Flags().String("redirect-uri", "", "OAuth redirect URI registered with Plaid, e.g. https://localhost:9090/oauth-return")
+	viper.BindPFlag("link.redirect_uri", linkCommand.Flags().Lookup("redirect-uri"))
+	linkCommand.Flags().String("tls-cert", "", "Certificate file for serving Plaid Link over HTTPS")
+	viper.BindPFlag("link.tls_cert", linkCommand.Flags().Lookup("tls-cert"))
+	linkCommand.Flags().String("tls-key", "", "Key file for --tls-cert")
+	viper.BindPFlag("link.tls_key", linkCommand.Flags().Lookup("tls-key"))
+	linkCommand.Flags().Bool("hosted", false, "Link through a Plaid-hosted page that can be opened on another device")
+	viper.BindPFlag("link.hosted", linkCommand.Flags().Lookup("hosted"))
+	linkCommand.Flags().Bool("no-open", false, "Print the Link URL instead of opening a browser")
+	viper.BindPFlag("link.no_open", linkCommand.Flags().Lookup("no-open"))
+	linkCommand.Flags().String("external-host", "", "Host name to print in the Link URL, e.g. a Tailscale name, to link from another machine")
+	viper.BindPFlag("link.external_host", linkCommand.Flags().Lookup("external-host"))
+	linkCommand.Flags().Int("days-requested", 365, "Days of transaction history to request when linking a new item, up to 730")
+	viper.BindPFlag("link.days_requested", linkCommand.Flags().Lookup("days-requested"))
+	linkCommand.Flags().StringSlice("products", []string{"transactions"}, "Plaid products to request when linking a new item, e.g. transactions,auth,investments")
+	viper.BindPFlag("link.products", linkCommand.Flags().Lookup("products"))
+
+	var revealFlag bool
+	var tokensFormat string
 	tokensCommand := &cobra.Command{
 		Use:   "tokens",
 		Short: "List access tokens",
+		Long:  "List access tokens. Tokens are masked unless --reveal is passed.",
 		Run: func(cmd *cobra.Command, args []string) {
-			resolved := make(map[string]string)
+			tokens := make(map[string]string)
 			for itemID, token := range data.Tokens {
-				if alias, ok := data.BackAliases[itemID]; ok {
-					resolved[alias] = token
-				} else {
-					resolved[itemID] = token
+				if !revealFlag {
+					token = MaskToken(token)
 				}
+				tokens[itemID] = token
 			}
 
-			printJSON, err := json.MarshalIndent(resolved, "", "  ")
-			if err != nil {
-				log.Fatalln(err)
+			switch tokensFormat {
+			case "json":
+				resolved := make(map[string]string)
+				for itemID, token := range tokens {
+					resolved[ItemLabel(data, itemID)] = token
+				}
+
+				printJSON, err := json.MarshalIndent(resolved, "", "  ")
+				if err != nil {
+					Fatal("tokens failed", err)
+				}
+				fmt.Println(string(printJSON))
+			case "table":
+				var itemIDs []string
+				for itemID := range tokens {
+					itemIDs = append(itemIDs, itemID)
+				}
+				sort.Slice(itemIDs, func(i, j int) bool {
+					return ItemLabel(data, itemIDs[i]) < ItemLabel(data, itemIDs[j])
+				})
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "NAME\tITEM ID\tACCESS TOKEN")
+				for _, itemID := range itemIDs {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", ItemLabel(data, itemID), itemID, tokens[itemID])
+				}
+				w.Flush()
+			default:
+				Fatal("tokens failed", errors.New(fmt.Sprintf("Invalid output format: %s", tokensFormat)))
 			}
-			fmt.Println(string(printJSON))
 		},
 	}
+	tokensCommand.Flags().BoolVar(&revealFlag, "reveal", false, "Show full access tokens")
+	tokensCommand.Flags().StringVarP(&tokensFormat, "output-format", "o", "json", "Output format (json or table)")
 
 	aliasCommand := &cobra.Command{
 		Use:   "alias [ITEM-ID] [NAME]",
@@ -209,85 +341,189 @@ func main() {
 
 			err := SetAlias(data, itemID, alias)
 			if err != nil {
-				log.Fatalln(err)
+				Fatal("alias failed", err)
+			}
+		},
+	}
+
+	var aliasAccountForceFlag bool
+	aliasAccountCommand := &cobra.Command{
+		Use:   "alias-account [ACCOUNT-ID] [NAME]",
+		Short: "Give an account a friendly name",
+		Long:  "Give an account a friendly name. You can use this name instead of the account ID with --account-id. The account must belong to a linked item, unless --force, e.g. for importing an account no longer linked.",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			items, err := ResolveItems(data, "all")
+			if err != nil {
+				Fatal("alias-account failed", err)
+			}
+			var accountIDs []string
+			for _, a := range FetchAllAccounts(ctx, client, data, linker, items) {
+				accountIDs = append(accountIDs, a.ID)
+			}
+
+			err = SetAccountAlias(data, accountIDs, args[0], args[1], aliasAccountForceFlag)
+			if err != nil {
+				Fatal("alias-account failed", err)
+			}
+		},
+	}
+	aliasAccountCommand.Flags().BoolVar(&aliasAccountForceFlag, "force", false, "Alias an account that isn't in any linked item")
+
+	renameAliasCommand := &cobra.Command{
+		Use:   "rename-alias [OLD-NAME] [NEW-NAME]",
+		Short: "Rename an alias",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RenameAlias(data, args[0], args[1])
+			if err != nil {
+				Fatal("rename-alias failed", err)
+			}
+		},
+	}
+
+	removeAliasCommand := &cobra.Command{
+		Use:   "remove-alias [NAME]",
+		Short: "Remove an alias",
+		Long:  "Remove an alias. The linked institution is kept and can still be referred to by its item ID.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RemoveAlias(data, args[0])
+			if err != nil {
+				Fatal("remove-alias failed", err)
 			}
 		},
 	}
 
+	var accountAliasesFlag bool
 	aliasesCommand := &cobra.Command{
 		Use:   "aliases",
 		Short: "List aliases",
 		Run: func(cmd *cobra.Command, args []string) {
-			printJSON, err := json.MarshalIndent(data.Aliases, "", "  ")
+			aliases := data.Aliases
+			if accountAliasesFlag {
+				aliases = data.AccountAliases
+			}
+
+			printJSON, err := json.MarshalIndent(aliases, "", "  ")
 			if err != nil {
-				log.Fatalln(err)
+				Fatal("aliases failed", err)
 			}
 			fmt.Println(string(printJSON))
 		},
 	}
 
+	aliasesCommand.Flags().BoolVarP(&accountAliasesFlag, "accounts", "a", false, "List account aliases instead of item aliases")
+
+	var accountsFormat string
 	accountsCommand := &cobra.Command{
 		Use:   "accounts [ITEM-ID-OR-ALIAS]",
 		Short: "List accounts for a given institution",
 		Long:  "List accounts for a given institution. An account ID returned from this command can be used as a filter when listing transactions.",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			itemOrAlias := args[0]
+			items, err := ResolveItems(data, args[0])
+			if err != nil {
+				Fatal("accounts failed", err)
+			}
 
-			var items []idAndAlias
+			allAccounts := FetchAllAccounts(ctx, client, data, linker, items)
 
-			if itemOrAlias == "all" {
-				for alias, itemID := range data.Aliases {
-					items = append(items, idAndAlias{itemID, alias})
+			sort.SliceStable(allAccounts, func(i, j int) bool {
+				li, lj := ItemLabel(data, allAccounts[i].ItemID), ItemLabel(data, allAccounts[j].ItemID)
+				if li != lj {
+					return li < lj
 				}
-			} else {
-				itemID, ok := data.Aliases[itemOrAlias]
-				if !ok {
-					panic("Unknown alias")
+				return allAccounts[i].DisplayName() < allAccounts[j].DisplayName()
+			})
+
+			switch accountsFormat {
+			case "table":
+				PrintAccountsTable(data, allAccounts)
+			case "json":
+				b, err := json.MarshalIndent(allAccounts, "", "  ")
+				if err != nil {
+					Fatal("accounts failed", err)
 				}
-				items = append(items, idAndAlias{itemID, itemOrAlias})
+
+				fmt.Println(string(b))
+			default:
+				Fatal("accounts failed", errors.New(fmt.Sprintf("Invalid output format: %s", accountsFormat)))
+			}
+		},
+	}
+	accountsCommand.Flags().StringVarP(&accountsFormat, "output-format", "o", "table", "Output format (table or json)")
+
+	syncAccountsCommand := &cobra.Command{
+		Use:   "sync-accounts [ITEM-ID-OR-ALIAS]",
+		Short: "Sync accounts for a given institution to Airtable",
+		Long:  "Sync accounts for a given institution to Airtable. Missing accounts are created, renamed accounts and balances are updated, and accounts Plaid no longer returns are marked inactive.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			items, err := ResolveItems(data, args[0])
+			if err != nil {
+				Fatal("sync-accounts failed", err)
 			}
 
-			for _, item := range items {
-				if item.id == "7jKq173RmNfQyGvRnw6XFxQjKVlo8DcgjdEMJ" {
-					// Sandbox item
-					continue
+			destinations, err := RouteItems(data, items)
+			if err != nil {
+				Fatal("sync-accounts failed", err)
+			}
+
+			for _, destination := range destinations {
+				UseAirtableDestination(destination)
+				items := destination.Items
+
+				err = CheckAirtableWriteAccess()
+				if err != nil {
+					Fatal("sync-accounts failed", err)
 				}
-				err = WithRelinkOnAuthError(ctx, idAndAlias{id: item.id}, data, linker, func() error {
-					fmt.Println("Syncing accounts for ", item)
-					token := data.Tokens[item.id]
-					res, _, err := client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(plaid.AccountsGetRequest{
-						AccessToken: token,
-					}).Execute()
-					if err != nil {
-						log.Println(item, err)
-						return nil
-					}
 
-					err = SyncAccounts(res.Accounts)
-					if err != nil {
-						return err
-					}
+				allAccounts := FetchAllAccounts(ctx, client, data, linker, items)
 
-					b, err := json.MarshalIndent(res.Accounts, "", "  ")
-					if err != nil {
-						return err
+				var institutions []plaid_cli.Institution
+				for _, item := range items {
+					institution, ok := data.Institutions[item.id]
+					if !ok {
+						// Items linked before institution metadata was stored
+						institution, err = plaid_cli.FetchInstitution(ctx, client, data, data.Tokens[item.id], countries, viper.GetDuration("plaid.institution_cache_ttl"))
+						if err != nil {
+							ItemFailed("Cannot fetch institution", err, ItemLabel(data, item.id))
+							continue
+						}
+						data.Institutions[item.id] = institution
+						err = data.SaveInstitutions()
+						if err != nil {
+							Fatal("sync-accounts failed", err)
+						}
 					}
+					institutions = append(institutions, institution)
+				}
 
-					fmt.Println(string(b))
+				institutionRecordIDs, err := SyncInstitutions(institutions)
+				if err != nil {
+					Fatal("sync-accounts failed", err)
+				}
 
-					return nil
-				})
+				institutionLinks := make(map[string]string)
+				for _, item := range items {
+					if institution, ok := data.Institutions[item.id]; ok {
+						institutionLinks[item.id] = institutionRecordIDs[institution.ID]
+					}
+				}
+
+				err = SyncAccounts(allAccounts, institutionLinks)
 				if err != nil {
-					log.Fatalln(err)
+					Fatal("sync-accounts failed", err)
 				}
+				AlertBalances(data, allAccounts)
 			}
-
 		},
 	}
 
 	var fromFlag string
 	var toFlag string
+	var countFlag int
 	var accountID string
 	var outputFormat string
 	transactionsCommand := &cobra.Command{
@@ -295,268 +531,2139 @@ func main() {
 		Short: "List transactions for a given institution",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			itemOrAlias := args[0]
-			itemID, ok := data.Aliases[itemOrAlias]
-			if ok {
-				itemOrAlias = itemID
+			item, err := ResolveItem(data, args[0])
+			if err != nil {
+				Fatal("transactions failed", err)
+			}
+
+			if countFlag < 1 || countFlag > pipeline.MaxPageSize {
+				Fatal("transactions failed", errors.New(fmt.Sprintf("Invalid --count: %d. Plaid allows 1 to %d", countFlag, pipeline.MaxPageSize)))
+			}
+			if outputFormat == "xlsx" && isatty.IsTerminal(os.Stdout.Fd()) {
+				Fatal("transactions failed", errors.New("Redirect xlsx output to a file, e.g. > transactions.xlsx"))
+			}
+
+			from, to, err := ParseDateRange(fromFlag, toFlag)
+			if err != nil {
+				Fatal("transactions failed", err)
 			}
 
-			err := WithRelinkOnAuthError(ctx, idAndAlias{id: itemOrAlias}, data, linker, func() error {
-				token := data.Tokens[itemOrAlias]
+			rates, err := NewRatesProvider()
+			if err != nil {
+				Fatal("transactions failed", err)
+			}
+
+			names, err := NewNameNormalizer()
+			if err != nil {
+				Fatal("transactions failed", err)
+			}
+
+			fields, err := LoadFieldCache(data.DataDir)
+			if err != nil {
+				Fatal("transactions failed", err)
+			}
+
+			err = WithRelinkOnAuthError(ctx, item, data, linker, func() error {
+				token := data.Tokens[item.id]
 
 				var accountIDs []string
 				if len(accountID) > 0 {
-					accountIDs = append(accountIDs, accountID)
+					accountIDs = append(accountIDs, ResolveAccountID(data, accountID))
 				}
 
 				options := plaid.NewTransactionsGetRequestOptions()
+				options.SetCount(int32(countFlag))
 				options.SetAccountIds(accountIDs)
+				options.SetIncludePersonalFinanceCategory(true)
+				options.SetIncludeOriginalDescription(true)
 				req := plaid.TransactionsGetRequest{
-					StartDate:   fromFlag,
-					EndDate:     toFlag,
+					StartDate:   from.Format(DateLayout),
+					EndDate:     to.Format(DateLayout),
 					Options:     options,
 					AccessToken: token,
 				}
 
-				transactions, err := AllTransactions(ctx, req, client)
+				progress := StartProgress(ItemLabel(data, item.id), NewDownloadETA(0))
+				transactions, err := pipeline.AllTransactions(ctx, req, client, progress.Update)
+				progress.Finish()
+				if err != nil {
+					return err
+				}
+				NormalizeAmounts(data, transactions)
+				err = ConvertCurrency(transactions, rates)
 				if err != nil {
 					return err
 				}
+				NormalizeNames(transactions, names)
+				fields.Apply(transactions)
 
-				serializer, err := NewTransactionSerializer(outputFormat)
+				salt := ""
+				if outputFormat == "anonymized" {
+					salt, err = AnonymizeSalt(dataDir)
+					if err != nil {
+						return err
+					}
+				}
+				serializer, err := pipeline.NewTransactionSerializer(outputFormat, salt)
 				if err != nil {
 					return err
 				}
 
-				b, err := serializer.serialize(transactions)
+				b, err := serializer.Serialize(transactions)
 				if err != nil {
 					return err
 				}
 
+				// Written as is: xlsx is binary and ndjson already ends in a newline
+				if outputFormat == "xlsx" || outputFormat == "ndjson" {
+					_, err = os.Stdout.Write(b)
+					return err
+				}
 				fmt.Println(string(b))
 
 				return nil
 			})
 
 			if err != nil {
-				log.Fatalln(err)
+				Fatal("transactions failed", err)
 			}
 		},
 	}
-	transactionsCommand.Flags().StringVarP(&fromFlag, "from", "f", "", "Date of first transaction (required)")
+	transactionsCommand.Flags().StringVarP(&fromFlag, "from", "f", "", "Date of first transaction, e.g. 2020-06-01, 30d, 3m, ytd or last-month (required)")
 	transactionsCommand.MarkFlagRequired("from")
 
-	transactionsCommand.Flags().StringVarP(&toFlag, "to", "t", "", "Date of last transaction (required)")
-	transactionsCommand.MarkFlagRequired("to")
+	transactionsCommand.Flags().StringVarP(&toFlag, "to", "t", "", "Date of last transaction, e.g. 2020-06-30, yesterday or last-month (default today)")
 
-	transactionsCommand.Flags().StringVarP(&outputFormat, "output-format", "o", "json", "Output format")
-	transactionsCommand.Flags().StringVarP(&accountID, "account-id", "a", "", "Fetch transactions for this account ID only.")
+	transactionsCommand.Flags().IntVar(&countFlag, "count", pipeline.MaxPageSize, "Transactions to request per page from Plaid, up to 500")
+
+	transactionsCommand.Flags().StringVarP(&outputFormat, "output-format", "o", "json", "Output format (json, ndjson, csv, xlsx, or anonymized)")
+	transactionsCommand.Flags().StringVarP(&accountID, "account-id", "a", "", "Fetch transactions for this account ID or account alias only.")
 
 	airtableSyncCommand := &cobra.Command{
 		Use:   "sync-transactions [ITEM-ID-OR-ALIAS]",
 		Short: "Sync transactions for a given institution",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			itemOrAlias := args[0]
-
-			var items []idAndAlias
+			items, err := ResolveItems(data, args[0])
+			if err != nil {
+				Fatal("sync-transactions failed", err)
+			}
 
-			if itemOrAlias == "all" {
-				for alias, itemID := range data.Aliases {
-					items = append(items, idAndAlias{itemID, alias})
+			if from := viper.GetString("sync.from"); from != "" {
+				_, err = ParseDate(from, false)
+				if err != nil {
+					Fatal("sync-transactions failed", err)
 				}
-			} else {
-				itemID, ok := data.Aliases[itemOrAlias]
-				if !ok {
-					panic("Unknown alias")
+			}
+
+			owner := viper.GetString("household.owner")
+			if args[0] == "all" {
+				items, err = OwnedItems(data, items)
+				if err != nil {
+					Fatal("sync-transactions failed", err)
 				}
-				items = append(items, idAndAlias{itemID, itemOrAlias})
 			}
 
-			var transactionsMu sync.Mutex
-			var allTransactions []plaid.Transaction
+			destinations, err := RouteItems(data, items)
+			if err != nil {
+				Fatal("sync-transactions failed", err)
+			}
 
-			var wg sync.WaitGroup
+			var lunchMoneyClient *lunchmoney.Client
+			if viper.GetBool("sync.lunchmoney") {
+				lunchMoneyClient, err = NewLunchMoneyClient()
+				if err != nil {
+					Fatal("sync-transactions failed", err)
+				}
+			}
 
-			for _, item := range items {
-				if item.id == "7jKq173RmNfQyGvRnw6XFxQjKVlo8DcgjdEMJ" {
-					// Sandbox item
-					continue
+			for _, destination := range destinations {
+				UseAirtableDestination(destination)
+				items := destination.Items
+				if len(destinations) > 1 {
+					slog.Info("Syncing to Airtable", "base", destination.BaseID, "table", destination.TransactionsTable, "items", len(items))
 				}
-				wg.Add(1)
-				go func(item idAndAlias) {
-					defer wg.Done()
-					fmt.Println("Downloading transactions for ", item)
-					err := WithRelinkOnAuthError(ctx, item, data, linker, func() error {
-						token := data.Tokens[item.id]
 
-						var accountIDs []string
-						if len(accountID) > 0 {
-							accountIDs = append(accountIDs, accountID)
-						}
+				err = CheckAirtableWriteAccess()
+				if err != nil {
+					Fatal("sync-transactions failed", err)
+				}
 
-						layout := "2006-01-02"
-						now := time.Now()
-						start := time.Date(2024, time.May, 24, 0, 0, 0, 0, time.Local)
-						if item.alias == "citi" {
-							start = time.Date(2023, time.August, 1, 0, 0, 0, 0, time.Local)
-						}
+				summary := NewRunSummary()
 
-						options := plaid.NewTransactionsGetRequestOptions()
-						options.SetAccountIds(accountIDs)
-						req := plaid.TransactionsGetRequest{
-							StartDate:   start.Format(layout),
-							EndDate:     now.Format(layout),
-							Options:     options,
-							AccessToken: token,
-						}
+				var allTransactions []Transaction
+				var wg sync.WaitGroup
 
-						transactions, err := AllTransactions(ctx, req, client)
-						if err != nil {
-							return err
-						}
+				downloadStart := time.Now()
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					allTransactions = DownloadTransactions(ctx, client, data, linker, items, nil)
+					if viper.GetBool("sync.dedupe") {
+						allTransactions = RemoveDuplicates(allTransactions)
+					}
+				}()
 
-						/*data, err := json.Marshal(transactions)
-						if err != nil {
-							return err
-						}
-						err = os.WriteFile("/tmp/citi.json", data, 0777)
-						if err != nil {
-							return err
-						}*/
+				var airtableTransactions []TransactionRecord
+				err = summary.Time("airtable fetch", func() error {
+					var err error
+					airtableTransactions, err = FetchAirtableTransactions(SyncFields, SyncWindowStart(items))
+					return err
+				})
+				if err != nil {
+					NotifySync(summary, err)
+					Fatal("sync-transactions failed", err)
+				}
 
-						transactionsMu.Lock()
-						allTransactions = append(allTransactions, transactions...)
-						transactionsMu.Unlock()
-						return nil
-					})
+				wg.Wait()
+				summary.Add("plaid download", downloadStart)
 
+				opts := SyncOptions{
+					Owner:        owner,
+					DeleteCutoff: DeleteCutoff(items),
+					SoftDelete:   viper.GetBool("sync.soft_delete"),
+				}
+				if viper.GetBool("sync.snapshot") {
+					opts.SnapshotDir = SnapshotDir(data.DataDir)
+				}
+				if owner != "" {
+					opts.AccountOwners, err = FetchAccountOwners()
 					if err != nil {
-						log.Println(item, err)
+						Fatal("sync-transactions failed", err)
 					}
-				}(item)
-			}
-
-			airtableTransactions, err := FetchAirtableTransactions()
-			if err != nil {
-				log.Fatalln(err)
-			}
-
-			wg.Wait()
-
-			fmt.Println("Syncing all transactions")
-			err = Sync(allTransactions, airtableTransactions)
-			if err != nil {
-				log.Fatalln(err)
-			}
-		},
-	}
-
-	unlinkCommand := &cobra.Command{
-		Use:   "unlink [ITEM-ID-OR-ALIAS]",
-		Short: "Unlink given institution",
-		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
-			itemOrAlias := args[0]
-
-			var items []idAndAlias
+				}
 
-			if itemOrAlias == "all" {
-				for alias, itemID := range data.Aliases {
-					items = append(items, idAndAlias{itemID, alias})
+				synced := make(map[string]struct{}, len(airtableTransactions))
+				for _, t := range airtableTransactions {
+					synced[t.Fields.PlaidID] = struct{}{}
 				}
-			} else {
-				itemID, ok := data.Aliases[itemOrAlias]
-				if !ok {
-					panic("Unknown alias")
+				var newTransactions []Transaction
+				for _, t := range allTransactions {
+					if _, ok := synced[t.ID]; !ok {
+						newTransactions = append(newTransactions, t)
+					}
 				}
-				items = append(items, idAndAlias{itemID, itemOrAlias})
-			}
-
-			for _, item := range items {
-				_, _, err := client.PlaidApi.ItemRemove(ctx).ItemRemoveRequest(plaid.ItemRemoveRequest{
-					AccessToken: data.Tokens[item.id],
-				}).Execute()
 
-				if err != nil {
-					log.Fatal("Could not unlink", item, err)
+				slog.Info("Syncing all transactions")
+				err = Sync(allTransactions, airtableTransactions, summary, opts)
+				if err == nil {
+					AlertTransactions(data, newTransactions)
 				}
-
-				delete(data.Aliases, item.alias)
-				delete(data.BackAliases, item.id)
-				delete(data.Tokens, item.id)
-				err = data.Save()
+				if err == nil && viper.GetBool("sync.detect_transfers") {
+					var n int
+					n, err = LinkTransfers(DetectTransfers(allTransactions, TransferWindow()), SyncWindowStart(items))
+					if err == nil && n > 0 {
+						slog.Info("Linked transfer transactions", "count", n)
+					}
+				}
+				if err == nil {
+					err = SyncFieldCache(data.DataDir, SyncWindowStart(items))
+				}
+				if err == nil && lunchMoneyClient != nil {
+					var n int
+					n, err = SyncLunchMoney(lunchMoneyClient, data, FetchAllAccounts(ctx, client, data, linker, items), allTransactions)
+					slog.Info("Inserted Lunch Money transactions", "count", n)
+				}
+				if err == nil && viper.GetBool("budgets.sync") {
+					if ItemsFailed() {
+						slog.Warn("Not updating Budgets: items failed, so spending would be missing")
+					} else if args[0] == "all" {
+						err = SyncBudgets(data, allTransactions, time.Now())
+					} else {
+						slog.Warn("Not updating Budgets: only syncing all items covers every account")
+					}
+				}
+				if owner != "" {
+					if logErr := RecordSyncLog(owner, SyncedAccountIDs(allTransactions), summary); logErr != nil {
+						LogError("Cannot write Sync Log", logErr)
+					}
+				}
+				summary.Print()
+				if recordErr := summary.Record(data.DataDir); recordErr != nil {
+					LogError("Cannot record run summary", recordErr)
+				}
+				NotifySync(summary, err)
 				if err != nil {
-					log.Println(item, err)
+					Fatal("sync-transactions failed", err)
 				}
 			}
 		},
 	}
-
-	airtableFixCommand := &cobra.Command{
-		Use:   "fix-airtable",
-		Short: "Fix duplicate airtable transactions",
+	airtableSyncCommand.Flags().String("from", "", "Sync transactions from this date, e.g. 2024-01-01, 90d or ytd, instead of each item's default window")
+	viper.BindPFlag("sync.from", airtableSyncCommand.Flags().Lookup("from"))
+	airtableSyncCommand.Flags().Bool("lunchmoney", false, "Also insert new transactions into Lunch Money")
+	viper.BindPFlag("sync.lunchmoney", airtableSyncCommand.Flags().Lookup("lunchmoney"))
+	airtableSyncCommand.Flags().Bool("snapshot", false, "Snapshot the Airtable Transactions table before updating or deleting records")
+	viper.BindPFlag("sync.snapshot", airtableSyncCommand.Flags().Lookup("snapshot"))
+
+	transfersCommand := &cobra.Command{
+		Use:   "transfers [ITEM-ID-OR-ALIAS]",
+		Short: "List transfers between your own accounts",
+		Long:  "List transfers between your own accounts: transactions in different accounts with opposite amounts, within sync.transfer_window of each other. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			airtableTransactions, err := FetchAirtableTransactions()
-			if err != nil {
-				log.Fatalln(err)
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
 			}
-
-			fmt.Println("Syncing all transactions")
-			err = FixAT(airtableTransactions)
+			items, err := ResolveItems(data, itemOrAlias)
 			if err != nil {
-				log.Fatalln(err)
+				Fatal("transfers failed", err)
 			}
+
+			transactions := DownloadTransactions(ctx, client, data, linker, items, nil)
+			PrintTransfers(data, DetectTransfers(transactions, TransferWindow()))
 		},
 	}
 
-	var withStatusFlag bool
-	var withOptionalMetadataFlag bool
-	insitutionCommand := &cobra.Command{
-		Use:   "institution [ITEM-ID-OR-ALIAS]",
-		Short: "Get information about an institution",
-		Long:  "Get information about an institution. Status can be reported using a flag.",
-		Args:  cobra.ExactArgs(1),
+	var rulesFlag bool
+	splitCommand := &cobra.Command{
+		Use:   "split [PLAID-TRANSACTION-ID]",
+		Short: "Split an Airtable transaction into several categorized parts",
+		Long:  "Split an Airtable transaction into several parts, each with its own amount and category. The original is kept with Split checked, and the parts link to it. With --rules, applies split.rules from the config file to recent transactions instead.",
+		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			itemOrAlias := args[0]
-			itemID, ok := data.Aliases[itemOrAlias]
-			if ok {
-				itemOrAlias = itemID
+			err := CheckAirtableWriteAccess()
+			if err != nil {
+				Fatal("split failed", err)
 			}
 
-			err := WithRelinkOnAuthError(ctx, idAndAlias{id: itemOrAlias}, data, linker, func() error {
-				token := data.Tokens[itemOrAlias]
-
-				_, _, err := client.PlaidApi.ItemGet(ctx).ItemGetRequest(plaid.ItemGetRequest{
-					AccessToken: token,
-				}).Execute()
+			if rulesFlag {
+				n, err := ApplySplitRules(time.Now().Add(-viper.GetDuration("sync.delete_window")))
 				if err != nil {
-					return err
+					Fatal("split failed", err)
 				}
+				slog.Info("Split transactions", "count", n)
+				return
+			}
 
-				/*instID := itemResp.Item.InstitutionId
+			if len(args) == 0 {
+				Fatal("split failed", errors.New("Pass a Plaid transaction ID, or --rules"))
+			}
 
-				opts := plaid.GetInstitutionByIDOptions{
-					IncludeOptionalMetadata: withOptionalMetadataFlag,
-					IncludeStatus:           withStatusFlag,
+			var parts []SplitPart
+			for {
+				prompt := promptui.Prompt{
+					Label: fmt.Sprintf("Part %d as \"<amount> <category>\" (empty when done)", len(parts)+1),
 				}
-				resp, err := client.GetInstitutionByIDWithOptions(instID, countries, opts)
+				input, err := prompt.Run()
 				if err != nil {
-					return err
+					Fatal("split failed", err)
+				}
+				input = strings.TrimSpace(input)
+				if input == "" {
+					break
 				}
 
-				b, err := json.MarshalIndent(resp.Institution, "", "  ")
+				fields := strings.SplitN(input, " ", 2)
+				amount, err := strconv.ParseFloat(fields[0], 64)
 				if err != nil {
-					return err
+					fmt.Fprintln(os.Stderr, "Invalid amount:", fields[0])
+					continue
 				}
+				part := SplitPart{Amount: amount}
+				if len(fields) > 1 {
+					part.Category = strings.TrimSpace(fields[1])
+				}
+				parts = append(parts, part)
+			}
 
-				fmt.Println(string(b))*/
-
-				return nil
-			})
+			err = SplitTransaction(args[0], parts)
+			if err != nil {
+				Fatal("split failed", err)
+			}
+		},
+	}
+	splitCommand.Flags().BoolVar(&rulesFlag, "rules", false, "Apply split.rules instead of splitting one transaction")
+
+	var reviewSinceFlag string
+	reviewCommand := &cobra.Command{
+		Use:   "review",
+		Short: "Categorize Airtable transactions that have no category",
+		Long:  "Go through Airtable transactions with an empty CategoryLookup, oldest first, and pick a category for each from the Categories table. Type to fuzzy-search categories. Picks are written back in batches; quitting or Ctrl-C saves what was picked so far.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			since, err := ParseDate(reviewSinceFlag, false)
+			if err != nil {
+				Fatal("review failed", err)
+			}
+
+			err = CheckAirtableWriteAccess()
+			if err != nil {
+				Fatal("review failed", err)
+			}
+
+			records, err := UncategorizedTransactions(since)
+			if err != nil {
+				Fatal("review failed", err)
+			}
+			if len(records) == 0 {
+				slog.Info("No transactions to review")
+				return
+			}
+
+			n, err := ReviewTransactions(records)
+			slog.Info("Categorized transactions", "count", n, "remaining", len(records)-n)
+			if err != nil {
+				Fatal("review failed", err)
+			}
+		},
+	}
+	reviewCommand.Flags().StringVar(&reviewSinceFlag, "since", "90d", "Review transactions on or after this date, e.g. 2024-01-01 or 6m")
+
+	var resolveFlag bool
+	duplicatesCommand := &cobra.Command{
+		Use:   "duplicates [ITEM-ID-OR-ALIAS]",
+		Short: "Find transactions that show up in two accounts",
+		Long:  "Find transactions with the same date, amount, merchant and account mask in different accounts, which happens when a card is linked through two items. With --resolve, pick which account to keep syncing; the others are ignored from then on. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("duplicates failed", err)
+			}
+
+			transactions := DownloadTransactions(ctx, client, data, linker, items, nil)
+			groups := DetectDuplicates(transactions)
+			if len(groups) == 0 {
+				fmt.Println("No duplicates found")
+				return
+			}
+
+			PrintDuplicates(groups)
+			if resolveFlag {
+				err = ResolveDuplicates(data, groups)
+				if err != nil {
+					Fatal("duplicates failed", err)
+				}
+			}
+		},
+	}
+	duplicatesCommand.Flags().BoolVar(&resolveFlag, "resolve", false, "Choose which account to keep for each set of duplicated accounts")
+
+	var olderThanFlag time.Duration
+	purgeCommand := &cobra.Command{
+		Use:   "purge",
+		Short: "Delete transactions that sync marked as removed",
+		Long:  "Delete Airtable transactions that sync-transactions marked as removed (with sync.soft_delete on).",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := CheckAirtableWriteAccess()
+			if err != nil {
+				Fatal("purge failed", err)
+			}
+
+			n, err := PurgeRemovedTransactions(olderThanFlag)
+			if err != nil {
+				Fatal("purge failed", err)
+			}
+
+			slog.Info("Deleted removed transactions", "count", n)
+		},
+	}
+	purgeCommand.Flags().DurationVar(&olderThanFlag, "older-than", 0, "Only delete transactions removed at least this long ago, e.g. 720h")
+
+	var sinceFlag string
+	backfillCategoriesCommand := &cobra.Command{
+		Use:   "backfill-categories [ITEM-ID-OR-ALIAS]",
+		Short: "Fill in personal finance categories on already synced transactions",
+		Long:  "Fill in the PFCPrimary, PFCDetailed and PFCConfidence columns on Airtable transactions synced before they existed. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("backfill-categories failed", err)
+			}
+
+			since, err := ParseDate(sinceFlag, false)
+			if err != nil {
+				Fatal("backfill-categories failed", err)
+			}
+
+			err = CheckAirtableWriteAccess()
+			if err != nil {
+				Fatal("backfill-categories failed", err)
+			}
+
+			transactions := DownloadTransactionsSince(ctx, client, data, linker, items, nil, func(idAndAlias) time.Time {
+				return since
+			})
+
+			n, err := BackfillPFC(transactions)
+			if err != nil {
+				Fatal("backfill-categories failed", err)
+			}
+			slog.Info("Backfilled categories", "count", n)
+		},
+	}
+	// Plaid keeps up to two years of history
+	backfillCategoriesCommand.Flags().StringVar(&sinceFlag, "since", "2y", "Backfill transactions on or after this date, e.g. 2024-01-01 or 6m")
+
+	var backfillFieldsSinceFlag string
+	backfillFieldsCommand := &cobra.Command{
+		Use:   "backfill-fields FIELDS [ITEM-ID-OR-ALIAS]",
+		Short: "Fill in columns added after transactions were synced",
+		Long:  "Fill in columns that sync only writes on new transactions on those synced before them. FIELDS is a comma separated list of: " + strings.Join(backfillFieldNames(), ", ") + ". Defaults to all items.",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var backfills []string
+			for _, name := range strings.Split(args[0], ",") {
+				name = strings.TrimSpace(name)
+				if _, ok := FieldBackfills[name]; !ok {
+					Fatal("backfill-fields failed", errors.New(fmt.Sprintf("Unknown fields %s, expected one of: %s", name, strings.Join(backfillFieldNames(), ", "))))
+				}
+				backfills = append(backfills, name)
+			}
+
+			itemOrAlias := "all"
+			if len(args) > 1 {
+				itemOrAlias = args[1]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("backfill-fields failed", err)
+			}
+
+			since, err := ParseDate(backfillFieldsSinceFlag, false)
+			if err != nil {
+				Fatal("backfill-fields failed", err)
+			}
+
+			err = CheckAirtableWriteAccess()
+			if err != nil {
+				Fatal("backfill-fields failed", err)
+			}
+
+			transactions := DownloadTransactionsSince(ctx, client, data, linker, items, nil, func(idAndAlias) time.Time {
+				return since
+			})
+
+			for _, name := range backfills {
+				n, err := BackfillFields(transactions, FieldBackfills[name])
+				if err != nil {
+					Fatal("backfill-fields failed", err)
+				}
+				slog.Info("Backfilled fields", "fields", name, "count", n)
+			}
+		},
+	}
+	backfillFieldsCommand.Flags().StringVar(&backfillFieldsSinceFlag, "since", "2y", "Backfill transactions on or after this date, e.g. 2024-01-01 or 6m")
+
+	validatePipelineCommand := &cobra.Command{
+		Use:   "validate-pipeline [ITEM-ID-OR-ALIAS]",
+		Short: "Check what sync-transactions would write without writing it",
+		Long:  "Check what sync-transactions would write without writing it. Reports how many transactions each names.rules, split.rules and category mapping rule matches, personal finance categories with no mapping, and records that would fail Airtable type checks. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("validate-pipeline failed", err)
+			}
+
+			transactions := DownloadTransactions(ctx, client, data, linker, items, nil)
+
+			rules, err := LoadPipelineRules()
+			if err != nil {
+				Fatal("validate-pipeline failed", &ConfigError{err})
+			}
+
+			airtableAccounts, err := FetchAirtableAccounts()
+			if err != nil {
+				Fatal("validate-pipeline failed", err)
+			}
+
+			categories, err := FetchAirtableCategories()
+			if err != nil {
+				Fatal("validate-pipeline failed", err)
+			}
+
+			report := ValidatePipeline(TransactionRecords(transactions), airtableAccounts, categories, rules)
+			report.Print()
+			if len(report.Problems) > 0 {
+				os.Exit(ExitError)
+			}
+		},
+	}
+
+	rulesCommand := &cobra.Command{
+		Use:   "rules",
+		Short: "Inspect the rules in the config file",
+	}
+
+	var rulesSinceFlag string
+	rulesStatsCommand := &cobra.Command{
+		Use:   "stats",
+		Short: "Show how many transactions each rule matches",
+		Long:  "Show how many Airtable transactions each names.rules, split.rules, categories.mapping and tax.deductible rule matches, and list the rules that match none.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			since, err := ParseDate(rulesSinceFlag, false)
+			if err != nil {
+				Fatal("rules stats failed", err)
+			}
+
+			stats, err := NewRuleStats(data, since)
+			if err != nil {
+				Fatal("rules stats failed", err)
+			}
+			stats.Print()
+		},
+	}
+	rulesStatsCommand.Flags().StringVar(&rulesSinceFlag, "since", "2y", "Match transactions on or after this date, e.g. 2024-01-01 or 6m")
+	rulesCommand.AddCommand(rulesStatsCommand)
+
+	var forceFlag bool
+	var keepRemoteFlag bool
+	unlinkCommand := &cobra.Command{
+		Use:   "unlink [ITEM-ID-OR-ALIAS]",
+		Short: "Unlink given institution",
+		Long:  "Unlink given institution. The item is removed at Plaid, which cannot be undone, so each item must be confirmed unless --force is passed.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			items, err := ResolveItems(data, args[0])
+			if err != nil {
+				Fatal("unlink failed", err)
+			}
+
+			if len(items) > 1 {
+				fmt.Fprintf(os.Stderr, "This will unlink %d institutions:\n", len(items))
+				for _, item := range items {
+					fmt.Fprintf(os.Stderr, "  %s\n", ItemLabel(data, item.id))
+				}
+			}
+
+			for _, item := range items {
+				// The label needs the institution, which is forgotten below
+				label := ItemLabel(data, item.id)
+				if !forceFlag {
+					err := ConfirmUnlink(ctx, client, data, item)
+					if err != nil {
+						LogError("Skipping", err, "item", label)
+						continue
+					}
+				}
+
+				if !keepRemoteFlag {
+					_, err := client.ItemRemove(ctx, plaid.ItemRemoveRequest{
+						AccessToken: data.Tokens[item.id],
+					})
+
+					if err != nil {
+						ItemFailed("Could not unlink", err, label)
+						continue
+					}
+				}
+
+				for alias, itemID := range data.Aliases {
+					if itemID == item.id {
+						delete(data.Aliases, alias)
+					}
+				}
+				delete(data.BackAliases, item.id)
+				delete(data.Institutions, item.id)
+				delete(data.Tokens, item.id)
+				err = data.Save()
+				if err != nil {
+					ItemFailed("Cannot save", err, label)
+				} else {
+					ItemSucceeded(label)
+				}
+			}
+		},
+	}
+
+	unlinkCommand.Flags().BoolVar(&forceFlag, "force", false, "Unlink without asking for confirmation")
+	unlinkCommand.Flags().BoolVar(&keepRemoteFlag, "keep-remote", false, "Only delete local state and leave the item linked at Plaid")
+
+	airtableCommand := &cobra.Command{
+		Use:   "airtable",
+		Short: "Manage the Airtable base plaid-cli syncs into",
+	}
+
+	var baseFlag string
+	airtableInitCommand := &cobra.Command{
+		Use:   "init",
+		Short: "Create the tables and fields plaid-cli expects",
+		Long:  "Create the Transactions, Accounts, Institutions, Categories, Budgets and Sync Log tables, and any missing fields, using the Airtable Metadata API. The token needs the schema.bases:read and schema.bases:write scopes.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := InitAirtableSchema(baseFlag)
+			if err != nil {
+				Fatal("init failed", err)
+			}
+
+			slog.Info("Done. Change \"After Plaid Issues\" in Transactions to a formula field returning 1 (the API can't create formulas).")
+		},
+	}
+	airtableInitCommand.Flags().StringVarP(&baseFlag, "base", "b", AirtableBaseID(), "Airtable base ID")
+	airtableCommand.AddCommand(airtableInitCommand)
+
+	var snapshotTableFlag string
+	var snapshotFormatFlag string
+	var snapshotDirFlag string
+	airtableSnapshotCommand := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save every record of an Airtable table to a local file",
+		Long:  "Save every record of an Airtable table, by default Transactions, to a timestamped JSON or CSV file in data/snapshots, or --dir. sync-transactions --snapshot (or sync.snapshot) takes one before any sync that updates or deletes transactions.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			table := snapshotTableFlag
+			if table == "" {
+				table = AirtableTransactionsTable()
+			}
+			dir := snapshotDirFlag
+			if dir == "" {
+				dir = SnapshotDir(data.DataDir)
+			}
+			path, n, err := SnapshotTable(table, dir, snapshotFormatFlag)
+			if err != nil {
+				Fatal("snapshot failed", err)
+			}
+			slog.Info("Saved snapshot", "table", table, "path", path, "count", n)
+		},
+	}
+	airtableSnapshotCommand.Flags().StringVar(&snapshotTableFlag, "table", "", "Table to snapshot (default airtable.transactions_table)")
+	airtableSnapshotCommand.Flags().StringVar(&snapshotFormatFlag, "format", "json", "Snapshot format (json or csv)")
+	airtableSnapshotCommand.Flags().StringVar(&snapshotDirFlag, "dir", "", "Directory to save the snapshot in (default data/snapshots in the data directory)")
+	airtableCommand.AddCommand(airtableSnapshotCommand)
+
+	var periodFlag string
+	var sendFlag bool
+	digestCommand := &cobra.Command{
+		Use:   "digest [ITEM-ID-OR-ALIAS]",
+		Short: "Summarize spending over the last week or month",
+		Long:  "Summarize total spending, spending by category, the largest transactions and balances over the last week or month. The summary is rendered with the Go template in digest.template, if set, and printed or, with --send, sent to notify.hooks. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("digest failed", err)
+			}
+
+			end := time.Now()
+			start, err := DigestStart(periodFlag, end)
+			if err != nil {
+				Fatal("digest failed", err)
+			}
+
+			accounts := FetchAllAccounts(ctx, client, data, linker, items)
+			transactions := DownloadTransactionsSince(ctx, client, data, linker, items, nil, func(idAndAlias) time.Time { return start })
+
+			digest, err := NewDigest(data, periodFlag, start, end, transactions, accounts).Render()
+			if err != nil {
+				Fatal("digest failed", err)
+			}
+
+			if sendFlag {
+				Notify(NotifyEvent{Event: EventDigest, Message: digest})
+				return
+			}
+			fmt.Print(digest)
+		},
+	}
+	digestCommand.Flags().StringVarP(&periodFlag, "period", "p", "week", "Period to summarize (week or month)")
+	digestCommand.Flags().BoolVar(&sendFlag, "send", false, "Send the digest to notify.hooks instead of printing it")
+
+	alertsCommand := &cobra.Command{
+		Use:              "alerts",
+		Short:            "List and acknowledge balance alerts",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	alertsListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List balance alerts that fired and haven't cleared",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			PrintAlerts(data)
+		},
+	}
+	alertsCommand.AddCommand(alertsListCommand)
+
+	alertsAckCommand := &cobra.Command{
+		Use:   "ack ALERT|all",
+		Short: "Stop reminders for an alert until it clears",
+		Long:  "Acknowledge an alert from plaid-cli alerts list, so it isn't sent again every alerts.remind. It fires again once its balance has recovered and drops again.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := AckAlert(data, args[0])
+			if err != nil {
+				Fatal("ack failed", err)
+			}
+		},
+	}
+	alertsCommand.AddCommand(alertsAckCommand)
+
+	sandboxCommand := &cobra.Command{
+		Use:   "sandbox",
+		Short: "Create and manipulate Plaid sandbox items",
+		Long:  "Create and manipulate Plaid sandbox items, to try linking, syncing and Airtable without real bank credentials. Needs plaid.environment set to sandbox.",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			requirePlaidCredentials(cmd)
+			err := CheckSandbox()
+			if err != nil {
+				Fatal("sandbox failed", err)
+			}
+		},
+	}
+
+	var webhookFlag string
+	var sandboxAliasFlag string
+	sandboxCreateItemCommand := &cobra.Command{
+		Use:   "create-item [INSTITUTION-ID]",
+		Short: "Create a sandbox item, as if it had been linked",
+		Long:  "Create a sandbox item at an institution (First Platypus Bank by default) with Plaid's test user, and store its access token as link would.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			institutionID := defaultSandboxInstitution
+			if len(args) > 0 {
+				institutionID = args[0]
+			}
+
+			itemID, err := CreateSandboxItem(ctx, client, data, institutionID, webhookFlag)
+			if err != nil {
+				Fatal("create-item failed", err)
+			}
+			slog.Info("Created sandbox item", "item_id", itemID)
+
+			institution, err := plaid_cli.FetchInstitution(ctx, client, data, data.Tokens[itemID], countries, viper.GetDuration("plaid.institution_cache_ttl"))
+			if err != nil {
+				LogError("Cannot fetch institution", err, "item_id", itemID)
+			} else {
+				data.Institutions[itemID] = institution
+				err = data.SaveInstitutions()
+				if err != nil {
+					Fatal("Cannot save", err)
+				}
+			}
+
+			if sandboxAliasFlag != "" {
+				err = SetAlias(data, itemID, sandboxAliasFlag)
+				if err != nil {
+					Fatal("create-item failed", err)
+				}
+			}
+		},
+	}
+	sandboxCreateItemCommand.Flags().StringVar(&webhookFlag, "webhook", "", "Webhook URL for the item, for fire-webhook")
+	sandboxCreateItemCommand.Flags().StringVarP(&sandboxAliasFlag, "alias", "a", "", "Alias for the new item")
+	sandboxCommand.AddCommand(sandboxCreateItemCommand)
+
+	var webhookCodeFlag string
+	sandboxFireWebhookCommand := &cobra.Command{
+		Use:   "fire-webhook [ITEM-ID-OR-ALIAS]",
+		Short: "Make Plaid send a webhook for a sandbox item",
+		Long:  "Make Plaid send a transactions webhook to the webhook the sandbox item was created with.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			item, err := ResolveItem(data, args[0])
+			if err != nil {
+				Fatal("fire-webhook failed", err)
+			}
+
+			err = FireSandboxWebhook(ctx, client, data.Tokens[item.id], webhookCodeFlag)
+			if err != nil {
+				Fatal("fire-webhook failed", err)
+			}
+		},
+	}
+	sandboxFireWebhookCommand.Flags().StringVar(&webhookCodeFlag, "code", "DEFAULT_UPDATE", "Webhook code, e.g. DEFAULT_UPDATE or SYNC_UPDATES_AVAILABLE")
+	sandboxCommand.AddCommand(sandboxFireWebhookCommand)
+
+	sandboxResetLoginCommand := &cobra.Command{
+		Use:   "reset-login [ITEM-ID-OR-ALIAS]",
+		Short: "Expire a sandbox item's login",
+		Long:  "Put a sandbox item in the ITEM_LOGIN_REQUIRED state, so the next command using it relinks.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			item, err := ResolveItem(data, args[0])
+			if err != nil {
+				Fatal("reset-login failed", err)
+			}
+
+			err = ResetSandboxLogin(ctx, client, data.Tokens[item.id])
+			if err != nil {
+				Fatal("reset-login failed", err)
+			}
+		},
+	}
+	sandboxCommand.AddCommand(sandboxResetLoginCommand)
+
+	exportCommand := &cobra.Command{
+		Use:   "export",
+		Short: "Export data for use in other tools",
+	}
+
+	var dirFlag string
+	exportAnalyticsCommand := &cobra.Command{
+		Use:   "analytics [ITEM-ID-OR-ALIAS]",
+		Short: "Export transactions, accounts and balances as partitioned CSV for DuckDB",
+		Long:  "Export transactions, accounts and balances as CSV partitioned by year and month, with a schema.sql that sets up DuckDB views over them. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("analytics failed", err)
+			}
+
+			accounts := FetchAllAccounts(ctx, client, data, linker, items)
+			transactions := DownloadTransactions(ctx, client, data, linker, items, nil)
+
+			err = ExportAnalytics(dirFlag, data, transactions, accounts)
+			if err != nil {
+				Fatal("analytics failed", err)
+			}
+
+			slog.Info("Exported", "transactions", len(transactions), "accounts", len(accounts), "dir", dirFlag)
+		},
+	}
+	exportAnalyticsCommand.Flags().StringVarP(&dirFlag, "dir", "d", "analytics", "Directory to export to")
+	exportCommand.AddCommand(exportAnalyticsCommand)
+
+	var icsOutFlag string
+	var icsMonthsFlag int
+	exportICSCommand := &cobra.Command{
+		Use:   "ics [ITEM-ID-OR-ALIAS]",
+		Short: "Export upcoming bills and paychecks as an iCalendar feed",
+		Long:  "Export the upcoming occurrences of the recurring bills and income Plaid detected in transactions, and credit card and loan due dates, as all-day events in an .ics file for calendar apps. `plaid-cli serve` serves it for subscribing when serve.calendar_token is set. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("ics failed", err)
+			}
+
+			bills := FetchBills(ctx, client, data, linker, items, time.Now().AddDate(0, icsMonthsFlag, 0))
+
+			out := os.Stdout
+			if icsOutFlag != "-" {
+				out, err = os.Create(icsOutFlag)
+				if err != nil {
+					Fatal("ics failed", err)
+				}
+				defer out.Close()
+			}
+			err = ics.Write(out, "Bills", BillEvents(bills))
+			if err != nil {
+				Fatal("ics failed", err)
+			}
+			slog.Info("Exported", "events", len(bills))
+		},
+	}
+	exportICSCommand.Flags().StringVarP(&icsOutFlag, "out", "o", "-", "File to write, or - for stdout")
+	exportICSCommand.Flags().IntVar(&icsMonthsFlag, "months", 3, "Months ahead to include")
+	exportCommand.AddCommand(exportICSCommand)
+
+	var encryptFlag bool
+	backupCommand := &cobra.Command{
+		Use:   "backup [FILE]",
+		Short: "Back up tokens, aliases and config",
+		Long:  "Back up tokens, aliases and config into a tar.gz archive, optionally encrypted with a passphrase.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			file := fmt.Sprintf("plaid-cli-backup-%s.tar.gz", time.Now().Format("20060102"))
+			if len(args) > 0 {
+				file = args[0]
+			}
+
+			passphrase := ""
+			if encryptFlag {
+				var err error
+				passphrase, err = BackupPassphrase()
+				if err != nil {
+					Fatal("backup failed", err)
+				}
+			}
+
+			b, err := CreateBackup(data.DataDir, viper.ConfigFileUsed(), passphrase)
+			if err != nil {
+				Fatal("backup failed", err)
+			}
+
+			err = ioutil.WriteFile(file, b, 0600)
+			if err != nil {
+				Fatal("backup failed", err)
+			}
+
+			slog.Info("Backed up", "file", file)
+		},
+	}
+	backupCommand.Flags().BoolVarP(&encryptFlag, "encrypt", "e", false, "Encrypt the backup with a passphrase")
+
+	var restoreForceFlag bool
+	restoreCommand := &cobra.Command{
+		Use:   "restore [FILE]",
+		Short: "Restore a backup created with the backup command",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(data.Tokens) > 0 && !restoreForceFlag {
+				Fatal("restore failed", errors.New(fmt.Sprintf("%s already has linked institutions. Pass --force to overwrite them.", data.DataDir)))
+			}
+
+			b, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				Fatal("restore failed", err)
+			}
+
+			err = RestoreBackup(b, data.DataDir, BackupPassphrase)
+			if err != nil {
+				Fatal("restore failed", err)
+			}
+
+			slog.Info("Restored", "file", args[0], "data_dir", data.DataDir)
+		},
+	}
+	restoreCommand.Flags().BoolVar(&restoreForceFlag, "force", false, "Overwrite existing data")
+
+	var withStatusFlag bool
+	var withOptionalMetadataFlag bool
+	profileCommand := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage profiles",
+		Long:  "Manage profiles. Each profile has its own linked items, aliases and config.toml (e.g. Plaid credentials and Airtable base), layered over the shared config.toml.",
+		// No Plaid credentials needed
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	profileListCommand := &cobra.Command{
+		Use:   "list",
+		Short: "List profiles",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			profiles, err := ListProfiles(rootDir)
+			if err != nil {
+				Fatal("profile list failed", err)
+			}
+			for _, name := range profiles {
+				marker := " "
+				if name == profile {
+					marker = "*"
+				}
+				fmt.Printf("%s %s\t%s\n", marker, name, ProfileDir(rootDir, name))
+			}
+		},
+	}
+
+	profileCreateCommand := &cobra.Command{
+		Use:   "create [NAME]",
+		Short: "Create a profile",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir, err := CreateProfile(rootDir, args[0])
+			if err != nil {
+				Fatal("profile create failed", err)
+			}
+			slog.Info("Created profile. Fill in its config.toml, then link items with --profile or `plaid-cli profile use`.", "profile", args[0], "config", filepath.Join(dir, "config.toml"))
+		},
+	}
+
+	profileUseCommand := &cobra.Command{
+		Use:   "use [NAME]",
+		Short: "Use a profile by default",
+		Long:  "Use a profile when neither --profile nor PLAID_CLI_PROFILE is given. Use \"default\" to go back to the default profile.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := UseProfile(rootDir, args[0])
+			if err != nil {
+				Fatal("profile use failed", err)
+			}
+			slog.Info("Using profile", "profile", args[0])
+		},
+	}
+	profileCommand.AddCommand(profileListCommand)
+	profileCommand.AddCommand(profileCreateCommand)
+	profileCommand.AddCommand(profileUseCommand)
+
+	initCommand := &cobra.Command{
+		Use:   "init",
+		Short: "Set up Plaid and Airtable credentials",
+		Long:  "Set up Plaid and Airtable credentials interactively. They are checked, then saved to config.toml in the data directory (or the profile's), and the Airtable tables and fields can be created.",
+		Args:  cobra.NoArgs,
+		// Sets up the credentials other commands need
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			err := RunInitWizard(ctx, dataDir)
+			if err != nil {
+				Fatal("init failed", err)
+			}
+		},
+	}
+
+	doctorCommand := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check configuration, Airtable access and linked items",
+		Long:  "Check Plaid credentials, the data directory, Airtable token scopes and base access, the Airtable schema and every linked item, printing how to fix each problem.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !PrintDoctor(Doctor(ctx, client, data)) {
+				os.Exit(ExitError)
+			}
+		},
+	}
+
+	var taxonomyFlag string
+	categoriesCommand := &cobra.Command{
+		Use:   "categories",
+		Short: "List Plaid's transaction categories",
+		Long:  "List the categories of Plaid's personal finance category taxonomy (--taxonomy pfc), or of the older one behind PlaidCategory1-3 (--taxonomy legacy).",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			categories, err := FetchCategories(ctx, client, taxonomyFlag)
+			if err != nil {
+				Fatal("categories failed", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tPRIMARY\tDESCRIPTION")
+			for _, c := range categories {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.ID, c.Name, c.Primary, c.Description)
+			}
+			w.Flush()
+		},
+	}
+	categoriesCommand.PersistentFlags().StringVar(&taxonomyFlag, "taxonomy", "pfc", "Category taxonomy (pfc or legacy)")
+
+	categoriesSyncCommand := &cobra.Command{
+		Use:   "sync",
+		Short: "Create or refresh a record per category in the Airtable Categories table",
+		Long:  "Create or refresh a record per category in the Airtable Categories table, which CategoryLookup links to. Records are matched on CategoryID, and categories added by hand are left alone.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			categories, err := FetchCategories(ctx, client, taxonomyFlag)
+			if err != nil {
+				Fatal("categories sync failed", err)
+			}
+
+			err = CheckAirtableWriteAccess()
+			if err != nil {
+				Fatal("categories sync failed", err)
+			}
+
+			n, err := SyncCategories(categories, taxonomyFlag)
+			if err != nil {
+				Fatal("categories sync failed", err)
+			}
+			slog.Info("Synced categories", "count", n, "taxonomy", taxonomyFlag)
+		},
+	}
+	categoriesCommand.AddCommand(categoriesSyncCommand)
+
+	identityCommand := &cobra.Command{
+		Use:   "identity [ITEM-ID-OR-ALIAS]",
+		Short: "List account owners' names, emails and addresses",
+		Long:  "List the owners of each account as the institution reports them, with Plaid Identity: names, primary email and address. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("identity failed", err)
+			}
+
+			PrintIdentityTable(data, FetchAllIdentities(ctx, client, data, linker, items))
+		},
+	}
+
+	identitySyncCommand := &cobra.Command{
+		Use:   "sync [ITEM-ID-OR-ALIAS]",
+		Short: "Sync account owners to the Airtable Owners table",
+		Long:  "Create or update a record per account owner in the Airtable Owners table, matched on name, with their emails and addresses and links to their accounts. Run sync-accounts first so the accounts exist. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("identity sync failed", err)
+			}
+
+			destinations, err := RouteItems(data, items)
+			if err != nil {
+				Fatal("identity sync failed", err)
+			}
+
+			for _, destination := range destinations {
+				UseAirtableDestination(destination)
+
+				err = CheckAirtableWriteAccess()
+				if err != nil {
+					Fatal("identity sync failed", err)
+				}
+
+				err = SyncOwners(FetchAllIdentities(ctx, client, data, linker, destination.Items))
+				if err != nil {
+					Fatal("identity sync failed", err)
+				}
+			}
+		},
+	}
+	identityCommand.AddCommand(identitySyncCommand)
+
+	var authRevealFlag bool
+	authCommand := &cobra.Command{
+		Use:   "auth [ITEM-ID-OR-ALIAS]",
+		Short: "Print account and routing numbers",
+		Long:  "Print the account and routing numbers of each account, with Plaid Auth. Account numbers are masked unless --reveal is passed, and are never stored. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("auth failed", err)
+			}
+
+			PrintAuthTable(data, FetchAllAuth(ctx, client, data, linker, items), authRevealFlag)
+		},
+	}
+	authCommand.Flags().BoolVar(&authRevealFlag, "reveal", false, "Show full account numbers")
+
+	var statementsSinceFlag string
+	statementsCommand := &cobra.Command{
+		Use:   "statements",
+		Short: "List and download PDF statements",
+		Long:  "List and download monthly PDF statements with Plaid Statements. Items need to be linked with --products transactions,statements.",
+	}
+	statementsCommand.PersistentFlags().StringVar(&statementsSinceFlag, "since", "", "Only statements for months on or after this date, e.g. 2024-01-01 or 6m")
+
+	// fetchStatements lists statements for the items in args, since --since
+	fetchStatements := func(command string, args []string) ([]idAndAlias, []Statement) {
+		itemOrAlias := "all"
+		if len(args) > 0 {
+			itemOrAlias = args[0]
+		}
+		items, err := ResolveItems(data, itemOrAlias)
+		if err != nil {
+			Fatal(command+" failed", err)
+		}
+
+		statements := FetchAllStatements(ctx, client, data, linker, items)
+		if statementsSinceFlag == "" {
+			return items, statements
+		}
+		since, err := ParseDate(statementsSinceFlag, false)
+		if err != nil {
+			Fatal(command+" failed", err)
+		}
+		var recent []Statement
+		for _, s := range statements {
+			if s.Period() >= since.Format("2006-01") {
+				recent = append(recent, s)
+			}
+		}
+		return items, recent
+	}
+
+	statementsListCommand := &cobra.Command{
+		Use:   "list [ITEM-ID-OR-ALIAS]",
+		Short: "List available statements",
+		Long:  "List the statements available for each account. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_, statements := fetchStatements("statements list", args)
+			PrintStatementsTable(data, statements)
+		},
+	}
+
+	var statementsAttachFlag bool
+	statementsDownloadCommand := &cobra.Command{
+		Use:   "download [ITEM-ID-OR-ALIAS]",
+		Short: "Download statements to a local directory",
+		Long:  "Download statements to statements.dir, in a directory per institution, skipping those already downloaded. With --airtable, also attach them to the Statements field of their account in Airtable. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			items, statements := fetchStatements("statements download", args)
+			dir := viper.GetString("statements.dir")
+			n := DownloadStatements(ctx, client, data, dir, statements)
+			slog.Info("Downloaded statements", "count", n, "dir", dir)
+
+			if !statementsAttachFlag {
+				return
+			}
+			destinations, err := RouteItems(data, items)
+			if err != nil {
+				Fatal("statements download failed", err)
+			}
+			for _, destination := range destinations {
+				UseAirtableDestination(destination)
+
+				err = CheckAirtableWriteAccess()
+				if err != nil {
+					Fatal("statements download failed", err)
+				}
+
+				var routed []Statement
+				for _, s := range statements {
+					for _, item := range destination.Items {
+						if s.ItemID == item.id {
+							routed = append(routed, s)
+						}
+					}
+				}
+				n, err := AttachStatements(data, dir, routed)
+				if err != nil {
+					Fatal("statements download failed", err)
+				}
+				slog.Info("Attached statements", "count", n)
+			}
+		},
+	}
+	statementsDownloadCommand.Flags().String("dir", "statements", "Directory to download statements to")
+	viper.BindPFlag("statements.dir", statementsDownloadCommand.Flags().Lookup("dir"))
+	statementsDownloadCommand.Flags().BoolVar(&statementsAttachFlag, "airtable", false, "Also attach statements to their account in Airtable")
+	statementsCommand.AddCommand(statementsListCommand)
+	statementsCommand.AddCommand(statementsDownloadCommand)
+
+	assetsCommand := &cobra.Command{
+		Use:   "assets",
+		Short: "Create Asset Reports",
+		Long:  "Create Asset Reports with Plaid Assets, e.g. for a mortgage lender asking for verified assets.",
+	}
+
+	var assetsDaysFlag int
+	var assetsDirFlag string
+	var assetsPollFlag time.Duration
+	assetsCreateReportCommand := &cobra.Command{
+		Use:   "create-report [ITEM-ID-OR-ALIAS...]",
+		Short: "Create an Asset Report across items and save it as JSON and PDF",
+		Long:  "Create an Asset Report covering the accounts of the given items, wait until Plaid has generated it, and save it to --dir as JSON and PDF. Defaults to all items.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				args = []string{"all"}
+			}
+			var items []idAndAlias
+			for _, arg := range args {
+				resolved, err := ResolveItems(data, arg)
+				if err != nil {
+					Fatal("assets create-report failed", err)
+				}
+				items = append(items, resolved...)
+			}
+
+			report, err := CreateAssetReport(ctx, client, data, items, assetsDaysFlag, assetsPollFlag)
+			if err != nil {
+				Fatal("assets create-report failed", err)
+			}
+			paths, err := SaveAssetReport(assetsDirFlag, report)
+			if err != nil {
+				Fatal("assets create-report failed", err)
+			}
+			slog.Info("Saved asset report", "asset_report_id", report.ID, "json", paths[0], "pdf", paths[1])
+		},
+	}
+	// Lenders usually ask for the last two months
+	assetsCreateReportCommand.Flags().IntVar(&assetsDaysFlag, "days", 61, "Days of history to include, up to 731")
+	assetsCreateReportCommand.Flags().StringVar(&assetsDirFlag, "dir", ".", "Directory to save the report to")
+	assetsCreateReportCommand.Flags().DurationVar(&assetsPollFlag, "poll", 10*time.Second, "How often to check whether the report is ready")
+	assetsCommand.AddCommand(assetsCreateReportCommand)
+
+	var streamFromFlag string
+	streamCommand := &cobra.Command{
+		Use:   "stream [ITEM-ID-OR-ALIAS]",
+		Short: "Stream transactions as JSON lines to stdout or an HTTP endpoint",
+		Long:  "Write transactions as one JSON object per line (NDJSON), for jq pipelines, or with stream.url set, POST them there in batches of stream.batch_size. Covers the sync window unless --from is given. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("stream failed", err)
+			}
+
+			startDate := syncStartDate
+			if streamFromFlag != "" {
+				from, err := ParseDate(streamFromFlag, false)
+				if err != nil {
+					Fatal("stream failed", err)
+				}
+				startDate = func(idAndAlias) time.Time { return from }
+			}
+			transactions := DownloadTransactionsSince(ctx, client, data, linker, items, nil, startDate)
+
+			url := viper.GetString("stream.url")
+			if url == "" {
+				b, err := (&pipeline.NDJSONSerializer{}).Serialize(transactions)
+				if err != nil {
+					Fatal("stream failed", err)
+				}
+				os.Stdout.Write(b)
+				return
+			}
+
+			n, err := PostTransactions(url, viper.GetInt("stream.batch_size"), transactions)
+			slog.Info("Posted transactions", "count", n, "url", url)
+			if err != nil {
+				Fatal("stream failed", err)
+			}
+		},
+	}
+	streamCommand.Flags().StringVar(&streamFromFlag, "from", "", "Start date, e.g. 2024-01-01 or 30d (default the sync window)")
+	streamCommand.Flags().String("url", "", "POST transactions to this URL instead of writing them to stdout")
+	viper.BindPFlag("stream.url", streamCommand.Flags().Lookup("url"))
+	streamCommand.Flags().Int("batch-size", 100, "Transactions per POST")
+	viper.BindPFlag("stream.batch_size", streamCommand.Flags().Lookup("batch-size"))
+
+	var fireflyFromFlag string
+	syncFireflyCommand := &cobra.Command{
+		Use:   "sync-firefly [ITEM-ID-OR-ALIAS]",
+		Short: "Sync accounts and transactions to Firefly III",
+		Long:  "Sync accounts and transactions to a Firefly III instance, set with url and token under [firefly]. Each account gets an asset account, and transactions are created once, keyed by their Plaid ID in external_id. Covers the sync window unless --from is given. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("sync-firefly failed", err)
+			}
+
+			fireflyClient, err := NewFireflyClient()
+			if err != nil {
+				Fatal("sync-firefly failed", err)
+			}
+
+			startDate := syncStartDate
+			if fireflyFromFlag != "" {
+				from, err := ParseDate(fireflyFromFlag, false)
+				if err != nil {
+					Fatal("sync-firefly failed", err)
+				}
+				startDate = func(idAndAlias) time.Time { return from }
+			}
+
+			accounts := FetchAllAccounts(ctx, client, data, linker, items)
+			accountIDs, err := SyncFireflyAccounts(fireflyClient, data, accounts)
+			if err != nil {
+				Fatal("sync-firefly failed", err)
+			}
+
+			transactions := DownloadTransactionsSince(ctx, client, data, linker, items, nil, startDate)
+			n, err := SyncFireflyTransactions(fireflyClient, data, accountIDs, transactions)
+			slog.Info("Created Firefly III transactions", "count", n)
+			if err != nil {
+				Fatal("sync-firefly failed", err)
+			}
+		},
+	}
+	syncFireflyCommand.Flags().StringVar(&fireflyFromFlag, "from", "", "Start date, e.g. 2024-01-01 or 30d (default the sync window)")
+
+	var lunchMoneyFromFlag string
+	syncLunchMoneyCommand := &cobra.Command{
+		Use:   "sync-lunchmoney [ITEM-ID-OR-ALIAS]",
+		Short: "Sync accounts and transactions to Lunch Money",
+		Long:  "Sync accounts and transactions to Lunch Money, with the token under [lunchmoney]. Each account is mapped to a manually managed asset, from lunchmoney.assets or by name, and new transactions are inserted once, keyed by their Plaid ID in external_id. Covers the sync window unless --from is given. Defaults to all items. To sync to Airtable in the same run, use sync-transactions --lunchmoney instead.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("sync-lunchmoney failed", err)
+			}
+
+			lunchMoneyClient, err := NewLunchMoneyClient()
+			if err != nil {
+				Fatal("sync-lunchmoney failed", err)
+			}
+
+			startDate := syncStartDate
+			if lunchMoneyFromFlag != "" {
+				from, err := ParseDate(lunchMoneyFromFlag, false)
+				if err != nil {
+					Fatal("sync-lunchmoney failed", err)
+				}
+				startDate = func(idAndAlias) time.Time { return from }
+			}
+
+			accounts := FetchAllAccounts(ctx, client, data, linker, items)
+			transactions := DownloadTransactionsSince(ctx, client, data, linker, items, nil, startDate)
+			n, err := SyncLunchMoney(lunchMoneyClient, data, accounts, transactions)
+			slog.Info("Inserted Lunch Money transactions", "count", n)
+			if err != nil {
+				Fatal("sync-lunchmoney failed", err)
+			}
+		},
+	}
+	syncLunchMoneyCommand.Flags().StringVar(&lunchMoneyFromFlag, "from", "", "Start date, e.g. 2024-01-01 or 30d (default the sync window)")
+
+	importCommand := &cobra.Command{
+		Use:   "import",
+		Short: "Import transactions from files exported by a bank",
+		Long:  "Import transactions from CSV or OFX files exported by a bank into Airtable, e.g. for years Plaid doesn't return. Imported transactions get stable IDs, so importing a file again only adds what's new, and those already synced from Plaid (same account, date and amount) are skipped. Nothing is deleted.",
+	}
+
+	var importAccountFlag string
+	var importDryRunFlag bool
+	var importCurrencyFlag string
+	importCommand.PersistentFlags().StringVar(&importAccountFlag, "account", "", "Account ID or alias the transactions belong to")
+	importCommand.PersistentFlags().BoolVar(&importDryRunFlag, "dry-run", false, "Only report what would be imported")
+	importCommand.PersistentFlags().StringVar(&importCurrencyFlag, "currency", "", "ISO currency code of the amounts, converted to currency.home")
+	importCommand.MarkPersistentFlagRequired("account")
+
+	var csvOptions importer.CSVOptions
+	importCSVCommand := &cobra.Command{
+		Use:   "csv [FILE]",
+		Short: "Import transactions from a CSV file",
+		Long:  "Import transactions from a CSV file with a header row, or stdin. Date, amount and description columns are found by common names, or set with the column flags. Amounts are taken to be negative for money leaving the account, as most banks export them, unless --positive-outflow.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			f, err := openImportFile(args)
+			if err != nil {
+				Fatal("import failed", err)
+			}
+			defer f.Close()
+
+			csvOptions.AccountID = ResolveAccountID(data, importAccountFlag)
+			csvOptions.Currency = importCurrencyFlag
+			txs, err := importer.ParseCSV(f, csvOptions)
+			if err != nil {
+				Fatal("import failed", err)
+			}
+			result, err := ImportTransactions(data, txs, importDryRunFlag)
+			LogImportResult(result, importDryRunFlag)
+			if err != nil {
+				Fatal("import failed", err)
+			}
+		},
+	}
+	importCSVCommand.Flags().StringVar(&csvOptions.DateColumn, "date-column", "", "Date column")
+	importCSVCommand.Flags().StringVar(&csvOptions.AmountColumn, "amount-column", "", "Signed amount column")
+	importCSVCommand.Flags().StringVar(&csvOptions.DebitColumn, "debit-column", "", "Money out column, for files without a signed amount")
+	importCSVCommand.Flags().StringVar(&csvOptions.CreditColumn, "credit-column", "", "Money in column, for files without a signed amount")
+	importCSVCommand.Flags().StringVar(&csvOptions.DescriptionColumn, "description-column", "", "Description column")
+	importCSVCommand.Flags().StringVar(&csvOptions.DateLayout, "date-format", "", "Go date layout, e.g. 01/02/2006 (default: common formats are tried)")
+	importCSVCommand.Flags().BoolVar(&csvOptions.PositiveOutflow, "positive-outflow", false, "Amounts are positive for money leaving the account")
+	importCommand.AddCommand(importCSVCommand)
+
+	importOFXCommand := &cobra.Command{
+		Use:   "ofx [FILE]",
+		Short: "Import transactions from an OFX, QFX or QBO file",
+		Long:  "Import the transactions of the statements in an OFX, QFX or QBO file, or stdin. Transaction IDs come from the bank's FITID.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			f, err := openImportFile(args)
+			if err != nil {
+				Fatal("import failed", err)
+			}
+			defer f.Close()
+
+			txs, err := importer.ParseOFX(f, importer.OFXOptions{
+				AccountID: ResolveAccountID(data, importAccountFlag),
+				Currency:  importCurrencyFlag,
+			})
+			if err != nil {
+				Fatal("import failed", err)
+			}
+			result, err := ImportTransactions(data, txs, importDryRunFlag)
+			LogImportResult(result, importDryRunFlag)
+			if err != nil {
+				Fatal("import failed", err)
+			}
+		},
+	}
+	importCommand.AddCommand(importOFXCommand)
+
+	var backfillFromFlag string
+	var backfillOptions BackfillOptions
+	backfillCommand := &cobra.Command{
+		Use:   "backfill [ITEM-ID-OR-ALIAS] --from DATE",
+		Short: "Sync older transactions in monthly chunks, resuming after failures",
+		Long:  "Sync transactions from --from to today into Airtable one chunk at a time, walking back from today, for institutions that time out on long date ranges. Progress is checkpointed after each chunk, so running the same backfill again resumes where it failed. Rate limited and failed requests are retried with backoff (recovery.retries, recovery.retry_delay). Nothing is deleted. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("backfill failed", err)
+			}
+			backfillOptions.From, err = ParseDate(backfillFromFlag, false)
+			if err != nil {
+				Fatal("backfill failed", err)
+			}
+
+			destinations, err := RouteItems(data, items)
+			if err != nil {
+				Fatal("backfill failed", err)
+			}
+			summary := NewRunSummary()
+			for _, destination := range destinations {
+				UseAirtableDestination(destination)
+				err = CheckAirtableWriteAccess()
+				if err != nil {
+					Fatal("backfill failed", err)
+				}
+
+				airtableTransactions, err := FetchAirtableTransactions(SyncFields, backfillOptions.From)
+				if err != nil {
+					Fatal("backfill failed", err)
+				}
+				for _, item := range destination.Items {
+					if item.id == sandboxItemID {
+						continue
+					}
+					err = Backfill(ctx, client, data, linker, item, airtableTransactions, summary, backfillOptions)
+					if err != nil {
+						ItemFailed("backfill failed", err, ItemLabel(data, item.id))
+					} else {
+						ItemSucceeded(ItemLabel(data, item.id))
+					}
+				}
+			}
+			summary.Print()
+		},
+	}
+	backfillCommand.Flags().StringVar(&backfillFromFlag, "from", "", "Oldest date to sync, e.g. 2022-01-01 or 2y")
+	backfillCommand.MarkFlagRequired("from")
+	backfillCommand.Flags().IntVar(&backfillOptions.Months, "months", 1, "Months per chunk")
+	backfillCommand.Flags().DurationVar(&backfillOptions.Delay, "delay", 2*time.Second, "Wait between chunks")
+	backfillCommand.Flags().BoolVar(&backfillOptions.Restart, "restart", false, "Start over instead of resuming from the last checkpoint")
+
+	var actualFromFlag string
+	syncActualCommand := &cobra.Command{
+		Use:   "sync-actual [ITEM-ID-OR-ALIAS]",
+		Short: "Sync transactions to Actual Budget",
+		Long:  "Import transactions into an Actual Budget server through actual-http-api, set up under [actual]. Plaid accounts are mapped to Actual accounts in actual.accounts, and imported_id is set to the Plaid ID so each transaction is imported once. Covers the sync window unless --from is given. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("sync-actual failed", err)
+			}
+
+			actualClient, err := NewActualClient()
+			if err != nil {
+				Fatal("sync-actual failed", err)
+			}
+
+			startDate := syncStartDate
+			if actualFromFlag != "" {
+				from, err := ParseDate(actualFromFlag, false)
+				if err != nil {
+					Fatal("sync-actual failed", err)
+				}
+				startDate = func(idAndAlias) time.Time { return from }
+			}
+
+			transactions := DownloadTransactionsSince(ctx, client, data, linker, items, nil, startDate)
+			added, updated, err := SyncActual(actualClient, data, transactions)
+			slog.Info("Imported transactions into Actual", "added", added, "updated", updated)
+			if err != nil {
+				Fatal("sync-actual failed", err)
+			}
+		},
+	}
+	syncActualCommand.Flags().StringVar(&actualFromFlag, "from", "", "Start date, e.g. 2024-01-01 or 30d (default the sync window)")
+
+	fieldsCommand := &cobra.Command{
+		Use:   "fields",
+		Short: "Fields synced back from Airtable (sync.fields)",
+	}
+
+	var fieldsSinceFlag string
+	fieldsSyncCommand := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync fields with Airtable without syncing transactions",
+		Long:  "Push local edits of bidirectional fields to Airtable and pull the sync.fields that flow out of Airtable into the local cache, as sync-transactions does after syncing.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			since, err := ParseDate(fieldsSinceFlag, false)
+			if err != nil {
+				Fatal("fields sync failed", err)
+			}
+			err = SyncFieldCache(data.DataDir, since)
+			if err != nil {
+				Fatal("fields sync failed", err)
+			}
+		},
+	}
+	fieldsSyncCommand.Flags().StringVar(&fieldsSinceFlag, "since", "90d", "Pull values of transactions from this date, e.g. 2024-01-01 or 90d")
+	fieldsCommand.AddCommand(fieldsSyncCommand)
+
+	fieldsSetCommand := &cobra.Command{
+		Use:   "set PLAID-TRANSACTION-ID FIELD VALUE",
+		Short: "Edit a bidirectional field locally",
+		Long:  "Edit a bidirectional field of a transaction in the local cache. The edit is pushed to Airtable on the next sync, unless the field changes in Airtable first. An empty value clears the field.",
+		Args:  cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			cache, err := LoadFieldCache(data.DataDir)
+			if err != nil {
+				Fatal("fields set failed", err)
+			}
+			err = cache.Set(args[0], args[1], args[2])
+			if err != nil {
+				Fatal("fields set failed", err)
+			}
+			err = cache.Save(data.DataDir)
+			if err != nil {
+				Fatal("fields set failed", err)
+			}
+		},
+	}
+	fieldsCommand.AddCommand(fieldsSetCommand)
+
+	var historyRunFlag string
+	historyCommand := &cobra.Command{
+		Use:   "history",
+		Short: "Changes made to Airtable, from the audit log",
+		Long:  "List the runs that changed Airtable, with how many records each created, updated and deleted. With --run, list that run's changes field by field. Changes are logged to data/audit.jsonl unless audit.enabled is false.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			entries, err := ReadAuditLog(data.DataDir)
+			if err != nil {
+				Fatal("history failed", err)
+			}
+			if historyRunFlag == "" {
+				PrintAuditRuns(AuditRuns(entries))
+				return
+			}
+			PrintAuditEntries(RunEntries(entries, historyRunFlag))
+		},
+	}
+	historyCommand.Flags().StringVar(&historyRunFlag, "run", "", "Show the changes of this run")
+
+	syncCommand := &cobra.Command{
+		Use:   "sync",
+		Short: "Manage sync runs",
+	}
+
+	var syncUndoYesFlag bool
+	var syncUndoForceFlag bool
+	syncUndoCommand := &cobra.Command{
+		Use:   "undo [RUN-ID]",
+		Short: "Revert the Airtable changes of a run",
+		Long:  "Revert the Airtable changes of a run from the audit log (see plaid-cli history), by default the last run not undone yet: created records are deleted, updated fields are set back and deleted records are created again from their logged fields, under new record IDs. Records updated by an upsert can't be set back, and links to re-created records from other records are lost. Runs whose records later runs changed again are refused unless --force. If an undo fails partway, running it again reverts the rest.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			entries, err := ReadAuditLog(data.DataDir)
+			if err != nil {
+				Fatal("sync undo failed", err)
+			}
+			var run string
+			if len(args) > 0 {
+				run = args[0]
+			} else {
+				var ok bool
+				run, ok = LastUndoableRun(entries)
+				if !ok {
+					Fatal("sync undo failed", errors.New("No run to undo"))
+				}
+			}
+
+			if recreated := RecreatedRecords(RunEntries(entries, run)); recreated > 0 {
+				slog.Warn("Deleted records are created again under new record IDs, so links to them from other records and anything else referring to their old IDs won't find them", "records", recreated)
+			}
+
+			if !syncUndoYesFlag {
+				PrintAuditEntries(RunEntries(entries, run))
+				_, err := (&promptui.Prompt{Label: fmt.Sprintf("Undo run %s", run), IsConfirm: true}).Run()
+				if err == promptui.ErrAbort {
+					return
+				}
+				if err != nil {
+					Fatal("sync undo failed", err)
+				}
+			}
+
+			undone, err := UndoRun(entries, run, syncUndoForceFlag)
+			slog.Info("Undid changes", "run", run, "changes", undone)
+			if err != nil {
+				Fatal("sync undo failed", err)
+			}
+		},
+	}
+	syncUndoCommand.Flags().BoolVarP(&syncUndoYesFlag, "yes", "y", false, "Don't list the changes and ask for confirmation")
+	syncUndoCommand.Flags().BoolVar(&syncUndoForceFlag, "force", false, "Undo even if later runs changed the same records")
+	syncCommand.AddCommand(syncUndoCommand)
+
+	serveCommand := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an API for starting syncs remotely",
+		Long:  "Serve an HTTP API, authenticated with serve.token, to list items, start syncs (`sync-transactions` with the same profile and config), check on them and stream their logs, e.g. for a home automation dashboard or a phone shortcut. See `plaid-cli ctl` for a client.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			token := viper.GetString("serve.token")
+			if token == "" {
+				Fatal("serve failed", &ConfigError{errors.New("Set serve.token or SERVE_TOKEN to a secret that requests must send")})
+			}
+			calendarToken := viper.GetString("serve.calendar_token")
+			if calendarToken != "" && calendarToken == token {
+				Fatal("serve failed", &ConfigError{errors.New("serve.calendar_token must differ from serve.token, which it would leak to calendar apps")})
+			}
+			webhookToken := viper.GetString("serve.webhook_token")
+			if webhookToken != "" && webhookToken == token {
+				Fatal("serve failed", &ConfigError{errors.New("serve.webhook_token must differ from serve.token, which it would leak to Plaid")})
+			}
+			server := &ControlServer{
+				Token:         token,
+				CalendarToken: calendarToken,
+				WebhookToken:  webhookToken,
+				Linker:        linker,
+				DataDir:       dataDir,
+				Env:           append(os.Environ(), "PLAID_CLI_DATA_DIR="+rootDir, "PLAID_CLI_PROFILE="+profile),
+			}
+			listen := viper.GetString("serve.listen")
+			slog.Info("Serving control API", "address", listen)
+			err := http.ListenAndServe(listen, server.Handler())
+			if err != nil {
+				Fatal("serve failed", err)
+			}
+		},
+	}
+	serveCommand.Flags().String("listen", "127.0.0.1:8787", "Address to listen on")
+	viper.BindPFlag("serve.listen", serveCommand.Flags().Lookup("listen"))
+
+	ctlCommand := &cobra.Command{
+		Use:   "ctl",
+		Short: "Control a running `plaid-cli serve`",
+		Long:  "Start syncs and check on them through the API of `plaid-cli serve`, at ctl.url with ctl.token (or serve.token, when both run with the same config).",
+		// Only needs the server
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+	ctlCommand.PersistentFlags().String("url", "http://127.0.0.1:8787", "URL of the server")
+	viper.BindPFlag("ctl.url", ctlCommand.PersistentFlags().Lookup("url"))
+	controlClient := func() *ControlClient {
+		token := viper.GetString("ctl.token")
+		if token == "" {
+			token = viper.GetString("serve.token")
+		}
+		return &ControlClient{URL: strings.TrimSuffix(viper.GetString("ctl.url"), "/"), Token: token}
+	}
+
+	ctlItemsCommand := &cobra.Command{
+		Use:   "items",
+		Short: "List the server's linked items",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			items, err := controlClient().Items()
+			if err != nil {
+				Fatal("ctl items failed", err)
+			}
+			PrintControlItems(items)
+		},
+	}
+
+	var ctlFollowFlag bool
+	ctlSyncCommand := &cobra.Command{
+		Use:   "sync [ITEM-ID-OR-ALIAS]",
+		Short: "Start a sync",
+		Long:  "Start syncing an item's transactions, or all items', and print the job ID. With --follow, stream the sync's logs and exit with its exit code.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			item := "all"
+			if len(args) > 0 {
+				item = args[0]
+			}
+			client := controlClient()
+			job, err := client.Sync(item)
+			if err != nil {
+				Fatal("ctl sync failed", err)
+			}
+			if !ctlFollowFlag {
+				fmt.Println(job.ID)
+				return
+			}
+
+			err = client.Logs(job.ID, true, os.Stdout)
+			if err != nil {
+				Fatal("ctl sync failed", err)
+			}
+			job, err = client.Job(job.ID)
+			if err != nil {
+				Fatal("ctl sync failed", err)
+			}
+			if job.ExitCode != nil && *job.ExitCode != 0 {
+				os.Exit(*job.ExitCode)
+			}
+		},
+	}
+	ctlSyncCommand.Flags().BoolVarP(&ctlFollowFlag, "follow", "f", false, "Stream the sync's logs until it finishes")
+
+	ctlStatusCommand := &cobra.Command{
+		Use:   "status",
+		Short: "List recent syncs",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			jobs, err := controlClient().Jobs()
+			if err != nil {
+				Fatal("ctl status failed", err)
+			}
+			PrintJobs(jobs)
+		},
+	}
+
+	ctlLogsCommand := &cobra.Command{
+		Use:   "logs [JOB-ID]",
+		Short: "Print a sync's logs",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := controlClient().Logs(args[0], ctlFollowFlag, os.Stdout)
+			if err != nil {
+				Fatal("ctl logs failed", err)
+			}
+		},
+	}
+	ctlLogsCommand.Flags().BoolVarP(&ctlFollowFlag, "follow", "f", false, "Keep streaming until the sync finishes")
+	ctlCommand.AddCommand(ctlItemsCommand)
+	ctlCommand.AddCommand(ctlSyncCommand)
+	ctlCommand.AddCommand(ctlStatusCommand)
+	ctlCommand.AddCommand(ctlLogsCommand)
+
+	reportCommand := &cobra.Command{
+		Use:   "report",
+		Short: "Reports computed from Plaid transactions",
+	}
+
+	var reportFromFlag string
+	var reportToFlag string
+	var reportFormatFlag string
+	reportCashflowCommand := &cobra.Command{
+		Use:   "cashflow [ITEM-ID-OR-ALIAS]",
+		Short: "Monthly income and spending per account, without transfers",
+		Long:  "Sum income and spending per account and month, leaving out transfers between your own accounts (see plaid-cli transfers) and pending transactions. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("report cashflow failed", err)
+			}
+
+			from, to, err := ParseDateRange(reportFromFlag, reportToFlag)
+			if err != nil {
+				Fatal("report cashflow failed", err)
+			}
+
+			accountNames := make(map[string]string)
+			for _, a := range FetchAllAccounts(ctx, client, data, linker, items) {
+				accountNames[a.ID] = a.DisplayName()
+			}
+
+			var transactions []Transaction
+			for _, t := range DownloadTransactionsSince(ctx, client, data, linker, items, nil, func(idAndAlias) time.Time { return from }) {
+				if t.Date <= to.Format(DateLayout) {
+					transactions = append(transactions, t)
+				}
+			}
+
+			err = WriteCashFlow(os.Stdout, NewCashFlow(data, transactions, TransferWindow(), accountNames), reportFormatFlag)
+			if err != nil {
+				Fatal("report cashflow failed", err)
+			}
+		},
+	}
+	reportCashflowCommand.Flags().StringVar(&reportFromFlag, "from", "6m", "Start date, e.g. 2024-01-01 or 6m")
+	reportCashflowCommand.Flags().StringVar(&reportToFlag, "to", "", "End date (default today)")
+	reportCashflowCommand.Flags().StringVarP(&reportFormatFlag, "output-format", "o", "table", "Output format (table, csv or json)")
+	reportCommand.AddCommand(reportCashflowCommand)
+
+	var taxYearFlag int
+	var taxDirFlag string
+	var taxFormatFlag string
+	reportTaxCommand := &cobra.Command{
+		Use:   "tax",
+		Short: "Yearly totals per category and deductible transactions, for your accountant",
+		Long:  "Total the year's Airtable transactions per category and export the deductible ones: checked in the tax.deductible_field checkbox (Deductible by default) or matching a tax.deductible rule. Writes CSV files or an XLSX workbook to --dir.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			report, err := NewTaxReport(data, taxYearFlag)
+			if err != nil {
+				Fatal("report tax failed", err)
+			}
+			paths, err := WriteTaxReport(data, taxDirFlag, taxFormatFlag, report)
+			if err != nil {
+				Fatal("report tax failed", err)
+			}
+			slog.Info("Wrote tax report", "year", taxYearFlag, "categories", len(report.Categories), "deductible", len(report.Deductible), "files", strings.Join(paths, ", "))
+		},
+	}
+	reportTaxCommand.Flags().IntVar(&taxYearFlag, "year", time.Now().Year()-1, "Tax year")
+	reportTaxCommand.Flags().StringVar(&taxDirFlag, "dir", ".", "Directory to write the report to")
+	reportTaxCommand.Flags().StringVarP(&taxFormatFlag, "output-format", "o", "csv", "Output format (csv or xlsx)")
+	reportCommand.AddCommand(reportTaxCommand)
+
+	var relinkDryRunFlag bool
+	var relinkWithinFlag time.Duration
+	relinkAllCommand := &cobra.Command{
+		Use:   "relink-all",
+		Short: "Relink every item whose login expired or whose consent expires soon",
+		Long:  "Check every item with Plaid and relink, one at a time, those that need it: their login expired, or their consent expires within --within. Run it before a sync instead of finding out halfway through.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			items := ItemsToRelink(ctx, client, data, relinkWithinFlag)
+			if len(items) == 0 {
+				slog.Info("No items need relinking")
+				return
+			}
+
+			if relinkDryRunFlag {
+				for _, item := range items {
+					fmt.Printf("%s\t%s\n", ItemLabel(data, item.Item.id), item.Reason)
+				}
+				return
+			}
+
+			relinked := RelinkAll(ctx, data, linker, items)
+			if relinked < len(items) {
+				Fatal("relink-all failed", errors.New(fmt.Sprintf("Relinked %d of %d items", relinked, len(items))))
+			}
+		},
+	}
+	relinkAllCommand.Flags().BoolVar(&relinkDryRunFlag, "dry-run", false, "Only list the items that need relinking")
+	relinkAllCommand.Flags().DurationVar(&relinkWithinFlag, "within", 7*24*time.Hour, "Relink items whose consent expires within this long")
+
+	setWebhookCommand := &cobra.Command{
+		Use:   "set-webhook [ITEM-ID-OR-ALIAS]",
+		Short: "Point items' Plaid webhooks at link.webhook",
+		Long:  "Set the webhook of items linked before link.webhook was set, so Plaid tells `plaid-cli serve` when their login expires. Defaults to all items.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			url := viper.GetString("link.webhook")
+			if url == "" {
+				Fatal("set-webhook failed", &ConfigError{errors.New("Set link.webhook or LINK_WEBHOOK to the URL of `plaid-cli serve`'s /v1/plaid/webhook")})
+			}
+			itemOrAlias := "all"
+			if len(args) > 0 {
+				itemOrAlias = args[0]
+			}
+			items, err := ResolveItems(data, itemOrAlias)
+			if err != nil {
+				Fatal("set-webhook failed", err)
+			}
+
+			updated := SetItemWebhooks(ctx, client, data, items, url)
+			if updated < len(items) {
+				Fatal("set-webhook failed", errors.New(fmt.Sprintf("Set the webhook of %d of %d items", updated, len(items))))
+			}
+		},
+	}
+
+	insitutionCommand := &cobra.Command{
+		Use:   "institution [ITEM-ID-OR-ALIAS]",
+		Short: "Get information about an institution",
+		Long:  "Get information about an institution. Status can be reported using a flag.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			item, err := ResolveItem(data, args[0])
+			if err != nil {
+				Fatal("institution failed", err)
+			}
+
+			err = WithRelinkOnAuthError(ctx, item, data, linker, func() error {
+				token := data.Tokens[item.id]
+
+				itemResp, err := client.ItemGet(ctx, plaid.ItemGetRequest{
+					AccessToken: token,
+				})
+				if err != nil {
+					return err
+				}
+
+				instID := itemResp.Item.GetInstitutionId()
+				if instID == "" {
+					return errors.New("Item has no institution")
+				}
+
+				// Status changes minute to minute, so never serve it from the cache
+				if withStatusFlag {
+					resp, err := client.InstitutionsGetById(ctx, plaid.InstitutionsGetByIdRequest{
+						InstitutionId: instID,
+						CountryCodes:  countries,
+						Options: &plaid.InstitutionsGetByIdRequestOptions{
+							IncludeOptionalMetadata: plaid.PtrBool(withOptionalMetadataFlag),
+							IncludeStatus:           plaid.PtrBool(true),
+						},
+					})
+					if err != nil {
+						return err
+					}
+
+					b, err := json.MarshalIndent(resp.Institution, "", "  ")
+					if err != nil {
+						return err
+					}
+
+					fmt.Println(string(b))
+					return nil
+				}
+
+				institution, err := data.GetInstitution(ctx, client, instID, countries, viper.GetDuration("plaid.institution_cache_ttl"))
+				if err != nil {
+					return err
+				}
+
+				// Backfill metadata for items linked before it was stored
+				data.Institutions[item.id] = institution
+				err = data.SaveInstitutions()
+				if err != nil {
+					return err
+				}
+
+				if !withOptionalMetadataFlag {
+					institution.Logo = ""
+					institution.URL = ""
+				}
+
+				b, err := json.MarshalIndent(institution, "", "  ")
+				if err != nil {
+					return err
+				}
+
+				fmt.Println(string(b))
+
+				return nil
+			})
 
 			if err != nil {
-				log.Fatalln(err)
+				Fatal("institution failed", err)
 			}
 		},
 	}
@@ -588,7 +2695,7 @@ Configuration:
   I recommend setting and exporting these on shell startup.
   
   API credentials can also be specified using a config file located at 
-  ~/.plaid-cli/config.toml:
+  config.toml in ~/.config/plaid-cli (or --data-dir):
   
     [plaid]
     client_id = "<client id>"
@@ -597,120 +2704,281 @@ Configuration:
   
   After setting those API credentials, plaid-cli is ready to use! 
   You'll probably want to run 'plaid-cli link' next.
+
+  Or run 'plaid-cli init' to be asked for the credentials instead.
   
   Please see the README (https://github.com/landakram/plaid-cli/blob/master/README.md) 
   for more detailed usage instructions.
 
   Made by @landakram.
 `,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			requirePlaidCredentials(cmd)
+			acquireRunLock(cmd, dataDir)
+			StartHealthcheck(cmd)
+		},
+	}
+	for _, command := range []*cobra.Command{
+		syncAccountsCommand,
+		airtableSyncCommand,
+		purgeCommand,
+		backfillCategoriesCommand,
+		backfillFieldsCommand,
+		restoreCommand,
+		syncFireflyCommand,
+		syncLunchMoneyCommand,
+		syncActualCommand,
+		importCSVCommand,
+		importOFXCommand,
+		backfillCommand,
+		fieldsSyncCommand,
+		syncUndoCommand,
+	} {
+		command.Annotations = map[string]string{runLockAnnotation: "true"}
+	}
+	for _, command := range []*cobra.Command{
+		syncAccountsCommand,
+		airtableSyncCommand,
+		backfillCommand,
+		syncFireflyCommand,
+		syncLunchMoneyCommand,
+		syncActualCommand,
+	} {
+		command.Annotations[healthcheckAnnotation] = "true"
 	}
 	rootCommand.AddCommand(linkCommand)
 	rootCommand.AddCommand(tokensCommand)
 	rootCommand.AddCommand(aliasCommand)
+	rootCommand.AddCommand(renameAliasCommand)
+	rootCommand.AddCommand(removeAliasCommand)
+	rootCommand.AddCommand(aliasAccountCommand)
 	rootCommand.AddCommand(aliasesCommand)
 	rootCommand.AddCommand(accountsCommand)
+	rootCommand.AddCommand(syncAccountsCommand)
 	rootCommand.AddCommand(transactionsCommand)
 	rootCommand.AddCommand(airtableSyncCommand)
-	rootCommand.AddCommand(airtableFixCommand)
+	rootCommand.AddCommand(purgeCommand)
+	rootCommand.AddCommand(transfersCommand)
+	rootCommand.AddCommand(duplicatesCommand)
+	rootCommand.AddCommand(splitCommand)
+	rootCommand.AddCommand(reviewCommand)
+	rootCommand.AddCommand(digestCommand)
+	rootCommand.AddCommand(alertsCommand)
+	rootCommand.AddCommand(sandboxCommand)
+	rootCommand.AddCommand(backfillCategoriesCommand)
+	rootCommand.AddCommand(backfillFieldsCommand)
+	rootCommand.AddCommand(airtableCommand)
+	rootCommand.AddCommand(exportCommand)
+	rootCommand.AddCommand(validatePipelineCommand)
+	rootCommand.AddCommand(rulesCommand)
 	rootCommand.AddCommand(insitutionCommand)
 	rootCommand.AddCommand(unlinkCommand)
+	rootCommand.AddCommand(backupCommand)
+	rootCommand.AddCommand(restoreCommand)
+	rootCommand.AddCommand(doctorCommand)
+	rootCommand.AddCommand(relinkAllCommand)
+	rootCommand.AddCommand(setWebhookCommand)
+	rootCommand.AddCommand(categoriesCommand)
+	rootCommand.AddCommand(identityCommand)
+	rootCommand.AddCommand(authCommand)
+	rootCommand.AddCommand(statementsCommand)
+	rootCommand.AddCommand(assetsCommand)
+	rootCommand.AddCommand(reportCommand)
+	rootCommand.AddCommand(streamCommand)
+	rootCommand.AddCommand(syncFireflyCommand)
+	rootCommand.AddCommand(syncLunchMoneyCommand)
+	rootCommand.AddCommand(syncActualCommand)
+	rootCommand.AddCommand(importCommand)
+	rootCommand.AddCommand(backfillCommand)
+	rootCommand.AddCommand(fieldsCommand)
+	rootCommand.AddCommand(historyCommand)
+	rootCommand.AddCommand(syncCommand)
+	rootCommand.AddCommand(serveCommand)
+	rootCommand.AddCommand(ctlCommand)
+	rootCommand.AddCommand(profileCommand)
+	rootCommand.AddCommand(initCommand)
+
+	// Read by ProfileName before cobra runs; declared so cobra accepts it
+	rootCommand.PersistentFlags().String("profile", "", "Profile to use (see `plaid-cli profile`), or PLAID_CLI_PROFILE")
+	rootCommand.PersistentFlags().String("data-dir", "", "Directory for config.toml, tokens and profiles, or PLAID_CLI_DATA_DIR")
+
+	rootCommand.PersistentFlags().BoolP("verbose", "v", false, "Log debug messages")
+	viper.BindPFlag("log.verbose", rootCommand.PersistentFlags().Lookup("verbose"))
+	rootCommand.PersistentFlags().BoolP("quiet", "q", false, "Only log warnings and errors")
+	viper.BindPFlag("log.quiet", rootCommand.PersistentFlags().Lookup("quiet"))
+	rootCommand.PersistentFlags().String("log-format", "text", "Log format (text or json)")
+	viper.BindPFlag("log.format", rootCommand.PersistentFlags().Lookup("log-format"))
+	rootCommand.PersistentFlags().Bool("debug-http", false, "Log each Plaid, Airtable and other HTTP request, with secrets redacted")
+	viper.BindPFlag("log.debug_http", rootCommand.PersistentFlags().Lookup("debug-http"))
+	rootCommand.PersistentFlags().Duration("wait", 0, "How long syncs and other writing commands wait for a running one to finish, e.g. 30m (default fail right away)")
+	viper.BindPFlag("lock.wait", rootCommand.PersistentFlags().Lookup("wait"))
+	rootCommand.PersistentFlags().Duration("plaid-timeout", 2*time.Minute, "Fail Plaid requests without a response within this long (0 for no limit)")
+	viper.BindPFlag("plaid.timeout", rootCommand.PersistentFlags().Lookup("plaid-timeout"))
+	rootCommand.PersistentFlags().Duration("airtable-timeout", time.Minute, "Fail Airtable requests without a response within this long (0 for no limit)")
+	viper.BindPFlag("airtable.timeout", rootCommand.PersistentFlags().Lookup("airtable-timeout"))
+	rootCommand.PersistentFlags().Duration("deadline", 0, "Stop the command if it runs longer than this, e.g. 1h (default no limit)")
+	viper.BindPFlag("run.deadline", rootCommand.PersistentFlags().Lookup("deadline"))
+	rootCommand.PersistentFlags().String("healthcheck-url", "", "Ping this URL when syncs start, succeed (the URL itself) and fail, e.g. a healthchecks.io check")
+	viper.BindPFlag("healthcheck.url", rootCommand.PersistentFlags().Lookup("healthcheck-url"))
+
+	var recordFlag string
+	var replayFlag string
+	rootCommand.PersistentFlags().StringVar(&recordFlag, "record", "", "Record Plaid and Airtable HTTP exchanges to fixtures in this directory")
+	rootCommand.PersistentFlags().StringVar(&replayFlag, "replay", "", "Serve Plaid and Airtable responses from fixtures in this directory instead of the network")
+	cobra.OnInitialize(func() {
+		err := SetupLogging(viper.GetBool("log.verbose"), viper.GetBool("log.quiet"), viper.GetString("log.format"))
+		if err != nil {
+			Fatal("Invalid flags", &ConfigError{err})
+		}
+		if recordFlag != "" && replayFlag != "" {
+			Fatal("Invalid flags", &ConfigError{errors.New("Pass only one of --record and --replay")})
+		}
+		// Plaid, Airtable and everything else use http.DefaultClient
+		if recordFlag != "" {
+			http.DefaultClient.Transport = &replay.Transport{Dir: recordFlag}
+		}
+		if replayFlag != "" {
+			http.DefaultClient.Transport = &replay.Transport{Dir: replayFlag, Replay: true}
+		}
+		if viper.GetBool("log.debug_http") {
+			http.DefaultClient.Transport = &httplog.Transport{Base: http.DefaultClient.Transport}
+		}
+		ctx = SetRunDeadline()
+		// Once, before commands share the linker between goroutines
+		ConfigureLinker(linker)
+	})
+
+	// Cobra reports usage errors itself
+	if err := rootCommand.Execute(); err != nil {
+		StopRunDeadline()
+		os.Exit(ExitConfig)
+	}
+	Exit()
+}
 
+// requirePlaidCredentials runs before every command but the profile
+// commands, which are needed to set up credentials in the first place.
+func requirePlaidCredentials(cmd *cobra.Command) {
 	if !viper.IsSet("plaid.client_id") {
 		log.Println("⚠️  PLAID_CLIENT_ID not set. Please see the configuration instructions below.")
-		rootCommand.Help()
-		os.Exit(1)
+		cmd.Root().Help()
+		os.Exit(ExitConfig)
 	}
 	if !viper.IsSet("plaid.secret") {
 		log.Println("⚠️ PLAID_SECRET not set. Please see the configuration instructions below.")
-		rootCommand.Help()
-		os.Exit(1)
+		cmd.Root().Help()
+		os.Exit(ExitConfig)
 	}
+}
 
-	rootCommand.Execute()
+// ItemLabel describes an item for listings, e.g. "Chase (chase)".
+func ItemLabel(data *plaid_cli.Data, itemID string) string {
+	return data.ItemLabel(itemID)
 }
 
-func AllTransactions(ctx context.Context, req plaid.TransactionsGetRequest, client *plaid.APIClient) ([]plaid.Transaction, error) {
-	var transactions []plaid.Transaction
+// AccountLabel is an account's alias, or its ID when it has none.
+func AccountLabel(data *plaid_cli.Data, accountID string) string {
+	for alias, id := range data.AccountAliases {
+		if id == accountID {
+			return alias
+		}
+	}
+	return accountID
+}
 
-	res, _, err := client.PlaidApi.TransactionsGet(ctx).TransactionsGetRequest(req).Execute()
+// PlaidClientFromConfig builds a client from the plaid.* settings.
+func PlaidClientFromConfig() (plaid_cli.PlaidClient, error) {
+	cfg := plaid.NewConfiguration()
+	cfg.AddDefaultHeader("PLAID-CLIENT-ID", viper.GetString("plaid.client_id"))
+	cfg.AddDefaultHeader("PLAID-SECRET", viper.GetString("plaid.secret"))
+	env, err := PlaidEnvironment()
 	if err != nil {
-		return transactions, err
+		return nil, err
 	}
+	cfg.UseEnvironment(env)
+	cfg.HTTPClient = plaidHTTPClient
+	return plaid_cli.NewPlaidClient(plaid.NewAPIClient(cfg)), nil
+}
 
-	transactions = append(transactions, res.Transactions...)
-
-	for len(transactions) < int(res.TotalTransactions) {
-		req.Options.SetOffset(*req.Options.Offset + *req.Options.Count)
-		res, _, err := client.PlaidApi.TransactionsGet(ctx).TransactionsGetRequest(req).Execute()
-		if err != nil {
-			return transactions, err
-		}
-
-		transactions = append(transactions, res.Transactions...)
-
+// ConfigureLinker applies the link settings from flags and the config
+// file, which are only known once a command runs. It runs once, after
+// flags are parsed, since relinks from concurrent downloads read them.
+func ConfigureLinker(linker *plaid_cli.Linker) {
+	linker.Bind = viper.GetString("link.bind")
+	linker.RedirectURI = viper.GetString("link.redirect_uri")
+	linker.TLSCert = viper.GetString("link.tls_cert")
+	linker.TLSKey = viper.GetString("link.tls_key")
+	linker.Hosted = viper.GetBool("link.hosted")
+	linker.NoOpen = viper.GetBool("link.no_open")
+	linker.ExternalHost = viper.GetString("link.external_host")
+	linker.DaysRequested = viper.GetInt("link.days_requested")
+	linker.Products = ConfigList("link.products")
+	linker.Webhook = viper.GetString("link.webhook")
+	// Link is finished elsewhere, so don't try to open a browser here
+	if linker.ExternalHost != "" {
+		linker.NoOpen = true
 	}
-
-	return transactions, nil
 }
 
-func WithRelinkOnAuthError(ctx context.Context, item idAndAlias, data *plaid_cli.Data, linker *plaid_cli.Linker, action func() error) error {
-	err := action()
-	e, _ := plaid.ToPlaidError(err)
-	if e.ErrorCode == "ITEM_LOGIN_REQUIRED" {
-		log.Printf("Login expired for %s (%s). Relinking...\n", item.alias, item.id)
-
-		port := viper.GetString("link.port")
-
-		err = linker.Relink(ctx, item.id, port)
-
-		if err != nil {
-			return err
-		}
-
-		log.Println("Re-running action...")
-
-		err = action()
+// backfillFieldNames are the names of FieldBackfills, sorted.
+func backfillFieldNames() []string {
+	var names []string
+	for name := range FieldBackfills {
+		names = append(names, name)
 	}
-
-	return err
+	sort.Strings(names)
+	return names
 }
 
-type TransactionSerializer interface {
-	serialize(txs []plaid.Transaction) ([]byte, error)
+func ResolveAccountID(data *plaid_cli.Data, accountIDOrAlias string) string {
+	if accountID, ok := data.AccountAliases[accountIDOrAlias]; ok {
+		return accountID
+	}
+	return accountIDOrAlias
 }
 
-func NewTransactionSerializer(t string) (TransactionSerializer, error) {
-	switch t {
-	case "csv":
-		return &CSVSerializer{}, nil
-	case "json":
-		return &JSONSerializer{}, nil
-	default:
-		return nil, errors.New(fmt.Sprintf("Invalid output format: %s", t))
+// ConfigList reads a list setting given either as a list or, as from
+// flags and the environment, comma separated.
+func ConfigList(key string) []string {
+	var list []string
+	for _, value := range viper.GetStringSlice(key) {
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
 	}
+	return list
 }
 
-type CSVSerializer struct{}
+// BackupPassphrase reads the backup passphrase from config or prompts for
+// it.
+func BackupPassphrase() (string, error) {
+	if p := viper.GetString("backup.passphrase"); p != "" {
+		return p, nil
+	}
 
-func (w *CSVSerializer) serialize(txs []plaid.Transaction) ([]byte, error) {
-	var records [][]string
-	for _, tx := range txs {
-		sanitizedName := strings.ReplaceAll(tx.Name, ",", "")
-		records = append(records, []string{tx.Date, fmt.Sprintf("%f", tx.Amount), sanitizedName})
+	prompt := promptui.Prompt{
+		Label: "Backup passphrase",
+		Mask:  '*',
 	}
+	return prompt.Run()
+}
 
-	b := bytes.NewBufferString("")
-	writer := csv.NewWriter(b)
-	err := writer.Write([]string{"Date", "Amount", "Description"})
-	if err != nil {
-		return nil, err
+// MaskToken hides all but the environment prefix and the last 4
+// characters of an access token, e.g. access-sandbox-…1234.
+func MaskToken(token string) string {
+	if len(token) <= 8 {
+		return strings.Repeat("*", len(token))
 	}
-	err = writer.WriteAll(records)
-	if err != nil {
-		return nil, err
+
+	prefix := ""
+	parts := strings.SplitN(token, "-", 3)
+	if len(parts) == 3 && parts[0] == "access" {
+		prefix = parts[0] + "-" + parts[1] + "-"
 	}
 
-	return b.Bytes(), err
+	return prefix + "…" + token[len(token)-4:]
 }
 
 func SetAlias(data *plaid_cli.Data, itemID string, alias string) error {
@@ -725,13 +2993,87 @@ func SetAlias(data *plaid_cli.Data, itemID string, alias string) error {
 		return err
 	}
 
-	log.Println(fmt.Sprintf("Aliased %s to %s.", itemID, alias))
+	slog.Info("Aliased item", "item_id", itemID, "alias", alias)
+
+	return nil
+}
+
+// SetAccountAlias names accountID alias. accountIDs are the accounts of
+// the linked items; unless force, accountID must be one of them. An
+// alias can't name two accounts, nor be another account's ID, which it
+// would shadow.
+func SetAccountAlias(data *plaid_cli.Data, accountIDs []string, accountID string, alias string, force bool) error {
+	if existing, ok := data.AccountAliases[alias]; ok && existing != accountID {
+		return errors.New(fmt.Sprintf("Alias `%s` already names account %s. Remove it from %s first.", alias, existing, filepath.Join(data.DataDir, "data", "account_aliases.json")))
+	}
+	if alias != accountID && contains(accountIDs, alias) {
+		return errors.New(fmt.Sprintf("`%s` is the ID of another account.", alias))
+	}
+	if _, ok := data.AccountAliases[accountID]; ok {
+		return errors.New(fmt.Sprintf("`%s` is an alias, not an account ID.", accountID))
+	}
+	if !force && !contains(accountIDs, accountID) {
+		return errors.New(fmt.Sprintf("No linked item has account `%s`. Pass --force to alias it anyway.", accountID))
+	}
+
+	data.AccountAliases[alias] = accountID
+	err := data.SaveAccountAliases()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Aliased account", "account_id", accountID, "alias", alias)
+
+	return nil
+}
+
+func RenameAlias(data *plaid_cli.Data, oldAlias string, newAlias string) error {
+	itemID, ok := data.Aliases[oldAlias]
+	if !ok {
+		return errors.New(fmt.Sprintf("No alias named `%s`.", oldAlias))
+	}
+	if _, ok := data.Aliases[newAlias]; ok {
+		return errors.New(fmt.Sprintf("Alias `%s` already exists.", newAlias))
+	}
+
+	delete(data.Aliases, oldAlias)
+	data.Aliases[newAlias] = itemID
+	if data.BackAliases[itemID] == oldAlias {
+		data.BackAliases[itemID] = newAlias
+	}
+	err := data.SaveAliases()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Renamed alias", "old", oldAlias, "new", newAlias)
 
 	return nil
 }
 
-type JSONSerializer struct{}
+func RemoveAlias(data *plaid_cli.Data, alias string) error {
+	itemID, ok := data.Aliases[alias]
+	if !ok {
+		return errors.New(fmt.Sprintf("No alias named `%s`.", alias))
+	}
+
+	delete(data.Aliases, alias)
+	if data.BackAliases[itemID] == alias {
+		delete(data.BackAliases, itemID)
+		// Fall back to any other alias for the same item
+		for other, otherID := range data.Aliases {
+			if otherID == itemID {
+				data.BackAliases[itemID] = other
+				break
+			}
+		}
+	}
+	err := data.SaveAliases()
+	if err != nil {
+		return err
+	}
 
-func (w *JSONSerializer) serialize(txs []plaid.Transaction) ([]byte, error) {
-	return json.MarshalIndent(txs, "", "  ")
+	slog.Info("Removed alias", "alias", alias, "item_id", itemID)
+
+	return nil
 }
@@ -0,0 +1,14 @@
+package main
+
+import "github.com/landakram/plaid-cli/pkg/plaid_cli"
+
+// The model lives in pkg/plaid_cli so the sync pipeline can be used as a
+// library. These aliases keep the CLI's code short.
+
+type Transaction = plaid_cli.Transaction
+type PersonalFinanceCategory = plaid_cli.PersonalFinanceCategory
+type Counterparty = plaid_cli.Counterparty
+type PaymentMeta = plaid_cli.PaymentMeta
+type Location = plaid_cli.Location
+type Account = plaid_cli.Account
+type Balances = plaid_cli.Balances
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Names like "SQ *COFFEE SHOP 0492 SAN FRANC" come straight from the
+// card processor. With names.normalize on, built-in cleanups strip the
+// processor prefix, store number and the (often truncated) city after it,
+// giving "Coffee Shop". Rules in names.rules then rename what's left:
+//
+//	[[names.rules]]
+//	match = "(?i)^amzn mktp.*"
+//	replace = "Amazon"
+
+// Payment processor prefixes, e.g. Square, Toast, PayPal
+var processorPrefix = regexp.MustCompile(`(?i)^((SQ|TST|SP|PP|PAYPAL)\s*\*|(POS PURCHASE|POS|DEBIT CARD PURCHASE|CHECKCARD)\s)\s*`)
+
+// A store number and everything after it, which is usually the location
+var storeNumberSuffix = regexp.MustCompile(`\s+#?\d{3,}\b.*$`)
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+type NameRule struct {
+	Match   string
+	Replace string
+}
+
+type NameNormalizer struct {
+	builtin bool
+	rules   []*regexp.Regexp
+	replace []string
+}
+
+// NewNameNormalizer returns the normalizer configured under names, or nil
+// when neither names.normalize nor names.rules is set.
+func NewNameNormalizer() (*NameNormalizer, error) {
+	var rules []NameRule
+	err := viper.UnmarshalKey("names.rules", &rules)
+	if err != nil {
+		return nil, err
+	}
+
+	builtin := viper.GetBool("names.normalize")
+	if !builtin && len(rules) == 0 {
+		return nil, nil
+	}
+
+	n := &NameNormalizer{builtin: builtin}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid names.rules match %q: %s", rule.Match, err))
+		}
+		n.rules = append(n.rules, re)
+		n.replace = append(n.replace, rule.Replace)
+	}
+	return n, nil
+}
+
+// Normalize returns the cleaned up name. The first matching rule wins.
+func (n *NameNormalizer) Normalize(name string) string {
+	cleaned, _ := n.normalize(name)
+	return cleaned
+}
+
+// normalize also returns the index of the rule that matched, or -1.
+func (n *NameNormalizer) normalize(name string) (string, int) {
+	cleaned := name
+	if n.builtin {
+		cleaned = cleanName(name)
+	}
+	rule := -1
+	for i, re := range n.rules {
+		if re.MatchString(cleaned) {
+			cleaned = re.ReplaceAllString(cleaned, n.replace[i])
+			rule = i
+			break
+		}
+	}
+	cleaned = strings.TrimSpace(cleaned)
+	if cleaned == "" {
+		return name, rule
+	}
+	return cleaned, rule
+}
+
+func cleanName(name string) string {
+	cleaned := whitespace.ReplaceAllString(strings.TrimSpace(name), " ")
+	cleaned = processorPrefix.ReplaceAllString(cleaned, "")
+	cleaned = storeNumberSuffix.ReplaceAllString(cleaned, "")
+	cleaned = strings.TrimSpace(cleaned)
+
+	// Only fix the case of all caps names, so "iTunes" stays as is
+	if cleaned == strings.ToUpper(cleaned) {
+		words := strings.Fields(strings.ToLower(cleaned))
+		for i, w := range words {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+		cleaned = strings.Join(words, " ")
+	}
+	return cleaned
+}
+
+// NormalizeNames replaces transaction names with their normalized form,
+// keeping the original in RawName. A nil normalizer does nothing.
+func NormalizeNames(txs []Transaction, n *NameNormalizer) {
+	if n == nil {
+		return
+	}
+	for i := range txs {
+		t := &txs[i]
+		cleaned := n.Normalize(t.Name)
+		if cleaned != t.Name {
+			t.RawName = t.Name
+			t.Name = cleaned
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"SQ *COFFEE SHOP 0492 SAN FRANC", "Coffee Shop"},
+		{"TST* THE BURGER JOINT", "The Burger Joint"},
+		{"PAYPAL *STEAM GAMES", "Steam Games"},
+		{"POS PURCHASE  TRADER JOE'S #552 OAKLAND", "Trader Joe's"},
+		{"CHECKCARD  SAFEWAY 1234", "Safeway"},
+		{"  WHOLE   FOODS  ", "Whole Foods"},
+		// Mixed case is left alone
+		{"iTunes.com/bill", "iTunes.com/bill"},
+		// Short numbers aren't store numbers
+		{"7 ELEVEN", "7 Eleven"},
+	}
+	for _, tt := range tests {
+		if got := cleanName(tt.in); got != tt.want {
+			t.Errorf("cleanName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNameNormalizer(t *testing.T) {
+	n := &NameNormalizer{
+		builtin: true,
+		rules:   []*regexp.Regexp{regexp.MustCompile(`(?i)^amzn mktp.*`), regexp.MustCompile(`(?i)^amzn.*`), regexp.MustCompile(`^Remove Me$`)},
+		replace: []string{"Amazon", "Amazon (other)", ""},
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"AMZN Mktp US*2K4", "Amazon"},
+		// The first matching rule wins
+		{"AMZN Digital", "Amazon (other)"},
+		// Rules see the cleaned up name, and one leaving nothing keeps
+		// the original
+		{"SQ *REMOVE ME", "SQ *REMOVE ME"},
+		{"Blue Bottle", "Blue Bottle"},
+	}
+	for _, tt := range tests {
+		if got := n.Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeNamesKeepsRawName(t *testing.T) {
+	txs := []Transaction{{Name: "SQ *COFFEE SHOP 0492"}, {Name: "Blue Bottle"}}
+	NormalizeNames(txs, &NameNormalizer{builtin: true})
+	if txs[0].Name != "Coffee Shop" || txs[0].RawName != "SQ *COFFEE SHOP 0492" {
+		t.Errorf("got %q (raw %q)", txs[0].Name, txs[0].RawName)
+	}
+	if txs[1].RawName != "" {
+		t.Errorf("unchanged name got RawName %q", txs[1].RawName)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Events sent to notify.hooks
+const (
+	// Transactions were created by a sync
+	EventCreated = "created"
+	// Transactions were deleted (or marked removed) by a sync
+	EventDeleted = "deleted"
+	// An item's login expired and it has to be relinked
+	EventRelink = "relink"
+	// A sync failed
+	EventFailure = "failure"
+	// A transaction or balance matched alerts.transactions or
+	// alerts.balances
+	EventAlert = "alert"
+	// A category went over its budget
+	EventBudget = "budget"
+	// A digest, from the digest command
+	EventDigest = "digest"
+)
+
+type NotifyEvent struct {
+	Event   string
+	Message string
+	Time    time.Time
+	// Set for created and deleted
+	Count int
+	// Set for relink
+	Item string
+	// Set for relink from a Plaid webhook, the Hosted Link page to relink
+	// the item on
+	URL string
+	// Set for failure
+	Error string
+}
+
+// NotifyHook is one entry of notify.hooks, e.g.
+//
+//	[[notify.hooks]]
+//	type = "slack"
+//	url = "https://hooks.slack.com/services/..."
+//	events = ["created", "failure"]
+//
+// Type is slack, discord, webhook or email. Hooks without events get all
+// of them.
+type NotifyHook struct {
+	Type   string
+	Events []string
+	// Slack, Discord and webhook
+	URL string
+	// Webhook body, a text/template executed with the NotifyEvent. The
+	// event as JSON by default.
+	Template string
+	// Email
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify sends event to every hook in notify.hooks that wants it. Failing
+// hooks are logged, never returned, so a broken webhook can't fail a sync.
+func Notify(event NotifyEvent) {
+	var hooks []NotifyHook
+	err := viper.UnmarshalKey("notify.hooks", &hooks)
+	if err != nil {
+		slog.Warn("Invalid notify.hooks", "error", err)
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, hook := range hooks {
+		if len(hook.Events) > 0 && !contains(hook.Events, event.Event) {
+			continue
+		}
+		err := hook.send(event)
+		if err != nil {
+			LogError("Cannot send notification", err, "event", event.Event, "hook", hook.Type)
+		}
+	}
+}
+
+func (h NotifyHook) send(event NotifyEvent) error {
+	text := "plaid-cli: " + event.Message
+
+	switch h.Type {
+	case "slack":
+		return postJSON(h.URL, map[string]string{"text": text})
+	case "discord":
+		return postJSON(h.URL, map[string]string{"content": text})
+	case "webhook":
+		if h.Template == "" {
+			return postJSON(h.URL, event)
+		}
+		t, err := template.New("notify").Parse(h.Template)
+		if err != nil {
+			return err
+		}
+		var body bytes.Buffer
+		err = t.Execute(&body, event)
+		if err != nil {
+			return err
+		}
+		return post(h.URL, body.Bytes())
+	case "email":
+		port := h.Port
+		if port == 0 {
+			port = 587
+		}
+		var auth smtp.Auth
+		if h.Username != "" {
+			auth = smtp.PlainAuth("", h.Username, h.Password, h.Host)
+		}
+		msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: plaid-cli %s\r\n\r\n%s\r\n", h.From, strings.Join(h.To, ", "), event.Event, event.Message)
+		return smtp.SendMail(fmt.Sprintf("%s:%d", h.Host, port), auth, h.From, h.To, []byte(msg))
+	default:
+		return errors.New(fmt.Sprintf("Unknown hook type: %s", h.Type))
+	}
+}
+
+func postJSON(url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return post(url, b)
+}
+
+func post(url string, body []byte) error {
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(fmt.Sprintf("%s: %s", resp.Status, b))
+	}
+	return nil
+}
+
+// NotifySync sends the events for a finished sync-transactions run.
+func NotifySync(summary *RunSummary, err error) {
+	if summary.Created > 0 {
+		Notify(NotifyEvent{Event: EventCreated, Count: summary.Created, Message: fmt.Sprintf("Synced %d new transactions", summary.Created)})
+	}
+	if summary.Deleted > 0 {
+		Notify(NotifyEvent{Event: EventDeleted, Count: summary.Deleted, Message: fmt.Sprintf("Removed %d transactions Plaid no longer returns", summary.Deleted)})
+	}
+	if err != nil {
+		Notify(NotifyEvent{Event: EventFailure, Error: err.Error(), Message: fmt.Sprintf("Sync failed: %s", err)})
+	}
+}
@@ -0,0 +1,139 @@
+// Package actual is a minimal client for an Actual Budget server through
+// actual-http-api (https://github.com/jhonderson/actual-http-api), the
+// REST bridge over Actual's Node.js API.
+package actual
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Client struct {
+	// The bridge, e.g. http://localhost:5007
+	URL    string
+	APIKey string
+	// The budget's Sync ID, from Settings > Advanced settings
+	BudgetID string
+	// For budgets with end-to-end encryption
+	EncryptionPassword string
+	HTTPClient         *http.Client
+}
+
+type Account struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	OffBudget bool   `json:"offbudget"`
+	Closed    bool   `json:"closed"`
+}
+
+// Transaction is a transaction to import. Amounts are in cents, negative
+// for money going out.
+type Transaction struct {
+	Date          string `json:"date"`
+	Amount        int64  `json:"amount"`
+	PayeeName     string `json:"payee_name,omitempty"`
+	ImportedPayee string `json:"imported_payee,omitempty"`
+	Notes         string `json:"notes,omitempty"`
+	// Actual skips transactions whose imported_id is already in the
+	// account
+	ImportedID string `json:"imported_id,omitempty"`
+	Cleared    bool   `json:"cleared"`
+}
+
+// ImportResult is the IDs of the transactions Actual added and of those it
+// matched to existing ones and updated.
+type ImportResult struct {
+	Added   []string `json:"added"`
+	Updated []string `json:"updated"`
+}
+
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("actual: %d %s", e.StatusCode, e.Message)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) Accounts() ([]Account, error) {
+	var res struct {
+		Data []Account `json:"data"`
+	}
+	err := c.do("GET", "accounts", nil, &res)
+	return res.Data, err
+}
+
+// ImportTransactions imports txs into an account, running the budget's
+// rules and reconciling with existing transactions as a bank import does.
+func (c *Client) ImportTransactions(accountID string, txs []Transaction) (ImportResult, error) {
+	var res struct {
+		Data ImportResult `json:"data"`
+	}
+	body := map[string]interface{}{"transactions": txs}
+	err := c.do("POST", "accounts/"+url.PathEscape(accountID)+"/transactions/import", body, &res)
+	return res.Data, err
+}
+
+func (c *Client) do(method string, endpoint string, body interface{}, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	u := fmt.Sprintf("%s/v1/budgets/%s/%s", strings.TrimRight(c.URL, "/"), url.PathEscape(c.BudgetID), endpoint)
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("x-api-key", c.APIKey)
+	if c.EncryptionPassword != "" {
+		req.Header.Add("budget-encryption-password", c.EncryptionPassword)
+	}
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		e := &Error{StatusCode: resp.StatusCode, Message: string(b)}
+		var res struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(b, &res) == nil && res.Error != "" {
+			e.Message = res.Error
+		}
+		return e
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,254 @@
+// Package airtable is a small client for the Airtable REST API, covering
+// what plaid-cli needs: paged listing with field selection, batched
+// creates, updates, upserts and deletes, the Metadata API and attachment
+// uploads. Requests are rate limited to Airtable's 5 requests per second
+// per base and retried when Airtable is throttling or unavailable.
+package airtable
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRootURL    = "https://api.airtable.com"
+	DefaultContentURL = "https://content.airtable.com"
+
+	// Airtable allows 5 requests per second per base
+	RequestsPerSecond = 5
+	// Create, update and delete accept at most 10 records per request
+	MaxBatchSize = 10
+
+	defaultMaxRetries = 5
+	// Airtable asks clients to wait 30 seconds after a 429
+	rateLimitBackoff = 30 * time.Second
+)
+
+type Client struct {
+	APIKey string
+	BaseID string
+
+	// Optional, defaulting to DefaultRootURL, DefaultContentURL and
+	// http.DefaultClient
+	RootURL    string
+	ContentURL string
+	HTTPClient *http.Client
+	// Optional, bounding every request and the waits between retries,
+	// e.g. with a deadline for the whole command
+	Context context.Context
+
+	// Retries for throttled (429) and failed (5xx) requests. Zero means
+	// the default of 5; use a negative number to disable retries.
+	MaxRetries int
+	// OnRetry, when set, is called before each retry
+	OnRetry func(attempt int, wait time.Duration, err error)
+	// OnMutation, when set, is called for each record a write changed.
+	// Updates and deletes then fetch the records first, for Before.
+	OnMutation func(Mutation)
+}
+
+// Error is returned for any non-2xx response from Airtable.
+type Error struct {
+	StatusCode int
+	// e.g. INVALID_PERMISSIONS_OR_MODEL_NOT_FOUND
+	Type    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("airtable: %d", e.StatusCode)
+	if e.Type != "" {
+		msg += " " + e.Type
+	} else {
+		msg += " " + http.StatusText(e.StatusCode)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *Error) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+func (c *Client) Table(name string) *Table {
+	return &Table{client: c, name: name}
+}
+
+func (c *Client) rootURL() string {
+	if c.RootURL != "" {
+		return c.RootURL
+	}
+	return DefaultRootURL
+}
+
+func (c *Client) contentURL() string {
+	if c.ContentURL != "" {
+		return c.ContentURL
+	}
+	return DefaultContentURL
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) context() context.Context {
+	if c.Context != nil {
+		return c.Context
+	}
+	return context.Background()
+}
+
+func (c *Client) maxRetries() int {
+	if c.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	if c.MaxRetries < 0 {
+		return 0
+	}
+	return c.MaxRetries
+}
+
+// Meta calls the Metadata API, e.g. Meta("GET", "whoami", nil, &whoami).
+func (c *Client) Meta(method string, endpoint string, body interface{}, v interface{}) error {
+	return c.do(method, fmt.Sprintf("%s/v0/meta/%s", c.rootURL(), endpoint), body, v)
+}
+
+// UploadAttachment adds a base64 encoded file to an attachment field,
+// for files that aren't available at a public URL.
+func (c *Client) UploadAttachment(recordID string, field string, filename string, contentType string, file string) error {
+	body := map[string]string{
+		"contentType": contentType,
+		"filename":    filename,
+		"file":        file,
+	}
+	return c.do("POST", fmt.Sprintf("%s/v0/%s/%s/%s/uploadAttachment", c.contentURL(), c.BaseID, recordID, field), body, nil)
+}
+
+// Requests across all clients share one limiter; several clients for the
+// same base are common and Airtable limits per base.
+var (
+	limiterMu   sync.Mutex
+	lastRequest time.Time
+)
+
+func wait() {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+
+	next := lastRequest.Add(time.Second / RequestsPerSecond)
+	if d := time.Until(next); d > 0 {
+		time.Sleep(d)
+	}
+	lastRequest = time.Now()
+}
+
+func (c *Client) do(method string, url string, body interface{}, v interface{}) error {
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err := c.doOnce(method, url, b, v)
+		apiErr, ok := err.(*Error)
+		if !ok || !apiErr.retryable() || attempt >= c.maxRetries() {
+			return err
+		}
+
+		delay := backoff
+		if apiErr.StatusCode == http.StatusTooManyRequests {
+			delay = rateLimitBackoff
+		}
+		if c.OnRetry != nil {
+			c.OnRetry(attempt+1, delay, err)
+		}
+		select {
+		case <-c.context().Done():
+			return c.context().Err()
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) doOnce(method string, url string, body []byte, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(c.context(), method, url, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	wait()
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return parseError(resp.StatusCode, b)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Airtable reports errors either as {"error": "NOT_FOUND"} or as
+// {"error": {"type": "...", "message": "..."}}.
+func parseError(statusCode int, b []byte) error {
+	apiErr := &Error{StatusCode: statusCode}
+
+	var resp struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(b, &resp) != nil || resp.Error == nil {
+		apiErr.Message = string(b)
+		return apiErr
+	}
+
+	if json.Unmarshal(resp.Error, &apiErr.Type) == nil {
+		return apiErr
+	}
+
+	var detail struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(resp.Error, &detail) == nil {
+		apiErr.Type = detail.Type
+		apiErr.Message = detail.Message
+	}
+	return apiErr
+}
@@ -0,0 +1,75 @@
+package airtable
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Mutation is one record changed by a write, as reported to
+// Client.OnMutation after the write succeeds.
+type Mutation struct {
+	Table string `json:"table"`
+	// create, update or delete
+	Op       string `json:"op"`
+	RecordID string `json:"record_id"`
+	// For updates, the written fields' values before; for deletes, the
+	// whole record. Records updated by an upsert have none.
+	Before map[string]interface{} `json:"before,omitempty"`
+	// The fields written, for creates and updates
+	After map[string]interface{} `json:"after,omitempty"`
+}
+
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+type mapRecord struct {
+	ID     string                 `json:"id"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// current fetches the records with the given IDs by ID, so mutations can
+// report what they overwrote.
+func (t *Table) current(ids []string) (map[string]map[string]interface{}, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	conditions := make([]string, len(ids))
+	for i, id := range ids {
+		conditions[i] = fmt.Sprintf("RECORD_ID() = '%s'", id)
+	}
+	var records []mapRecord
+	err := t.List(&records, &Options{Filter: fmt.Sprintf("OR(%s)", strings.Join(conditions, ", "))})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]map[string]interface{}, len(records))
+	for _, r := range records {
+		byID[r.ID] = r.Fields
+	}
+	return byID, nil
+}
+
+func (t *Table) report(m Mutation) {
+	m.Table = t.name
+	t.client.OnMutation(m)
+}
+
+func fieldsMap(raw json.RawMessage) map[string]interface{} {
+	var fields map[string]interface{}
+	json.Unmarshal(raw, &fields)
+	return fields
+}
+
+// only keeps the fields in keys.
+func only(fields map[string]interface{}, keys map[string]interface{}) map[string]interface{} {
+	kept := make(map[string]interface{}, len(keys))
+	for k := range keys {
+		// Empty fields are left out of API responses
+		kept[k] = fields[k]
+	}
+	return kept
+}
@@ -0,0 +1,57 @@
+package airtable
+
+// Record is meant to be embedded in record structs alongside a Fields
+// struct, e.g.
+//
+//	type BookRecord struct {
+//		airtable.Record
+//		Fields Book
+//	}
+//
+// An optional `Typecast bool` field on the record struct enables
+// Airtable's automatic conversion of string values when writing it.
+type Record struct {
+	ID          string `json:"id,omitempty"`
+	CreatedTime string `json:"createdTime,omitempty"`
+}
+
+// RecordLink holds the IDs of linked records.
+type RecordLink []string
+
+// Attachment is an attachment field.
+type Attachment []AttachmentFile
+
+// When creating attachments only URL and optionally Filename need to be
+// set; Airtable downloads the file from URL.
+type AttachmentFile struct {
+	ID       string  `json:"id,omitempty"`
+	URL      string  `json:"url"`
+	Filename string  `json:"filename,omitempty"`
+	Size     float64 `json:"size,omitempty"`
+	Type     string  `json:"type,omitempty"`
+}
+
+type SortDirection string
+
+const (
+	SortAsc  SortDirection = "asc"
+	SortDesc SortDirection = "desc"
+)
+
+type SortField struct {
+	Field     string        `json:"field"`
+	Direction SortDirection `json:"direction"`
+}
+
+// Options narrows down Table.List.
+type Options struct {
+	// Only return these fields. Fetching just what's needed is much
+	// faster on large tables.
+	Fields []string
+	// Formula records must match, e.g. "{Pending} = 1"
+	Filter string
+	// Only return records in this view, in the view's order
+	View       string
+	Sort       []SortField
+	MaxRecords int
+}
@@ -0,0 +1,308 @@
+package airtable
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+type Table struct {
+	client *Client
+	name   string
+}
+
+// TableClient is what *Table does, so code using a table can run against
+// a fake.
+type TableClient interface {
+	List(listPtr interface{}, options *Options) error
+	Create(recordPtr interface{}) error
+	Update(recordPtr interface{}) error
+	Delete(recordPtr interface{}) error
+	CreateAll(records interface{}, progress func(int)) error
+	UpdateAll(records interface{}, progress func(int)) error
+	UpsertAll(records interface{}, fieldsToMergeOn []string, progress func(int)) error
+	DeleteAll(records interface{}, progress func(int)) error
+}
+
+func (t *Table) url(suffix string) string {
+	return fmt.Sprintf("%s/v0/%s/%s%s", t.client.rootURL(), t.client.BaseID, url.PathEscape(t.name), suffix)
+}
+
+// List fetches every record matching options into listPtr, a pointer to
+// a slice of record structs.
+func (t *Table) List(listPtr interface{}, options *Options) error {
+	if options == nil {
+		options = &Options{}
+	}
+
+	body := map[string]interface{}{
+		"pageSize": 100,
+	}
+	if len(options.Fields) > 0 {
+		body["fields"] = options.Fields
+	}
+	if options.Filter != "" {
+		body["filterByFormula"] = options.Filter
+	}
+	if options.View != "" {
+		body["view"] = options.View
+	}
+	if len(options.Sort) > 0 {
+		body["sort"] = options.Sort
+	}
+	if options.MaxRecords > 0 {
+		body["maxRecords"] = options.MaxRecords
+	}
+
+	// listRecords takes the options in the body, so long filters don't
+	// run into URL length limits
+	var records []json.RawMessage
+	for {
+		var page struct {
+			Records []json.RawMessage `json:"records"`
+			Offset  string            `json:"offset"`
+		}
+		err := t.client.do("POST", t.url("/listRecords"), body, &page)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, page.Records...)
+		if page.Offset == "" {
+			break
+		}
+		body["offset"] = page.Offset
+	}
+
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, listPtr)
+}
+
+func (t *Table) Create(recordPtr interface{}) error {
+	return t.write("POST", []interface{}{recordPtr}, nil)
+}
+
+func (t *Table) Update(recordPtr interface{}) error {
+	return t.write("PATCH", []interface{}{recordPtr}, nil)
+}
+
+func (t *Table) Delete(recordPtr interface{}) error {
+	return t.delete([]interface{}{recordPtr})
+}
+
+// CreateAll creates records, a slice of record structs, in batches of
+// MaxBatchSize, filling in their IDs. progress, if not nil, is called
+// with the number of records written after each batch.
+func (t *Table) CreateAll(records interface{}, progress func(int)) error {
+	return t.batch(records, progress, func(batch []interface{}) error {
+		return t.write("POST", batch, nil)
+	})
+}
+
+// UpdateAll updates records, a slice of record structs with IDs set, in
+// batches of MaxBatchSize. Fields left out of the JSON encoding (e.g.
+// with omitempty) are left alone.
+func (t *Table) UpdateAll(records interface{}, progress func(int)) error {
+	return t.batch(records, progress, func(batch []interface{}) error {
+		return t.write("PATCH", batch, nil)
+	})
+}
+
+// UpsertAll updates the records matching on fieldsToMergeOn and creates
+// the rest, filling in their IDs.
+func (t *Table) UpsertAll(records interface{}, fieldsToMergeOn []string, progress func(int)) error {
+	return t.batch(records, progress, func(batch []interface{}) error {
+		return t.write("PATCH", batch, fieldsToMergeOn)
+	})
+}
+
+func (t *Table) DeleteAll(records interface{}, progress func(int)) error {
+	return t.batch(records, progress, t.delete)
+}
+
+func (t *Table) batch(records interface{}, progress func(int), write func([]interface{}) error) error {
+	v := reflect.ValueOf(records)
+	if v.Kind() != reflect.Slice {
+		return errors.New(fmt.Sprintf("airtable: expected a slice of records, got %T", records))
+	}
+
+	for start := 0; start < v.Len(); start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > v.Len() {
+			end = v.Len()
+		}
+
+		batch := make([]interface{}, 0, end-start)
+		for i := start; i < end; i++ {
+			batch = append(batch, v.Index(i).Addr().Interface())
+		}
+
+		err := write(batch)
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(len(batch))
+		}
+	}
+	return nil
+}
+
+type wireRecord struct {
+	ID     string          `json:"id,omitempty"`
+	Fields json.RawMessage `json:"fields"`
+}
+
+// toWire pulls the ID, fields and typecast flag out of a record struct.
+// JSON decoding is case insensitive, so this matches both the embedded
+// Record's "id" and a "Fields" struct field.
+func toWire(recordPtr interface{}) (wireRecord, bool, error) {
+	b, err := json.Marshal(recordPtr)
+	if err != nil {
+		return wireRecord{}, false, err
+	}
+
+	var r struct {
+		ID       string          `json:"id"`
+		Fields   json.RawMessage `json:"fields"`
+		Typecast bool            `json:"typecast"`
+	}
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return wireRecord{}, false, err
+	}
+	if r.Fields == nil {
+		return wireRecord{}, false, errors.New(fmt.Sprintf("airtable: %T has no Fields", recordPtr))
+	}
+
+	return wireRecord{ID: r.ID, Fields: r.Fields}, r.Typecast, nil
+}
+
+func (t *Table) write(method string, recordPtrs []interface{}, fieldsToMergeOn []string) error {
+	body := map[string]interface{}{}
+
+	wire := make([]wireRecord, len(recordPtrs))
+	typecast := false
+	for i, recordPtr := range recordPtrs {
+		r, tc, err := toWire(recordPtr)
+		if err != nil {
+			return err
+		}
+		if method == "PATCH" && fieldsToMergeOn == nil && r.ID == "" {
+			return errors.New("airtable: cannot update a record without an ID")
+		}
+		if method == "POST" || fieldsToMergeOn != nil {
+			r.ID = ""
+		}
+		wire[i] = r
+		typecast = typecast || tc
+	}
+	body["records"] = wire
+	if typecast {
+		body["typecast"] = true
+	}
+	if fieldsToMergeOn != nil {
+		body["performUpsert"] = map[string]interface{}{"fieldsToMergeOn": fieldsToMergeOn}
+	}
+
+	var before map[string]map[string]interface{}
+	if t.client.OnMutation != nil && method == "PATCH" && fieldsToMergeOn == nil {
+		ids := make([]string, len(wire))
+		for i, r := range wire {
+			ids[i] = r.ID
+		}
+		var err error
+		before, err = t.current(ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	var resp struct {
+		Records []json.RawMessage `json:"records"`
+		// Upserts only
+		CreatedRecords []string `json:"createdRecords"`
+	}
+	err := t.client.do(method, t.url(""), body, &resp)
+	if err != nil {
+		return err
+	}
+
+	if t.client.OnMutation != nil {
+		created := make(map[string]bool)
+		for _, id := range resp.CreatedRecords {
+			created[id] = true
+		}
+		for i, r := range resp.Records {
+			if i >= len(wire) {
+				break
+			}
+			var id struct {
+				ID string `json:"id"`
+			}
+			json.Unmarshal(r, &id)
+			m := Mutation{Op: OpUpdate, RecordID: id.ID, After: fieldsMap(wire[i].Fields)}
+			if method == "POST" || created[id.ID] {
+				m.Op = OpCreate
+			} else if current, ok := before[id.ID]; ok {
+				m.Before = only(current, m.After)
+			}
+			t.report(m)
+		}
+	}
+
+	// Records come back in request order; copy IDs and computed fields
+	// back into the caller's structs
+	for i, r := range resp.Records {
+		if i >= len(recordPtrs) {
+			break
+		}
+		err := json.Unmarshal(r, recordPtrs[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Table) delete(recordPtrs []interface{}) error {
+	query := make([]string, len(recordPtrs))
+	ids := make([]string, len(recordPtrs))
+	for i, recordPtr := range recordPtrs {
+		r, _, err := toWire(recordPtr)
+		if err != nil {
+			return err
+		}
+		if r.ID == "" {
+			return errors.New("airtable: cannot delete a record without an ID")
+		}
+		query[i] = "records[]=" + url.QueryEscape(r.ID)
+		ids[i] = r.ID
+	}
+
+	var before map[string]map[string]interface{}
+	if t.client.OnMutation != nil {
+		var err error
+		before, err = t.current(ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := t.client.do("DELETE", t.url("?"+strings.Join(query, "&")), nil, nil)
+	if err != nil {
+		return err
+	}
+	if t.client.OnMutation != nil {
+		for _, id := range ids {
+			t.report(Mutation{Op: OpDelete, RecordID: id, Before: before[id]})
+		}
+	}
+	return nil
+}
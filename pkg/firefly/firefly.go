@@ -0,0 +1,221 @@
+// Package firefly is a minimal client for the Firefly III API, covering
+// the asset accounts and transactions plaid-cli syncs.
+package firefly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Client struct {
+	// The Firefly III instance, e.g. https://firefly.example.com
+	URL string
+	// A personal access token, from Options > Profile > OAuth
+	Token      string
+	HTTPClient *http.Client
+}
+
+// Account is an account's attributes. Which are required depends on the
+// type and role; see the Firefly III API reference.
+type Account struct {
+	ID                 string `json:"-"`
+	Name               string `json:"name"`
+	Type               string `json:"type"`
+	AccountRole        string `json:"account_role,omitempty"`
+	CurrencyCode       string `json:"currency_code,omitempty"`
+	AccountNumber      string `json:"account_number,omitempty"`
+	Notes              string `json:"notes,omitempty"`
+	CreditCardType     string `json:"credit_card_type,omitempty"`
+	MonthlyPaymentDate string `json:"monthly_payment_date,omitempty"`
+}
+
+// Split is a transaction split. plaid-cli creates single split
+// transactions. Amounts are positive; Type says which way money moved.
+type Split struct {
+	Type                string `json:"type"`
+	Date                string `json:"date"`
+	Amount              string `json:"amount"`
+	Description         string `json:"description"`
+	CurrencyCode        string `json:"currency_code,omitempty"`
+	ForeignAmount       string `json:"foreign_amount,omitempty"`
+	ForeignCurrencyCode string `json:"foreign_currency_code,omitempty"`
+	SourceID            string `json:"source_id,omitempty"`
+	SourceName          string `json:"source_name,omitempty"`
+	DestinationID       string `json:"destination_id,omitempty"`
+	DestinationName     string `json:"destination_name,omitempty"`
+	CategoryName        string `json:"category_name,omitempty"`
+	ExternalID          string `json:"external_id,omitempty"`
+	Notes               string `json:"notes,omitempty"`
+}
+
+// Error is an unsuccessful response.
+type Error struct {
+	StatusCode int
+	Message    string
+	Body       string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("firefly: %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("firefly: %d %s", e.StatusCode, e.Body)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+type resource struct {
+	ID         string          `json:"id"`
+	Attributes json.RawMessage `json:"attributes"`
+}
+
+type page struct {
+	Data []resource `json:"data"`
+	Meta struct {
+		Pagination struct {
+			TotalPages int `json:"total_pages"`
+		} `json:"pagination"`
+	} `json:"meta"`
+}
+
+// list fetches every page of a collection endpoint.
+func (c *Client) list(endpoint string, query url.Values) ([]resource, error) {
+	var resources []resource
+	for n := 1; ; n++ {
+		query.Set("page", fmt.Sprint(n))
+		var p page
+		err := c.do("GET", endpoint+"?"+query.Encode(), nil, &p)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, p.Data...)
+		if n >= p.Meta.Pagination.TotalPages {
+			return resources, nil
+		}
+	}
+}
+
+// Accounts lists accounts of a type, e.g. "asset".
+func (c *Client) Accounts(accountType string) ([]Account, error) {
+	resources, err := c.list("accounts", url.Values{"type": {accountType}})
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]Account, len(resources))
+	for i, r := range resources {
+		err := json.Unmarshal(r.Attributes, &accounts[i])
+		if err != nil {
+			return nil, err
+		}
+		accounts[i].ID = r.ID
+	}
+	return accounts, nil
+}
+
+// CreateAccount creates an account and returns it with its ID set.
+func (c *Client) CreateAccount(account Account) (Account, error) {
+	var res struct {
+		Data resource `json:"data"`
+	}
+	err := c.do("POST", "accounts", account, &res)
+	if err != nil {
+		return account, err
+	}
+	account.ID = res.Data.ID
+	return account, nil
+}
+
+// ExternalIDs returns the external IDs of an account's transactions
+// between start and end, as YYYY-MM-DD dates.
+func (c *Client) ExternalIDs(accountID string, start string, end string) (map[string]bool, error) {
+	resources, err := c.list("accounts/"+url.PathEscape(accountID)+"/transactions", url.Values{"start": {start}, "end": {end}})
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool)
+	for _, r := range resources {
+		var attributes struct {
+			Transactions []struct {
+				ExternalID string `json:"external_id"`
+			} `json:"transactions"`
+		}
+		err := json.Unmarshal(r.Attributes, &attributes)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range attributes.Transactions {
+			if t.ExternalID != "" {
+				ids[t.ExternalID] = true
+			}
+		}
+	}
+	return ids, nil
+}
+
+// CreateTransaction stores a transaction with a single split. With
+// applyRules, the instance's rules run on it as for one entered by hand.
+func (c *Client) CreateTransaction(split Split, applyRules bool) error {
+	body := map[string]interface{}{
+		"apply_rules":  applyRules,
+		"transactions": []Split{split},
+	}
+	return c.do("POST", "transactions", body, nil)
+}
+
+func (c *Client) do(method string, endpoint string, body interface{}, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(c.URL, "/")+"/api/v1/"+endpoint, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	req.Header.Add("Accept", "application/vnd.api+json")
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		e := &Error{StatusCode: resp.StatusCode, Body: string(b)}
+		var res struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(b, &res) == nil {
+			e.Message = res.Message
+		}
+		return e
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(b, v)
+}
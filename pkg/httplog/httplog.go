@@ -0,0 +1,181 @@
+// Package httplog logs HTTP exchanges for debugging, with the secrets
+// plaid-cli sends (Plaid access tokens, client secrets, Airtable personal
+// access tokens and other API keys) redacted.
+package httplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+var (
+	// Query parameters whose values are secrets
+	secretParam = regexp.MustCompile(`(?i)token|secret|key|password|signature|auth`)
+	// Secrets recognizable by their shape, wherever they appear
+	secretValues = []*regexp.Regexp{
+		// Plaid access, public and link tokens
+		regexp.MustCompile(`\b(access|public|link)-(sandbox|development|production)-[0-9a-f-]+`),
+		// Airtable personal access tokens
+		regexp.MustCompile(`\bpat[A-Za-z0-9]{14}\.[0-9a-f]{64}\b`),
+	}
+	// JSON fields whose values are secrets: credentials, and the account
+	// and routing numbers of /auth/get
+	secretFields = map[string]bool{
+		"access_token": true,
+		"public_token": true,
+		"link_token":   true,
+		"client_id":    true,
+		"secret":       true,
+		"account":      true,
+		"routing":      true,
+		"wire_routing": true,
+		"sort_code":    true,
+		"iban":         true,
+		"bic":          true,
+		"branch":       true,
+	}
+	// JSON fields that hold personal information throughout, like the
+	// names, addresses, emails and phone numbers of /identity/get
+	personalFields = map[string]bool{
+		"owners": true,
+	}
+)
+
+// Transport logs the method, URL, status and duration of each request
+// going through Base, plus Plaid's request_id and error_code, which Plaid
+// support asks for. Bodies and headers aren't logged.
+type Transport struct {
+	// Defaulting to http.DefaultTransport
+	Base http.RoundTripper
+	// Defaulting to slog.Default()
+	Logger *slog.Logger
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	logger := t.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	args := []any{"method", req.Method, "url", RedactURL(req.URL), "duration", time.Since(start).Round(time.Millisecond)}
+	if err != nil {
+		logger.Info("HTTP request failed", append(args, "error", Redact(err.Error()))...)
+		return nil, err
+	}
+
+	args = append(args, "status", resp.StatusCode)
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+		args = append(args, plaidMetadata(b)...)
+	}
+	logger.Info("HTTP request", args...)
+	return resp, nil
+}
+
+// plaidMetadata picks the request_id, and for errors the error_code, out
+// of a Plaid response.
+func plaidMetadata(body []byte) []any {
+	var resp struct {
+		RequestID string `json:"request_id"`
+		ErrorCode string `json:"error_code"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return nil
+	}
+	var args []any
+	if resp.RequestID != "" {
+		args = append(args, "plaid_request_id", resp.RequestID)
+	}
+	if resp.ErrorCode != "" {
+		args = append(args, "plaid_error_code", resp.ErrorCode)
+	}
+	return args
+}
+
+// RedactURL is u with its password and the values of secret-looking
+// query parameters replaced, and any other secrets redacted.
+func RedactURL(u *url.URL) string {
+	r := *u
+	if _, ok := r.User.Password(); ok {
+		r.User = url.UserPassword(r.User.Username(), redacted)
+	}
+	query := r.Query()
+	for name := range query {
+		if secretParam.MatchString(name) {
+			query.Set(name, redacted)
+		}
+	}
+	if len(query) > 0 {
+		r.RawQuery = query.Encode()
+	}
+	return Redact(r.String())
+}
+
+// Redact replaces the secrets recognizable by their shape in s.
+func Redact(s string) string {
+	for _, re := range secretValues {
+		s = re.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// RedactJSON is the JSON document b with the string values of secret and
+// personal fields replaced, keeping its structure, and any other secrets
+// redacted. b is only redacted by shape when it isn't JSON.
+func RedactJSON(b []byte) []byte {
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if decoder.Decode(&v) != nil {
+		return []byte(Redact(string(b)))
+	}
+	redactFields(v, false)
+	out, err := json.Marshal(v)
+	if err != nil {
+		return []byte(Redact(string(b)))
+	}
+	return []byte(Redact(string(out)))
+}
+
+// redactFields redacts the fields of v in place, and every string in it
+// when all is set.
+func redactFields(v interface{}, all bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if _, ok := field.(string); ok && (all || secretFields[k]) {
+				v[k] = redacted
+				continue
+			}
+			redactFields(field, all || personalFields[k])
+		}
+	case []interface{}:
+		for i, item := range v {
+			if _, ok := item.(string); ok && all {
+				v[i] = redacted
+				continue
+			}
+			redactFields(item, all)
+		}
+	}
+}
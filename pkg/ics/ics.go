@@ -0,0 +1,76 @@
+// Package ics writes iCalendar (RFC 5545) feeds of all-day events, for
+// calendar apps to import or subscribe to, without a dependency.
+package ics
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is an all-day event.
+type Event struct {
+	// Stable across exports, so subscribed calendars update events
+	// instead of duplicating them
+	UID         string
+	Date        time.Time
+	Summary     string
+	Description string
+}
+
+// Write writes events as a calendar named name to w.
+func Write(w io.Writer, name string, events []Event) error {
+	now := time.Now().UTC().Format("20060102T150405Z")
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//plaid-cli//plaid-cli//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escape(name),
+	}
+	for _, e := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+escape(e.UID),
+			"DTSTAMP:"+now,
+			"DTSTART;VALUE=DATE:"+e.Date.Format("20060102"),
+			"DTEND;VALUE=DATE:"+e.Date.AddDate(0, 0, 1).Format("20060102"),
+			"SUMMARY:"+escape(e.Summary),
+		)
+		if e.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+escape(e.Description))
+		}
+		lines = append(lines, "TRANSP:TRANSPARENT", "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		_, err := io.WriteString(w, fold(line)+"\r\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold splits lines longer than 75 octets, continuing them on lines
+// starting with a space, without splitting UTF-8 characters.
+func fold(line string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range line {
+		size := len(string(r))
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
@@ -0,0 +1,211 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// CSVOptions say how to read a bank's CSV export. Columns are matched by
+// header, case insensitively; when empty, common names like "Date",
+// "Posted Date", "Amount" or "Description" are tried.
+type CSVOptions struct {
+	AccountID string
+	// e.g. "01/02/2006"; when empty, common layouts are tried
+	DateLayout        string
+	DateColumn        string
+	AmountColumn      string
+	DescriptionColumn string
+	// For exports with separate money out and money in columns instead of
+	// a signed amount
+	DebitColumn  string
+	CreditColumn string
+	// Amounts are positive for money leaving the account, as Plaid's are.
+	// Most banks export them the other way around.
+	PositiveOutflow bool
+	Currency        string
+}
+
+var (
+	dateColumns        = []string{"date", "posted date", "posting date", "transaction date", "trans. date"}
+	amountColumns      = []string{"amount", "transaction amount"}
+	descriptionColumns = []string{"description", "payee", "name", "memo", "details"}
+	debitColumns       = []string{"debit", "withdrawal", "withdrawals", "money out"}
+	creditColumns      = []string{"credit", "deposit", "deposits", "money in"}
+
+	dateLayouts = []string{"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "1/2/06", "01-02-2006", "2006/01/02", "Jan 2, 2006", "02 Jan 2006"}
+)
+
+// ParseCSV reads transactions from a CSV file with a header row. Each
+// transaction's ID is derived from the account, date, amount and
+// description, and how many identical rows came before it, so importing
+// the same file again gives the same IDs.
+func ParseCSV(r io.Reader, opts CSVOptions) ([]plaid_cli.Transaction, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	date, err := column(header, opts.DateColumn, dateColumns, true)
+	if err != nil {
+		return nil, err
+	}
+	description, err := column(header, opts.DescriptionColumn, descriptionColumns, true)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := column(header, opts.AmountColumn, amountColumns, false)
+	if err != nil {
+		return nil, err
+	}
+	debit, credit := -1, -1
+	if amount < 0 {
+		debit, err = column(header, opts.DebitColumn, debitColumns, true)
+		if err != nil {
+			return nil, fmt.Errorf("no amount column, and %w", err)
+		}
+		credit, err = column(header, opts.CreditColumn, creditColumns, true)
+		if err != nil {
+			return nil, fmt.Errorf("no amount column, and %w", err)
+		}
+	}
+
+	seen := make(map[string]int)
+	var txs []plaid_cli.Transaction
+	for i, row := range rows[1:] {
+		line := i + 2
+		if emptyRow(row) {
+			continue
+		}
+		cell := func(n int) string {
+			if n < 0 || n >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[n])
+		}
+
+		d, err := parseDate(cell(date), opts.DateLayout)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		var a float64
+		if amount >= 0 {
+			a, err = parseAmount(cell(amount))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if !opts.PositiveOutflow {
+				a = -a
+			}
+		} else {
+			out, err := parseAmount(cell(debit))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			in, err := parseAmount(cell(credit))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			// Some banks export debits as negative numbers
+			a = abs(out) - abs(in)
+		}
+
+		name := cell(description)
+		key := strings.Join([]string{d, strconv.FormatFloat(a, 'f', 2, 64), name}, "\x00")
+		txs = append(txs, plaid_cli.Transaction{
+			ID:                  transactionID(opts.AccountID, key, strconv.Itoa(seen[key])),
+			AccountID:           opts.AccountID,
+			Amount:              a,
+			Date:                d,
+			Name:                name,
+			OriginalDescription: name,
+			IsoCurrencyCode:     opts.Currency,
+		})
+		seen[key]++
+	}
+	return txs, nil
+}
+
+// column finds the index of a column by name, or by the first of
+// candidates present. Missing columns are -1, or an error when required.
+func column(header []string, name string, candidates []string, required bool) (int, error) {
+	if name != "" {
+		candidates = []string{name}
+	}
+	for _, c := range candidates {
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")), c) {
+				return i, nil
+			}
+		}
+	}
+	if required {
+		return -1, fmt.Errorf("no %s column in %s", strings.Join(candidates, " or "), strings.Join(header, ", "))
+	}
+	return -1, nil
+}
+
+func emptyRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseDate(s string, layout string) (string, error) {
+	layouts := dateLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	for _, l := range layouts {
+		t, err := time.Parse(l, s)
+		if err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q", s)
+}
+
+// parseAmount parses amounts like "1,234.56", "$-12.00" or "(12.00)". An
+// empty amount is 0.
+func parseAmount(s string) (float64, error) {
+	cleaned := strings.NewReplacer(",", "", "$", "", "€", "", "£", "", " ", "").Replace(s)
+	if cleaned == "" {
+		return 0, nil
+	}
+	negative := false
+	if strings.HasPrefix(cleaned, "(") && strings.HasSuffix(cleaned, ")") {
+		negative = true
+		cleaned = cleaned[1 : len(cleaned)-1]
+	}
+	a, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if negative {
+		a = -a
+	}
+	return a, nil
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,31 @@
+// Package importer reads transactions exported by banks, as CSV or OFX
+// files, into plaid-cli's transaction model so they can be synced like
+// Plaid's.
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// IDPrefix starts the IDs of imported transactions, which stand in for
+// Plaid transaction IDs.
+const IDPrefix = "import_"
+
+// IsImported reports whether a transaction ID was made by this package.
+func IsImported(id string) bool {
+	return strings.HasPrefix(id, IDPrefix)
+}
+
+// transactionID is a stable ID for an imported transaction: importing the
+// same file into the same account again gives the same IDs.
+func transactionID(accountID string, parts ...string) string {
+	h := sha256.New()
+	fmt.Fprint(h, accountID)
+	for _, p := range parts {
+		fmt.Fprint(h, "\x00", p)
+	}
+	return IDPrefix + hex.EncodeToString(h.Sum(nil))[:24]
+}
@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+var (
+	ofxTransaction = regexp.MustCompile(`(?is)<STMTTRN>(.*?)</STMTTRN>`)
+	// Matches both SGML (OFX 1.x, closing tags optional) and XML (OFX 2.x)
+	// elements
+	ofxElement = regexp.MustCompile(`(?i)<([A-Z0-9.]+)>([^<\r\n]*)`)
+)
+
+// OFXOptions say how to read an OFX (or QFX, QBO) file.
+type OFXOptions struct {
+	AccountID string
+	// For files without a CURDEF
+	Currency string
+}
+
+// ParseOFX reads the transactions of the statements in an OFX file. IDs
+// are derived from the account and the bank's FITID, which is unique per
+// account.
+func ParseOFX(r io.Reader, opts OFXOptions) ([]plaid_cli.Transaction, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	content := string(b)
+
+	currency := opts.Currency
+	if m := ofxElements(content)["CURDEF"]; m != "" {
+		currency = m
+	}
+
+	var txs []plaid_cli.Transaction
+	for i, m := range ofxTransaction.FindAllStringSubmatch(content, -1) {
+		fields := ofxElements(m[1])
+
+		if len(fields["DTPOSTED"]) < 8 {
+			return nil, fmt.Errorf("transaction %d: invalid DTPOSTED %q", i+1, fields["DTPOSTED"])
+		}
+		d, err := parseDate(fields["DTPOSTED"][:8], "20060102")
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i+1, err)
+		}
+		amount, err := parseAmount(fields["TRNAMT"])
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i+1, err)
+		}
+
+		name := fields["NAME"]
+		if name == "" {
+			name = fields["PAYEE"]
+		}
+		description := strings.TrimSpace(strings.Join([]string{name, fields["MEMO"]}, " "))
+		if name == "" {
+			name = fields["MEMO"]
+		}
+
+		id := fields["FITID"]
+		if id == "" {
+			id = strings.Join([]string{d, fields["TRNAMT"], description, fmt.Sprint(i)}, "\x00")
+		}
+		// OFX amounts are negative for money leaving the account
+		txs = append(txs, plaid_cli.Transaction{
+			ID:                  transactionID(opts.AccountID, id),
+			AccountID:           opts.AccountID,
+			Amount:              -amount,
+			Date:                d,
+			Name:                name,
+			OriginalDescription: description,
+			CheckNumber:         fields["CHECKNUM"],
+			IsoCurrencyCode:     currency,
+		})
+	}
+	return txs, nil
+}
+
+// ofxElements are the values of the elements in s, by tag. For repeated
+// tags the first value wins.
+func ofxElements(s string) map[string]string {
+	elements := make(map[string]string)
+	for _, m := range ofxElement.FindAllStringSubmatch(s, -1) {
+		tag := strings.ToUpper(m[1])
+		if _, ok := elements[tag]; !ok {
+			elements[tag] = unescapeOFX(strings.TrimSpace(m[2]))
+		}
+	}
+	return elements
+}
+
+func unescapeOFX(s string) string {
+	return strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'").Replace(s)
+}
@@ -0,0 +1,242 @@
+// Package lunchmoney is a minimal client for the Lunch Money API, covering
+// the manually managed assets and transactions plaid-cli syncs.
+package lunchmoney
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultURL = "https://dev.lunchmoney.app/v1"
+
+// MaxInsert is how many transactions InsertTransactions sends per request.
+const MaxInsert = 100
+
+type Client struct {
+	// An access token, from Settings > Developers
+	Token string
+	// DefaultURL if empty
+	URL        string
+	HTTPClient *http.Client
+}
+
+// Asset is a manually managed account.
+type Asset struct {
+	ID              int64  `json:"id,omitempty"`
+	TypeName        string `json:"type_name"`
+	SubtypeName     string `json:"subtype_name,omitempty"`
+	Name            string `json:"name"`
+	Balance         string `json:"balance"`
+	Currency        string `json:"currency,omitempty"`
+	InstitutionName string `json:"institution_name,omitempty"`
+}
+
+type Category struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Transaction is a transaction to insert. Amounts are positive for money
+// going out, as with Plaid.
+type Transaction struct {
+	Date       string `json:"date"`
+	Amount     string `json:"amount"`
+	Payee      string `json:"payee"`
+	Currency   string `json:"currency,omitempty"`
+	AssetID    int64  `json:"asset_id"`
+	CategoryID int64  `json:"category_id,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+	// cleared or uncleared
+	Status     string `json:"status,omitempty"`
+	ExternalID string `json:"external_id,omitempty"`
+}
+
+// InsertOptions are the insert endpoint's flags.
+type InsertOptions struct {
+	ApplyRules        bool `json:"apply_rules"`
+	CheckForRecurring bool `json:"check_for_recurring"`
+	// Don't adjust the assets' balances by the inserted amounts
+	SkipBalanceUpdate bool `json:"skip_balance_update"`
+}
+
+// Error is an unsuccessful response. Lunch Money reports some errors with
+// a 200 status and an error field.
+type Error struct {
+	StatusCode int
+	Messages   []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("lunchmoney: %d %s", e.StatusCode, strings.Join(e.Messages, "; "))
+}
+
+func (c *Client) url() string {
+	if c.URL != "" {
+		return strings.TrimRight(c.URL, "/")
+	}
+	return DefaultURL
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) Assets() ([]Asset, error) {
+	var res struct {
+		Assets []Asset `json:"assets"`
+	}
+	err := c.do("GET", "assets", nil, &res)
+	return res.Assets, err
+}
+
+// CreateAsset creates an asset and returns it with its ID set.
+func (c *Client) CreateAsset(asset Asset) (Asset, error) {
+	var created Asset
+	err := c.do("POST", "assets", asset, &created)
+	return created, err
+}
+
+// UpdateBalance sets an asset's balance.
+func (c *Client) UpdateBalance(assetID int64, balance string) error {
+	return c.do("PUT", fmt.Sprintf("assets/%d", assetID), map[string]string{"balance": balance}, nil)
+}
+
+func (c *Client) Categories() ([]Category, error) {
+	var res struct {
+		Categories []Category `json:"categories"`
+	}
+	err := c.do("GET", "categories", nil, &res)
+	return res.Categories, err
+}
+
+// ExternalIDs returns the external IDs of an asset's transactions between
+// start and end, as YYYY-MM-DD dates.
+func (c *Client) ExternalIDs(assetID int64, start string, end string) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	for offset := 0; ; {
+		query := url.Values{
+			"asset_id":   {fmt.Sprint(assetID)},
+			"start_date": {start},
+			"end_date":   {end},
+			"offset":     {fmt.Sprint(offset)},
+		}
+		var res struct {
+			Transactions []struct {
+				ExternalID string `json:"external_id"`
+			} `json:"transactions"`
+			HasMore bool `json:"has_more"`
+		}
+		err := c.do("GET", "transactions?"+query.Encode(), nil, &res)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range res.Transactions {
+			if t.ExternalID != "" {
+				ids[t.ExternalID] = true
+			}
+		}
+		if !res.HasMore || len(res.Transactions) == 0 {
+			return ids, nil
+		}
+		offset += len(res.Transactions)
+	}
+}
+
+// InsertTransactions inserts txs in batches of MaxInsert and returns how
+// many were inserted. Lunch Money rejects an external_id that is already
+// used in the same asset.
+func (c *Client) InsertTransactions(txs []Transaction, opts InsertOptions) (int, error) {
+	inserted := 0
+	for start := 0; start < len(txs); start += MaxInsert {
+		end := start + MaxInsert
+		if end > len(txs) {
+			end = len(txs)
+		}
+		body := struct {
+			InsertOptions
+			Transactions []Transaction `json:"transactions"`
+		}{opts, txs[start:end]}
+		var res struct {
+			IDs []int64 `json:"ids"`
+		}
+		err := c.do("POST", "transactions", body, &res)
+		if err != nil {
+			return inserted, err
+		}
+		inserted += len(res.IDs)
+	}
+	return inserted, nil
+}
+
+func (c *Client) do(method string, endpoint string, body interface{}, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.url()+"/"+endpoint, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if e := parseError(resp.StatusCode, b); e != nil {
+		return e
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(b, v)
+}
+
+// parseError finds an error in a response: a non-2xx status, or an error
+// field, which is a message or a list of them.
+func parseError(statusCode int, body []byte) error {
+	var res struct {
+		Error json.RawMessage `json:"error"`
+	}
+	json.Unmarshal(body, &res)
+
+	e := &Error{StatusCode: statusCode}
+	var message string
+	if json.Unmarshal(res.Error, &message) == nil && message != "" {
+		e.Messages = []string{message}
+	} else {
+		json.Unmarshal(res.Error, &e.Messages)
+	}
+
+	if len(e.Messages) > 0 {
+		return e
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		e.Messages = []string{string(body)}
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+)
+
+// SyncFields are the fields Sync needs to diff a target against the
+// source.
+var SyncFields = []string{"PlaidID", "AccountIDDedupe", "Pending", "Address", "DateTime"}
+
+// Set instead of deleting the record when SoftDelete is on, so receipts
+// and notes attached to it survive until they are purged
+type TombstoneFields struct {
+	Removed   bool
+	RemovedAt string
+}
+
+type TombstoneRecord struct {
+	airtable.Record
+	Fields TombstoneFields
+}
+
+// AirtableTarget syncs to an Airtable table with the TransactionFields
+// columns. Only rows where the "After Plaid Issues" field is 1 are synced.
+type AirtableTarget struct {
+	Table airtable.TableClient
+	// Restricts Existing to a view, when set
+	View string
+	// Fields Existing fetches, or all of them when nil
+	Fields []string
+	// Mark removed transactions with TombstoneFields instead of deleting
+	SoftDelete bool
+}
+
+func (a *AirtableTarget) Existing(since time.Time) ([]Record, error) {
+	filter := "{After Plaid Issues} = 1"
+	if a.SoftDelete {
+		filter = fmt.Sprintf("AND(%s, NOT({Removed}))", filter)
+	}
+	if !since.IsZero() {
+		filter = fmt.Sprintf("AND(%s, NOT(IS_BEFORE({DateTime}, '%s')))", filter, since.Format("2006-01-02"))
+	}
+
+	var records []Record
+	err := a.Table.List(&records, &airtable.Options{
+		Fields: a.Fields,
+		Filter: filter,
+		View:   a.View,
+	})
+	return records, err
+}
+
+func (a *AirtableTarget) Create(records []Record, progress func(int)) error {
+	return a.Table.CreateAll(records, progress)
+}
+
+func (a *AirtableTarget) Update(records []Record, progress func(int)) error {
+	return a.Table.UpdateAll(records, progress)
+}
+
+func (a *AirtableTarget) Delete(records []Record, progress func(int)) error {
+	if a.SoftDelete {
+		return a.Table.UpdateAll(Tombstones(records), progress)
+	}
+	return a.Table.DeleteAll(records, progress)
+}
+
+// Tombstones are the updates marking records removed.
+func Tombstones(ts []Record) []TombstoneRecord {
+	removedAt := time.Now().Format(time.RFC3339)
+	ret := make([]TombstoneRecord, len(ts))
+	for i, t := range ts {
+		ret[i] = TombstoneRecord{Fields: TombstoneFields{Removed: true, RemovedAt: removedAt}}
+		ret[i].ID = t.ID
+	}
+	return ret
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// PartSeparator separates a transaction's ID from the part number in the
+// IDs of rows split off it, e.g. "<transaction ID>:2". Plaid never returns
+// those, so they are never deleted.
+const PartSeparator = ":"
+
+// IsPart reports whether id belongs to a row split off a transaction.
+func IsPart(id string) bool {
+	return strings.Contains(id, PartSeparator)
+}
+
+// ByAccountID groups records by account ID, then transaction ID.
+func ByAccountID(ts []Record) map[string]map[string]Record {
+	ret := make(map[string]map[string]Record)
+	for _, t := range ts {
+		byID, ok := ret[t.Fields.AccountID]
+		if !ok {
+			byID = make(map[string]Record)
+			ret[t.Fields.AccountID] = byID
+		}
+		byID[t.Fields.PlaidID] = t
+	}
+	return ret
+}
+
+// AccountUpdate is what a sync changes in one account.
+type AccountUpdate struct {
+	AccountID string
+	ToCreate  []Record
+	ToDelete  []Record
+	ToUpdate  []Record
+}
+
+// DiffAccount compares the transactions from the source with those in the
+// target for one account. Transactions missing from the source are only
+// deleted when dated after cutoff, since older ones may just be outside
+// the window that was fetched.
+func DiffAccount(plaidTs, existingTs map[string]Record, cutoff time.Time) (AccountUpdate, error) {
+	var u AccountUpdate
+	ids := make(map[string]struct{})
+	for id, t := range plaidTs {
+		ids[id] = struct{}{}
+		existing, ok := existingTs[id]
+		if !ok {
+			u.ToCreate = append(u.ToCreate, t)
+		} else if existing.Fields.Pending != t.Fields.Pending ||
+			existing.Fields.Address != t.Fields.Address {
+			t.ID = existing.ID
+			u.ToUpdate = append(u.ToUpdate, t)
+		}
+	}
+
+	for id, t := range existingTs {
+		// Parts of split transactions aren't in Plaid
+		if IsPart(id) {
+			continue
+		}
+		if _, ok := ids[id]; !ok {
+			transactionTime, err := ParseAirtableDate(t.Fields.DateTime)
+			if err != nil {
+				return u, fmt.Errorf("transaction %s: %w", id, err)
+			}
+			if transactionTime.After(cutoff) {
+				slog.Debug("Deleting transaction", "plaid_id", t.Fields.PlaidID, "account_id", t.Fields.AccountID, "date", t.Fields.DateTime)
+				u.ToDelete = append(u.ToDelete, t)
+			}
+		}
+	}
+	return u, nil
+}
+
+// ParseAirtableDate parses a date read back from Airtable, ignoring the
+// time part present when the column is a dateTime field.
+func ParseAirtableDate(s string) (time.Time, error) {
+	if len(s) > len("2006-01-02") {
+		s = s[:len("2006-01-02")]
+	}
+	return time.Parse("2006-01-02", s)
+}
@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func record(id string, airtableID string, accountID string, date string, pending bool) Record {
+	r := Record{Fields: TransactionFields{
+		PlaidID:   id,
+		AccountID: accountID,
+		DateTime:  date,
+		Pending:   pending,
+	}}
+	r.ID = airtableID
+	return r
+}
+
+func byID(records ...Record) map[string]Record {
+	ret := make(map[string]Record)
+	for _, r := range records {
+		ret[r.Fields.PlaidID] = r
+	}
+	return ret
+}
+
+func plaidIDs(records []Record) []string {
+	ids := []string{}
+	for _, r := range records {
+		ids = append(ids, r.Fields.PlaidID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func equalIDs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiffAccount(t *testing.T) {
+	cutoff := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		plaid    map[string]Record
+		existing map[string]Record
+		create   []string
+		update   []string
+		delete   []string
+	}{
+		{
+			name:   "new transaction",
+			plaid:  byID(record("a", "", "acc", "2024-03-05", false)),
+			create: []string{"a"},
+		},
+		{
+			name:     "unchanged transaction",
+			plaid:    byID(record("a", "", "acc", "2024-03-05", false)),
+			existing: byID(record("a", "rec1", "acc", "2024-03-05", false)),
+		},
+		{
+			name:     "pending transaction posted",
+			plaid:    byID(record("a", "", "acc", "2024-03-05", false)),
+			existing: byID(record("a", "rec1", "acc", "2024-03-05", true)),
+			update:   []string{"a"},
+		},
+		{
+			name:     "removed after the cutoff",
+			existing: byID(record("a", "rec1", "acc", "2024-03-05", false)),
+			delete:   []string{"a"},
+		},
+		{
+			name:     "missing before the cutoff",
+			existing: byID(record("a", "rec1", "acc", "2024-02-05", false)),
+		},
+		{
+			name:     "airtable datetime after the cutoff",
+			existing: byID(record("a", "rec1", "acc", "2024-03-05T00:00:00.000Z", false)),
+			delete:   []string{"a"},
+		},
+		{
+			name:     "split part",
+			existing: byID(record("a"+PartSeparator+"2", "rec1", "acc", "2024-03-05", false)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := DiffAccount(tt.plaid, tt.existing, cutoff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plaidIDs(u.ToCreate); !equalIDs(got, tt.create) {
+				t.Errorf("ToCreate = %v, want %v", got, tt.create)
+			}
+			if got := plaidIDs(u.ToUpdate); !equalIDs(got, tt.update) {
+				t.Errorf("ToUpdate = %v, want %v", got, tt.update)
+			}
+			if got := plaidIDs(u.ToDelete); !equalIDs(got, tt.delete) {
+				t.Errorf("ToDelete = %v, want %v", got, tt.delete)
+			}
+		})
+	}
+}
+
+func TestDiffAccountUpdateKeepsRecordID(t *testing.T) {
+	u, err := DiffAccount(
+		byID(record("a", "", "acc", "2024-03-05", false)),
+		byID(record("a", "rec1", "acc", "2024-03-05", true)),
+		time.Time{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.ToUpdate) != 1 || u.ToUpdate[0].ID != "rec1" {
+		t.Fatalf("ToUpdate = %+v, want the existing record ID rec1", u.ToUpdate)
+	}
+}
+
+func TestDiffAccountInvalidDate(t *testing.T) {
+	_, err := DiffAccount(nil, byID(record("a", "rec1", "acc", "March 5", false)), time.Time{})
+	if err == nil {
+		t.Fatal("want an error for an unparseable date")
+	}
+}
@@ -0,0 +1,114 @@
+// Package pipeline syncs transactions from a TransactionSource, usually
+// Plaid, to a SyncTarget, usually an Airtable table. It is what
+// `plaid-cli sync-transactions` runs, usable without the CLI:
+//
+//	records := pipeline.Records(transactions, pipeline.RecordOptions{})
+//	existing, err := target.Existing(since)
+//	...
+//	err = pipeline.Sync(records, existing, target, pipeline.Options{DeleteCutoff: since}, nil)
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// TransactionSource provides the transactions to sync.
+type TransactionSource interface {
+	Transactions(ctx context.Context) ([]plaid_cli.Transaction, error)
+}
+
+// SyncTarget stores synced transactions.
+type SyncTarget interface {
+	// Existing returns the synced records dated on or after since, or
+	// all of them when since is zero.
+	Existing(since time.Time) ([]Record, error)
+	// Create, Update and Delete call progress with the number of records
+	// written after each batch. progress may be nil.
+	Create(records []Record, progress func(int)) error
+	Update(records []Record, progress func(int)) error
+	Delete(records []Record, progress func(int)) error
+}
+
+type Options struct {
+	// Household member running this sync. Empty when not sharing a target.
+	Owner string
+	// Account ID to the household member that last synced it. Accounts
+	// last synced by someone else are never deleted from.
+	AccountOwners map[string]string
+	// Records missing from the source are only deleted when dated after
+	// this
+	DeleteCutoff time.Time
+}
+
+// Change is the kind of write reported to Sync's progress callback.
+type Change string
+
+const (
+	Created Change = "created"
+	Updated Change = "updated"
+	Deleted Change = "deleted"
+)
+
+// Plan diffs records from the source against existing records, per
+// account.
+func Plan(records []Record, existing []Record, opts Options) ([]AccountUpdate, error) {
+	sourceArranged := ByAccountID(records)
+	existingArranged := ByAccountID(existing)
+
+	var updates []AccountUpdate
+	for accountID, transactions := range sourceArranged {
+		u, err := DiffAccount(transactions, existingArranged[accountID], opts.DeleteCutoff)
+		if err != nil {
+			return nil, err
+		}
+		u.AccountID = accountID
+		if owner := opts.AccountOwners[accountID]; owner != "" && owner != opts.Owner && len(u.ToDelete) > 0 {
+			slog.Warn("Not deleting transactions in an account last synced by another owner. Check household.items if this account should be yours.", "count", len(u.ToDelete), "account_id", accountID, "owner", owner)
+			u.ToDelete = nil
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// Apply writes updates to target. Deletions go first, so a transaction
+// Plaid re-issued under a new ID is never briefly in the target twice.
+func Apply(target SyncTarget, updates []AccountUpdate, progress func(Change, int)) error {
+	report := func(c Change) func(int) {
+		return func(n int) {
+			if progress != nil {
+				progress(c, n)
+			}
+		}
+	}
+
+	for _, u := range updates {
+		err := target.Delete(u.ToDelete, report(Deleted))
+		if err != nil {
+			return err
+		}
+		err = target.Create(u.ToCreate, report(Created))
+		if err != nil {
+			return err
+		}
+		err = target.Update(u.ToUpdate, report(Updated))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync makes target match records, which should be every transaction in
+// the synced window, e.g. Records of a TransactionSource's transactions.
+func Sync(records []Record, existing []Record, target SyncTarget, opts Options, progress func(Change, int)) error {
+	updates, err := Plan(records, existing, opts)
+	if err != nil {
+		return err
+	}
+	return Apply(target, updates, progress)
+}
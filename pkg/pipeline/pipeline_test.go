@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	cutoff := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	records := []Record{
+		record("a", "", "mine", "2024-03-05", false),
+		record("b", "", "theirs", "2024-03-05", false),
+	}
+	existing := []Record{
+		record("old-mine", "rec1", "mine", "2024-03-04", false),
+		record("old-theirs", "rec2", "theirs", "2024-03-04", false),
+		// Not in the source at all, so never planned
+		record("other", "rec3", "other", "2024-03-04", false),
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		deletes map[string][]string
+	}{
+		{
+			name:    "single owner",
+			opts:    Options{DeleteCutoff: cutoff},
+			deletes: map[string][]string{"mine": {"old-mine"}, "theirs": {"old-theirs"}},
+		},
+		{
+			name: "account last synced by another owner",
+			opts: Options{
+				Owner:         "me",
+				AccountOwners: map[string]string{"mine": "me", "theirs": "them"},
+				DeleteCutoff:  cutoff,
+			},
+			deletes: map[string][]string{"mine": {"old-mine"}, "theirs": {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates, err := Plan(records, existing, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(updates) != len(tt.deletes) {
+				t.Fatalf("got updates for %d accounts, want %d", len(updates), len(tt.deletes))
+			}
+			for _, u := range updates {
+				want, ok := tt.deletes[u.AccountID]
+				if !ok {
+					t.Errorf("unexpected update for account %s", u.AccountID)
+					continue
+				}
+				if got := plaidIDs(u.ToDelete); !equalIDs(got, want) {
+					t.Errorf("account %s: ToDelete = %v, want %v", u.AccountID, got, want)
+				}
+				if len(u.ToCreate) != 1 {
+					t.Errorf("account %s: ToCreate = %v, want one record", u.AccountID, plaidIDs(u.ToCreate))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// PlaidSource fetches an item's transactions with /transactions/get.
+type PlaidSource struct {
+	Client  plaid_cli.PlaidClient
+	Request plaid.TransactionsGetRequest
+	// Called after each page, may be nil
+	Progress func(done int, total int)
+}
+
+func (p *PlaidSource) Transactions(ctx context.Context) ([]plaid_cli.Transaction, error) {
+	return AllTransactions(ctx, p.Request, p.Client, p.Progress)
+}
+
+// MaxPageSize is the most transactions /transactions/get returns at once.
+const MaxPageSize = 500
+
+// AllTransactions pages through /transactions/get, calling progress (if
+// not nil) with how many of the transactions have been fetched after each
+// page. Pages are MaxPageSize unless req.Options.Count says otherwise.
+// AccountType and AccountMask are filled in from the accounts in the
+// response.
+func AllTransactions(ctx context.Context, req plaid.TransactionsGetRequest, client plaid_cli.PlaidClient, progress func(done int, total int)) ([]plaid_cli.Transaction, error) {
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+
+	// Paging changes the offset, so work on a copy of the caller's options
+	options := plaid.TransactionsGetRequestOptions{}
+	if req.Options != nil {
+		options = *req.Options
+	}
+	if options.GetCount() <= 0 {
+		options.SetCount(MaxPageSize)
+	}
+	options.SetOffset(options.GetOffset())
+	req.Options = &options
+
+	var transactions []plaid.Transaction
+
+	res, err := client.TransactionsGet(ctx, req)
+	if err != nil {
+		return plaid_cli.TransactionsFromPlaid(transactions), err
+	}
+
+	accounts := make(map[string]plaid_cli.Account)
+	for _, a := range plaid_cli.AccountsFromPlaid(res.Accounts) {
+		accounts[a.ID] = a
+	}
+	withAccounts := func(txs []plaid_cli.Transaction) []plaid_cli.Transaction {
+		for i := range txs {
+			txs[i].AccountType = accounts[txs[i].AccountID].Type
+			txs[i].AccountMask = accounts[txs[i].AccountID].Mask
+		}
+		return txs
+	}
+
+	transactions = append(transactions, res.Transactions...)
+	progress(len(transactions), int(res.TotalTransactions))
+
+	for len(transactions) < int(res.TotalTransactions) && len(res.Transactions) > 0 {
+		options.SetOffset(options.GetOffset() + int32(len(res.Transactions)))
+		res, err = client.TransactionsGet(ctx, req)
+		if err != nil {
+			return withAccounts(plaid_cli.TransactionsFromPlaid(transactions)), err
+		}
+
+		transactions = append(transactions, res.Transactions...)
+		progress(len(transactions), int(res.TotalTransactions))
+	}
+
+	return withAccounts(plaid_cli.TransactionsFromPlaid(transactions)), nil
+}
@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// PluginProtocol is the version of the plugin protocol, sent in the init
+// request.
+const PluginProtocol = 1
+
+// PluginTarget is a SyncTarget implemented by an external program, so
+// new destinations don't need changes to plaid-cli.
+//
+// The program is started once per sync and speaks JSON lines over stdio:
+// plaid-cli writes one request per line to its stdin, and it writes one
+// response per line to its stdout. Its stderr goes to plaid-cli's.
+// Requests are
+//
+//	{"method": "init", "protocol": 1, "options": {...}}
+//	{"method": "existing", "since": "2024-01-01T00:00:00Z"}
+//	{"method": "create", "records": [{"id": "...", "fields": {...}}]}
+//	{"method": "update", "records": [...]}
+//	{"method": "delete", "records": [...]}
+//
+// where options are the plugin's options from the config and fields are
+// TransactionFields, keyed by PlaidID. ids are Airtable record IDs when
+// the records came from an Airtable sync, and since is omitted for all
+// records. Responses are {} on success, {"records": [...]} for existing,
+// and {"error": "message"} on failure. stdin is closed at the end of the
+// sync, and the program should then exit.
+type PluginTarget struct {
+	Name string
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+}
+
+type pluginRecord struct {
+	ID     string            `json:"id,omitempty"`
+	Fields TransactionFields `json:"fields"`
+}
+
+type pluginRequest struct {
+	Method   string                 `json:"method"`
+	Protocol int                    `json:"protocol,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+	Since    *time.Time             `json:"since,omitempty"`
+	Records  []pluginRecord         `json:"records,omitempty"`
+}
+
+type pluginResponse struct {
+	Error   string         `json:"error"`
+	Records []pluginRecord `json:"records"`
+}
+
+// StartPlugin starts the program at path with args and sends it the init
+// request with options.
+func StartPlugin(name string, path string, args []string, options map[string]interface{}) (*PluginTarget, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", name, err)
+	}
+
+	p := &PluginTarget{Name: name, cmd: cmd, stdin: stdin, stdout: bufio.NewScanner(stdout)}
+	// Batches of records make for long lines
+	p.stdout.Buffer(nil, 64*1024*1024)
+
+	_, err = p.call(pluginRequest{Method: "init", Protocol: PluginProtocol, Options: options})
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PluginTarget) call(req pluginRequest) (pluginResponse, error) {
+	var res pluginResponse
+	b, err := json.Marshal(req)
+	if err != nil {
+		return res, err
+	}
+	_, err = p.stdin.Write(append(b, '\n'))
+	if err != nil {
+		return res, fmt.Errorf("plugin %s: %s: %w", p.Name, req.Method, err)
+	}
+
+	if !p.stdout.Scan() {
+		err := p.stdout.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return res, fmt.Errorf("plugin %s: %s: %w", p.Name, req.Method, err)
+	}
+	err = json.Unmarshal(p.stdout.Bytes(), &res)
+	if err != nil {
+		return res, fmt.Errorf("plugin %s: %s: invalid response: %w", p.Name, req.Method, err)
+	}
+	if res.Error != "" {
+		return res, fmt.Errorf("plugin %s: %s: %s", p.Name, req.Method, res.Error)
+	}
+	return res, nil
+}
+
+func (p *PluginTarget) Existing(since time.Time) ([]Record, error) {
+	req := pluginRequest{Method: "existing"}
+	if !since.IsZero() {
+		req.Since = &since
+	}
+	res, err := p.call(req)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, len(res.Records))
+	for i, r := range res.Records {
+		records[i].ID = r.ID
+		records[i].Fields = r.Fields
+	}
+	return records, nil
+}
+
+func (p *PluginTarget) write(method string, records []Record, progress func(int)) error {
+	if len(records) == 0 {
+		return nil
+	}
+	req := pluginRequest{Method: method, Records: make([]pluginRecord, len(records))}
+	for i, r := range records {
+		req.Records[i] = pluginRecord{ID: r.ID, Fields: r.Fields}
+	}
+	_, err := p.call(req)
+	if err == nil && progress != nil {
+		progress(len(records))
+	}
+	return err
+}
+
+func (p *PluginTarget) Create(records []Record, progress func(int)) error {
+	return p.write("create", records, progress)
+}
+
+func (p *PluginTarget) Update(records []Record, progress func(int)) error {
+	return p.write("update", records, progress)
+}
+
+func (p *PluginTarget) Delete(records []Record, progress func(int)) error {
+	return p.write("delete", records, progress)
+}
+
+// Close closes the plugin's stdin and waits for it to exit.
+func (p *PluginTarget) Close() error {
+	p.stdin.Close()
+	err := p.cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	return nil
+}
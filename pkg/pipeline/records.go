@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// TransactionFields are the Transactions columns plaid-cli writes. Fields
+// added after the original schema are omitempty, so bases without those
+// columns keep working.
+type TransactionFields struct {
+	PlaidID string
+	// Used to dedupe, not for human consumption
+	AccountID     string              `json:"AccountIDDedupe"`
+	AccountIDLink airtable.RecordLink `json:"AccountID"`
+	Amount        float64
+	Name          string
+	// Name as Plaid returned it, when names are normalized
+	RawName             string `json:",omitempty"`
+	OriginalDescription string `json:",omitempty"`
+	MerchantName        string
+	Pending             bool
+	DateTime            string
+	AuthorizedDate      string `json:",omitempty"`
+	// RFC 3339, in UTC
+	AuthorizedAt   string `json:",omitempty"`
+	PostedAt       string `json:",omitempty"`
+	PlaidCategory1 string
+	PlaidCategory2 string
+	PlaidCategory3 string
+	// Personal finance category, e.g. FOOD_AND_DRINK / FOOD_AND_DRINK_COFFEE
+	PFCPrimary    string `json:",omitempty"`
+	PFCDetailed   string `json:",omitempty"`
+	PFCConfidence string `json:",omitempty"`
+	// "<address> <city>", as older bases expect
+	Address     string
+	City        string   `json:",omitempty"`
+	Region      string   `json:",omitempty"`
+	PostalCode  string   `json:",omitempty"`
+	Country     string   `json:",omitempty"`
+	Latitude    *float64 `json:",omitempty"`
+	Longitude   *float64 `json:",omitempty"`
+	StoreNumber string   `json:",omitempty"`
+	// Only set on new records, by a category mapping, so updates leave
+	// categories picked by hand alone
+	CategoryLookup airtable.RecordLink `json:",omitempty"`
+	// Set by LinkTransfers
+	Transfer         bool                `json:",omitempty"`
+	TransferPair     airtable.RecordLink `json:",omitempty"`
+	CheckNumber      string              `json:",omitempty"`
+	ReferenceNumber  string              `json:",omitempty"`
+	Payer            string              `json:",omitempty"`
+	Payee            string              `json:",omitempty"`
+	PPDID            string              `json:",omitempty"`
+	Currency         string              `json:",omitempty"`
+	OriginalAmount   *float64            `json:",omitempty"`
+	OriginalCurrency string              `json:",omitempty"`
+	// Only filled in with sync.merchant_details on
+	MerchantLogo   airtable.Attachment `json:",omitempty"`
+	Website        string              `json:",omitempty"`
+	PaymentChannel string              `json:",omitempty"`
+	// e.g. "Starbucks (merchant), Chase (financial_institution)"
+	Counterparties string `json:",omitempty"`
+}
+
+// Record is a synced transaction.
+type Record struct {
+	airtable.Record
+	Fields   TransactionFields
+	Typecast bool
+}
+
+// RecordOptions control how transactions are mapped to records.
+type RecordOptions struct {
+	// Fill in MerchantLogo, Website, PaymentChannel and Counterparties
+	MerchantDetails bool
+	// For the local date of authorized datetimes. UTC when nil.
+	Location *time.Location
+}
+
+// Records maps transactions to the records Sync writes.
+func Records(transactions []plaid_cli.Transaction, opts RecordOptions) []Record {
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	plaidTransactions := make([]Record, len(transactions))
+	for i, t := range transactions {
+		s := func(tags []string, n int) string {
+			if n >= len(tags) {
+				return ""
+			}
+			return tags[n]
+		}
+		address := t.Location.Address + " " + t.Location.City
+		plaidTransactions[i] = Record{Fields: TransactionFields{
+			PlaidID:             t.ID,
+			AccountID:           t.AccountID,
+			AccountIDLink:       airtable.RecordLink{t.AccountID},
+			Amount:              t.Amount,
+			Name:                t.Name,
+			RawName:             t.RawName,
+			OriginalDescription: t.OriginalDescription,
+			MerchantName:        t.MerchantName,
+			Pending:             t.Pending,
+			DateTime:            t.Date,
+			AuthorizedDate:      authorizedDate(t, loc),
+			AuthorizedAt:        formatDatetime(t.AuthorizedDatetime),
+			PostedAt:            formatDatetime(t.Datetime),
+			PlaidCategory1:      s(t.Category, 0),
+			PlaidCategory2:      s(t.Category, 1),
+			PlaidCategory3:      s(t.Category, 2),
+			Address:             address,
+			City:                t.Location.City,
+			Region:              t.Location.Region,
+			PostalCode:          t.Location.PostalCode,
+			Country:             t.Location.Country,
+			Latitude:            t.Location.Lat,
+			Longitude:           t.Location.Lon,
+			StoreNumber:         t.Location.StoreNumber,
+			CheckNumber:         t.CheckNumber,
+			ReferenceNumber:     t.PaymentMeta.ReferenceNumber,
+			Payer:               t.PaymentMeta.Payer,
+			Payee:               t.PaymentMeta.Payee,
+			PPDID:               t.PaymentMeta.PpdID,
+			Currency:            t.IsoCurrencyCode,
+			OriginalAmount:      t.OriginalAmount,
+			OriginalCurrency:    t.OriginalCurrency,
+		}, Typecast: true}
+		plaidTransactions[i].ID = t.ID
+
+		if pfc := t.PersonalFinanceCategory; pfc != nil {
+			plaidTransactions[i].Fields.PFCPrimary = pfc.Primary
+			plaidTransactions[i].Fields.PFCDetailed = pfc.Detailed
+			plaidTransactions[i].Fields.PFCConfidence = pfc.ConfidenceLevel
+		}
+
+		if opts.MerchantDetails {
+			f := &plaidTransactions[i].Fields
+			if t.LogoURL != "" {
+				f.MerchantLogo = airtable.Attachment{{URL: t.LogoURL}}
+			}
+			f.Website = t.Website
+			f.PaymentChannel = t.PaymentChannel
+
+			counterparties := make([]string, len(t.Counterparties))
+			for j, c := range t.Counterparties {
+				counterparties[j] = fmt.Sprintf("%s (%s)", c.Name, c.Type)
+			}
+			f.Counterparties = strings.Join(counterparties, ", ")
+		}
+	}
+	return plaidTransactions
+}
+
+// authorizedDate falls back to the local date of the authorized datetime,
+// so a purchase at 11pm isn't dated the next day in UTC.
+func authorizedDate(t plaid_cli.Transaction, loc *time.Location) string {
+	if t.AuthorizedDate != "" || t.AuthorizedDatetime == nil {
+		return t.AuthorizedDate
+	}
+	return t.AuthorizedDatetime.In(loc).Format("2006-01-02")
+}
+
+func formatDatetime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,319 @@
+package pipeline
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/landakram/plaid-cli/pkg/xlsx"
+)
+
+type TransactionSerializer interface {
+	Serialize(txs []plaid_cli.Transaction) ([]byte, error)
+}
+
+// NewTransactionSerializer returns the serializer for an output format:
+// csv, json, ndjson, xlsx or anonymized. salt is only used by anonymized.
+func NewTransactionSerializer(t string, salt string) (TransactionSerializer, error) {
+	switch t {
+	case "csv":
+		return &CSVSerializer{}, nil
+	case "json":
+		return &JSONSerializer{}, nil
+	case "ndjson":
+		return &NDJSONSerializer{}, nil
+	case "xlsx":
+		return &XLSXSerializer{}, nil
+	case "anonymized":
+		if salt == "" {
+			return nil, errors.New("Anonymized output needs a salt")
+		}
+		return &AnonymizedSerializer{Salt: salt}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Invalid output format: %s", t))
+	}
+}
+
+type CSVSerializer struct{}
+
+func (w *CSVSerializer) Serialize(txs []plaid_cli.Transaction) ([]byte, error) {
+	fields := fieldNames(txs)
+	var records [][]string
+	for _, tx := range txs {
+		sanitizedName := strings.ReplaceAll(tx.Name, ",", "")
+		record := []string{
+			tx.Date,
+			fmt.Sprintf("%f", tx.Amount),
+			sanitizedName,
+			tx.IsoCurrencyCode,
+			tx.OriginalDescription,
+			tx.CheckNumber,
+			tx.PaymentMeta.ReferenceNumber,
+			tx.PaymentMeta.Payer,
+			tx.PaymentMeta.Payee,
+			tx.PaymentMeta.PpdID,
+		}
+		for _, field := range fields {
+			record = append(record, tx.Fields[field])
+		}
+		records = append(records, record)
+	}
+
+	b := bytes.NewBufferString("")
+	writer := csv.NewWriter(b)
+	header := []string{"Date", "Amount", "Description", "Currency", "OriginalDescription", "CheckNumber", "ReferenceNumber", "Payer", "Payee", "PPDID"}
+	err := writer.Write(append(header, fields...))
+	if err != nil {
+		return nil, err
+	}
+	err = writer.WriteAll(records)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), err
+}
+
+// fieldNames are the Fields synced back from Airtable on any of txs,
+// sorted, for extra columns.
+func fieldNames(txs []plaid_cli.Transaction) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, tx := range txs {
+		for name := range tx.Fields {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NDJSONSerializer writes a JSON object per line, for jq and streaming
+// ingestion.
+type NDJSONSerializer struct{}
+
+func (w *NDJSONSerializer) Serialize(txs []plaid_cli.Transaction) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	for _, tx := range txs {
+		err := encoder.Encode(tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// XLSXSerializer writes a workbook with a summary sheet and a sheet per
+// account, with dates and amounts as typed cells rather than text.
+type XLSXSerializer struct{}
+
+func (w *XLSXSerializer) Serialize(txs []plaid_cli.Transaction) ([]byte, error) {
+	var accountIDs []string
+	byAccount := make(map[string][]plaid_cli.Transaction)
+	for _, tx := range txs {
+		if _, ok := byAccount[tx.AccountID]; !ok {
+			accountIDs = append(accountIDs, tx.AccountID)
+		}
+		byAccount[tx.AccountID] = append(byAccount[tx.AccountID], tx)
+	}
+
+	fields := fieldNames(txs)
+
+	// The summary comes first, filled in as accounts are added
+	sheets := []xlsx.Sheet{{Name: "Summary", Rows: [][]interface{}{{"Account", "AccountID", "Transactions", "From", "To", "Total"}}}}
+	names := map[string]bool{"Summary": true}
+	for _, accountID := range accountIDs {
+		accountTxs := byAccount[accountID]
+		sort.SliceStable(accountTxs, func(i, j int) bool {
+			return accountTxs[i].Date < accountTxs[j].Date
+		})
+
+		name := sheetName(accountTxs[0], names)
+		names[name] = true
+
+		header := []interface{}{"Date", "AuthorizedDate", "Amount", "Currency", "Description", "Merchant", "Category", "DetailedCategory", "Pending", "OriginalDescription", "TransactionID"}
+		for _, field := range fields {
+			header = append(header, field)
+		}
+		rows := [][]interface{}{header}
+		total := 0.0
+		for _, tx := range accountTxs {
+			var primary, detailed string
+			if pfc := tx.PersonalFinanceCategory; pfc != nil {
+				primary, detailed = pfc.Primary, pfc.Detailed
+			}
+			pending := "no"
+			if tx.Pending {
+				pending = "yes"
+			}
+			row := []interface{}{
+				dateCell(tx.Date),
+				dateCell(tx.AuthorizedDate),
+				tx.Amount,
+				tx.IsoCurrencyCode,
+				tx.Name,
+				tx.MerchantName,
+				primary,
+				detailed,
+				pending,
+				tx.OriginalDescription,
+				tx.ID,
+			}
+			for _, field := range fields {
+				row = append(row, tx.Fields[field])
+			}
+			rows = append(rows, row)
+			total += tx.Amount
+		}
+		sheets = append(sheets, xlsx.Sheet{Name: name, Rows: rows})
+
+		sheets[0].Rows = append(sheets[0].Rows, []interface{}{
+			name,
+			accountID,
+			len(accountTxs),
+			dateCell(accountTxs[0].Date),
+			dateCell(accountTxs[len(accountTxs)-1].Date),
+			math.Round(total*100) / 100,
+		})
+	}
+
+	var b bytes.Buffer
+	err := xlsx.Write(&b, sheets)
+	return b.Bytes(), err
+}
+
+// sheetName names an account's sheet by its type and mask, e.g.
+// "depository 1234", unique among taken and within Excel's limits.
+func sheetName(tx plaid_cli.Transaction, taken map[string]bool) string {
+	name := strings.TrimSpace(tx.AccountType + " " + tx.AccountMask)
+	if tx.AccountMask == "" && len(tx.AccountID) > 8 {
+		name = strings.TrimSpace(tx.AccountType + " " + tx.AccountID[len(tx.AccountID)-8:])
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	if len(name) > 28 {
+		name = name[:28]
+	}
+	if name == "" {
+		name = "Account"
+	}
+
+	unique := name
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s %d", name, i)
+	}
+	return unique
+}
+
+// dateCell is a typed date cell, or the text as is when it isn't a date.
+func dateCell(date string) interface{} {
+	if date == "" {
+		return nil
+	}
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t
+}
+
+type JSONSerializer struct{}
+
+func (w *JSONSerializer) Serialize(txs []plaid_cli.Transaction) ([]byte, error) {
+	return json.MarshalIndent(txs, "", "  ")
+}
+
+// AnonymizedSerializer emits monthly aggregates per category and hashed
+// merchant instead of raw transactions, so spending patterns can be
+// shared without exposing names, exact amounts, or dates.
+type AnonymizedSerializer struct {
+	// Secret, or anyone could hash a list of merchant names and match
+	// them up
+	Salt string
+}
+
+func (w *AnonymizedSerializer) Serialize(txs []plaid_cli.Transaction) ([]byte, error) {
+	type key struct{ month, category, merchant string }
+	type aggregate struct {
+		count int
+		total float64
+	}
+
+	var keys []key
+	aggregates := make(map[key]*aggregate)
+	for _, tx := range txs {
+		merchant := tx.MerchantName
+		if merchant == "" {
+			merchant = tx.Name
+		}
+		hash := sha256.Sum256([]byte(w.Salt + strings.ToLower(merchant)))
+
+		category := ""
+		if len(tx.Category) > 0 {
+			category = tx.Category[0]
+		}
+
+		month := tx.Date
+		if len(month) >= 7 {
+			month = month[:7]
+		}
+
+		k := key{month, category, hex.EncodeToString(hash[:])[:12]}
+		a, ok := aggregates[k]
+		if !ok {
+			a = &aggregate{}
+			aggregates[k] = a
+			keys = append(keys, k)
+		}
+		a.count++
+		a.total += tx.Amount
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].month != keys[j].month {
+			return keys[i].month < keys[j].month
+		}
+		if keys[i].category != keys[j].category {
+			return keys[i].category < keys[j].category
+		}
+		return keys[i].merchant < keys[j].merchant
+	})
+
+	var records [][]string
+	for _, k := range keys {
+		a := aggregates[k]
+		// Round to the nearest 10 so individual amounts can't be recovered
+		rounded := math.Round(a.total/10) * 10
+		records = append(records, []string{k.month, k.category, k.merchant, fmt.Sprintf("%d", a.count), fmt.Sprintf("%.0f", rounded)})
+	}
+
+	b := bytes.NewBufferString("")
+	writer := csv.NewWriter(b)
+	err := writer.Write([]string{"Month", "Category", "Merchant", "Count", "Amount"})
+	if err != nil {
+		return nil, err
+	}
+	err = writer.WriteAll(records)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), err
+}
@@ -0,0 +1,169 @@
+package plaid_cli
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// PlaidClient is the part of the Plaid API plaid-cli uses. Commands and
+// the sync take one instead of the SDK client, so they can run against a
+// fake without credentials.
+type PlaidClient interface {
+	AccountsGet(ctx context.Context, req plaid.AccountsGetRequest) (plaid.AccountsGetResponse, error)
+	TransactionsGet(ctx context.Context, req plaid.TransactionsGetRequest) (plaid.TransactionsGetResponse, error)
+	ItemGet(ctx context.Context, req plaid.ItemGetRequest) (plaid.ItemGetResponse, error)
+	ItemRemove(ctx context.Context, req plaid.ItemRemoveRequest) (plaid.ItemRemoveResponse, error)
+	ItemWebhookUpdate(ctx context.Context, req plaid.ItemWebhookUpdateRequest) (plaid.ItemWebhookUpdateResponse, error)
+	ItemPublicTokenExchange(ctx context.Context, req plaid.ItemPublicTokenExchangeRequest) (plaid.ItemPublicTokenExchangeResponse, error)
+	InstitutionsGetById(ctx context.Context, req plaid.InstitutionsGetByIdRequest) (plaid.InstitutionsGetByIdResponse, error)
+	CategoriesGet(ctx context.Context) (plaid.CategoriesGetResponse, error)
+	IdentityGet(ctx context.Context, req plaid.IdentityGetRequest) (plaid.IdentityGetResponse, error)
+	AuthGet(ctx context.Context, req plaid.AuthGetRequest) (plaid.AuthGetResponse, error)
+	StatementsList(ctx context.Context, req plaid.StatementsListRequest) (plaid.StatementsListResponse, error)
+	// StatementsDownload returns the statement's PDF
+	StatementsDownload(ctx context.Context, req plaid.StatementsDownloadRequest) ([]byte, error)
+	AssetReportCreate(ctx context.Context, req plaid.AssetReportCreateRequest) (plaid.AssetReportCreateResponse, error)
+	AssetReportGet(ctx context.Context, req plaid.AssetReportGetRequest) (plaid.AssetReportGetResponse, error)
+	// AssetReportPdfGet returns the report's PDF
+	AssetReportPdfGet(ctx context.Context, req plaid.AssetReportPDFGetRequest) ([]byte, error)
+	LinkTokenCreate(ctx context.Context, req plaid.LinkTokenCreateRequest) (plaid.LinkTokenCreateResponse, error)
+	LinkTokenGet(ctx context.Context, req plaid.LinkTokenGetRequest) (plaid.LinkTokenGetResponse, error)
+	SandboxPublicTokenCreate(ctx context.Context, req plaid.SandboxPublicTokenCreateRequest) (plaid.SandboxPublicTokenCreateResponse, error)
+	SandboxItemFireWebhook(ctx context.Context, req plaid.SandboxItemFireWebhookRequest) (plaid.SandboxItemFireWebhookResponse, error)
+	SandboxItemResetLogin(ctx context.Context, req plaid.SandboxItemResetLoginRequest) (plaid.SandboxItemResetLoginResponse, error)
+	TransactionsRecurringGet(ctx context.Context, req plaid.TransactionsRecurringGetRequest) (plaid.TransactionsRecurringGetResponse, error)
+	LiabilitiesGet(ctx context.Context, req plaid.LiabilitiesGetRequest) (plaid.LiabilitiesGetResponse, error)
+}
+
+// NewPlaidClient wraps the SDK client.
+func NewPlaidClient(api *plaid.APIClient) PlaidClient {
+	return &sdkClient{api: api.PlaidApi}
+}
+
+type sdkClient struct {
+	api *plaid.PlaidApiService
+}
+
+func (c *sdkClient) AccountsGet(ctx context.Context, req plaid.AccountsGetRequest) (plaid.AccountsGetResponse, error) {
+	resp, _, err := c.api.AccountsGet(ctx).AccountsGetRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) TransactionsGet(ctx context.Context, req plaid.TransactionsGetRequest) (plaid.TransactionsGetResponse, error) {
+	resp, _, err := c.api.TransactionsGet(ctx).TransactionsGetRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) ItemGet(ctx context.Context, req plaid.ItemGetRequest) (plaid.ItemGetResponse, error) {
+	resp, _, err := c.api.ItemGet(ctx).ItemGetRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) ItemRemove(ctx context.Context, req plaid.ItemRemoveRequest) (plaid.ItemRemoveResponse, error) {
+	resp, _, err := c.api.ItemRemove(ctx).ItemRemoveRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) ItemWebhookUpdate(ctx context.Context, req plaid.ItemWebhookUpdateRequest) (plaid.ItemWebhookUpdateResponse, error) {
+	resp, _, err := c.api.ItemWebhookUpdate(ctx).ItemWebhookUpdateRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) ItemPublicTokenExchange(ctx context.Context, req plaid.ItemPublicTokenExchangeRequest) (plaid.ItemPublicTokenExchangeResponse, error) {
+	resp, _, err := c.api.ItemPublicTokenExchange(ctx).ItemPublicTokenExchangeRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) InstitutionsGetById(ctx context.Context, req plaid.InstitutionsGetByIdRequest) (plaid.InstitutionsGetByIdResponse, error) {
+	resp, _, err := c.api.InstitutionsGetById(ctx).InstitutionsGetByIdRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) CategoriesGet(ctx context.Context) (plaid.CategoriesGetResponse, error) {
+	resp, _, err := c.api.CategoriesGet(ctx).Body(map[string]interface{}{}).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) IdentityGet(ctx context.Context, req plaid.IdentityGetRequest) (plaid.IdentityGetResponse, error) {
+	resp, _, err := c.api.IdentityGet(ctx).IdentityGetRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) AuthGet(ctx context.Context, req plaid.AuthGetRequest) (plaid.AuthGetResponse, error) {
+	resp, _, err := c.api.AuthGet(ctx).AuthGetRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) StatementsList(ctx context.Context, req plaid.StatementsListRequest) (plaid.StatementsListResponse, error) {
+	resp, _, err := c.api.StatementsList(ctx).StatementsListRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) StatementsDownload(ctx context.Context, req plaid.StatementsDownloadRequest) ([]byte, error) {
+	// The SDK buffers the PDF in a temporary file
+	f, _, err := c.api.StatementsDownload(ctx).StatementsDownloadRequest(req).Execute()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func (c *sdkClient) AssetReportCreate(ctx context.Context, req plaid.AssetReportCreateRequest) (plaid.AssetReportCreateResponse, error) {
+	resp, _, err := c.api.AssetReportCreate(ctx).AssetReportCreateRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) AssetReportGet(ctx context.Context, req plaid.AssetReportGetRequest) (plaid.AssetReportGetResponse, error) {
+	resp, _, err := c.api.AssetReportGet(ctx).AssetReportGetRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) AssetReportPdfGet(ctx context.Context, req plaid.AssetReportPDFGetRequest) ([]byte, error) {
+	f, _, err := c.api.AssetReportPdfGet(ctx).AssetReportPDFGetRequest(req).Execute()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func (c *sdkClient) LinkTokenCreate(ctx context.Context, req plaid.LinkTokenCreateRequest) (plaid.LinkTokenCreateResponse, error) {
+	resp, _, err := c.api.LinkTokenCreate(ctx).LinkTokenCreateRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) LinkTokenGet(ctx context.Context, req plaid.LinkTokenGetRequest) (plaid.LinkTokenGetResponse, error) {
+	resp, _, err := c.api.LinkTokenGet(ctx).LinkTokenGetRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) SandboxPublicTokenCreate(ctx context.Context, req plaid.SandboxPublicTokenCreateRequest) (plaid.SandboxPublicTokenCreateResponse, error) {
+	resp, _, err := c.api.SandboxPublicTokenCreate(ctx).SandboxPublicTokenCreateRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) SandboxItemFireWebhook(ctx context.Context, req plaid.SandboxItemFireWebhookRequest) (plaid.SandboxItemFireWebhookResponse, error) {
+	resp, _, err := c.api.SandboxItemFireWebhook(ctx).SandboxItemFireWebhookRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) SandboxItemResetLogin(ctx context.Context, req plaid.SandboxItemResetLoginRequest) (plaid.SandboxItemResetLoginResponse, error) {
+	resp, _, err := c.api.SandboxItemResetLogin(ctx).SandboxItemResetLoginRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) TransactionsRecurringGet(ctx context.Context, req plaid.TransactionsRecurringGetRequest) (plaid.TransactionsRecurringGetResponse, error) {
+	resp, _, err := c.api.TransactionsRecurringGet(ctx).TransactionsRecurringGetRequest(req).Execute()
+	return resp, err
+}
+
+func (c *sdkClient) LiabilitiesGet(ctx context.Context, req plaid.LiabilitiesGetRequest) (plaid.LiabilitiesGetResponse, error) {
+	resp, _, err := c.api.LiabilitiesGet(ctx).LiabilitiesGetRequest(req).Execute()
+	return resp, err
+}
@@ -0,0 +1,91 @@
+package plaid_cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// Hosted Link runs Link on a Plaid-hosted page instead of the local
+// server, so linking can be finished on another device (e.g. a phone)
+// when plaid-cli runs on a machine without a browser. Completion is
+// found by polling /link/token/get.
+
+const hostedLinkPollInterval = 5 * time.Second
+
+var errHostedLinkDisabled = errors.New("Plaid did not return a Hosted Link URL. Is Hosted Link enabled for your Plaid account?")
+
+func (l *Linker) hostedLink(ctx context.Context, resp plaid.LinkTokenCreateResponse) (*TokenPair, error) {
+	session, err := l.waitForHostedSession(ctx, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	results := session.Results.Get()
+	if results == nil || results.ItemAddResults == nil || len(*results.ItemAddResults) == 0 {
+		return nil, errors.New("Link finished without linking an institution")
+	}
+
+	res, err := l.exchange(ctx, (*results.ItemAddResults)[0].PublicToken)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		ItemID:      res.ItemId,
+		AccessToken: res.AccessToken,
+	}, nil
+}
+
+func (l *Linker) hostedRelink(ctx context.Context, resp plaid.LinkTokenCreateResponse) error {
+	_, err := l.waitForHostedSession(ctx, resp)
+	return err
+}
+
+// waitForHostedSession prints the Hosted Link URL and waits for a session
+// using it to finish, returning an error if the user exited Link.
+func (l *Linker) waitForHostedSession(ctx context.Context, resp plaid.LinkTokenCreateResponse) (plaid.LinkTokenGetSessionsResponse, error) {
+	url := resp.GetHostedLinkUrl()
+	if url == "" {
+		return plaid.LinkTokenGetSessionsResponse{}, errHostedLinkDisabled
+	}
+	slog.Info("Open the Hosted Link URL on any device to continue linking. Waiting for Link to finish...", "url", url)
+
+	ticker := time.NewTicker(hostedLinkPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return plaid.LinkTokenGetSessionsResponse{}, context.Cause(ctx)
+		case <-ticker.C:
+		}
+
+		got, err := l.Client.LinkTokenGet(ctx, plaid.LinkTokenGetRequest{
+			LinkToken: resp.LinkToken,
+		})
+		if err != nil {
+			return plaid.LinkTokenGetSessionsResponse{}, err
+		}
+		if expiration := got.Expiration.Get(); expiration != nil && time.Now().After(*expiration) {
+			return plaid.LinkTokenGetSessionsResponse{}, errors.New("The Hosted Link URL expired before Link was finished")
+		}
+
+		for _, session := range got.GetLinkSessions() {
+			if session.FinishedAt.Get() == nil {
+				continue
+			}
+			if exit := session.Exit.Get(); exit != nil {
+				if e := exit.Error.Get(); e != nil {
+					return session, errors.New(fmt.Sprintf("Link failed: %s", e.ErrorMessage))
+				}
+				if session.Results.Get() == nil {
+					return session, errors.New("Link was exited before it finished")
+				}
+			}
+			return session, nil
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package plaid_cli
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+type Institution struct {
+	ID   string
+	Name string
+	URL  string
+	// Base64 encoded PNG, as returned by Plaid
+	Logo     string
+	Products []string
+	OAuth    bool
+}
+
+type CachedInstitution struct {
+	Institution
+	FetchedAt time.Time
+}
+
+// FetchInstitution looks up the institution an item belongs to.
+func FetchInstitution(ctx context.Context, client PlaidClient, data *Data, accessToken string, countries []plaid.CountryCode, ttl time.Duration) (Institution, error) {
+	itemResp, err := client.ItemGet(ctx, plaid.ItemGetRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		return Institution{}, err
+	}
+
+	instID := itemResp.Item.GetInstitutionId()
+	if instID == "" {
+		return Institution{}, errors.New("Item has no institution")
+	}
+
+	return data.GetInstitution(ctx, client, instID, countries, ttl)
+}
+
+// GetInstitution returns institution metadata from the local cache,
+// only calling /institutions/get_by_id (which is heavily rate limited)
+// when the cached copy is older than ttl.
+func (d *Data) GetInstitution(ctx context.Context, client PlaidClient, institutionID string, countries []plaid.CountryCode, ttl time.Duration) (Institution, error) {
+	if cached, ok := d.InstitutionCache[institutionID]; ok && time.Since(cached.FetchedAt) < ttl {
+		return cached.Institution, nil
+	}
+
+	resp, err := client.InstitutionsGetById(ctx, plaid.InstitutionsGetByIdRequest{
+		InstitutionId: institutionID,
+		CountryCodes:  countries,
+		Options: &plaid.InstitutionsGetByIdRequestOptions{
+			IncludeOptionalMetadata: plaid.PtrBool(true),
+		},
+	})
+	if err != nil {
+		return Institution{}, err
+	}
+
+	institution := InstitutionFromPlaid(resp.Institution)
+	d.InstitutionCache[institutionID] = CachedInstitution{
+		Institution: institution,
+		FetchedAt:   time.Now(),
+	}
+	err = d.SaveInstitutionCache()
+	if err != nil {
+		return Institution{}, err
+	}
+
+	return institution, nil
+}
+
+func InstitutionFromPlaid(inst plaid.Institution) Institution {
+	products := make([]string, len(inst.Products))
+	for i, p := range inst.Products {
+		products[i] = string(p)
+	}
+
+	return Institution{
+		ID:       inst.InstitutionId,
+		Name:     inst.Name,
+		URL:      inst.GetUrl(),
+		Logo:     inst.GetLogo(),
+		Products: products,
+		OAuth:    inst.Oauth,
+	}
+}
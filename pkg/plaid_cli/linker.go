@@ -2,28 +2,138 @@ package plaid_cli
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	"github.com/plaid/plaid-go/v27/plaid"
 	"github.com/skratchdot/open-golang/open"
 )
 
 type Linker struct {
-	Results       chan string
-	RelinkResults chan bool
-	Errors        chan error
-	Client        *plaid.APIClient
-	Data          *Data
-	countries     []plaid.CountryCode
-	lang          string
-
-	mu sync.Mutex
+	Client PlaidClient
+	Data   *Data
+	// Address to serve Link on. All interfaces when empty.
+	Bind string
+	// OAuth redirect URI registered with Plaid, e.g.
+	// https://localhost:9090/oauth-return. Banks using OAuth redirect
+	// back to it, and it must be HTTPS.
+	RedirectURI string
+	// Certificate and key files for serving Link over HTTPS. A self-signed
+	// certificate is used when RedirectURI is HTTPS and these are empty.
+	TLSCert string
+	TLSKey  string
+	// Use Hosted Link instead of serving Link locally
+	Hosted bool
+	// URL Plaid sends new items' webhooks to, e.g. `plaid-cli serve`'s
+	// /v1/plaid/webhook
+	Webhook string
+	// Only print the Link URL, for machines without a browser
+	NoOpen bool
+	// Host name in the printed Link URL, e.g. a Tailscale name, for
+	// finishing Link on another machine
+	ExternalHost string
+	// Days of history to request for new items, up to 730
+	DaysRequested int
+	// Products to request for new items, e.g. transactions and auth
+	Products  []string
+	countries []plaid.CountryCode
+	lang      string
+
+	// Links take turns, so only one Link page is open at a time. queued
+	// counts those running or waiting, under queueMu.
+	mu      sync.Mutex
+	queueMu sync.Mutex
+	queued  int
+}
+
+// linkSession is one Link page being served. Each has its own ID and
+// channels, so a page left open from an earlier link can't answer for
+// the next one.
+type linkSession struct {
+	ID      string
+	Label   string
+	results chan string
+	errors  chan error
+}
+
+func newLinkSession(label string) (*linkSession, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return &linkSession{
+		ID:      hex.EncodeToString(b),
+		Label:   label,
+		results: make(chan string, 1),
+		errors:  make(chan error, 1),
+	}, nil
+}
+
+// result and fail deliver the page's answer. Only the first one counts,
+// so a page posting twice doesn't block its handler.
+func (s *linkSession) result(r string) {
+	select {
+	case s.results <- r:
+	default:
+	}
+}
+
+func (s *linkSession) fail(err error) {
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
+
+// wait waits for the Link page's answer, or for ctx to be done, e.g. by
+// run.deadline when nobody is there to open the page.
+func (s *linkSession) wait(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", context.Cause(ctx)
+	case err := <-s.errors:
+		return "", err
+	case r := <-s.results:
+		return r, nil
+	}
+}
+
+// take waits for the Links queued before this one, logging which
+// institution is up next, and returns a func to call when done.
+func (l *Linker) take(label string) func() {
+	l.queueMu.Lock()
+	l.queued++
+	busy := l.queued > 1
+	l.queueMu.Unlock()
+	if busy {
+		slog.Info("Waiting for another link to finish", "item", label)
+	}
+
+	l.mu.Lock()
+	l.queueMu.Lock()
+	waiting := l.queued - 1
+	l.queueMu.Unlock()
+	slog.Info("Linking", "item", label, "waiting", waiting)
+
+	return func() {
+		l.queueMu.Lock()
+		l.queued--
+		l.queueMu.Unlock()
+		l.mu.Unlock()
+	}
 }
 
 type TokenPair struct {
@@ -32,139 +142,281 @@ type TokenPair struct {
 }
 
 func (l *Linker) Relink(ctx context.Context, itemID string, port string) error {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	label := l.Data.ItemLabel(itemID)
+	defer l.take(label)()
 
-	log.Printf("Starting relink server for %s\n", itemID)
-	token := l.Data.Tokens[itemID]
-	hostname, err := os.Hostname()
+	req, err := l.relinkRequest(l.Data.Tokens[itemID])
 	if err != nil {
-		log.Fatal(err)
-	}
-	resp, httpResp, err := l.Client.PlaidApi.LinkTokenCreate(ctx).LinkTokenCreateRequest(
-		plaid.LinkTokenCreateRequest{
-			User: plaid.LinkTokenCreateRequestUser{
-				ClientUserId: hostname,
-			},
-			ClientName:   "plaid-cli",
-			CountryCodes: l.countries,
-			Language:     l.lang,
-			AccessToken:  *plaid.NewNullableString(&token),
-			Transactions: &plaid.LinkTokenTransactions{
-				DaysRequested: plaid.PtrInt32(365),
-			},
-		}).Execute()
+		return err
+	}
+	if l.Hosted {
+		req.SetHostedLink(plaid.LinkTokenCreateHostedLink{})
+	}
+	resp, err := l.Client.LinkTokenCreate(ctx, req)
 	if err != nil {
-		log.Print(resp)
-		log.Print(httpResp)
-		log.Fatal(err)
+		return err
 	}
-	return l.relink(port, resp.LinkToken)
+	if l.Hosted {
+		return l.hostedRelink(ctx, resp)
+	}
+	return l.relink(ctx, port, resp.LinkToken, label)
 }
 
-func (l *Linker) Link(ctx context.Context, port string) (*TokenPair, error) {
-	hostname, err := os.Hostname()
+// HostedRelinkURL creates an update mode session on a Plaid-hosted page
+// for the item with accessToken and returns its URL without waiting for
+// it, to be sent somewhere it can be opened, e.g. a phone.
+func (l *Linker) HostedRelinkURL(ctx context.Context, accessToken string) (string, error) {
+	req, err := l.relinkRequest(accessToken)
 	if err != nil {
-		log.Fatal(err)
-	}
-	resp, httpResp, err := l.Client.PlaidApi.LinkTokenCreate(ctx).LinkTokenCreateRequest(
-		plaid.LinkTokenCreateRequest{
-			User: plaid.LinkTokenCreateRequestUser{
-				ClientUserId: hostname,
-			},
-			ClientName:   "plaid-cli",
-			Products:     []plaid.Products{"transactions"},
-			CountryCodes: l.countries,
-			Language:     l.lang,
-			Transactions: &plaid.LinkTokenTransactions{
-				DaysRequested: plaid.PtrInt32(365),
-			},
-		}).Execute()
+		return "", err
+	}
+	req.SetHostedLink(plaid.LinkTokenCreateHostedLink{})
+	resp, err := l.Client.LinkTokenCreate(ctx, req)
 	if err != nil {
-		log.Print(resp)
-		log.Print(httpResp)
-		log.Fatal(err)
+		return "", err
 	}
-	return l.link(ctx, port, resp.LinkToken)
+	url := resp.GetHostedLinkUrl()
+	if url == "" {
+		return "", errHostedLinkDisabled
+	}
+	return url, nil
 }
 
-func (l *Linker) link(ctx context.Context, port string, linkToken string) (*TokenPair, error) {
-	log.Printf("Starting Plaid Link on port %s...\n", port)
+// relinkRequest is the request for an update mode link token.
+func (l *Linker) relinkRequest(token string) (plaid.LinkTokenCreateRequest, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return plaid.LinkTokenCreateRequest{}, err
+	}
+	req := plaid.LinkTokenCreateRequest{
+		User: plaid.LinkTokenCreateRequestUser{
+			ClientUserId: hostname,
+		},
+		ClientName:   "plaid-cli",
+		CountryCodes: l.countries,
+		Language:     l.lang,
+		AccessToken:  *plaid.NewNullableString(&token),
+		Transactions: &plaid.LinkTokenTransactions{
+			DaysRequested: plaid.PtrInt32(int32(l.DaysRequested)),
+		},
+	}
+	if l.RedirectURI != "" {
+		req.SetRedirectUri(l.RedirectURI)
+	}
+	return req, nil
+}
 
-	go func() {
-		http.HandleFunc("/link", handleLink(l, linkToken))
-		err := http.ListenAndServe(fmt.Sprintf(":%s", port), nil)
+func (l *Linker) Link(ctx context.Context, port string) (*TokenPair, error) {
+	label := "a new institution"
+	defer l.take(label)()
+
+	if l.DaysRequested < 1 || l.DaysRequested > 730 {
+		return nil, errors.New(fmt.Sprintf("Invalid days requested: %d. Plaid allows 1 to 730", l.DaysRequested))
+	}
+	var products []plaid.Products
+	statements := false
+	for _, p := range l.Products {
+		product, err := plaid.NewProductsFromValue(p)
 		if err != nil {
-			l.Errors <- err
+			return nil, err
 		}
-	}()
+		products = append(products, *product)
+		statements = statements || *product == plaid.PRODUCTS_STATEMENTS
+	}
+	if len(products) == 0 {
+		return nil, errors.New("No products to request")
+	}
 
-	url := fmt.Sprintf("http://localhost:%s/link", port)
-	log.Printf("Your browser should open automatically. If it doesn't, please visit %s to continue linking!\n", url)
-	open.Run(url)
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	req := plaid.LinkTokenCreateRequest{
+		User: plaid.LinkTokenCreateRequestUser{
+			ClientUserId: hostname,
+		},
+		ClientName:   "plaid-cli",
+		Products:     products,
+		CountryCodes: l.countries,
+		Language:     l.lang,
+		Transactions: &plaid.LinkTokenTransactions{
+			DaysRequested: plaid.PtrInt32(int32(l.DaysRequested)),
+		},
+	}
+	if statements {
+		// Statements needs the months to fetch; the same window as
+		// transactions
+		now := time.Now()
+		req.SetStatements(plaid.LinkTokenCreateRequestStatements{
+			StartDate: now.AddDate(0, 0, -l.DaysRequested).Format("2006-01-02"),
+			EndDate:   now.Format("2006-01-02"),
+		})
+	}
+	if l.RedirectURI != "" {
+		req.SetRedirectUri(l.RedirectURI)
+	}
+	if l.Webhook != "" {
+		req.SetWebhook(l.Webhook)
+	}
+	if l.Hosted {
+		req.SetHostedLink(plaid.LinkTokenCreateHostedLink{})
+	}
+	resp, err := l.Client.LinkTokenCreate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if l.Hosted {
+		return l.hostedLink(ctx, resp)
+	}
+	return l.link(ctx, port, resp.LinkToken, label)
+}
 
-	select {
-	case err := <-l.Errors:
+func (l *Linker) link(ctx context.Context, port string, linkToken string, label string) (*TokenPair, error) {
+	session, err := newLinkSession(label)
+	if err != nil {
+		return nil, err
+	}
+	srv, url, err := l.serve(session, port, "/link", handleLink(session, linkToken))
+	if err != nil {
 		return nil, err
-	case publicToken := <-l.Results:
+	}
+	defer shutdown(srv)
 
-		res, err := l.exchange(ctx, publicToken)
-		if err != nil {
-			return nil, err
-		}
+	l.openBrowser(url, label)
 
-		pair := &TokenPair{
-			ItemID:      res.ItemId,
-			AccessToken: res.AccessToken,
-		}
+	publicToken, err := session.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := l.exchange(ctx, publicToken)
+	if err != nil {
+		return nil, err
+	}
 
-		return pair, nil
+	pair := &TokenPair{
+		ItemID:      res.ItemId,
+		AccessToken: res.AccessToken,
 	}
+
+	return pair, nil
 }
 
-func (l *Linker) relink(port string, linkToken string) error {
-	log.Printf("Starting Plaid Link on port %s...\n", port)
+func (l *Linker) relink(ctx context.Context, port string, linkToken string, label string) error {
+	session, err := newLinkSession(label)
+	if err != nil {
+		return err
+	}
+	srv, url, err := l.serve(session, port, "/relink", handleRelink(session, linkToken))
+	if err != nil {
+		return err
+	}
+	defer shutdown(srv)
 
-	go func() {
-		http.HandleFunc("/relink", handleRelink(l, linkToken))
-		err := http.ListenAndServe(fmt.Sprintf(":%s", port), nil)
+	l.openBrowser(url, label)
+
+	_, err = session.wait(ctx)
+	return err
+}
+
+// serve starts a server for one link on its own mux, so the port can be
+// reused for the next link once the server is shut down. When port is 0
+// or already taken, a free port is picked. Returns the URL of path.
+func (l *Linker) serve(session *linkSession, port string, path string, handler http.HandlerFunc) (*http.Server, string, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(l.Bind, port))
+	// The OAuth redirect URI is registered with a fixed port
+	if err != nil && port != "0" && l.RedirectURI == "" {
+		slog.Warn("Cannot listen on port, picking a free port instead", "port", port, "error", err)
+		listener, err = net.Listen("tcp", net.JoinHostPort(l.Bind, "0"))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	scheme := "http"
+	if l.TLSCert != "" || strings.HasPrefix(l.RedirectURI, "https:") {
+		var cert tls.Certificate
+		if l.TLSCert != "" {
+			cert, err = tls.LoadX509KeyPair(l.TLSCert, l.TLSKey)
+		} else {
+			cert, err = selfSignedCertificate()
+		}
 		if err != nil {
-			l.Errors <- err
+			listener.Close()
+			return nil, "", err
+		}
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+		scheme = "https"
+	}
+
+	host := l.Bind
+	if l.ExternalHost != "" {
+		host = l.ExternalHost
+	} else if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)), path)
+	slog.Info("Starting Plaid Link", "addr", listener.Addr().String())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, handler)
+	// Where OAuth banks send the browser back to finish Link
+	mux.HandleFunc(oauthReturnPath, handler)
+	srv := &http.Server{Handler: mux}
+
+	go func() {
+		err := srv.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			session.fail(err)
 		}
 	}()
+	return srv, url, nil
+}
+
+func (l *Linker) openBrowser(url string, label string) {
+	if l.NoOpen {
+		slog.Info("Visit the Link URL to continue linking", "item", label, "url", url)
+		return
+	}
+
+	slog.Info("Your browser should open automatically. If it doesn't, visit the Link URL to continue linking", "item", label, "url", url)
+	err := open.Run(url)
+	if err != nil {
+		slog.Warn("Cannot open a browser. Visit the Link URL to continue linking, or pass --external-host to link from another machine", "item", label, "url", url, "error", err)
+	}
+}
 
-	url := fmt.Sprintf("http://localhost:%s/relink", port)
-	log.Printf("Your browser should open automatically. If it doesn't, please visit %s to continue linking!\n", url)
-	open.Run(url)
+const oauthReturnPath = "/oauth-return"
 
-	select {
-	case err := <-l.Errors:
-		return err
-	case <-l.RelinkResults:
-		return nil
+// shutdown stops srv once the browser has been answered.
+func shutdown(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		slog.Warn("Cannot shut down link server", "error", err)
 	}
 }
 
 func (l *Linker) exchange(ctx context.Context, publicToken string) (plaid.ItemPublicTokenExchangeResponse, error) {
-	resp, _, err := l.Client.PlaidApi.ItemPublicTokenExchange(ctx).ItemPublicTokenExchangeRequest(plaid.ItemPublicTokenExchangeRequest{
+	resp, err := l.Client.ItemPublicTokenExchange(ctx, plaid.ItemPublicTokenExchangeRequest{
 		PublicToken: publicToken,
-	}).Execute()
+	})
 	return resp, err
 }
 
-func NewLinker(data *Data, client *plaid.APIClient, countries []plaid.CountryCode, lang string) *Linker {
+func NewLinker(data *Data, client PlaidClient, countries []plaid.CountryCode, lang string) *Linker {
 	return &Linker{
-		Results:       make(chan string),
-		RelinkResults: make(chan bool),
-		Errors:        make(chan error),
 		Client:        client,
 		Data:          data,
+		DaysRequested: 365,
+		Products:      []string{"transactions"},
 		countries:     countries,
 		lang:          lang,
 	}
 }
 
-func handleLink(linker *Linker, linkToken string) func(w http.ResponseWriter, r *http.Request) {
+func handleLink(session *linkSession, linkToken string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -172,34 +424,50 @@ func handleLink(linker *Linker, linkToken string) func(w http.ResponseWriter, r
 			t, _ = t.Parse(linkTemplate)
 
 			d := LinkTmplData{
-				LinkToken: linkToken,
+				LinkToken:   linkToken,
+				OAuthReturn: r.URL.Path == oauthReturnPath,
+				Session:     session.ID,
+				Label:       session.Label,
 			}
 			t.Execute(w, d)
 		case http.MethodPost:
 			r.ParseForm()
+			if r.Form.Get("session") != session.ID {
+				http.Error(w, "This Link page is from an earlier link", http.StatusConflict)
+				return
+			}
 			token := r.Form.Get("public_token")
 			if token != "" {
-				linker.Results <- token
+				session.result(token)
 			} else {
-				linker.Errors <- errors.New("Empty public_token")
+				session.fail(errors.New("Empty public_token"))
 			}
 
 			fmt.Fprintf(w, "ok")
 		default:
-			linker.Errors <- errors.New("Invalid HTTP method")
+			session.fail(errors.New("Invalid HTTP method"))
 		}
 	}
 }
 
 type LinkTmplData struct {
 	LinkToken string
+	// Re-initialize Link after an OAuth redirect
+	OAuthReturn bool
+	// Posted back, so answers from other sessions' pages are ignored
+	Session string
+	// The institution being linked, e.g. "Chase (chase)"
+	Label string
 }
 
 type RelinkTmplData struct {
-	LinkToken string
+	LinkToken   string
+	OAuthReturn bool
+	Session     string
+	Label       string
 }
 
-func handleRelink(linker *Linker, linkToken string) func(w http.ResponseWriter, r *http.Request) {
+func handleRelink(session *linkSession, linkToken string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -207,27 +475,35 @@ func handleRelink(linker *Linker, linkToken string) func(w http.ResponseWriter,
 			t, _ = t.Parse(relinkTemplate)
 
 			d := RelinkTmplData{
-				LinkToken: linkToken,
+				LinkToken:   linkToken,
+				OAuthReturn: r.URL.Path == oauthReturnPath,
+				Session:     session.ID,
+				Label:       session.Label,
 			}
 			t.Execute(w, d)
 		case http.MethodPost:
 			r.ParseForm()
+			if r.Form.Get("session") != session.ID {
+				http.Error(w, "This Link page is from an earlier link", http.StatusConflict)
+				return
+			}
 			err := r.Form.Get("error")
 			if err != "" {
-				linker.Errors <- errors.New(err)
+				session.fail(errors.New(err))
 			} else {
-				linker.RelinkResults <- true
+				session.result("")
 			}
 
 			fmt.Fprintf(w, "ok")
 		default:
-			linker.Errors <- errors.New("Invalid HTTP method")
+			session.fail(errors.New("Invalid HTTP method"))
 		}
 	}
 }
 
 var linkTemplate string = `<html>
   <head>
+    <title>plaid-cli: {{ .Label | html }}</title>
     <style>
     .alert-success {
 	font-size: 1.2em;
@@ -241,24 +517,30 @@ var linkTemplate string = `<html>
 	width: 100%;
 	height: 100%;
     }
+    .label {
+	font-family: Arial, Helvetica, sans-serif;
+    }
     .hidden {
 	visibility: hidden;
     }
     </style>
   </head>
   <body>
+    <h2 class="label">Linking {{ .Label | html }}</h2>
     <script src="https://cdnjs.cloudflare.com/ajax/libs/jquery/2.2.3/jquery.min.js"></script>
     <script src="https://cdn.plaid.com/link/v2/stable/link-initialize.js"></script>
     <script type="text/javascript">
      (function($) {
        var handler = Plaid.create({
 	 token: '{{ .LinkToken }}',
+	 {{ if .OAuthReturn }}receivedRedirectUri: window.location.href,{{ end }}
 	 onSuccess: function(public_token, metadata) {
 	   // Send the public_token to your app server.
 	   // The metadata object contains info about the institution the
 	   // user selected and the account ID or IDs, if the
 	   // Select Account view is enabled.
 	   $.post('/link', {
+	     session: '{{ .Session }}',
 	     public_token: public_token,
 	   });
 	   document.getElementById("alert").classList.remove("hidden");
@@ -283,7 +565,7 @@ var linkTemplate string = `<html>
 
     <div id="alert" class="alert-success hidden">
       <div>
-	<h2>All done here!</h2>
+	<h2>All done with {{ .Label | html }}!</h2>
 	<p>You can close this window and go back to plaid-cli.</p>
       </div>
     </div>
@@ -292,6 +574,7 @@ var linkTemplate string = `<html>
 
 var relinkTemplate string = `<html>
   <head>
+    <title>plaid-cli: {{ .Label | html }}</title>
     <style>
     .alert-success {
 	font-size: 1.2em;
@@ -305,18 +588,23 @@ var relinkTemplate string = `<html>
 	width: 100%;
 	height: 100%;
     }
+    .label {
+	font-family: Arial, Helvetica, sans-serif;
+    }
     .hidden {
 	visibility: hidden;
     }
     </style>
   </head>
   <body>
+    <h2 class="label">Linking {{ .Label | html }}</h2>
     <script src="https://cdnjs.cloudflare.com/ajax/libs/jquery/2.2.3/jquery.min.js"></script>
     <script src="https://cdn.plaid.com/link/v2/stable/link-initialize.js"></script>
     <script type="text/javascript">
      (function($) {
        var handler = Plaid.create({
 	 token: '{{ .LinkToken }}',
+	 {{ if .OAuthReturn }}receivedRedirectUri: window.location.href,{{ end }}
 	 onSuccess: (public_token, metadata) => {
 	   // You do not need to repeat the /item/public_token/exchange
 	   // process when a user uses Link in update mode.
@@ -325,10 +613,12 @@ var relinkTemplate string = `<html>
 	 onExit: function(err, metadata) {
 	   if (err != null) {
 	     $.post('/relink', {
+	       session: '{{ .Session }}',
 	       error: err
 	     });
 	   } else {
 	     $.post('/relink', {
+	       session: '{{ .Session }}',
 	       error: null
 	     });
 	   }
@@ -347,7 +637,7 @@ var relinkTemplate string = `<html>
 
     <div id="alert" class="alert-success hidden">
       <div>
-	<h2>All done here!</h2>
+	<h2>All done with {{ .Label | html }}!</h2>
 	<p>You can close this window and go back to plaid-cli.</p>
       </div>
     </div>
@@ -0,0 +1,230 @@
+package plaid_cli
+
+import (
+	"time"
+
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// Transaction and Account are the types the rest of plaid-cli works with.
+// Plaid SDK types are converted at the edge (see TransactionsFromPlaid and
+// AccountsFromPlaid) so a plaid-go upgrade only has to touch this file.
+
+type Transaction struct {
+	ID        string  `json:"transaction_id"`
+	AccountID string  `json:"account_id"`
+	Amount    float64 `json:"amount"`
+	Date      string  `json:"date"`
+	// When the transaction was authorized, which for card transactions is
+	// usually when it actually happened. Datetimes are only available at
+	// some institutions.
+	AuthorizedDate     string     `json:"authorized_date"`
+	AuthorizedDatetime *time.Time `json:"authorized_datetime"`
+	Datetime           *time.Time `json:"datetime"`
+	Name               string     `json:"name"`
+	// Set by NormalizeNames when Name was cleaned up
+	RawName string `json:"raw_name,omitempty"`
+	// The bank's raw description, often with reference numbers Name drops
+	OriginalDescription string `json:"original_description"`
+	MerchantName        string `json:"merchant_name"`
+	Pending             bool   `json:"pending"`
+	// Deprecated by Plaid in favor of PersonalFinanceCategory
+	Category                []string                 `json:"category"`
+	PersonalFinanceCategory *PersonalFinanceCategory `json:"personal_finance_category"`
+	Location                Location                 `json:"location"`
+	CheckNumber             string                   `json:"check_number"`
+	PaymentMeta             PaymentMeta              `json:"payment_meta"`
+	// Empty for unofficial currencies (e.g. crypto)
+	IsoCurrencyCode string `json:"iso_currency_code"`
+	// Set by ConvertCurrency when Amount was converted to the home currency
+	OriginalAmount   *float64 `json:"original_amount,omitempty"`
+	OriginalCurrency string   `json:"original_currency,omitempty"`
+	// Merchant enrichment
+	LogoURL        string         `json:"logo_url"`
+	Website        string         `json:"website"`
+	PaymentChannel string         `json:"payment_channel"`
+	Counterparties []Counterparty `json:"counterparties"`
+	// e.g. depository or credit, and the last digits of the account
+	// number. Not part of Plaid's transaction object; filled in by
+	// AllTransactions from the accounts in the response.
+	AccountType string `json:"-"`
+	AccountMask string `json:"-"`
+	// Values of fields synced back from Airtable (sync.fields), by field
+	// name. Not part of Plaid's transaction object.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+type PersonalFinanceCategory struct {
+	Primary         string `json:"primary"`
+	Detailed        string `json:"detailed"`
+	ConfidenceLevel string `json:"confidence_level"`
+}
+
+type Counterparty struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Website string `json:"website"`
+	LogoURL string `json:"logo_url"`
+}
+
+// Details of checks and ACH transfers, mostly useful for reconciliation
+type PaymentMeta struct {
+	ReferenceNumber  string `json:"reference_number"`
+	PpdID            string `json:"ppd_id"`
+	Payee            string `json:"payee"`
+	ByOrderOf        string `json:"by_order_of"`
+	Payer            string `json:"payer"`
+	PaymentMethod    string `json:"payment_method"`
+	PaymentProcessor string `json:"payment_processor"`
+	Reason           string `json:"reason"`
+}
+
+type Location struct {
+	Address     string   `json:"address"`
+	City        string   `json:"city"`
+	Region      string   `json:"region"`
+	PostalCode  string   `json:"postal_code"`
+	Country     string   `json:"country"`
+	Lat         *float64 `json:"lat"`
+	Lon         *float64 `json:"lon"`
+	StoreNumber string   `json:"store_number"`
+}
+
+type Account struct {
+	ID           string   `json:"account_id"`
+	ItemID       string   `json:"item_id"`
+	Name         string   `json:"name"`
+	OfficialName string   `json:"official_name"`
+	Mask         string   `json:"mask"`
+	Type         string   `json:"type"`
+	Subtype      string   `json:"subtype"`
+	Balances     Balances `json:"balances"`
+}
+
+type Balances struct {
+	Available       *float64 `json:"available"`
+	Current         *float64 `json:"current"`
+	Limit           *float64 `json:"limit"`
+	IsoCurrencyCode string   `json:"iso_currency_code"`
+}
+
+// DisplayName prefers the official account name when Plaid has one.
+func (a Account) DisplayName() string {
+	if a.OfficialName != "" {
+		return a.OfficialName
+	}
+	return a.Name
+}
+
+func transactionFromPlaid(t plaid.Transaction) Transaction {
+	var pfc *PersonalFinanceCategory
+	if p := t.PersonalFinanceCategory.Get(); p != nil {
+		pfc = &PersonalFinanceCategory{
+			Primary:         p.Primary,
+			Detailed:        p.Detailed,
+			ConfidenceLevel: val(p.ConfidenceLevel),
+		}
+	}
+
+	return Transaction{
+		ID:                      t.TransactionId,
+		AccountID:               t.AccountId,
+		Amount:                  t.Amount,
+		Date:                    t.Date,
+		AuthorizedDate:          val(t.AuthorizedDate),
+		AuthorizedDatetime:      t.AuthorizedDatetime.Get(),
+		Datetime:                t.Datetime.Get(),
+		Name:                    t.Name,
+		OriginalDescription:     val(t.OriginalDescription),
+		MerchantName:            val(t.MerchantName),
+		Pending:                 t.Pending,
+		Category:                t.Category,
+		PersonalFinanceCategory: pfc,
+		IsoCurrencyCode:         val(t.IsoCurrencyCode),
+		LogoURL:                 val(t.LogoUrl),
+		Website:                 val(t.Website),
+		PaymentChannel:          t.PaymentChannel,
+		Counterparties:          counterpartiesFromPlaid(t.GetCounterparties()),
+		CheckNumber:             val(t.CheckNumber),
+		PaymentMeta: PaymentMeta{
+			ReferenceNumber:  val(t.PaymentMeta.ReferenceNumber),
+			PpdID:            val(t.PaymentMeta.PpdId),
+			Payee:            val(t.PaymentMeta.Payee),
+			ByOrderOf:        val(t.PaymentMeta.ByOrderOf),
+			Payer:            val(t.PaymentMeta.Payer),
+			PaymentMethod:    val(t.PaymentMeta.PaymentMethod),
+			PaymentProcessor: val(t.PaymentMeta.PaymentProcessor),
+			Reason:           val(t.PaymentMeta.Reason),
+		},
+		Location: Location{
+			Address:     val(t.Location.Address),
+			City:        val(t.Location.City),
+			Region:      val(t.Location.Region),
+			PostalCode:  val(t.Location.PostalCode),
+			Country:     val(t.Location.Country),
+			Lat:         t.Location.Lat.Get(),
+			Lon:         t.Location.Lon.Get(),
+			StoreNumber: val(t.Location.StoreNumber),
+		},
+	}
+}
+
+func counterpartiesFromPlaid(cs []plaid.TransactionCounterparty) []Counterparty {
+	ret := make([]Counterparty, len(cs))
+	for i, c := range cs {
+		ret[i] = Counterparty{
+			Name:    c.Name,
+			Type:    string(c.Type),
+			Website: val(c.Website),
+			LogoURL: val(c.LogoUrl),
+		}
+	}
+	return ret
+}
+
+// TransactionsFromPlaid converts transactions from the Plaid SDK.
+func TransactionsFromPlaid(ts []plaid.Transaction) []Transaction {
+	ret := make([]Transaction, len(ts))
+	for i, t := range ts {
+		ret[i] = transactionFromPlaid(t)
+	}
+	return ret
+}
+
+func accountFromPlaid(a plaid.AccountBase) Account {
+	subtype := ""
+	if a.Subtype.IsSet() && a.Subtype.Get() != nil {
+		subtype = string(*a.Subtype.Get())
+	}
+
+	return Account{
+		ID:           a.AccountId,
+		Name:         a.Name,
+		OfficialName: val(a.OfficialName),
+		Mask:         val(a.Mask),
+		Type:         string(a.Type),
+		Subtype:      subtype,
+		Balances: Balances{
+			Available:       a.Balances.Available.Get(),
+			Current:         a.Balances.Current.Get(),
+			Limit:           a.Balances.Limit.Get(),
+			IsoCurrencyCode: val(a.Balances.IsoCurrencyCode),
+		},
+	}
+}
+
+// AccountsFromPlaid converts accounts from the Plaid SDK.
+func AccountsFromPlaid(as []plaid.AccountBase) []Account {
+	ret := make([]Account, len(as))
+	for i, a := range as {
+		ret[i] = accountFromPlaid(a)
+	}
+	return ret
+}
+
+func val(s plaid.NullableString) string {
+	if !s.IsSet() || s.Get() == nil {
+		return ""
+	}
+	return *s.Get()
+}
@@ -1,18 +1,78 @@
 package plaid_cli
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
 )
 
+// SchemaVersion is written to the header of every data file. Bump it and
+// add an entry to migrations when the layout of a file changes.
+const SchemaVersion = 1
+
+// migrations[n] upgrades the payload of a file from schema version n to
+// n+1.
+var migrations = map[int]func(json.RawMessage) (json.RawMessage, error){
+	// Version 0 files have no header and hold the payload directly.
+	0: func(raw json.RawMessage) (json.RawMessage, error) { return raw, nil },
+}
+
+type envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Backfill is the checkpoint of a backfill, which syncs an item's
+// transactions in chunks walking back from today. Dates are 2006-01-02.
+type Backfill struct {
+	// The oldest date to sync
+	From string
+	// Every chunk from this date on is synced
+	SyncedFrom string
+	UpdatedAt  time.Time
+}
+
+// AlertState is an alert that fired and whose condition hasn't cleared
+// yet.
+type AlertState struct {
+	Message string
+	FiredAt time.Time
+	SentAt  time.Time
+	// Acknowledged, so it's not sent again until it clears and fires
+	// again
+	Acked bool
+}
+
 type Data struct {
 	DataDir     string
 	Tokens      map[string]string
 	Aliases     map[string]string
 	BackAliases map[string]string
+	// Keyed by item ID
+	Institutions map[string]Institution
+	// Keyed by institution ID
+	InstitutionCache map[string]CachedInstitution
+	// Alias to account ID
+	AccountAliases map[string]string
+	// Account ID to why it's ignored, e.g. the account it duplicates
+	IgnoredAccounts map[string]string
+	// Keyed by item ID, for backfills that haven't finished
+	Backfills map[string]Backfill
+	// Keyed by alert ID
+	Alerts map[string]AlertState
+
+	mu       sync.Mutex
+	migrated bool
+	// Payloads as last read or written, keyed by path, to tell our
+	// changes from those other processes saved since
+	saved map[string]json.RawMessage
 }
 
 func LoadData(dataDir string) (*Data, error) {
@@ -21,10 +81,25 @@ func LoadData(dataDir string) (*Data, error) {
 	data := &Data{
 		DataDir:     dataDir,
 		BackAliases: make(map[string]string),
+		saved:       make(map[string]json.RawMessage),
 	}
 
 	data.loadTokens()
 	data.loadAliases()
+	data.loadInstitutions()
+	data.loadInstitutionCache()
+	data.loadAccountAliases()
+	data.loadIgnoredAccounts()
+	data.loadBackfills()
+	data.loadAlerts()
+
+	if data.migrated {
+		slog.Info("Migrating data files", "data_dir", dataDir, "schema_version", SchemaVersion)
+		err := data.Save()
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return data, nil
 }
@@ -32,9 +107,9 @@ func LoadData(dataDir string) (*Data, error) {
 func (d *Data) loadAliases() {
 	var aliases map[string]string = make(map[string]string)
 	filePath := d.aliasesPath()
-	err := load(filePath, &aliases)
+	err := d.load(filePath, &aliases)
 	if err != nil {
-		log.Printf("Error loading aliases from %s. Assuming empty tokens. Error: %s", d.aliasesPath(), err)
+		slog.Warn("Cannot load aliases. Assuming empty tokens.", "path", d.aliasesPath(), "error", err)
 	}
 
 	d.Aliases = aliases
@@ -52,31 +127,154 @@ func (d *Data) aliasesPath() string {
 	return filepath.Join(d.DataDir, "data", "aliases.json")
 }
 
+func (d *Data) institutionsPath() string {
+	return filepath.Join(d.DataDir, "data", "institutions.json")
+}
+
+func (d *Data) loadInstitutions() {
+	var institutions map[string]Institution = make(map[string]Institution)
+	filePath := d.institutionsPath()
+	err := d.load(filePath, &institutions)
+	if err != nil {
+		slog.Warn("Cannot load institutions. Assuming empty institutions.", "path", d.institutionsPath(), "error", err)
+	}
+
+	d.Institutions = institutions
+}
+
+func (d *Data) institutionCachePath() string {
+	return filepath.Join(d.DataDir, "data", "institution_cache.json")
+}
+
+func (d *Data) loadInstitutionCache() {
+	var cache map[string]CachedInstitution = make(map[string]CachedInstitution)
+	filePath := d.institutionCachePath()
+	err := d.load(filePath, &cache)
+	if err != nil {
+		slog.Warn("Cannot load institution cache. Assuming empty cache.", "path", d.institutionCachePath(), "error", err)
+	}
+
+	d.InstitutionCache = cache
+}
+
+func (d *Data) accountAliasesPath() string {
+	return filepath.Join(d.DataDir, "data", "account_aliases.json")
+}
+
+func (d *Data) loadAccountAliases() {
+	var aliases map[string]string = make(map[string]string)
+	filePath := d.accountAliasesPath()
+	err := d.load(filePath, &aliases)
+	if err != nil {
+		slog.Warn("Cannot load account aliases. Assuming empty account aliases.", "path", d.accountAliasesPath(), "error", err)
+	}
+
+	d.AccountAliases = aliases
+}
+
+func (d *Data) ignoredAccountsPath() string {
+	return filepath.Join(d.DataDir, "data", "ignored_accounts.json")
+}
+
+func (d *Data) loadIgnoredAccounts() {
+	var ignored map[string]string = make(map[string]string)
+	filePath := d.ignoredAccountsPath()
+	err := d.load(filePath, &ignored)
+	if err != nil {
+		slog.Warn("Cannot load ignored accounts. Assuming no ignored accounts.", "path", d.ignoredAccountsPath(), "error", err)
+	}
+
+	d.IgnoredAccounts = ignored
+}
+
+func (d *Data) backfillsPath() string {
+	return filepath.Join(d.DataDir, "data", "backfills.json")
+}
+
+func (d *Data) loadBackfills() {
+	var backfills map[string]Backfill = make(map[string]Backfill)
+	filePath := d.backfillsPath()
+	err := d.load(filePath, &backfills)
+	if err != nil {
+		slog.Warn("Cannot load backfills. Assuming no backfills in progress.", "path", d.backfillsPath(), "error", err)
+	}
+
+	d.Backfills = backfills
+}
+
+func (d *Data) alertsPath() string {
+	return filepath.Join(d.DataDir, "data", "alerts.json")
+}
+
+func (d *Data) loadAlerts() {
+	var alerts map[string]AlertState = make(map[string]AlertState)
+	filePath := d.alertsPath()
+	err := d.load(filePath, &alerts)
+	if err != nil {
+		slog.Warn("Cannot load alerts. Assuming no alerts fired.", "path", d.alertsPath(), "error", err)
+	}
+
+	d.Alerts = alerts
+}
+
 func (d *Data) loadTokens() {
 	var tokens map[string]string = make(map[string]string)
 	filePath := d.tokensPath()
-	err := load(filePath, &tokens)
+	err := d.load(filePath, &tokens)
 	if err != nil {
-		log.Printf("Error loading tokens from %s. Assuming empty tokens. Error: %s", d.tokensPath(), err)
+		slog.Warn("Cannot load tokens. Assuming empty tokens.", "path", d.tokensPath(), "error", err)
 	}
 
 	d.Tokens = tokens
 }
 
-func load(filePath string, v interface{}) error {
+func (d *Data) load(filePath string, v interface{}) error {
 	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0755)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
 
+	b, err := ioutil.ReadAll(f)
 	if err != nil {
 		return err
-	} else {
-		b, err := ioutil.ReadAll(f)
+	}
+
+	payload, err := d.decode(filePath, b)
+	if err != nil || payload == nil {
+		return err
+	}
+	d.saved[filePath] = payload
+	return json.Unmarshal(payload, v)
+}
+
+// decode unwraps and migrates the payload of a data file, which is nil
+// for a freshly created file.
+func (d *Data) decode(filePath string, b []byte) (json.RawMessage, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	var e envelope
+	err := json.Unmarshal(b, &e)
+	if err != nil || e.SchemaVersion == 0 || e.Data == nil {
+		e = envelope{SchemaVersion: 0, Data: b}
+	}
+
+	if e.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("%s has schema version %d, but this version of plaid-cli only supports up to %d", filePath, e.SchemaVersion, SchemaVersion)
+	}
+
+	for e.SchemaVersion < SchemaVersion {
+		e.Data, err = migrations[e.SchemaVersion](e.Data)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		return json.Unmarshal(b, v)
+		e.SchemaVersion++
+		d.migrated = true
 	}
+
+	return e.Data, nil
 }
 
 func (d *Data) Save() error {
@@ -90,29 +288,235 @@ func (d *Data) Save() error {
 		return err
 	}
 
+	err = d.SaveInstitutions()
+	if err != nil {
+		return err
+	}
+
+	err = d.SaveAccountAliases()
+	if err != nil {
+		return err
+	}
+
+	err = d.SaveIgnoredAccounts()
+	if err != nil {
+		return err
+	}
+
+	err = d.SaveInstitutionCache()
+	if err != nil {
+		return err
+	}
+
+	err = d.SaveBackfills()
+	if err != nil {
+		return err
+	}
+
+	err = d.SaveAlerts()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// ItemLabel describes an item for listings, e.g. "Chase (chase)", falling
+// back to the alias or item ID when no institution metadata is stored.
+func (d *Data) ItemLabel(itemID string) string {
+	name := itemID
+	if alias, ok := d.BackAliases[itemID]; ok {
+		name = alias
+	}
+	if institution, ok := d.Institutions[itemID]; ok {
+		return fmt.Sprintf("%s (%s)", institution.Name, name)
+	}
+	return name
+}
+
 func (d *Data) SaveTokens() error {
-	return save(d.Tokens, d.tokensPath())
+	return d.save(&d.Tokens, d.tokensPath())
 }
 
 func (d *Data) SaveAliases() error {
-	return save(d.Aliases, d.aliasesPath())
+	err := d.save(&d.Aliases, d.aliasesPath())
+	if err != nil {
+		return err
+	}
+
+	// Aliases other processes saved were merged in
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.BackAliases = make(map[string]string)
+	for alias, itemID := range d.Aliases {
+		d.BackAliases[itemID] = alias
+	}
+	return nil
 }
 
-func save(v interface{}, filePath string) error {
-	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0755)
+func (d *Data) SaveInstitutions() error {
+	return d.save(&d.Institutions, d.institutionsPath())
+}
+
+func (d *Data) SaveInstitutionCache() error {
+	return d.save(&d.InstitutionCache, d.institutionCachePath())
+}
+
+func (d *Data) SaveAccountAliases() error {
+	return d.save(&d.AccountAliases, d.accountAliasesPath())
+}
+
+func (d *Data) SaveIgnoredAccounts() error {
+	return d.save(&d.IgnoredAccounts, d.ignoredAccountsPath())
+}
+
+func (d *Data) SaveBackfills() error {
+	return d.save(&d.Backfills, d.backfillsPath())
+}
+
+func (d *Data) SaveAlerts() error {
+	return d.save(&d.Alerts, d.alertsPath())
+}
+
+// lock serializes writers within this process and, via an advisory file
+// lock, across concurrently running plaid-cli processes.
+func (d *Data) lock() (func(), error) {
+	d.mu.Lock()
+
+	f, err := os.OpenFile(filepath.Join(d.DataDir, "data", ".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		d.mu.Unlock()
+		return nil, err
+	}
+
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+		d.mu.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+		d.mu.Unlock()
+	}, nil
+}
+
+// save writes v, a pointer to one of the maps, to filePath. Entries
+// another process changed since we read the file are merged in, into v
+// too, unless we changed the same entry. It writes to a temporary file and
+// renames it into place so readers never observe a partially written
+// file.
+func (d *Data) save(v interface{}, filePath string) error {
+	unlock, err := d.lock()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer unlock()
 
-	b, err := json.Marshal(v)
+	payload, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
 
+	current, err := ioutil.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	theirs, err := d.decode(filePath, current)
+	if err != nil {
+		return err
+	}
+	if theirs != nil && !equalJSON(theirs, d.saved[filePath]) {
+		payload, err = mergePayloads(d.saved[filePath], theirs, payload)
+		if err != nil {
+			return fmt.Errorf("cannot merge %s: %w", filePath, err)
+		}
+		target := reflect.ValueOf(v).Elem()
+		target.Set(reflect.Zero(target.Type()))
+		err = json.Unmarshal(payload, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(envelope{SchemaVersion: SchemaVersion, Data: payload})
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
 	_, err = f.Write(b)
-	return err
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(f.Name(), filePath)
+	if err != nil {
+		return err
+	}
+	d.saved[filePath] = payload
+	return nil
+}
+
+// mergePayloads applies the entries mine added, changed or removed
+// relative to base to theirs. All three are JSON objects.
+func mergePayloads(base, theirs, mine json.RawMessage) (json.RawMessage, error) {
+	var baseEntries, theirEntries, myEntries map[string]json.RawMessage
+	if base != nil {
+		err := json.Unmarshal(base, &baseEntries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := json.Unmarshal(theirs, &theirEntries)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(mine, &myEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := theirEntries
+	if merged == nil {
+		merged = make(map[string]json.RawMessage)
+	}
+	for k, v := range myEntries {
+		if old, ok := baseEntries[k]; !ok || !equalJSON(old, v) {
+			merged[k] = v
+		}
+	}
+	for k := range baseEntries {
+		if _, ok := myEntries[k]; !ok {
+			delete(merged, k)
+		}
+	}
+	return json.Marshal(merged)
+}
+
+func equalJSON(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
 }
@@ -0,0 +1,129 @@
+package plaid_cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RunLock keeps commands that write to Airtable and the data files, like
+// syncs and backfills, from running at the same time in a data
+// directory. It is an OS lock on a file holding the PID of the command
+// holding it, which the OS releases when that process exits, however it
+// exits.
+type RunLock struct {
+	f *os.File
+}
+
+// LockHolder is what the lock file says about the command holding it.
+type LockHolder struct {
+	PID       int       `json:"pid"`
+	Hostname  string    `json:"hostname"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// LockedError is returned when another command holds the lock.
+type LockedError struct {
+	Holder LockHolder
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder.PID == 0 {
+		return "Another command is starting"
+	}
+	return fmt.Sprintf("%s (PID %d on %s) has been running since %s", e.Holder.Command, e.Holder.PID, e.Holder.Hostname, e.Holder.StartedAt.Local().Format("2006-01-02 15:04:05"))
+}
+
+// RunLockFile is the lock file's name in the data directory's data
+// folder. It describes a running process, so backups leave it out.
+const RunLockFile = "run.lock"
+
+func runLockPath(dataDir string) string {
+	return filepath.Join(dataDir, "data", RunLockFile)
+}
+
+// AcquireRunLock takes the lock for command, waiting up to wait for the
+// command holding it to finish.
+func AcquireRunLock(dataDir string, command string, wait time.Duration) (*RunLock, error) {
+	path := runLockPath(dataDir)
+	hostname, _ := os.Hostname()
+	me := LockHolder{PID: os.Getpid(), Hostname: hostname, Command: command, StartedAt: time.Now()}
+	b, err := json.Marshal(me)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			break
+		}
+
+		if !time.Now().Before(deadline) {
+			holder, err := readLockHolder(path)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			return nil, &LockedError{Holder: holder}
+		}
+		time.Sleep(time.Second)
+	}
+
+	// The file is left in place on release, so whoever had it last is
+	// overwritten
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt(b, 0)
+	}
+	if err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, err
+	}
+	return &RunLock{f: f}, nil
+}
+
+func readLockHolder(path string) (LockHolder, error) {
+	var holder LockHolder
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return holder, err
+	}
+	// Between taking the lock and writing to it
+	if len(b) == 0 {
+		return holder, nil
+	}
+	err = json.Unmarshal(b, &holder)
+	if err != nil {
+		return holder, errors.New(fmt.Sprintf("%s is not a lock file, remove it if no plaid-cli is running: %s", path, err))
+	}
+	return holder, nil
+}
+
+// Release releases the lock. The file stays, since removing it could
+// remove one another command just locked.
+func (l *RunLock) Release() error {
+	l.f.Truncate(0)
+	err := unlockFile(l.f)
+	closeErr := l.f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
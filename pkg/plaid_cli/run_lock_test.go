@@ -0,0 +1,101 @@
+package plaid_cli
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func lockDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "data"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRunLockExcludes(t *testing.T) {
+	dir := lockDir(t)
+
+	first, err := AcquireRunLock(dir, "sync-transactions", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = AcquireRunLock(dir, "backfill", 0)
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second acquire: got %v, want a LockedError", err)
+	}
+	if locked.Holder.PID != os.Getpid() || locked.Holder.Command != "sync-transactions" {
+		t.Errorf("holder = %+v, want this process running sync-transactions", locked.Holder)
+	}
+
+	err = first.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := AcquireRunLock(dir, "backfill", 0)
+	if err != nil {
+		t.Fatalf("acquire after release: %s", err)
+	}
+	second.Release()
+}
+
+func TestRunLockWaits(t *testing.T) {
+	dir := lockDir(t)
+
+	first, err := AcquireRunLock(dir, "sync-transactions", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		first.Release()
+	}()
+
+	second, err := AcquireRunLock(dir, "backfill", 5*time.Second)
+	if err != nil {
+		t.Fatalf("acquire while waiting for release: %s", err)
+	}
+	second.Release()
+}
+
+func TestRunLockIgnoresLeftoverFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"crashed holder", `{"pid":999999,"hostname":"elsewhere","command":"sync-transactions"}`},
+		{"empty", ""},
+		{"garbage", "not json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := lockDir(t)
+			err := ioutil.WriteFile(runLockPath(dir), []byte(tt.contents), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l, err := AcquireRunLock(dir, "sync-transactions", 0)
+			if err != nil {
+				t.Fatalf("acquire over a leftover file: %s", err)
+			}
+			defer l.Release()
+
+			holder, err := readLockHolder(runLockPath(dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if holder.PID != os.Getpid() {
+				t.Errorf("lock file says %+v, want this process", holder)
+			}
+		})
+	}
+}
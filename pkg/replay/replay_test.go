@@ -0,0 +1,134 @@
+package replay
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func post(t *testing.T, transport http.RoundTripper, body string) (string, error) {
+	t.Helper()
+	req, err := http.NewRequest("POST", "https://sandbox.plaid.com/transactions/get", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), nil
+}
+
+// record records a response for each body, numbered in order.
+func record(t *testing.T, dir string, exchanges [][2]string) {
+	t.Helper()
+	responses := make(map[string][]string)
+	for _, e := range exchanges {
+		responses[e[0]] = append(responses[e[0]], e[1])
+	}
+	recorder := &Transport{Dir: dir, Base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		b, _ := ioutil.ReadAll(req.Body)
+		body := responses[string(b)][0]
+		responses[string(b)] = responses[string(b)][1:]
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+	})}
+	for _, e := range exchanges {
+		_, err := post(t, recorder, e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+const (
+	item1 = `{"access_token":"access-sandbox-1111","start_date":"2024-01-01","end_date":"2024-03-01"}`
+	item2 = `{"access_token":"access-sandbox-2222","start_date":"2024-01-01","end_date":"2024-03-01"}`
+)
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	record(t, dir, [][2]string{
+		{item1, `{"transactions":["first"]}`},
+		{item1, `{"transactions":["second"]}`},
+		{item2, `{"transactions":["other item"]}`},
+	})
+
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{name: "first recording", body: item1, want: `{"transactions":["first"]}`},
+		{name: "in recorded order", body: item1, want: `{"transactions":["second"]}`},
+		{name: "last one repeated", body: item1, want: `{"transactions":["second"]}`},
+		{name: "other access token", body: item2, want: `{"transactions":["other item"]}`},
+		{
+			name: "dates ignored",
+			body: strings.ReplaceAll(item2, "2024-03-01", "2024-03-02"),
+			want: `{"transactions":["other item"]}`,
+		},
+		{
+			name:    "unrecorded access token",
+			body:    strings.ReplaceAll(item1, "1111", "3333"),
+			wantErr: true,
+		},
+		{
+			name:    "other request",
+			body:    strings.ReplaceAll(item1, `"start_date"`, `"count":10,"start_date"`),
+			wantErr: true,
+		},
+	}
+
+	replayer := &Transport{Dir: dir, Replay: true}
+	for _, tt := range tests {
+		got, err := post(t, replayer, tt.body)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %s, want no fixture", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecordRedacts(t *testing.T) {
+	dir := t.TempDir()
+	record(t, dir, [][2]string{
+		{item1, `{"numbers":{"ach":[{"account":"1111222233330000","routing":"011401533"}]}}`},
+	})
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("got fixtures %v (%v), want one", paths, err)
+	}
+	b, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"access-sandbox-1111", "1111222233330000", "011401533"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("fixture contains %s:\n%s", secret, b)
+		}
+	}
+}
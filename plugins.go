@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/landakram/plaid-cli/pkg/pipeline"
+	"github.com/spf13/viper"
+)
+
+// PluginConfig registers an external sync destination, e.g.
+//
+//	[[plugins]]
+//	name = "ledger"
+//	path = "/usr/local/bin/plaid-ledger"
+//	args = ["--journal", "~/finances.journal"]
+//	options = { account_prefix = "Assets:Bank" }
+//
+// See pipeline.PluginTarget for the protocol.
+type PluginConfig struct {
+	Name    string
+	Path    string
+	Args    []string
+	Options map[string]interface{}
+}
+
+func pluginConfigs() ([]PluginConfig, error) {
+	var plugins []PluginConfig
+	err := viper.UnmarshalKey("plugins", &plugins)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range plugins {
+		if p.Name == "" || p.Path == "" {
+			return nil, errors.New(fmt.Sprintf("plugins entry %d needs a name and a path", i+1))
+		}
+	}
+	return plugins, nil
+}
+
+// ApplyPlugins feeds each configured plugin the same creates, updates and
+// deletes a sync just wrote to Airtable. A plugin that fails is logged and
+// the others still run; the first error is returned.
+func ApplyPlugins(updates []pipeline.AccountUpdate, summary *RunSummary) error {
+	plugins, err := pluginConfigs()
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, config := range plugins {
+		err := summary.Time("plugin "+config.Name, func() error {
+			plugin, err := pipeline.StartPlugin(config.Name, config.Path, config.Args, config.Options)
+			if err != nil {
+				return err
+			}
+			err = pipeline.Apply(plugin, updates, nil)
+			closeErr := plugin.Close()
+			if err != nil {
+				return err
+			}
+			return closeErr
+		})
+		if err != nil {
+			LogError("Plugin failed", err, "plugin", config.Name)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		slog.Debug("Plugin synced", "plugin", config.Name)
+	}
+	return firstErr
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A profile is a separate data directory, with its own tokens, aliases
+// and config.toml, e.g. for each person in a household syncing to their
+// own Airtable base. Profiles live in <root>/profiles/<name>, where root
+// is the DataDir, and the profile's config.toml is layered over the one
+// in root, so shared settings only need to be written once. The default
+// profile is root itself.
+
+const defaultProfile = "default"
+
+var profileNamePattern = regexp.MustCompile(`^[\w-]+$`)
+
+// ProfileName picks the profile from --profile, PLAID_CLI_PROFILE or the
+// last `profile use`, in that order. Flags are parsed by hand because
+// the data directory is loaded before cobra runs.
+func ProfileName(args []string, root string) string {
+	if name, ok := flagFromArgs(args, "profile"); ok {
+		return name
+	}
+
+	if name := os.Getenv("PLAID_CLI_PROFILE"); name != "" {
+		return name
+	}
+
+	b, err := ioutil.ReadFile(currentProfilePath(root))
+	if err == nil && len(strings.TrimSpace(string(b))) > 0 {
+		return strings.TrimSpace(string(b))
+	}
+	return defaultProfile
+}
+
+// ProfileDir is the data directory of the named profile.
+func ProfileDir(root string, name string) string {
+	if name == "" || name == defaultProfile {
+		return root
+	}
+	return filepath.Join(root, "profiles", name)
+}
+
+func currentProfilePath(root string) string {
+	return filepath.Join(root, "profile")
+}
+
+// CheckProfile makes sure a profile exists before its data directory is
+// created by loading it, so a typo doesn't silently start a new one.
+func CheckProfile(root string, name string) error {
+	if name == "" || name == defaultProfile {
+		return nil
+	}
+	if !profileNamePattern.MatchString(name) {
+		return errors.New(fmt.Sprintf("Invalid profile name: %s. Valid characters: [0-9A-Za-z_-]", name))
+	}
+	if _, err := os.Stat(ProfileDir(root, name)); os.IsNotExist(err) {
+		return errors.New(fmt.Sprintf("No profile named %s. Create it with `plaid-cli profile create %s`.", name, name))
+	}
+	return nil
+}
+
+// ListProfiles returns the default profile and every created one.
+func ListProfiles(root string) ([]string, error) {
+	profiles := []string{defaultProfile}
+
+	entries, err := ioutil.ReadDir(filepath.Join(root, "profiles"))
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && profileNamePattern.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return append(profiles, names...), nil
+}
+
+const profileConfigTemplate = `# Settings for the %s profile, layered over %s.
+# Uncomment whatever differs from the shared config.
+
+# [plaid]
+# client_id = ""
+# secret = ""
+# environment = "production"
+
+# [airtable]
+# token = ""
+# base_id = ""
+`
+
+// CreateProfile creates the profile's data directory and a config.toml
+// to fill in, returning the directory.
+func CreateProfile(root string, name string) (string, error) {
+	if name == defaultProfile {
+		return "", errors.New("The default profile always exists")
+	}
+	if !profileNamePattern.MatchString(name) {
+		return "", errors.New(fmt.Sprintf("Invalid profile name: %s. Valid characters: [0-9A-Za-z_-]", name))
+	}
+
+	dir := ProfileDir(root, name)
+	if _, err := os.Stat(dir); err == nil {
+		return "", errors.New(fmt.Sprintf("Profile %s already exists", name))
+	}
+
+	err := os.MkdirAll(filepath.Join(dir, "data"), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	config := fmt.Sprintf(profileConfigTemplate, name, filepath.Join(root, "config.toml"))
+	err = ioutil.WriteFile(filepath.Join(dir, "config.toml"), []byte(config), 0600)
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// UseProfile makes name the profile used when neither --profile nor
+// PLAID_CLI_PROFILE is set.
+func UseProfile(root string, name string) error {
+	err := CheckProfile(root, name)
+	if err != nil {
+		return err
+	}
+	if name == defaultProfile {
+		err := os.Remove(currentProfilePath(root))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return ioutil.WriteFile(currentProfilePath(root), []byte(name+"\n"), 0600)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Progress bars are drawn on stderr when it is a terminal and logs are
+// plain text. Otherwise, e.g. under cron or with --log-format json,
+// progress is logged every progressLogInterval instead.
+var showProgressBars = isatty.IsTerminal(os.Stderr.Fd())
+
+const progressLogInterval = 10 * time.Second
+
+const progressBarWidth = 30
+
+// Bars being drawn, one per line, e.g. one per item while downloading
+// in parallel
+var (
+	progressMu    sync.Mutex
+	progressBars  []*Progress
+	progressDrawn int
+)
+
+// Progress tracks one long running step, e.g. downloading an item's
+// transactions.
+type Progress struct {
+	Label    string
+	ETA      *ETA
+	finished bool
+	loggedAt time.Time
+}
+
+// StartProgress shows a bar for label, or logs that it started.
+func StartProgress(label string, eta *ETA) *Progress {
+	p := &Progress{Label: label, ETA: eta, loggedAt: time.Now()}
+	if !showProgressBars {
+		slog.Info(label)
+		return p
+	}
+
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressBars = append(progressBars, p)
+	drawProgress()
+	return p
+}
+
+// Step records n more units of work done.
+func (p *Progress) Step(n int) {
+	p.update(func() {
+		p.ETA.Step(n)
+	})
+}
+
+// Update sets how much of how much work is done, for when the total is
+// only learned along the way, as when paging.
+func (p *Progress) Update(done int, total int) {
+	p.update(func() {
+		p.ETA.Done = done
+		p.ETA.Total = total
+	})
+}
+
+// Finish leaves the bar at its final state. Once every bar is finished,
+// the next ones start on fresh lines.
+func (p *Progress) Finish() {
+	if !showProgressBars {
+		if !p.finished {
+			p.finished = true
+			slog.Info(p.Label, "done", p.ETA.Done, "total", p.ETA.Total)
+		}
+		return
+	}
+
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	p.finished = true
+	drawProgress()
+	for _, bar := range progressBars {
+		if !bar.finished {
+			return
+		}
+	}
+	progressBars = nil
+	progressDrawn = 0
+}
+
+// update applies change and redraws, or logs if it has been a while.
+// Logging happens outside progressMu, since logs are written through
+// progressWriter.
+func (p *Progress) update(change func()) {
+	progressMu.Lock()
+	change()
+	if showProgressBars {
+		drawProgress()
+		progressMu.Unlock()
+		return
+	}
+	log := time.Since(p.loggedAt) >= progressLogInterval
+	if log {
+		p.loggedAt = time.Now()
+	}
+	done, total, remaining := p.ETA.Done, p.ETA.Total, p.ETA.Remaining()
+	progressMu.Unlock()
+
+	if log {
+		slog.Info(p.Label, "done", done, "total", total, "eta", remaining.Round(time.Second))
+	}
+}
+
+// drawProgress redraws every bar in place. progressMu must be held.
+func drawProgress() {
+	var b strings.Builder
+	if progressDrawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", progressDrawn)
+	}
+	for _, bar := range progressBars {
+		fmt.Fprintf(&b, "\r\x1b[K%s\n", bar)
+	}
+	os.Stderr.WriteString(b.String())
+	progressDrawn = len(progressBars)
+}
+
+// progressWriter writes logs above the bars, so they don't draw over
+// each other.
+type progressWriter struct{}
+
+func (progressWriter) Write(b []byte) (int, error) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if progressDrawn == 0 {
+		return os.Stderr.Write(b)
+	}
+
+	// Clear the bars, write the log, and draw them again below it
+	fmt.Fprintf(os.Stderr, "\x1b[%dA\x1b[J", progressDrawn)
+	n, err := os.Stderr.Write(b)
+	progressDrawn = 0
+	drawProgress()
+	return n, err
+}
+
+// String renders the bar, e.g.
+// "Chase (chase)  [=========>          ] 120/450, ETA 12s".
+func (p *Progress) String() string {
+	filled := 0
+	if p.finished {
+		filled = progressBarWidth
+	} else if p.ETA.Total > 0 {
+		filled = p.ETA.Done * progressBarWidth / p.ETA.Total
+	}
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	if p.finished {
+		return fmt.Sprintf("%-30s [%s] %d/%d, done", p.Label, bar, p.ETA.Done, p.ETA.Total)
+	}
+	return fmt.Sprintf("%-30s [%s] %s", p.Label, bar, p.ETA)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/spf13/viper"
+)
+
+// Plaid errors WithRelinkOnAuthError recovers from, by the recovery.*
+// setting that says how
+var recoveryClasses = map[string]string{
+	"ITEM_LOGIN_REQUIRED":        "login_required",
+	"PENDING_EXPIRATION":         "pending_expiration",
+	"INVALID_ACCESS_TOKEN":       "invalid_access_token",
+	"PRODUCT_NOT_READY":          "product_not_ready",
+	"INSTITUTION_DOWN":           "institution_down",
+	"INSTITUTION_NOT_RESPONDING": "institution_down",
+}
+
+// Ways to recover, set per class, e.g. recovery.institution_down = "fail"
+const (
+	// Relink the item in update mode and run the action again
+	RecoverRelink = "relink"
+	// Ask for the institution to be linked again as a new item, with
+	// `plaid-cli link --replace`
+	RecoverLink = "link"
+	// Wait recovery.retry_delay and run the action again, up to
+	// recovery.retries times
+	RecoverRetry = "retry"
+	// Log a warning and carry on without the item
+	RecoverSkip = "skip"
+	// Return the error
+	RecoverFail = "fail"
+)
+
+// WithRelinkOnAuthError runs action, recovering from Plaid errors that
+// have a recovery.* setting. By default an expired login or consent is
+// relinked, an invalid access token is reported with how to link the
+// institution again, a product that isn't ready is retried and an
+// institution that is down is skipped.
+func WithRelinkOnAuthError(ctx context.Context, item idAndAlias, data *plaid_cli.Data, linker *plaid_cli.Linker, action func() error) error {
+	label := ItemLabel(data, item.id)
+	relinked := false
+	retries := 0
+	for {
+		err := action()
+		e, perr := plaid.ToPlaidError(err)
+		if err == nil || perr != nil {
+			return err
+		}
+		class, ok := recoveryClasses[e.ErrorCode]
+		if !ok {
+			return err
+		}
+
+		switch recovery := viper.GetString("recovery." + class); recovery {
+		case RecoverRelink:
+			if relinked {
+				return err
+			}
+			LogError("Login expired, relinking", err, "item", label)
+			Notify(NotifyEvent{
+				Event:   EventRelink,
+				Item:    label,
+				Message: fmt.Sprintf("Login expired for %s, it needs to be relinked", label),
+			})
+
+			err = linker.Relink(ctx, item.id, viper.GetString("link.port"))
+			if err != nil {
+				return &AuthError{err}
+			}
+			relinked = true
+			slog.Info("Re-running action", "item", label)
+		case RecoverLink:
+			Notify(NotifyEvent{
+				Event:   EventRelink,
+				Item:    label,
+				Message: fmt.Sprintf("The access token for %s is invalid, it needs to be linked again", label),
+			})
+			return &AuthError{errors.New(fmt.Sprintf("%s. Link the institution again with `plaid-cli link --replace %s`", e.ErrorMessage, itemRef(data, item.id)))}
+		case RecoverRetry:
+			if retries >= viper.GetInt("recovery.retries") {
+				return err
+			}
+			retries++
+			delay := viper.GetDuration("recovery.retry_delay")
+			slog.Info("Plaid isn't ready, retrying", "item", label, "error_code", e.ErrorCode, "retry", retries, "delay", delay)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		case RecoverSkip:
+			slog.Warn("Skipping item", "item", label, "error_code", e.ErrorCode, "error", e.ErrorMessage)
+			recordItemResult(label, errors.New(e.ErrorCode))
+			return nil
+		case RecoverFail:
+			return err
+		default:
+			return errors.New(fmt.Sprintf("Invalid recovery.%s: %s. Valid: relink, link, retry, skip, fail", class, recovery))
+		}
+	}
+}
+
+// ReplaceItem moves an item's alias to the item that replaces it, after
+// linking the institution again, and forgets the old item.
+func ReplaceItem(data *plaid_cli.Data, old idAndAlias, itemID string) error {
+	delete(data.Tokens, old.id)
+	delete(data.Institutions, old.id)
+	if old.alias != "" {
+		delete(data.BackAliases, old.id)
+		data.Aliases[old.alias] = itemID
+		data.BackAliases[itemID] = old.alias
+	}
+	return data.Save()
+}
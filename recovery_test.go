@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+func TestWithRelinkOnAuthError(t *testing.T) {
+	deadline := errors.New("run.deadline passed")
+
+	tests := []struct {
+		name string
+		// recovery.* settings
+		config map[string]interface{}
+		// What each run of the action returns, the last one repeating
+		errs []error
+		// Hosted Link, with the context canceled before Link finishes
+		canceled        bool
+		linkTokenCreate error
+		runs            int
+		wantErr         string
+		wantAuth        bool
+		wantCause       error
+	}{
+		{name: "success", errs: []error{nil}, runs: 1},
+		{name: "not a Plaid error", errs: []error{errors.New("boom")}, runs: 1, wantErr: "boom"},
+		{name: "no recovery for the code", errs: []error{plaidError("RATE_LIMIT_EXCEEDED")}, runs: 1, wantErr: "400 Bad Request"},
+		{
+			name:   "retried until ready",
+			config: map[string]interface{}{"recovery.product_not_ready": RecoverRetry, "recovery.retries": 2, "recovery.retry_delay": time.Duration(0)},
+			errs:   []error{plaidError("PRODUCT_NOT_READY"), plaidError("PRODUCT_NOT_READY"), nil},
+			runs:   3,
+		},
+		{
+			name:    "out of retries",
+			config:  map[string]interface{}{"recovery.product_not_ready": RecoverRetry, "recovery.retries": 2, "recovery.retry_delay": time.Duration(0)},
+			errs:    []error{plaidError("PRODUCT_NOT_READY")},
+			runs:    3,
+			wantErr: "400 Bad Request",
+		},
+		{
+			name:   "institution down, skipped",
+			config: map[string]interface{}{"recovery.institution_down": RecoverSkip},
+			errs:   []error{plaidError("INSTITUTION_NOT_RESPONDING")},
+			runs:   1,
+		},
+		{
+			name:     "invalid access token, linked again",
+			config:   map[string]interface{}{"recovery.invalid_access_token": RecoverLink},
+			errs:     []error{plaidError("INVALID_ACCESS_TOKEN")},
+			runs:     1,
+			wantErr:  "plaid-cli link --replace bank",
+			wantAuth: true,
+		},
+		{
+			name:    "fail",
+			config:  map[string]interface{}{"recovery.login_required": RecoverFail},
+			errs:    []error{plaidError("ITEM_LOGIN_REQUIRED")},
+			runs:    1,
+			wantErr: "400 Bad Request",
+		},
+		{
+			name:    "invalid setting",
+			config:  map[string]interface{}{"recovery.pending_expiration": "wait"},
+			errs:    []error{plaidError("PENDING_EXPIRATION")},
+			runs:    1,
+			wantErr: "Invalid recovery.pending_expiration: wait",
+		},
+		{
+			name:            "relink fails",
+			config:          map[string]interface{}{"recovery.login_required": RecoverRelink},
+			errs:            []error{plaidError("ITEM_LOGIN_REQUIRED")},
+			linkTokenCreate: errors.New("link token refused"),
+			runs:            1,
+			wantErr:         "link token refused",
+			wantAuth:        true,
+		},
+		{
+			name:      "relink stops at the deadline",
+			config:    map[string]interface{}{"recovery.login_required": RecoverRelink},
+			errs:      []error{plaidError("ITEM_LOGIN_REQUIRED")},
+			canceled:  true,
+			runs:      1,
+			wantAuth:  true,
+			wantCause: deadline,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.config {
+				setConfig(t, key, value)
+			}
+
+			data := &plaid_cli.Data{
+				Tokens:      map[string]string{"item": "access-token"},
+				BackAliases: map[string]string{"item": "bank"},
+			}
+			client := &fakePlaid{linkTokenCreate: func(req plaid.LinkTokenCreateRequest) (plaid.LinkTokenCreateResponse, error) {
+				if tt.linkTokenCreate != nil {
+					return plaid.LinkTokenCreateResponse{}, tt.linkTokenCreate
+				}
+				resp := plaid.LinkTokenCreateResponse{LinkToken: "link-token"}
+				resp.SetHostedLinkUrl("https://hosted.plaid.com/link/test")
+				return resp, nil
+			}}
+			linker := plaid_cli.NewLinker(data, client, nil, "en")
+			linker.Hosted = true
+
+			ctx := context.Background()
+			if tt.canceled {
+				var cancel context.CancelCauseFunc
+				ctx, cancel = context.WithCancelCause(ctx)
+				cancel(deadline)
+			}
+
+			runs := 0
+			err := WithRelinkOnAuthError(ctx, idAndAlias{id: "item", alias: "bank"}, data, linker, func() error {
+				err := tt.errs[min(runs, len(tt.errs)-1)]
+				runs++
+				return err
+			})
+
+			if runs != tt.runs {
+				t.Errorf("ran the action %d times, want %d", runs, tt.runs)
+			}
+			if tt.wantErr == "" && tt.wantCause == nil {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("want an error")
+			}
+			if tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+			if tt.wantCause != nil && !errors.Is(err, tt.wantCause) {
+				t.Errorf("err = %v, want it caused by %v", err, tt.wantCause)
+			}
+			var authErr *AuthError
+			if errors.As(err, &authErr) != tt.wantAuth {
+				t.Errorf("err = %#v, want an AuthError: %v", err, tt.wantAuth)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/spf13/viper"
+)
+
+// ItemToRelink is an item whose login expired or whose consent is about
+// to, with what Plaid reported.
+type ItemToRelink struct {
+	Item   idAndAlias
+	Reason error
+}
+
+// ItemsToRelink checks every item with /item/get, returning those that
+// need relinking now or whose consent expires within the given time.
+// Items that can't be checked for other reasons are logged and skipped.
+func ItemsToRelink(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, within time.Duration) []ItemToRelink {
+	var itemIDs []string
+	for itemID := range data.Tokens {
+		itemIDs = append(itemIDs, itemID)
+	}
+	sort.Slice(itemIDs, func(i, j int) bool {
+		return ItemLabel(data, itemIDs[i]) < ItemLabel(data, itemIDs[j])
+	})
+
+	var items []ItemToRelink
+	for _, itemID := range itemIDs {
+		relink, err := ItemHealth(ctx, client, data, itemID, within)
+		if err != nil && !relink {
+			ItemFailed("Cannot check item", err, ItemLabel(data, itemID))
+			continue
+		}
+		if relink {
+			items = append(items, ItemToRelink{Item: idAndAlias{id: itemID, alias: data.BackAliases[itemID]}, Reason: err})
+		}
+	}
+	return items
+}
+
+// RelinkAll relinks items one at a time, so each Link page is finished
+// before the next opens. It returns how many items were relinked.
+func RelinkAll(ctx context.Context, data *plaid_cli.Data, linker *plaid_cli.Linker, items []ItemToRelink) int {
+	port := viper.GetString("link.port")
+
+	relinked := 0
+	for i, item := range items {
+		label := ItemLabel(data, item.Item.id)
+		slog.Info(fmt.Sprintf("Relinking item %d of %d", i+1, len(items)), "item", label, "reason", item.Reason.Error())
+		err := linker.Relink(ctx, item.Item.id, port)
+		if err != nil {
+			ItemFailed("Cannot relink", err, label)
+			continue
+		}
+		slog.Info("Institution relinked", "item", label)
+		ItemSucceeded(label)
+		relinked++
+	}
+	return relinked
+}
+
+// SendRelinkURL creates a Hosted Link page to relink itemID on and sends
+// it to notify.hooks, so the item can be fixed from wherever the
+// notification is read.
+func SendRelinkURL(ctx context.Context, data *plaid_cli.Data, linker *plaid_cli.Linker, itemID string, reason string) error {
+	label := ItemLabel(data, itemID)
+	url, err := linker.HostedRelinkURL(ctx, data.Tokens[itemID])
+	if err != nil {
+		return err
+	}
+	slog.Info("Sending relink URL", "item", label, "reason", reason)
+	Notify(NotifyEvent{
+		Event:   EventRelink,
+		Item:    label,
+		URL:     url,
+		Message: fmt.Sprintf("%s for %s. Relink it at %s", reason, label, url),
+	})
+	return nil
+}
+
+// SetItemWebhooks points the items' webhooks at url, for items linked
+// before link.webhook was set. It returns how many were updated.
+func SetItemWebhooks(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, items []idAndAlias, url string) int {
+	updated := 0
+	for _, item := range items {
+		if item.id == sandboxItemID {
+			updated++
+			continue
+		}
+		label := ItemLabel(data, item.id)
+		req := plaid.ItemWebhookUpdateRequest{AccessToken: data.Tokens[item.id]}
+		req.SetWebhook(url)
+		_, err := client.ItemWebhookUpdate(ctx, req)
+		if err != nil {
+			ItemFailed("Cannot set webhook", err, label)
+			continue
+		}
+		slog.Info("Webhook set", "item", label)
+		ItemSucceeded(label)
+		updated++
+	}
+	return updated
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// ResolveItem accepts an item ID or alias and returns the item it refers
+// to, or an error suggesting close matches.
+func ResolveItem(data *plaid_cli.Data, itemOrAlias string) (idAndAlias, error) {
+	if itemID, ok := data.Aliases[itemOrAlias]; ok {
+		return idAndAlias{itemID, itemOrAlias}, nil
+	}
+
+	if _, ok := data.Tokens[itemOrAlias]; ok {
+		return idAndAlias{itemOrAlias, data.BackAliases[itemOrAlias]}, nil
+	}
+
+	return idAndAlias{}, unknownItemError(data, itemOrAlias)
+}
+
+// ResolveItems is like ResolveItem but also accepts "all", which returns
+// every linked item.
+func ResolveItems(data *plaid_cli.Data, itemOrAlias string) ([]idAndAlias, error) {
+	if itemOrAlias != "all" {
+		item, err := ResolveItem(data, itemOrAlias)
+		if err != nil {
+			return nil, err
+		}
+		return []idAndAlias{item}, nil
+	}
+
+	var items []idAndAlias
+	for itemID := range data.Tokens {
+		items = append(items, idAndAlias{itemID, data.BackAliases[itemID]})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].id < items[j].id
+	})
+	return items, nil
+}
+
+func unknownItemError(data *plaid_cli.Data, itemOrAlias string) error {
+	var aliases []string
+	var suggestions []string
+	for alias := range data.Aliases {
+		aliases = append(aliases, alias)
+		if levenshtein(strings.ToLower(alias), strings.ToLower(itemOrAlias)) <= 2 {
+			suggestions = append(suggestions, alias)
+		}
+	}
+	sort.Strings(aliases)
+	sort.Strings(suggestions)
+
+	msg := fmt.Sprintf("Unknown item ID or alias `%s`.", itemOrAlias)
+	if len(suggestions) > 0 {
+		msg += fmt.Sprintf(" Did you mean %s?", strings.Join(suggestions, ", "))
+	}
+	if len(aliases) > 0 {
+		msg += fmt.Sprintf(" Known aliases: %s.", strings.Join(aliases, ", "))
+	} else {
+		msg += " No aliases are set up; run `plaid-cli tokens` to see item IDs."
+	}
+	return errors.New(msg)
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j] + 1
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+			if prev[j-1]+cost < curr[j] {
+				curr[j] = prev[j-1] + cost
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// OwnedItems narrows items to the ones listed in household.items, when
+// set, so machines sharing an Airtable base each sync their own items.
+func OwnedItems(data *plaid_cli.Data, items []idAndAlias) ([]idAndAlias, error) {
+	owned := viper.GetStringSlice("household.items")
+	if len(owned) == 0 {
+		return items, nil
+	}
+
+	ownedIDs := make(map[string]struct{})
+	for _, itemOrAlias := range owned {
+		item, err := ResolveItem(data, itemOrAlias)
+		if err != nil {
+			return nil, err
+		}
+		ownedIDs[item.id] = struct{}{}
+	}
+
+	var ret []idAndAlias
+	for _, item := range items {
+		if _, ok := ownedIDs[item.id]; ok {
+			ret = append(ret, item)
+		}
+	}
+	return ret, nil
+}
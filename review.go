@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/viper"
+)
+
+// `plaid-cli review` walks through transactions without a CategoryLookup
+// and asks for a category for each, picked from the Categories table.
+
+type ReviewFields struct {
+	PlaidID     string
+	DateTime    string
+	Name        string
+	Amount      float64
+	AccountID   string `json:"AccountIDDedupe"`
+	PFCDetailed string
+}
+
+type ReviewRecord struct {
+	airtable.Record
+	Fields ReviewFields
+}
+
+type CategoryLookupFields struct {
+	CategoryLookup airtable.RecordLink
+}
+
+type CategoryLookupRecord struct {
+	airtable.Record
+	Fields CategoryLookupFields
+}
+
+// Picked categories are written once this many are waiting, one
+// Airtable batch
+const reviewBatchSize = 10
+
+const (
+	reviewSkip = "(skip)"
+	reviewQuit = "(quit)"
+)
+
+// UncategorizedTransactions returns synced transactions dated on or after
+// since with an empty CategoryLookup, oldest first.
+func UncategorizedTransactions(since time.Time) ([]ReviewRecord, error) {
+	filter := fmt.Sprintf("AND({After Plaid Issues} = 1, {CategoryLookup} = '', NOT(IS_BEFORE({DateTime}, '%s')))", since.Format(DateLayout))
+	if viper.GetBool("sync.soft_delete") {
+		filter = fmt.Sprintf("AND(%s, NOT({Removed}))", filter)
+	}
+
+	var records []ReviewRecord
+	err := NewAirtableClient().Table(AirtableTransactionsTable()).List(&records, &airtable.Options{
+		Fields: []string{"PlaidID", "DateTime", "Name", "Amount", "AccountIDDedupe", "PFCDetailed"},
+		Filter: filter,
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Fields.DateTime < records[j].Fields.DateTime
+	})
+	return records, err
+}
+
+// ReviewTransactions asks for a category for each record, writing the
+// picks back in batches, and returns how many were categorized.
+func ReviewTransactions(records []ReviewRecord) (int, error) {
+	var categories []CategoryRecord
+	err := NewAirtableClient().Table("Categories").List(&categories, &airtable.Options{Fields: []string{"Name"}})
+	if err != nil {
+		return 0, err
+	}
+	if len(categories) == 0 {
+		return 0, errors.New("No categories to pick from. Add some to the Categories table, or run `plaid-cli categories sync`")
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Fields.Name < categories[j].Fields.Name
+	})
+
+	items := []string{reviewSkip, reviewQuit}
+	for _, c := range categories {
+		items = append(items, c.Fields.Name)
+	}
+
+	var pending []CategoryLookupRecord
+	categorized := 0
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		err := NewAirtableClient().Table(AirtableTransactionsTable()).UpdateAll(pending, nil)
+		if err != nil {
+			return err
+		}
+		categorized += len(pending)
+		pending = nil
+		return nil
+	}
+
+	for i, r := range records {
+		fmt.Fprintf(os.Stderr, "\n[%d/%d] %s  %s  %.2f  %s\n", i+1, len(records), r.Fields.DateTime, r.Fields.Name, r.Fields.Amount, r.Fields.PFCDetailed)
+
+		prompt := promptui.Select{
+			Label:             "Category (type to search)",
+			Items:             items,
+			Size:              10,
+			StartInSearchMode: true,
+			Searcher: func(input string, index int) bool {
+				return fuzzyMatch(input, items[index])
+			},
+		}
+		index, _, err := prompt.Run()
+		if err == promptui.ErrInterrupt || (err == nil && items[index] == reviewQuit) {
+			break
+		}
+		if err != nil {
+			flush()
+			return categorized, err
+		}
+		if items[index] == reviewSkip {
+			continue
+		}
+
+		update := CategoryLookupRecord{Fields: CategoryLookupFields{
+			CategoryLookup: airtable.RecordLink{categories[index-2].ID},
+		}}
+		update.ID = r.ID
+		pending = append(pending, update)
+		if len(pending) >= reviewBatchSize {
+			err := flush()
+			if err != nil {
+				return categorized, err
+			}
+			slog.Debug("Saved categories", "count", categorized)
+		}
+	}
+
+	return categorized, flush()
+}
+
+// fuzzyMatch reports whether the letters of input appear in s in order,
+// ignoring case and spaces, e.g. "grcr" matches "Groceries".
+func fuzzyMatch(input string, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(strings.ReplaceAll(input, " ", "")) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/pipeline"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// PipelineRules are the rules from the config file that shape what Sync
+// writes: names.rules, split.rules and the category mapping.
+type PipelineRules struct {
+	Names   *NameNormalizer
+	Splits  []SplitRule
+	Mapping CategoryMapping
+}
+
+func LoadPipelineRules() (PipelineRules, error) {
+	var rules PipelineRules
+	var err error
+
+	rules.Names, err = NewNameNormalizer()
+	if err != nil {
+		return rules, err
+	}
+	rules.Splits, err = splitRules()
+	if err != nil {
+		return rules, err
+	}
+	rules.Mapping, err = LoadCategoryMapping()
+	return rules, err
+}
+
+// RuleHit is how many records a rule matched. Rule is its match pattern,
+// or the PFC for the category mapping.
+type RuleHit struct {
+	Rule string
+	Hits int
+}
+
+// RuleHits has a RuleHit per rule, in config order, or by PFC for the
+// category mapping.
+type RuleHits struct {
+	Names   []RuleHit
+	Splits  []RuleHit
+	Mapping []RuleHit
+	// PFC to how many records have it but no mapping
+	Unmapped map[string]int
+}
+
+// CountRuleHits counts the records each rule matches, the first matching
+// one winning as when the rules are applied. Names rules see the name
+// Plaid returned, split rules the name after them, and the mapping counts
+// records whether or not they already have a category.
+func (r PipelineRules) CountRuleHits(records []TransactionRecord) RuleHits {
+	hits := RuleHits{Unmapped: make(map[string]int)}
+
+	var names []int
+	if r.Names != nil {
+		names = make([]int, len(r.Names.rules))
+	}
+	splits := make([]int, len(r.Splits))
+	mapping := make(map[string]int)
+	for pfc := range r.Mapping {
+		mapping[pfc] = 0
+	}
+
+	for _, record := range records {
+		f := record.Fields
+
+		if r.Names != nil {
+			raw := f.RawName
+			if raw == "" {
+				raw = f.Name
+			}
+			if _, i := r.Names.normalize(raw); i >= 0 {
+				names[i]++
+			}
+		}
+
+		if !pipeline.IsPart(f.PlaidID) {
+			for i, rule := range r.Splits {
+				if rule.pattern.MatchString(f.Name) {
+					splits[i]++
+					break
+				}
+			}
+		}
+
+		if pfc, ok := r.Mapping.match(f); ok {
+			mapping[pfc]++
+		} else if pfc := f.PFCDetailed; pfc != "" {
+			hits.Unmapped[pfc]++
+		} else if pfc := f.PFCPrimary; pfc != "" {
+			hits.Unmapped[pfc]++
+		}
+	}
+
+	for i, n := range names {
+		hits.Names = append(hits.Names, RuleHit{Rule: r.Names.rules[i].String(), Hits: n})
+	}
+	for i, n := range splits {
+		hits.Splits = append(hits.Splits, RuleHit{Rule: r.Splits[i].Match, Hits: n})
+	}
+	for pfc, n := range mapping {
+		hits.Mapping = append(hits.Mapping, RuleHit{Rule: pfc, Hits: n})
+	}
+	sort.Slice(hits.Mapping, func(i, j int) bool {
+		return hits.Mapping[i].Rule < hits.Mapping[j].Rule
+	})
+	return hits
+}
+
+// RuleStats is how many of the transactions synced to Airtable each rule
+// in the config file matches, so rules that never do can be removed.
+type RuleStats struct {
+	Records    int
+	Hits       RuleHits
+	Deductible []RuleHit
+}
+
+// NewRuleStats counts rule hits over the Airtable transactions dated on
+// or after since. Unlike the other rules, every matching tax.deductible
+// rule counts, since any of them makes a transaction deductible.
+func NewRuleStats(data *plaid_cli.Data, since time.Time) (RuleStats, error) {
+	var stats RuleStats
+
+	rules, err := LoadPipelineRules()
+	if err != nil {
+		return stats, &ConfigError{err}
+	}
+	deductible, err := deductibleRules()
+	if err != nil {
+		return stats, &ConfigError{err}
+	}
+
+	categories, err := FetchAirtableCategories()
+	if err != nil {
+		return stats, err
+	}
+	categoryNames := make(map[string]string)
+	for _, c := range categories {
+		categoryNames[c.ID] = c.Fields.Name
+	}
+
+	filter := fmt.Sprintf("AND({After Plaid Issues} = 1, NOT(IS_BEFORE({DateTime}, '%s')))", since.Format(DateLayout))
+	if viper.GetBool("sync.soft_delete") {
+		filter = fmt.Sprintf("AND(%s, NOT({Removed}))", filter)
+	}
+	fields := []string{"PlaidID", "Name", "AccountIDDedupe", "PFCPrimary", "PFCDetailed", "CategoryLookup"}
+	// Bases that never normalized names may not have the column
+	if rules.Names != nil {
+		fields = append(fields, "RawName")
+	}
+
+	var records []TransactionRecord
+	err = NewAirtableClient().Table(AirtableTransactionsTable()).List(&records, &airtable.Options{Fields: fields, Filter: filter})
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Records = len(records)
+	stats.Hits = rules.CountRuleHits(records)
+
+	hits := make([]int, len(deductible))
+	for _, r := range records {
+		f := r.Fields
+		t := TaxTransaction{
+			Name:        f.Name,
+			AccountID:   f.AccountID,
+			PFCPrimary:  f.PFCPrimary,
+			PFCDetailed: f.PFCDetailed,
+		}
+		if len(f.CategoryLookup) > 0 {
+			t.Category = categoryNames[f.CategoryLookup[0]]
+		}
+		for i, rule := range deductible {
+			if rule.matches(data, t) {
+				hits[i]++
+			}
+		}
+	}
+	for i, n := range hits {
+		stats.Deductible = append(stats.Deductible, RuleHit{Rule: deductible[i].String(), Hits: n})
+	}
+	return stats, nil
+}
+
+// Dead returns the rules that matched nothing, as "<section> <rule>".
+func (s RuleStats) Dead() []string {
+	var dead []string
+	sections := []struct {
+		name string
+		hits []RuleHit
+	}{
+		{"names.rules", s.Hits.Names},
+		{"split.rules", s.Hits.Splits},
+		{"categories.mapping", s.Hits.Mapping},
+		{"tax.deductible", s.Deductible},
+	}
+	for _, section := range sections {
+		for _, h := range section.hits {
+			if h.Hits == 0 {
+				dead = append(dead, fmt.Sprintf("%s %s", section.name, h.Rule))
+			}
+		}
+	}
+	return dead
+}
+
+func (s RuleStats) Print() {
+	fmt.Printf("Matched rules against %d transactions\n", s.Records)
+
+	printRuleHits("names.rules", s.Hits.Names)
+	printRuleHits("split.rules", s.Hits.Splits)
+	printRuleHits("categories.mapping", s.Hits.Mapping)
+	printRuleHits("tax.deductible", s.Deductible)
+
+	dead := s.Dead()
+	if len(dead) == 0 {
+		fmt.Println("Every rule matched at least one transaction")
+		return
+	}
+	fmt.Printf("%d rules never matched:\n", len(dead))
+	for _, d := range dead {
+		fmt.Printf("  %s\n", d)
+	}
+}
+
+// String describes the rule by its fields, e.g. `category = "MEDICAL",
+// account = "hsa"`.
+func (r DeductibleRule) String() string {
+	var parts []string
+	for _, field := range []struct{ name, value string }{{"match", r.Match}, {"category", r.Category}, {"account", r.Account}} {
+		if field.value != "" {
+			parts = append(parts, fmt.Sprintf("%s = %q", field.name, field.value))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
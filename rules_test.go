@@ -0,0 +1,138 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/pipeline"
+)
+
+func ruleRecord(id string, name string, rawName string, primary string, detailed string) TransactionRecord {
+	return TransactionRecord{Fields: TransactionFields{
+		PlaidID:     id,
+		Name:        name,
+		RawName:     rawName,
+		PFCPrimary:  primary,
+		PFCDetailed: detailed,
+	}}
+}
+
+func TestCountRuleHits(t *testing.T) {
+	rules := PipelineRules{
+		Names: &NameNormalizer{
+			rules:   []*regexp.Regexp{regexp.MustCompile(`(?i)^amzn`), regexp.MustCompile(`(?i)amazon`), regexp.MustCompile(`^Never$`)},
+			replace: []string{"Amazon", "Amazon (other)", ""},
+		},
+		Splits: []SplitRule{
+			{Match: "(?i)costco", pattern: regexp.MustCompile("(?i)costco")},
+			{Match: "(?i)costco gas", pattern: regexp.MustCompile("(?i)costco gas")},
+		},
+		Mapping: CategoryMapping{
+			"FOOD_AND_DRINK_COFFEE": airtable.RecordLink{"Coffee"},
+			"FOOD_AND_DRINK":        airtable.RecordLink{"Eating Out"},
+			"TRAVEL":                airtable.RecordLink{"Travel"},
+		},
+	}
+	records := []TransactionRecord{
+		// Renamed, so the rule is matched against RawName
+		ruleRecord("a", "Amazon", "AMZN Mktp US", "GENERAL_MERCHANDISE", "GENERAL_MERCHANDISE_ONLINE_MARKETPLACES"),
+		// The first matching rule wins
+		ruleRecord("b", "Amazon (other)", "AMZN Amazon Prime", "GENERAL_MERCHANDISE", "GENERAL_MERCHANDISE_ONLINE_MARKETPLACES"),
+		ruleRecord("c", "Costco Gas", "", "TRANSPORTATION", "TRANSPORTATION_GAS"),
+		// Parts are never split again
+		ruleRecord("c"+pipeline.PartSeparator+"1", "Costco Gas", "", "", ""),
+		ruleRecord("d", "Blue Bottle", "", "FOOD_AND_DRINK", "FOOD_AND_DRINK_COFFEE"),
+		ruleRecord("e", "Burger Joint", "", "FOOD_AND_DRINK", "FOOD_AND_DRINK_FAST_FOOD"),
+	}
+
+	hits := rules.CountRuleHits(records)
+
+	tests := []struct {
+		name string
+		got  []RuleHit
+		want []RuleHit
+	}{
+		{"names.rules", hits.Names, []RuleHit{{`(?i)^amzn`, 2}, {`(?i)amazon`, 0}, {`^Never$`, 0}}},
+		{"split.rules", hits.Splits, []RuleHit{{"(?i)costco", 1}, {"(?i)costco gas", 0}}},
+		{"mapping", hits.Mapping, []RuleHit{{"FOOD_AND_DRINK", 1}, {"FOOD_AND_DRINK_COFFEE", 1}, {"TRAVEL", 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", tt.got, tt.want)
+			}
+			for i := range tt.want {
+				if tt.got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", tt.got, tt.want)
+					break
+				}
+			}
+		})
+	}
+
+	wantUnmapped := map[string]int{"GENERAL_MERCHANDISE_ONLINE_MARKETPLACES": 2, "TRANSPORTATION_GAS": 1}
+	if len(hits.Unmapped) != len(wantUnmapped) {
+		t.Fatalf("Unmapped = %v, want %v", hits.Unmapped, wantUnmapped)
+	}
+	for pfc, n := range wantUnmapped {
+		if hits.Unmapped[pfc] != n {
+			t.Errorf("Unmapped = %v, want %v", hits.Unmapped, wantUnmapped)
+		}
+	}
+}
+
+func TestValidatePipelineAppliesMapping(t *testing.T) {
+	rules := PipelineRules{Mapping: CategoryMapping{
+		"FOOD_AND_DRINK_COFFEE": airtable.RecordLink{"Coffee"},
+		"TRAVEL":                airtable.RecordLink{"Travel"},
+	}}
+	records := []TransactionRecord{
+		ruleRecord("a", "Blue Bottle", "", "FOOD_AND_DRINK", "FOOD_AND_DRINK_COFFEE"),
+		ruleRecord("b", "United", "", "TRAVEL", "TRAVEL_FLIGHTS"),
+		ruleRecord("c", "Deposit", "", "", ""),
+	}
+	for i := range records {
+		records[i].Fields.DateTime = "2024-03-05"
+		records[i].Fields.AccountID = "acc"
+	}
+	accounts := []AccountRecord{{Fields: AccountFields{AccountID: "acc"}}}
+	categories := []CategoryRecord{{Fields: CategoryFields{Name: "Coffee"}}}
+
+	report := ValidatePipeline(records, accounts, categories, rules)
+
+	if report.Categorized != 2 || report.Uncategorized != 1 {
+		t.Errorf("Categorized = %d, Uncategorized = %d, want 2 and 1", report.Categorized, report.Uncategorized)
+	}
+	if got := records[0].Fields.CategoryLookup; len(got) != 1 || got[0] != "Coffee" {
+		t.Errorf("CategoryLookup = %v, want [Coffee]", got)
+	}
+	// Typecasting would create a Travel category
+	if len(report.Problems) != 1 || len(report.Problems["b"]) != 1 {
+		t.Errorf("Problems = %v, want only b's missing category", report.Problems)
+	}
+}
+
+func TestRuleStatsDead(t *testing.T) {
+	stats := RuleStats{
+		Hits: RuleHits{
+			Names:   []RuleHit{{"(?i)^amzn", 3}, {"^Never$", 0}},
+			Mapping: []RuleHit{{"TRAVEL", 0}},
+		},
+		Deductible: []RuleHit{{DeductibleRule{Category: "MEDICAL", Account: "hsa"}.String(), 0}},
+	}
+	want := []string{
+		"names.rules ^Never$",
+		"categories.mapping TRAVEL",
+		`tax.deductible category = "MEDICAL", account = "hsa"`,
+	}
+	got := stats.Dead()
+	if len(got) != len(want) {
+		t.Fatalf("Dead() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Dead()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
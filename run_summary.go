@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+)
+
+type PhaseTiming struct {
+	Phase    string
+	Duration time.Duration
+}
+
+type RunSummary struct {
+	StartedAt time.Time
+	Phases    []PhaseTiming
+	Created   int
+	Updated   int
+	Deleted   int
+}
+
+func NewRunSummary() *RunSummary {
+	return &RunSummary{StartedAt: time.Now()}
+}
+
+func (s *RunSummary) Time(phase string, action func() error) error {
+	start := time.Now()
+	err := action()
+	s.Add(phase, start)
+	return err
+}
+
+func (s *RunSummary) Add(phase string, start time.Time) {
+	s.Phases = append(s.Phases, PhaseTiming{Phase: phase, Duration: time.Since(start)})
+}
+
+func (s *RunSummary) Print() {
+	phases := make([]any, len(s.Phases))
+	for i, p := range s.Phases {
+		phases[i] = slog.Duration(p.Phase, p.Duration.Round(time.Millisecond))
+	}
+	slog.Info("Sync summary",
+		slog.Group("phases", phases...),
+		"total", time.Since(s.StartedAt).Round(time.Millisecond),
+		"created", s.Created,
+		"updated", s.Updated,
+		"deleted", s.Deleted,
+	)
+}
+
+// Record appends the summary to a JSON lines file in the data dir so
+// timings can be compared across runs.
+func (s *RunSummary) Record(dataDir string) error {
+	f, err := os.OpenFile(filepath.Join(dataDir, "data", "runs.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// ETA estimates the remaining time of a batch of work from the observed
+// throughput. For Airtable writes (NewETA) it never reports less than the
+// rate limit allows.
+type ETA struct {
+	Total int
+	Done  int
+	start time.Time
+	floor func(left int) time.Duration
+}
+
+func NewETA(total int) *ETA {
+	return &ETA{Total: total, start: time.Now(), floor: airtableWriteTime}
+}
+
+// NewDownloadETA estimates from throughput alone, e.g. for paging
+// through transactions.
+func NewDownloadETA(total int) *ETA {
+	return &ETA{Total: total, start: time.Now()}
+}
+
+// airtableWriteTime is how long writing left records takes at best.
+func airtableWriteTime(left int) time.Duration {
+	requests := (left + airtable.MaxBatchSize - 1) / airtable.MaxBatchSize
+	return time.Duration(requests) * time.Second / airtable.RequestsPerSecond
+}
+
+func (e *ETA) Step(n int) {
+	e.Done += n
+}
+
+func (e *ETA) Remaining() time.Duration {
+	left := e.Total - e.Done
+	if left <= 0 {
+		return 0
+	}
+
+	var floor time.Duration
+	if e.floor != nil {
+		floor = e.floor(left)
+	}
+	if e.Done == 0 {
+		return floor
+	}
+
+	observed := time.Since(e.start) / time.Duration(e.Done) * time.Duration(left)
+	if observed < floor {
+		return floor
+	}
+	return observed
+}
+
+func (e *ETA) String() string {
+	return fmt.Sprintf("%d/%d, ETA %s", e.Done, e.Total, e.Remaining().Round(time.Second))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Commands annotated with runLockAnnotation write to Airtable or the data
+// files, and hold the run lock so that e.g. a sync fired by cron while a
+// backfill is still going waits or fails instead of interfering.
+const runLockAnnotation = "run_lock"
+
+var runLock *plaid_cli.RunLock
+
+// acquireRunLock takes the run lock for cmd if it needs it, waiting up to
+// lock.wait for a running command to finish.
+func acquireRunLock(cmd *cobra.Command, dataDir string) {
+	if cmd.Annotations[runLockAnnotation] == "" {
+		return
+	}
+	lock, err := plaid_cli.AcquireRunLock(dataDir, cmd.CommandPath(), viper.GetDuration("lock.wait"))
+	var lockedErr *plaid_cli.LockedError
+	if errors.As(err, &lockedErr) {
+		Fatal("Another command is running, pass --wait to wait for it", err)
+	}
+	if err != nil {
+		Fatal("Cannot acquire run lock", err)
+	}
+	slog.Debug("Acquired run lock", "command", cmd.CommandPath())
+	runLock = lock
+}
+
+// releaseRunLock releases the run lock if held. Exit and Fatal call it,
+// since os.Exit skips deferred calls.
+func releaseRunLock() {
+	if runLock == nil {
+		return
+	}
+	err := runLock.Release()
+	if err != nil {
+		LogError("Cannot release run lock", err)
+	}
+	runLock = nil
+}
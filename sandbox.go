@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+	"github.com/spf13/viper"
+)
+
+// Plaid's /sandbox endpoints create items and simulate events without real
+// bank credentials, so link, sync and Airtable can be tried end to end.
+
+// First Platypus Bank, Plaid's default sandbox institution
+const defaultSandboxInstitution = "ins_109508"
+
+// PlaidEnvironment returns the API host for plaid.environment. Plaid
+// retired the development environment, so it maps to production.
+func PlaidEnvironment() (plaid.Environment, error) {
+	switch strings.ToLower(viper.GetString("plaid.environment")) {
+	case "", "production", "development":
+		return plaid.Production, nil
+	case "sandbox":
+		return plaid.Sandbox, nil
+	default:
+		return "", errors.New(fmt.Sprintf("Unknown plaid.environment: %s (sandbox or production)", viper.GetString("plaid.environment")))
+	}
+}
+
+// CheckSandbox makes sure sandbox commands are only run against the
+// sandbox.
+func CheckSandbox() error {
+	env, err := PlaidEnvironment()
+	if err != nil {
+		return err
+	}
+	if env != plaid.Sandbox {
+		return errors.New("Sandbox commands need sandbox credentials. Set plaid.environment to sandbox (or PLAID_ENVIRONMENT=sandbox) with your sandbox secret.")
+	}
+	return nil
+}
+
+// CreateSandboxItem creates an item at institutionID with the sandbox test
+// user and stores its access token, as `link` would.
+func CreateSandboxItem(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, institutionID string, webhook string) (string, error) {
+	req := plaid.SandboxPublicTokenCreateRequest{
+		InstitutionId:   institutionID,
+		InitialProducts: []plaid.Products{"transactions"},
+	}
+	if webhook != "" {
+		req.Options = &plaid.SandboxPublicTokenCreateRequestOptions{Webhook: &webhook}
+	}
+
+	created, err := client.SandboxPublicTokenCreate(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	exchanged, err := client.ItemPublicTokenExchange(ctx, plaid.ItemPublicTokenExchangeRequest{
+		PublicToken: created.PublicToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	data.Tokens[exchanged.ItemId] = exchanged.AccessToken
+	return exchanged.ItemId, data.Save()
+}
+
+// FireSandboxWebhook makes Plaid send webhookCode (e.g. DEFAULT_UPDATE) to
+// the item's webhook.
+func FireSandboxWebhook(ctx context.Context, client plaid_cli.PlaidClient, token string, webhookCode string) error {
+	_, err := client.SandboxItemFireWebhook(ctx, plaid.SandboxItemFireWebhookRequest{
+		AccessToken: token,
+		WebhookCode: webhookCode,
+	})
+	return err
+}
+
+// ResetSandboxLogin puts the item in ITEM_LOGIN_REQUIRED, to try relinking.
+func ResetSandboxLogin(ctx context.Context, client plaid_cli.PlaidClient, token string) error {
+	_, err := client.SandboxItemResetLogin(ctx, plaid.SandboxItemResetLoginRequest{
+		AccessToken: token,
+	})
+	return err
+}
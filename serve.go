@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+)
+
+// Jobs kept for status and logs, oldest dropped first
+const maxControlJobs = 20
+
+// Job states
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// ControlItem is a linked item, as listed by the control API.
+type ControlItem struct {
+	ID          string `json:"id"`
+	Alias       string `json:"alias,omitempty"`
+	Institution string `json:"institution,omitempty"`
+}
+
+// Job is a sync started through the control API.
+type Job struct {
+	ID         string     `json:"id"`
+	Item       string     `json:"item"`
+	State      string     `json:"state"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	mu  sync.Mutex
+	log []byte
+	// Closed and replaced whenever the log or state changes
+	changed chan struct{}
+}
+
+// Write appends the sync's output to the job's log.
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.log = append(j.log, p...)
+	j.notify()
+	return len(p), nil
+}
+
+func (j *Job) finish(exitCode int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.ExitCode = &exitCode
+	j.FinishedAt = &now
+	j.State = JobSucceeded
+	if exitCode != 0 {
+		j.State = JobFailed
+	}
+	j.notify()
+}
+
+func (j *Job) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// ControlServer is the API `serve` exposes, for dashboards and shortcuts
+// to start syncs and follow them. Syncs run as `plaid-cli
+// sync-transactions` in a child process, one at a time, so they take the
+// run lock like any other and a failing one can't take the server down.
+type ControlServer struct {
+	// Requests must send it as a bearer token
+	Token string
+	// Only unlocks the calendar, which calendar apps fetch with it in the
+	// URL, where it ends up synced to their servers. No calendar when
+	// empty.
+	CalendarToken string
+	// Only unlocks the Plaid webhook, which Plaid calls with it in the URL.
+	// No webhook when empty.
+	WebhookToken string
+	// Creates Hosted Link pages for items the webhook reports need
+	// relinking
+	Linker *plaid_cli.Linker
+	// The profile's data directory, for listing items
+	DataDir string
+	// Environment for the syncs, selecting the same profile
+	Env []string
+
+	mu     sync.Mutex
+	jobs   []*Job
+	lastID int
+}
+
+func (s *ControlServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/items", s.handleItems)
+	mux.HandleFunc("POST /v1/sync", s.handleSync)
+	mux.HandleFunc("GET /v1/jobs", s.handleJobs)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.handleJob)
+	mux.HandleFunc("GET /v1/jobs/{id}/logs", s.handleLogs)
+
+	root := http.NewServeMux()
+	root.Handle("/", s.authenticate(mux, s.Token, false))
+	if s.CalendarToken != "" {
+		root.Handle("GET /v1/calendar.ics", s.authenticate(http.HandlerFunc(s.handleCalendar), s.CalendarToken, true))
+	}
+	if s.WebhookToken != "" {
+		root.Handle("POST /v1/plaid/webhook", s.authenticate(http.HandlerFunc(s.handlePlaidWebhook), s.WebhookToken, true))
+	}
+	return root
+}
+
+// authenticate lets through requests with the bearer token want, or with
+// it as ?token= when inQuery.
+func (s *ControlServer) authenticate(next http.Handler, want string, inQuery bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		// Calendar apps subscribe to a URL and Plaid calls one, neither
+		// can send headers
+		if !ok && inQuery {
+			token, ok = r.URL.Query().Get("token"), true
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+			writeControlError(w, http.StatusUnauthorized, errors.New("Missing or wrong token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *ControlServer) handleItems(w http.ResponseWriter, r *http.Request) {
+	// Items may have been linked since the server started
+	data, err := plaid_cli.LoadData(s.DataDir)
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := []ControlItem{}
+	for itemID := range data.Tokens {
+		items = append(items, ControlItem{
+			ID:          itemID,
+			Alias:       data.BackAliases[itemID],
+			Institution: data.Institutions[itemID].Name,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return ItemLabel(data, items[i].ID) < ItemLabel(data, items[j].ID)
+	})
+	writeControlJSON(w, http.StatusOK, items)
+}
+
+func (s *ControlServer) handleSync(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Item string `json:"item"`
+	}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeControlError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if req.Item == "" {
+		req.Item = "all"
+	}
+
+	data, err := plaid_cli.LoadData(s.DataDir)
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	_, err = ResolveItems(data, req.Item)
+	if err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job, err := s.start(req.Item)
+	if err != nil {
+		writeControlError(w, http.StatusConflict, err)
+		return
+	}
+	writeControlJSON(w, http.StatusAccepted, job.snapshot())
+}
+
+// start runs a sync of item, unless one is already running.
+func (s *ControlServer) start(item string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.snapshot().State == JobRunning {
+			return nil, errors.New(fmt.Sprintf("Job %s is still syncing %s", job.ID, job.Item))
+		}
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	s.lastID++
+	job := &Job{
+		ID:        strconv.Itoa(s.lastID),
+		Item:      item,
+		State:     JobRunning,
+		StartedAt: time.Now(),
+		changed:   make(chan struct{}),
+	}
+	cmd := exec.Command(executable, "sync-transactions", item)
+	cmd.Env = s.Env
+	cmd.Stdout = job
+	cmd.Stderr = job
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	s.jobs = append(s.jobs, job)
+	if len(s.jobs) > maxControlJobs {
+		s.jobs = s.jobs[len(s.jobs)-maxControlJobs:]
+	}
+	slog.Info("Started sync", "job", job.ID, "item", item)
+
+	go func() {
+		err := cmd.Wait()
+		exitCode := 0
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		} else if err != nil {
+			fmt.Fprintln(job, err)
+			exitCode = ExitError
+		}
+		job.finish(exitCode)
+		slog.Info("Sync finished", "job", job.ID, "item", item, "exit_code", exitCode)
+	}()
+	return job, nil
+}
+
+func (s *ControlServer) find(id string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func (s *ControlServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := []*Job{}
+	// Newest first
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, s.jobs[i].snapshot())
+	}
+	s.mu.Unlock()
+	writeControlJSON(w, http.StatusOK, jobs)
+}
+
+func (s *ControlServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	job := s.find(r.PathValue("id"))
+	if job == nil {
+		writeControlError(w, http.StatusNotFound, errors.New(fmt.Sprintf("No job %s", r.PathValue("id"))))
+		return
+	}
+	writeControlJSON(w, http.StatusOK, job.snapshot())
+}
+
+// handleLogs writes the job's output so far, and with ?follow=true keeps
+// streaming it until the job finishes.
+func (s *ControlServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	job := s.find(r.PathValue("id"))
+	if job == nil {
+		writeControlError(w, http.StatusNotFound, errors.New(fmt.Sprintf("No job %s", r.PathValue("id"))))
+		return
+	}
+	follow := r.URL.Query().Get("follow") == "true"
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	offset := 0
+	for {
+		job.mu.Lock()
+		chunk := job.log[offset:]
+		running := job.State == JobRunning
+		changed := job.changed
+		job.mu.Unlock()
+
+		if len(chunk) > 0 {
+			w.Write(chunk)
+			offset += len(chunk)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if !follow || !running {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// handleCalendar serves `plaid-cli export ics`, run like a sync, with
+// ?months= passed on.
+func (s *ControlServer) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	args := []string{"export", "ics"}
+	if months := r.URL.Query().Get("months"); months != "" {
+		if _, err := strconv.Atoi(months); err != nil {
+			writeControlError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("Invalid months: %s", months)))
+			return
+		}
+		args = append(args, "--months", months)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cmd := exec.CommandContext(r.Context(), executable, args...)
+	cmd.Env = s.Env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	calendar, err := cmd.Output()
+	if err != nil {
+		writeControlError(w, http.StatusBadGateway, errors.New(fmt.Sprintf("%s: %s", err, strings.TrimSpace(stderr.String()))))
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(calendar)
+}
+
+// handlePlaidWebhook sends a Hosted Link page to relink the item on to
+// notify.hooks when Plaid reports its login expired or is about to.
+// Other webhooks are acknowledged and ignored, so Plaid doesn't retry
+// them.
+func (s *ControlServer) handlePlaidWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook struct {
+		WebhookType string `json:"webhook_type"`
+		WebhookCode string `json:"webhook_code"`
+		ItemID      string `json:"item_id"`
+		Error       *struct {
+			ErrorCode string `json:"error_code"`
+		} `json:"error"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&webhook)
+	if err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var reason string
+	switch {
+	case webhook.WebhookType != "ITEM":
+	case webhook.WebhookCode == "ERROR" && webhook.Error != nil && webhook.Error.ErrorCode == "ITEM_LOGIN_REQUIRED":
+		reason = "Login expired"
+	case webhook.WebhookCode == "PENDING_EXPIRATION", webhook.WebhookCode == "PENDING_DISCONNECT":
+		reason = "Consent expires soon"
+	}
+	if reason == "" {
+		slog.Debug("Ignoring Plaid webhook", "type", webhook.WebhookType, "code", webhook.WebhookCode)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Items may have been linked since the server started
+	data, err := plaid_cli.LoadData(s.DataDir)
+	if err != nil {
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if _, ok := data.Tokens[webhook.ItemID]; !ok {
+		slog.Warn("Plaid webhook for an unknown item", "item", webhook.ItemID, "code", webhook.WebhookCode)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	err = SendRelinkURL(r.Context(), data, s.Linker, webhook.ItemID, reason)
+	if err != nil {
+		LogError("Cannot send relink URL", err, "item", ItemLabel(data, webhook.ItemID))
+		writeControlError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// snapshot copies the job's fields, for encoding while it runs.
+func (j *Job) snapshot() *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return &Job{
+		ID:         j.ID,
+		Item:       j.Item,
+		State:      j.State,
+		ExitCode:   j.ExitCode,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+	}
+}
+
+func writeControlJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeControlError(w http.ResponseWriter, status int, err error) {
+	writeControlJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	s := &ControlServer{}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name    string
+		inQuery bool
+		header  string
+		query   string
+		want    int
+	}{
+		{name: "bearer token", header: "Bearer secret", want: http.StatusNoContent},
+		{name: "wrong bearer token", header: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "empty bearer token", header: "Bearer ", want: http.StatusUnauthorized},
+		{name: "not a bearer token", header: "Basic secret", want: http.StatusUnauthorized},
+		{name: "token prefix", header: "Bearer secre", want: http.StatusUnauthorized},
+		{name: "query token not accepted", query: "?token=secret", want: http.StatusUnauthorized},
+		{name: "query token", inQuery: true, query: "?token=secret", want: http.StatusNoContent},
+		{name: "wrong query token", inQuery: true, query: "?token=nope", want: http.StatusUnauthorized},
+		{name: "empty query token", inQuery: true, query: "?token=", want: http.StatusUnauthorized},
+		{name: "bearer token where query accepted", inQuery: true, header: "Bearer secret", want: http.StatusNoContent},
+		// The header wins, so a wrong one isn't rescued by the query
+		{name: "wrong bearer token, right query token", inQuery: true, header: "Bearer nope", query: "?token=secret", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/calendar.ics"+tt.query, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.authenticate(ok, "secret", tt.inQuery).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerTokens(t *testing.T) {
+	s := &ControlServer{Token: "control", CalendarToken: "calendar", WebhookToken: "webhook"}
+	handler := s.Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		want   int
+	}{
+		{"control token", "GET", "/v1/jobs", "Bearer control", http.StatusOK},
+		{"control token in the query", "GET", "/v1/jobs?token=control", "", http.StatusUnauthorized},
+		{"calendar token on the API", "GET", "/v1/jobs", "Bearer calendar", http.StatusUnauthorized},
+		{"webhook token on the API", "GET", "/v1/jobs", "Bearer webhook", http.StatusUnauthorized},
+		{"calendar token on the webhook", "POST", "/v1/plaid/webhook?token=calendar", "", http.StatusUnauthorized},
+		{"webhook token on the calendar", "GET", "/v1/calendar.ics?token=webhook", "", http.StatusUnauthorized},
+		{"control token on the calendar", "GET", "/v1/calendar.ics?token=control", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerWithoutCalendarOrWebhook(t *testing.T) {
+	handler := (&ControlServer{Token: "control"}).Handler()
+	for _, path := range []string{"/v1/calendar.ics?token=", "/v1/plaid/webhook?token="} {
+		r := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		// An empty token must not unlock routes that are off
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d", path, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type snapshotRecord struct {
+	ID          string                 `json:"id"`
+	CreatedTime string                 `json:"createdTime"`
+	Fields      map[string]interface{} `json:"fields"`
+}
+
+// SnapshotDir is where snapshots go unless another directory is given.
+func SnapshotDir(dataDir string) string {
+	return filepath.Join(dataDir, "data", "snapshots")
+}
+
+// SnapshotTable saves every record of an Airtable table to a file in dir
+// named after the base, table and time, as JSON (the records as the API
+// returns them) or CSV (a column per field, lists and links as JSON). It
+// returns the file's path and how many records it holds.
+func SnapshotTable(table string, dir string, format string) (string, int, error) {
+	if format != "json" && format != "csv" {
+		return "", 0, errors.New(fmt.Sprintf("Invalid snapshot format: %s (json or csv)", format))
+	}
+
+	var records []FieldRecord
+	err := NewAirtableClient().Table(table).List(&records, nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", 0, err
+	}
+	name := fmt.Sprintf("%s-%s-%s.%s", AirtableBaseID(), strings.ReplaceAll(table, " ", "-"), time.Now().UTC().Format("20060102T150405Z"), format)
+	path := filepath.Join(dir, name)
+
+	if format == "csv" {
+		return path, len(records), writeCSV(path, snapshotRows(records), false)
+	}
+
+	snapshot := make([]snapshotRecord, len(records))
+	for i, r := range records {
+		snapshot[i] = snapshotRecord{ID: r.ID, CreatedTime: r.CreatedTime, Fields: r.Fields}
+	}
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return "", 0, err
+	}
+	return path, len(records), ioutil.WriteFile(path, b, 0600)
+}
+
+func snapshotRows(records []FieldRecord) [][]string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, r := range records {
+		for field := range r.Fields {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+
+	rows := [][]string{append([]string{"RecordID", "CreatedTime"}, fields...)}
+	for _, r := range records {
+		row := []string{r.ID, r.CreatedTime}
+		for _, field := range fields {
+			row = append(row, auditValue(r.Fields[field]))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
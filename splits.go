@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/pipeline"
+	"github.com/spf13/viper"
+)
+
+// A split replaces one transaction with several rows in Airtable, e.g. a
+// Costco run split between Groceries and Household. The original row is
+// kept, with Split checked so rollups can leave it out, and each part
+// links back to it through SplitOf. Parts get the PlaidID
+// "<original>:<n>", which Sync leaves alone.
+
+type SplitPart struct {
+	Amount   float64
+	Category string
+}
+
+// SplitRule splits transactions whose name matches Match, configured as
+// e.g.
+//
+//	[[split.rules]]
+//	match = "(?i)costco"
+//	parts = [{category = "Groceries", share = 0.7}, {category = "Household", share = 0.3}]
+type SplitRule struct {
+	Match string
+	Parts []struct {
+		Category string
+		Share    float64
+	}
+
+	pattern *regexp.Regexp
+}
+
+func splitRules() ([]SplitRule, error) {
+	var rules []SplitRule
+	err := viper.UnmarshalKey("split.rules", &rules)
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		rules[i].pattern, err = regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid split.rules match %q: %s", rule.Match, err))
+		}
+	}
+	return rules, nil
+}
+
+type SplitFields struct {
+	PlaidID        string
+	AccountID      string              `json:"AccountIDDedupe"`
+	AccountIDLink  airtable.RecordLink `json:"AccountID,omitempty"`
+	Amount         float64
+	Name           string
+	MerchantName   string
+	DateTime       string
+	CategoryLookup []string            `json:",omitempty"`
+	SplitOf        airtable.RecordLink `json:",omitempty"`
+	Split          bool                `json:",omitempty"`
+}
+
+type SplitRecord struct {
+	airtable.Record
+	Fields   SplitFields
+	Typecast bool
+}
+
+// SplitTransaction splits the Airtable transaction with the given Plaid
+// ID into parts, which must add up to its amount. Categories are matched
+// to the Categories table by name.
+func SplitTransaction(plaidID string, parts []SplitPart) error {
+	client := NewAirtableClient()
+
+	transactionsTable := client.Table(AirtableTransactionsTable())
+
+	var found []SplitRecord
+	err := transactionsTable.List(&found, &airtable.Options{
+		Fields: []string{"PlaidID", "AccountIDDedupe", "AccountID", "Amount", "Name", "MerchantName", "DateTime", "Split"},
+		Filter: fmt.Sprintf("{PlaidID} = '%s'", plaidID),
+	})
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return errors.New(fmt.Sprintf("No Airtable transaction with PlaidID %s", plaidID))
+	}
+
+	return splitRecord(transactionsTable, found[0], parts)
+}
+
+func splitRecord(transactionsTable airtable.TableClient, parent SplitRecord, parts []SplitPart) error {
+	if parent.Fields.Split {
+		return errors.New(fmt.Sprintf("%s is already split", parent.Fields.PlaidID))
+	}
+	if len(parts) < 2 {
+		return errors.New("A split needs at least two parts")
+	}
+
+	total := 0.0
+	for _, p := range parts {
+		total += p.Amount
+	}
+	if math.Abs(total-parent.Fields.Amount) >= 0.005 {
+		return errors.New(fmt.Sprintf("Parts add up to %.2f, but the transaction is %.2f", total, parent.Fields.Amount))
+	}
+
+	children := make([]SplitRecord, len(parts))
+	for i, p := range parts {
+		children[i] = SplitRecord{Fields: SplitFields{
+			PlaidID:       fmt.Sprintf("%s%s%d", parent.Fields.PlaidID, pipeline.PartSeparator, i+1),
+			AccountID:     parent.Fields.AccountID,
+			AccountIDLink: parent.Fields.AccountIDLink,
+			Amount:        p.Amount,
+			Name:          parent.Fields.Name,
+			MerchantName:  parent.Fields.MerchantName,
+			DateTime:      parent.Fields.DateTime,
+			SplitOf:       airtable.RecordLink{parent.ID},
+		}, Typecast: true}
+		if p.Category != "" {
+			children[i].Fields.CategoryLookup = []string{p.Category}
+		}
+	}
+
+	err := transactionsTable.CreateAll(children, nil)
+	if err != nil {
+		return err
+	}
+
+	update := SplitRecord{Fields: SplitFields{
+		PlaidID:   parent.Fields.PlaidID,
+		AccountID: parent.Fields.AccountID,
+		Amount:    parent.Fields.Amount,
+		Name:      parent.Fields.Name,
+		DateTime:  parent.Fields.DateTime,
+		Split:     true,
+	}}
+	update.ID = parent.ID
+	return transactionsTable.Update(&update)
+}
+
+// ApplySplitRules splits unsplit transactions dated on or after since
+// that match a rule in split.rules, and returns how many were split.
+func ApplySplitRules(since time.Time) (int, error) {
+	rules, err := splitRules()
+	if err != nil {
+		return 0, err
+	}
+	if len(rules) == 0 {
+		return 0, errors.New("No split.rules configured")
+	}
+
+	client := NewAirtableClient()
+
+	transactionsTable := client.Table(AirtableTransactionsTable())
+
+	var candidates []SplitRecord
+	err = transactionsTable.List(&candidates, &airtable.Options{
+		Fields: []string{"PlaidID", "AccountIDDedupe", "AccountID", "Amount", "Name", "MerchantName", "DateTime", "Split"},
+		Filter: fmt.Sprintf("AND({After Plaid Issues} = 1, NOT({Split}), NOT(IS_BEFORE({DateTime}, '%s')))", since.Format("2006-01-02")),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	split := 0
+	for _, c := range candidates {
+		if pipeline.IsPart(c.Fields.PlaidID) {
+			continue
+		}
+		for _, rule := range rules {
+			if !rule.pattern.MatchString(c.Fields.Name) {
+				continue
+			}
+
+			parts := make([]SplitPart, len(rule.Parts))
+			remaining := c.Fields.Amount
+			for j, p := range rule.Parts {
+				amount := math.Round(c.Fields.Amount*p.Share*100) / 100
+				// The last part takes the rounding difference
+				if j == len(rule.Parts)-1 {
+					amount = math.Round(remaining*100) / 100
+				}
+				remaining -= amount
+				parts[j] = SplitPart{Amount: amount, Category: p.Category}
+			}
+
+			err := splitRecord(transactionsTable, c, parts)
+			if err != nil {
+				return split, errors.New(fmt.Sprintf("Cannot split %s (%s): %s", c.Fields.PlaidID, c.Fields.Name, err))
+			}
+			split++
+			break
+		}
+	}
+	return split, nil
+}
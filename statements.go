@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/plaid/plaid-go/v27/plaid"
+)
+
+// Statement is a monthly PDF statement available through Plaid
+// Statements.
+type Statement struct {
+	ItemID      string
+	AccountID   string
+	Account     string
+	Mask        string
+	StatementID string
+	Year        int
+	Month       int
+}
+
+// Period is the statement's month, e.g. 2024-03.
+func (s Statement) Period() string {
+	return fmt.Sprintf("%04d-%02d", s.Year, s.Month)
+}
+
+// Filename is e.g. "2024-03 Checking 1234.pdf".
+func (s Statement) Filename() string {
+	name := s.Period() + " " + s.Account
+	if s.Mask != "" {
+		name += " " + s.Mask
+	}
+	return sanitizeFilename(name) + ".pdf"
+}
+
+func sanitizeFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+}
+
+func FetchStatements(ctx context.Context, client plaid_cli.PlaidClient, accessToken string) ([]Statement, error) {
+	res, err := client.StatementsList(ctx, plaid.StatementsListRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []Statement
+	for _, a := range res.Accounts {
+		for _, s := range a.Statements {
+			statements = append(statements, Statement{
+				ItemID:      res.ItemId,
+				AccountID:   a.AccountId,
+				Account:     a.AccountName,
+				Mask:        a.AccountMask,
+				StatementID: s.StatementId,
+				Year:        int(s.Year),
+				Month:       int(s.Month),
+			})
+		}
+	}
+	return statements, nil
+}
+
+// FetchAllStatements lists statements for each item, relinking as needed.
+// Items that fail, e.g. because they weren't linked with Statements, are
+// logged and skipped.
+func FetchAllStatements(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, linker *plaid_cli.Linker, items []idAndAlias) []Statement {
+	var allStatements []Statement
+	for _, item := range items {
+		if item.id == sandboxItemID {
+			continue
+		}
+		err := WithRelinkOnAuthError(ctx, item, data, linker, func() error {
+			statements, err := FetchStatements(ctx, client, data.Tokens[item.id])
+			if err != nil {
+				return err
+			}
+
+			allStatements = append(allStatements, statements...)
+			return nil
+		})
+		if err != nil {
+			ItemFailed("Cannot list statements", err, ItemLabel(data, item.id))
+		} else {
+			ItemSucceeded(ItemLabel(data, item.id))
+		}
+	}
+	return allStatements
+}
+
+func PrintStatementsTable(data *plaid_cli.Data, statements []Statement) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTITUTION\tACCOUNT\tMASK\tMONTH\tSTATEMENT ID")
+	for _, s := range statements {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ItemLabel(data, s.ItemID), s.Account, s.Mask, s.Period(), s.StatementID)
+	}
+	w.Flush()
+}
+
+// StatementPath is where a statement is downloaded to: a directory per
+// institution under dir.
+func StatementPath(data *plaid_cli.Data, dir string, s Statement) string {
+	return filepath.Join(dir, sanitizeFilename(ItemLabel(data, s.ItemID)), s.Filename())
+}
+
+// DownloadStatements downloads statements not already in dir and returns
+// how many were downloaded. Statements that fail are logged and skipped.
+func DownloadStatements(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, dir string, statements []Statement) int {
+	downloaded := 0
+	for _, s := range statements {
+		path := StatementPath(data, dir, s)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		pdf, err := client.StatementsDownload(ctx, plaid.StatementsDownloadRequest{
+			AccessToken: data.Tokens[s.ItemID],
+			StatementId: s.StatementID,
+		})
+		if err == nil {
+			err = writeStatement(path, pdf)
+		}
+		if err != nil {
+			ItemFailed("Cannot download statement", err, ItemLabel(data, s.ItemID), "account", s.Account, "month", s.Period())
+			continue
+		}
+		slog.Info("Downloaded statement", "path", path)
+		downloaded++
+	}
+	return downloaded
+}
+
+// writeStatement writes through a temporary file, so an interrupted
+// download isn't mistaken for a finished one next time.
+func writeStatement(path string, pdf []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path+".tmp", pdf, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+type AccountStatementsFields struct {
+	AccountID  string
+	Statements airtable.Attachment `json:",omitempty"`
+}
+
+type AccountStatementsRecord struct {
+	airtable.Record
+	Fields AccountStatementsFields
+}
+
+// AttachStatements uploads downloaded statements to the Statements field
+// of their account in the Accounts table, skipping those already attached
+// by filename. It returns how many were attached.
+func AttachStatements(data *plaid_cli.Data, dir string, statements []Statement) (int, error) {
+	client := NewAirtableClient()
+
+	var accounts []AccountStatementsRecord
+	err := client.Table("Accounts").List(&accounts, &airtable.Options{Fields: []string{"AccountID", "Statements"}})
+	if err != nil {
+		return 0, err
+	}
+	records := make(map[string]AccountStatementsRecord)
+	for _, a := range accounts {
+		records[a.Fields.AccountID] = a
+	}
+
+	attached := 0
+	for _, s := range statements {
+		record, ok := records[s.AccountID]
+		if !ok {
+			slog.Warn("Account isn't in Airtable, run sync-accounts to attach its statements", "account", s.Account, "account_id", s.AccountID)
+			continue
+		}
+		if hasAttachment(record.Fields.Statements, s.Filename()) {
+			continue
+		}
+
+		pdf, err := ioutil.ReadFile(StatementPath(data, dir, s))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return attached, err
+		}
+		err = client.UploadAttachment(record.ID, "Statements", s.Filename(), "application/pdf", base64.StdEncoding.EncodeToString(pdf))
+		if err != nil {
+			return attached, err
+		}
+		attached++
+	}
+	return attached, nil
+}
+
+func hasAttachment(attachment airtable.Attachment, filename string) bool {
+	for _, f := range attachment {
+		if f.Filename == filename {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+
+	"github.com/landakram/plaid-cli/pkg/pipeline"
+	"github.com/spf13/viper"
+)
+
+// PostTransactions POSTs txs to url as NDJSON (application/x-ndjson), in
+// batches of batchSize, with stream.headers added to each request, e.g.
+//
+//	[stream]
+//	url = "https://ingest.example.com/transactions"
+//	headers = { authorization = "Bearer ..." }
+//
+// It stops at the first batch that fails and returns how many
+// transactions were posted before it.
+func PostTransactions(url string, batchSize int, txs []Transaction) (int, error) {
+	if batchSize < 1 {
+		return 0, errors.New(fmt.Sprintf("Invalid batch size: %d", batchSize))
+	}
+	headers := viper.GetStringMapString("stream.headers")
+
+	posted := 0
+	for start := 0; start < len(txs); start += batchSize {
+		end := start + batchSize
+		if end > len(txs) {
+			end = len(txs)
+		}
+
+		body, err := (&pipeline.NDJSONSerializer{}).Serialize(txs[start:end])
+		if err != nil {
+			return posted, err
+		}
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return posted, err
+		}
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return posted, err
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return posted, errors.New(fmt.Sprintf("%s: %s", resp.Status, b))
+		}
+
+		posted += end - start
+		slog.Debug("Posted transactions", "count", end-start, "total", posted)
+	}
+	return posted, nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/landakram/plaid-cli/pkg/xlsx"
+	"github.com/spf13/viper"
+)
+
+// DeductibleRule marks transactions as deductible for `report tax`, on
+// top of the checkbox in tax.deductible_field, e.g.
+//
+//	[[tax.deductible]]
+//	match = "(?i)red cross|unicef"
+//
+//	[[tax.deductible]]
+//	category = "MEDICAL"
+//
+// Match is a regular expression on the name. Category is your category
+// or a personal finance category, primary or detailed. Account is an
+// account ID or alias. A rule matches when all of its fields do.
+type DeductibleRule struct {
+	Match    string
+	Category string
+	Account  string
+
+	pattern *regexp.Regexp
+}
+
+func (r DeductibleRule) matches(data *plaid_cli.Data, t TaxTransaction) bool {
+	if r.pattern != nil && !r.pattern.MatchString(t.Name) {
+		return false
+	}
+	if r.Account != "" && ResolveAccountID(data, r.Account) != t.AccountID {
+		return false
+	}
+	if r.Category != "" && !strings.EqualFold(r.Category, t.Category) && !strings.EqualFold(r.Category, t.PFCPrimary) && !strings.EqualFold(r.Category, t.PFCDetailed) {
+		return false
+	}
+	return true
+}
+
+func deductibleRules() ([]DeductibleRule, error) {
+	var rules []DeductibleRule
+	err := viper.UnmarshalKey("tax.deductible", &rules)
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		if rule.Match == "" && rule.Category == "" && rule.Account == "" {
+			return nil, errors.New(fmt.Sprintf("tax.deductible rule %d matches everything; set match, category or account", i+1))
+		}
+		if rule.Match != "" {
+			rules[i].pattern, err = regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rules, nil
+}
+
+// TaxTransaction is a transaction in the tax year as synced to Airtable.
+type TaxTransaction struct {
+	Date        string
+	Name        string
+	Amount      float64
+	AccountID   string
+	Category    string
+	PFCPrimary  string
+	PFCDetailed string
+	Deductible  bool
+}
+
+// TaxCategory is a category's total over the tax year.
+type TaxCategory struct {
+	Category   string
+	Count      int
+	Total      float64
+	Deductible float64
+}
+
+type TaxReport struct {
+	Year       int
+	Categories []TaxCategory
+	// Deductible transactions, by date
+	Deductible []TaxTransaction
+}
+
+// TaxRecord is read into a map since the deductible checkbox's name is
+// configurable.
+type TaxRecord struct {
+	airtable.Record
+	Fields map[string]interface{}
+}
+
+// NewTaxReport totals the year's Airtable transactions by category,
+// your category (CategoryLookup) if set and the personal finance category
+// otherwise, and lists the deductible ones: checked in
+// tax.deductible_field or matching a tax.deductible rule. Amounts are as
+// synced, in the amounts.sign convention. Split originals are left out in
+// favor of their parts.
+func NewTaxReport(data *plaid_cli.Data, year int) (TaxReport, error) {
+	report := TaxReport{Year: year}
+
+	rules, err := deductibleRules()
+	if err != nil {
+		return report, err
+	}
+
+	client := NewAirtableClient()
+
+	var categories []CategoryRecord
+	err = client.Table("Categories").List(&categories, &airtable.Options{Fields: []string{"Name"}})
+	if err != nil {
+		return report, err
+	}
+	categoryNames := make(map[string]string)
+	for _, c := range categories {
+		categoryNames[c.ID] = c.Fields.Name
+	}
+
+	filter := fmt.Sprintf("AND({After Plaid Issues} = 1, NOT({Split}), NOT(IS_BEFORE({DateTime}, '%d-01-01')), IS_BEFORE({DateTime}, '%d-01-01'))", year, year+1)
+	if viper.GetBool("sync.soft_delete") {
+		filter = fmt.Sprintf("AND(%s, NOT({Removed}))", filter)
+	}
+	fields := []string{"DateTime", "Name", "Amount", "AccountIDDedupe", "PFCPrimary", "PFCDetailed", "CategoryLookup"}
+	deductibleField := viper.GetString("tax.deductible_field")
+	if deductibleField != "" {
+		fields = append(fields, deductibleField)
+	}
+
+	var records []TaxRecord
+	err = client.Table(AirtableTransactionsTable()).List(&records, &airtable.Options{Fields: fields, Filter: filter})
+	if err != nil {
+		return report, err
+	}
+
+	byCategory := make(map[string]*TaxCategory)
+	for _, r := range records {
+		t := taxTransaction(r.Fields, categoryNames)
+		checked, _ := r.Fields[deductibleField].(bool)
+		t.Deductible = checked
+		for _, rule := range rules {
+			t.Deductible = t.Deductible || rule.matches(data, t)
+		}
+
+		c, ok := byCategory[t.Category]
+		if !ok {
+			c = &TaxCategory{Category: t.Category}
+			byCategory[t.Category] = c
+		}
+		c.Count++
+		c.Total += t.Amount
+		if t.Deductible {
+			c.Deductible += t.Amount
+			report.Deductible = append(report.Deductible, t)
+		}
+	}
+
+	for _, c := range byCategory {
+		c.Total = roundCents(c.Total)
+		c.Deductible = roundCents(c.Deductible)
+		report.Categories = append(report.Categories, *c)
+	}
+	sort.Slice(report.Categories, func(i, j int) bool {
+		return report.Categories[i].Category < report.Categories[j].Category
+	})
+	sort.SliceStable(report.Deductible, func(i, j int) bool {
+		return report.Deductible[i].Date < report.Deductible[j].Date
+	})
+	return report, nil
+}
+
+func taxTransaction(fields map[string]interface{}, categoryNames map[string]string) TaxTransaction {
+	str := func(name string) string {
+		s, _ := fields[name].(string)
+		return s
+	}
+	amount, _ := fields["Amount"].(float64)
+	t := TaxTransaction{
+		Date:        str("DateTime"),
+		Name:        str("Name"),
+		Amount:      amount,
+		AccountID:   str("AccountIDDedupe"),
+		PFCPrimary:  str("PFCPrimary"),
+		PFCDetailed: str("PFCDetailed"),
+	}
+
+	if links, ok := fields["CategoryLookup"].([]interface{}); ok && len(links) > 0 {
+		id, _ := links[0].(string)
+		t.Category = categoryNames[id]
+	}
+	if t.Category == "" {
+		t.Category = t.PFCPrimary
+	}
+	if t.Category == "" {
+		t.Category = "Uncategorized"
+	}
+	return t
+}
+
+func (r TaxReport) categoryRows() [][]interface{} {
+	rows := [][]interface{}{{"category", "count", "total", "deductible"}}
+	for _, c := range r.Categories {
+		rows = append(rows, []interface{}{c.Category, c.Count, c.Total, c.Deductible})
+	}
+	return rows
+}
+
+func (r TaxReport) deductibleRows(data *plaid_cli.Data) [][]interface{} {
+	rows := [][]interface{}{{"date", "name", "amount", "category", "account"}}
+	for _, t := range r.Deductible {
+		rows = append(rows, []interface{}{t.Date, t.Name, t.Amount, t.Category, AccountLabel(data, t.AccountID)})
+	}
+	return rows
+}
+
+// WriteTaxReport writes the report to dir, as tax-<year>-categories.csv
+// and tax-<year>-deductible.csv, or as tax-<year>.xlsx with a sheet for
+// each, returning the paths written.
+func WriteTaxReport(data *plaid_cli.Data, dir string, format string, report TaxReport) ([]string, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Join(dir, fmt.Sprintf("tax-%d", report.Year))
+
+	switch format {
+	case "csv":
+		paths := []string{base + "-categories.csv", base + "-deductible.csv"}
+		for i, rows := range [][][]interface{}{report.categoryRows(), report.deductibleRows(data)} {
+			err := writeCSVRows(paths[i], rows)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return paths, nil
+	case "xlsx":
+		f, err := os.OpenFile(base+".xlsx", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		err = xlsx.Write(f, []xlsx.Sheet{
+			{Name: "Categories", Rows: report.categoryRows()},
+			{Name: "Deductible", Rows: report.deductibleRows(data)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []string{base + ".xlsx"}, f.Close()
+	default:
+		return nil, errors.New(fmt.Sprintf("Invalid output format: %s (csv or xlsx)", format))
+	}
+}
+
+func writeCSVRows(path string, rows [][]interface{}) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			switch v := cell.(type) {
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', 2, 64)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/spf13/viper"
+)
+
+// Clients for Plaid and Airtable, whose requests fail after plaid.timeout
+// and airtable.timeout instead of hanging when an institution or
+// Airtable is slow.
+var (
+	plaidHTTPClient    = &http.Client{Transport: &timeoutTransport{key: "plaid.timeout"}}
+	airtableHTTPClient = &http.Client{Transport: &timeoutTransport{key: "airtable.timeout"}}
+)
+
+// runContext bounds the whole command by run.deadline. Set once flags
+// are parsed; everything the commands do derives from it.
+var (
+	runContext     = context.Background()
+	cancelDeadline context.CancelFunc
+)
+
+// SetRunDeadline starts the clock on run.deadline, if set.
+func SetRunDeadline() context.Context {
+	deadline := viper.GetDuration("run.deadline")
+	if deadline > 0 {
+		runContext, cancelDeadline = context.WithTimeoutCause(context.Background(), deadline,
+			errors.New(fmt.Sprintf("Command didn't finish within %s, see run.deadline", deadline)))
+	}
+	return runContext
+}
+
+// StopRunDeadline releases run.deadline's timer once the command is
+// done. Exit calls it, since deferred calls don't run on os.Exit.
+func StopRunDeadline() {
+	if cancelDeadline != nil {
+		cancelDeadline()
+	}
+}
+
+// timeoutTransport limits each request, including reading its body, to
+// the duration in the setting key. The setting is read per request, so
+// flags apply to clients built before they were parsed. Requests go
+// through http.DefaultClient's transport, which --record and --replay
+// swap out.
+type timeoutTransport struct {
+	key string
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := http.DefaultClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	timeout := viper.GetDuration(t.key)
+	if timeout <= 0 {
+		return transport.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeoutCause(req.Context(), timeout,
+		errors.New(fmt.Sprintf("%s %s: no response within %s, see %s", req.Method, req.URL.Host, timeout, t.key)))
+	resp, err := transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		err = cause(ctx, err)
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, ctx: ctx, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's timeout once its body is read.
+type cancelOnClose struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = cause(b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// cause replaces the error of a request that timed out with why.
+func cause(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return err
+}
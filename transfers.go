@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/landakram/plaid-cli/pkg/airtable"
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/spf13/viper"
+)
+
+// TransferPair is money moving between two of your own accounts: the same
+// amount with opposite signs, a few days apart.
+type TransferPair struct {
+	A Transaction
+	B Transaction
+}
+
+// DetectTransfers pairs up transactions in different accounts with
+// opposite amounts dated within window of each other. Each transaction is
+// in at most one pair, matched to the closest date. Pending transactions
+// are skipped since their amounts and dates can still change.
+func DetectTransfers(txs []Transaction, window time.Duration) []TransferPair {
+	var candidates []Transaction
+	for _, t := range txs {
+		if !t.Pending && t.Amount != 0 {
+			candidates = append(candidates, t)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Date != candidates[j].Date {
+			return candidates[i].Date < candidates[j].Date
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+
+	matched := make(map[string]bool)
+	var pairs []TransferPair
+	for i, a := range candidates {
+		if matched[a.ID] {
+			continue
+		}
+		aDate, err := time.Parse("2006-01-02", a.Date)
+		if err != nil {
+			continue
+		}
+
+		best := -1
+		var bestGap time.Duration
+		for j := i + 1; j < len(candidates); j++ {
+			b := candidates[j]
+			bDate, err := time.Parse("2006-01-02", b.Date)
+			if err != nil {
+				continue
+			}
+			gap := bDate.Sub(aDate)
+			if gap > window {
+				break
+			}
+			if matched[b.ID] || b.AccountID == a.AccountID || math.Abs(a.Amount+b.Amount) >= 0.005 {
+				continue
+			}
+			if best == -1 || gap < bestGap {
+				best, bestGap = j, gap
+			}
+		}
+
+		if best != -1 {
+			b := candidates[best]
+			matched[a.ID] = true
+			matched[b.ID] = true
+			pairs = append(pairs, TransferPair{A: a, B: b})
+		}
+	}
+	return pairs
+}
+
+// TransferWindow is sync.transfer_window, 3 days by default.
+func TransferWindow() time.Duration {
+	return viper.GetDuration("sync.transfer_window")
+}
+
+func PrintTransfers(data *plaid_cli.Data, pairs []TransferPair) {
+	accountNames := make(map[string]string)
+	for alias, accountID := range data.AccountAliases {
+		accountNames[accountID] = alias
+	}
+	name := func(accountID string) string {
+		if n, ok := accountNames[accountID]; ok {
+			return n
+		}
+		return accountID
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tACCOUNT\tAMOUNT\tDATE\tACCOUNT\tAMOUNT\tDESCRIPTION")
+	for _, p := range pairs {
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%s\t%s\t%.2f\t%s\n", p.A.Date, name(p.A.AccountID), p.A.Amount, p.B.Date, name(p.B.AccountID), p.B.Amount, p.A.Name)
+	}
+	w.Flush()
+}
+
+type TransferFields struct {
+	PlaidID      string
+	Transfer     bool
+	TransferPair airtable.RecordLink
+}
+
+type TransferRecord struct {
+	airtable.Record
+	Fields TransferFields
+}
+
+// LinkTransfers flags both sides of each pair as a Transfer in Airtable
+// and links them to each other via TransferPair. since bounds the
+// Airtable fetch like FetchAirtableTransactions. Returns how many records
+// were updated.
+func LinkTransfers(pairs []TransferPair, since time.Time) (int, error) {
+	client := NewAirtableClient()
+
+	transactionsTable := client.Table(AirtableTransactionsTable())
+
+	records, err := FetchAirtableTransactions([]string{"PlaidID", "Transfer", "TransferPair"}, since)
+	if err != nil {
+		return 0, err
+	}
+	byPlaidID := make(map[string]TransactionRecord)
+	for _, r := range records {
+		byPlaidID[r.Fields.PlaidID] = r
+	}
+
+	var updates []TransferRecord
+	link := func(r TransactionRecord, other TransactionRecord) {
+		if r.Fields.Transfer && len(r.Fields.TransferPair) == 1 && r.Fields.TransferPair[0] == other.ID {
+			return
+		}
+		u := TransferRecord{Fields: TransferFields{
+			PlaidID:      r.Fields.PlaidID,
+			Transfer:     true,
+			TransferPair: airtable.RecordLink{other.ID},
+		}}
+		u.ID = r.ID
+		updates = append(updates, u)
+	}
+
+	for _, p := range pairs {
+		a, aOK := byPlaidID[p.A.ID]
+		b, bOK := byPlaidID[p.B.ID]
+		if !aOK || !bOK {
+			continue
+		}
+		link(a, b)
+		link(b, a)
+	}
+
+	err = transactionsTable.UpdateAll(updates, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(updates), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func tx(id string, accountID string, date string, amount float64) Transaction {
+	return Transaction{ID: id, AccountID: accountID, Date: date, Amount: amount}
+}
+
+func TestDetectTransfers(t *testing.T) {
+	window := 72 * time.Hour
+
+	tests := []struct {
+		name string
+		txs  []Transaction
+		// Pairs as "A-B", ordered by date
+		want []string
+	}{
+		{
+			name: "same day",
+			txs:  []Transaction{tx("out", "checking", "2024-03-01", 500), tx("in", "savings", "2024-03-01", -500)},
+			want: []string{"in-out"},
+		},
+		{
+			name: "within the window",
+			txs:  []Transaction{tx("out", "checking", "2024-03-01", 500), tx("in", "savings", "2024-03-04", -500)},
+			want: []string{"out-in"},
+		},
+		{
+			name: "outside the window",
+			txs:  []Transaction{tx("out", "checking", "2024-03-01", 500), tx("in", "savings", "2024-03-05", -500)},
+		},
+		{
+			name: "same account",
+			txs:  []Transaction{tx("charge", "card", "2024-03-01", 20), tx("refund", "card", "2024-03-02", -20)},
+		},
+		{
+			name: "amounts differ",
+			txs:  []Transaction{tx("out", "checking", "2024-03-01", 500), tx("in", "savings", "2024-03-01", -499.99)},
+		},
+		{
+			name: "rounding",
+			txs:  []Transaction{tx("out", "checking", "2024-03-01", 0.1+0.2), tx("in", "savings", "2024-03-01", -0.3)},
+			want: []string{"in-out"},
+		},
+		{
+			name: "closest date wins",
+			txs: []Transaction{
+				tx("out", "checking", "2024-03-01", 500),
+				tx("far", "savings", "2024-03-03", -500),
+				tx("near", "brokerage", "2024-03-02", -500),
+			},
+			want: []string{"out-near"},
+		},
+		{
+			name: "each transaction in one pair",
+			txs: []Transaction{
+				tx("out1", "checking", "2024-03-01", 500),
+				tx("out2", "checking", "2024-03-01", 500),
+				tx("in", "savings", "2024-03-02", -500),
+			},
+			want: []string{"out1-in"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, p := range DetectTransfers(tt.txs, window) {
+				got = append(got, p.A.ID+"-"+p.B.ID)
+			}
+			sort.Strings(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("pairs = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("pairs = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectTransfersSkipsPending(t *testing.T) {
+	out := tx("out", "checking", "2024-03-01", 500)
+	in := tx("in", "savings", "2024-03-01", -500)
+	in.Pending = true
+	if pairs := DetectTransfers([]Transaction{out, in}, 72*time.Hour); len(pairs) != 0 {
+		t.Errorf("paired a pending transaction: %+v", pairs)
+	}
+}
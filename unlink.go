@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/landakram/plaid-cli/pkg/plaid_cli"
+	"github.com/manifoldco/promptui"
+)
+
+// ConfirmUnlink shows what belongs to an item and asks the user to type
+// its alias (or item ID) before it is removed, since ItemRemove cannot be
+// undone.
+func ConfirmUnlink(ctx context.Context, client plaid_cli.PlaidClient, data *plaid_cli.Data, item idAndAlias) error {
+	fmt.Fprintf(os.Stderr, "About to unlink %s\n", ItemLabel(data, item.id))
+
+	accounts, err := FetchAccounts(ctx, client, data.Tokens[item.id])
+	if err != nil {
+		LogError("Cannot fetch accounts", err, "item", ItemLabel(data, item.id))
+	} else {
+		accountIDs := make([]string, len(accounts))
+		for i, a := range accounts {
+			accountIDs[i] = a.ID
+			fmt.Fprintf(os.Stderr, "  %s (%s)\n", a.DisplayName(), a.Mask)
+		}
+		fmt.Fprintf(os.Stderr, "%d accounts\n", len(accounts))
+
+		count, err := CountAirtableTransactions(accountIDs)
+		if err != nil {
+			LogError("Cannot count Airtable transactions", err, "item", ItemLabel(data, item.id))
+		} else {
+			fmt.Fprintf(os.Stderr, "%d synced Airtable transactions\n", count)
+		}
+	}
+
+	expected := item.alias
+	if expected == "" {
+		expected = item.id
+	}
+
+	prompt := promptui.Prompt{
+		Label: fmt.Sprintf("Type %s to confirm", expected),
+	}
+
+	input, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+
+	if input != expected {
+		return errors.New("Confirmation did not match")
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/landakram/plaid-cli/pkg/pipeline"
+)
+
+type PipelineReport struct {
+	Records int
+	Hits    RuleHits
+	// Records the category mapping would categorize
+	Categorized int
+	// Records with no personal finance category at all
+	Uncategorized int
+	// Record ID to reasons it would be rejected or mangled by Airtable
+	Problems map[string][]string
+}
+
+// ValidatePipeline counts rule hits, applies the category mapping as Sync
+// does and runs the Airtable field mapping checks against records, without
+// writing anything.
+func ValidatePipeline(records []TransactionRecord, accounts []AccountRecord, categories []CategoryRecord, rules PipelineRules) PipelineReport {
+	report := PipelineReport{
+		Records:  len(records),
+		Hits:     rules.CountRuleHits(records),
+		Problems: make(map[string][]string),
+	}
+	for _, n := range rules.Mapping.Categorize(records) {
+		report.Categorized += n
+	}
+
+	knownAccounts := make(map[string]struct{})
+	for _, a := range accounts {
+		knownAccounts[a.Fields.AccountID] = struct{}{}
+	}
+	// Links from the config are names and from mapping_table record IDs
+	knownCategories := make(map[string]struct{})
+	for _, c := range categories {
+		knownCategories[c.ID] = struct{}{}
+		knownCategories[c.Fields.Name] = struct{}{}
+	}
+
+	for _, r := range records {
+		f := r.Fields
+
+		var problems []string
+		if f.PlaidID == "" {
+			problems = append(problems, "missing PlaidID")
+		}
+		if _, err := pipeline.ParseAirtableDate(f.DateTime); err != nil {
+			problems = append(problems, fmt.Sprintf("DateTime %q is not a date", f.DateTime))
+		}
+		if math.IsNaN(f.Amount) || math.IsInf(f.Amount, 0) {
+			problems = append(problems, "Amount is not a number")
+		}
+		if f.Name == "" {
+			problems = append(problems, "missing Name")
+		}
+		// Typecast would silently create a new, empty Accounts record
+		if _, ok := knownAccounts[f.AccountID]; !ok {
+			problems = append(problems, fmt.Sprintf("account %s is not in the Accounts table", f.AccountID))
+		}
+		// Likewise for a mapped category missing from Categories
+		for _, c := range f.CategoryLookup {
+			if _, ok := knownCategories[c]; !ok {
+				problems = append(problems, fmt.Sprintf("category %q is not in the Categories table", c))
+			}
+		}
+		if len(problems) > 0 {
+			report.Problems[f.PlaidID] = problems
+		}
+
+		if f.PFCPrimary == "" {
+			report.Uncategorized++
+		}
+	}
+
+	return report
+}
+
+func printRuleHits(section string, hits []RuleHit) {
+	if len(hits) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", section)
+	for _, h := range hits {
+		fmt.Printf("  %5d %s\n", h.Hits, h.Rule)
+	}
+}
+
+func (r PipelineReport) Print() {
+	fmt.Printf("Checked %d records\n", r.Records)
+
+	printRuleHits("names.rules", r.Hits.Names)
+	printRuleHits("split.rules", r.Hits.Splits)
+	printRuleHits("categories.mapping", r.Hits.Mapping)
+	fmt.Printf("%d records categorized, %d without a personal finance category\n", r.Categorized, r.Uncategorized)
+
+	if len(r.Hits.Unmapped) > 0 {
+		fmt.Printf("%d personal finance categories have no mapping:\n", len(r.Hits.Unmapped))
+		var unmapped []string
+		for pfc := range r.Hits.Unmapped {
+			unmapped = append(unmapped, pfc)
+		}
+		sort.Strings(unmapped)
+		for _, pfc := range unmapped {
+			fmt.Printf("  %5d %s\n", r.Hits.Unmapped[pfc], pfc)
+		}
+	}
+
+	if len(r.Problems) == 0 {
+		fmt.Println("No records would fail Airtable checks")
+		return
+	}
+
+	fmt.Printf("%d records would fail Airtable checks:\n", len(r.Problems))
+	var ids []string
+	for id := range r.Problems {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Printf("  %s: %s\n", id, strings.Join(r.Problems[id], "; "))
+	}
+}